@@ -3,20 +3,30 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/pocky-ops-bot/internal/bot"
 	"github.com/pocky-ops-bot/internal/bot/handlers"
+	"github.com/pocky-ops-bot/internal/bot/types"
 	"github.com/pocky-ops-bot/internal/clients/binance"
 	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/mcp"
 	"github.com/pocky-ops-bot/internal/clients/telegram"
 	"github.com/pocky-ops-bot/internal/config"
+	"github.com/pocky-ops-bot/internal/formatting"
+	"github.com/pocky-ops-bot/internal/kv"
 	"github.com/pocky-ops-bot/internal/services"
 	"github.com/pocky-ops-bot/internal/tools"
 	binancetools "github.com/pocky-ops-bot/internal/tools/binance"
+	mcptools "github.com/pocky-ops-bot/internal/tools/mcp"
+	"github.com/pocky-ops-bot/internal/usage"
 )
 
 func main() {
@@ -40,22 +50,16 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
-	// Create Telegram poller
-	poller, err := telegram.NewPollerWithOptions(
-		cfg.TelegramToken,
-		telegram.WithTimeout(cfg.Timeout),
-		telegram.WithPollInterval(cfg.PollInterval),
-		telegram.WithMaxRetries(cfg.MaxRetries),
-		telegram.WithLogger(logger),
-	)
+	// Create update source (long-polling or webhook)
+	source, err := newUpdateSource(cfg, logger)
 	if err != nil {
-		slog.Error("Failed to create poller", "error", err)
+		slog.Error("Failed to create update source", "mode", cfg.TelegramMode, "error", err)
 		os.Exit(1)
 	}
 
 	// Test connection to Telegram API
 	ctx := context.Background()
-	botUser, err := poller.GetMe(ctx)
+	botUser, err := source.GetMe(ctx)
 	if err != nil {
 		slog.Error("Failed to connect to Telegram API", "error", err)
 		os.Exit(1)
@@ -67,10 +71,16 @@ func main() {
 		"name", botUser.FirstName,
 	)
 
-	// Create Telegram sender
+	// Create Telegram sender (AI replies are CommonMark, converted to the parse mode)
+	parseMode, err := formatting.ParseMode(cfg.TelegramParseMode)
+	if err != nil {
+		slog.Error("Invalid TELEGRAM_PARSE_MODE", "error", err)
+		os.Exit(1)
+	}
 	sender, err := telegram.NewSender(
 		cfg.TelegramToken,
 		telegram.WithSenderLogger(logger),
+		telegram.WithSenderParseMode(parseMode),
 	)
 	if err != nil {
 		slog.Error("Failed to create sender", "error", err)
@@ -81,31 +91,75 @@ func main() {
 	if err := sender.SetMyCommands(ctx, []telegram.BotCommand{
 		{Command: "start", Description: "🚀 Bắt đầu sử dụng bot"},
 		{Command: "dautu", Description: "💰 Xem danh mục đầu tư Spot & Futures"},
+		{Command: "chiphi", Description: "💸 Xem chi phí AI"},
+		{Command: "huy", Description: "🛑 Huỷ yêu cầu đang xử lý"},
 		{Command: "xoa", Description: "🗑️ Xoá lịch sử trò chuyện"},
 		{Command: "trogiup", Description: "❓ Hướng dẫn sử dụng"},
+		{Command: "id", Description: "🆔 Xem User ID và Chat ID"},
 	}); err != nil {
 		slog.Warn("Failed to set bot commands", "error", err)
 	}
 
-	// Create AI client
-	aiOpts := []llm.ClientOption{
-		llm.WithProvider(llm.Provider(cfg.AIProvider)),
-		llm.WithModel(cfg.AIModel),
-		llm.WithMaxTokens(cfg.AIMaxTokens),
-		llm.WithLLMTimeout(cfg.AITimeout),
-		llm.WithLLMLogger(logger),
-	}
-	if cfg.AIBaseURL != "" {
-		aiOpts = append(aiOpts, llm.WithBaseURL(cfg.AIBaseURL))
+	// Create AI client: primary provider plus optional fallbacks, with retries
+	backends := append([]config.AIBackend{{
+		Provider: cfg.AIProvider,
+		Model:    cfg.AIModel,
+		APIKey:   cfg.AIAPIKey,
+		BaseURL:  cfg.AIBaseURL,
+	}}, cfg.AIFallbacks...)
+	aiClients := make([]*llm.Client, 0, len(backends))
+	for _, backend := range backends {
+		client, err := newAIClient(cfg, backend, logger)
+		if err != nil {
+			slog.Error("Failed to create AI client", "provider", backend.Provider, "error", err)
+			os.Exit(1)
+		}
+		if client.Provider().Local() {
+			if err := checkLocalModel(ctx, client); err != nil {
+				slog.Error("AI model check failed", "provider", backend.Provider, "error", err)
+				os.Exit(1)
+			}
+		}
+		aiClients = append(aiClients, client)
 	}
-	aiClient, err := llm.NewClient(cfg.AIAPIKey, aiOpts...)
+	aiClient, err := llm.NewResilientClient(aiClients,
+		llm.WithMaxRetries(cfg.AIMaxRetries),
+		llm.WithResilientLogger(logger),
+	)
 	if err != nil {
 		slog.Error("Failed to create AI client", "error", err)
 		os.Exit(1)
 	}
+	if len(cfg.AIFallbacks) > 0 {
+		chain := make([]string, 0, len(aiClients))
+		for _, c := range aiClients {
+			chain = append(chain, string(c.Provider())+":"+c.Model())
+		}
+		slog.Info("AI fallback chain configured", "chain", strings.Join(chain, " → "))
+	}
 
-	// Create tool registry with Binance tools (if configured)
-	var chatOpts []services.ChatServiceOption
+	// Meter AI usage: every completion (replies and summaries) is recorded
+	// and refused once a budget is exhausted
+	var completer services.AICompleter = aiClient
+	var reporter handlers.UsageReporter
+	if cfg.UsageTracking {
+		ledger, closeLedger, err := newLedger(cfg, logger)
+		if err != nil {
+			slog.Error("Failed to open usage ledger", "path", cfg.UsagePath, "error", err)
+			os.Exit(1)
+		}
+		defer closeLedger()
+		completer = usage.NewMeter(aiClient, ledger, logger)
+		reporter = ledger
+		slog.Info("Usage tracking enabled", "path", cfg.UsagePath, "budgets", ledger.Budgets().Enabled())
+	}
+
+	// Create tool registry with Binance and MCP tools (if configured)
+	registry := tools.NewRegistry(logger)
+	chatOpts := []services.ChatServiceOption{
+		services.WithToolParallelism(cfg.AIToolParallelism),
+		services.WithToolTimeout(cfg.AIToolTimeout),
+	}
 	if cfg.AIVietnamese {
 		chatOpts = append(chatOpts, services.WithVietnamese())
 	}
@@ -123,12 +177,7 @@ func main() {
 			os.Exit(1)
 		}
 
-		registry := tools.NewRegistry(logger)
-		registry.Register(binancetools.NewGetBalancesTool(bnClient, logger))
-		registry.Register(binancetools.NewGetPricesTool(bnClient, logger))
-		registry.Register(binancetools.NewGet24hrStatsTool(bnClient, logger))
-
-		// Futures client & tools
+		// Futures client
 		futOpts := []binance.ClientOption{
 			binance.WithLogger(logger),
 		}
@@ -141,44 +190,126 @@ func main() {
 			os.Exit(1)
 		}
 
-		registry.Register(binancetools.NewGetFuturesAccountTool(futClient, logger))
-		registry.Register(binancetools.NewGetFuturesPositionsTool(futClient, logger))
-		registry.Register(binancetools.NewGetFuturesOpenOrdersTool(futClient, logger))
-		registry.Register(binancetools.NewGetFuturesTradesTool(futClient, logger))
-		registry.Register(binancetools.NewGetFuturesIncomeTool(futClient, logger))
-
-		chatOpts = append(chatOpts, services.WithTools(registry))
+		binancetools.Register(registry, bnClient, futClient, logger)
 		slog.Info("Binance tools registered", "spot", 3, "futures", 5)
 	}
+	var mcpGroups []string
+	if cfg.MCPConfig != "" {
+		groups, closeMCP, err := registerMCPTools(ctx, cfg, registry, logger)
+		if err != nil {
+			slog.Error("Failed to load MCP config", "path", cfg.MCPConfig, "error", err)
+			os.Exit(1)
+		}
+		defer closeMCP()
+		mcpGroups = groups
+	}
+	// MCP tools may only be registered once their servers are up
+	if len(registry.Definitions()) > 0 || len(mcpGroups) > 0 {
+		chatOpts = append(chatOpts, services.WithTools(registry))
+	}
 
 	// Create stateless chat service
-	chatService := services.NewChatService(aiClient, cfg.AISystemPrompt, logger, chatOpts...)
+	chatService := services.NewChatService(completer, cfg.AISystemPrompt, logger, chatOpts...)
 
 	// Build router for stateless commands
 	router := bot.NewRouter(logger)
+	router.SetCallbackAnswerer(sender)
 	cmdHandler := handlers.NewCommandHandler(sender, logger)
 	router.RegisterCommand("start", cmdHandler.Start)
 	router.RegisterCommand("trogiup", cmdHandler.Help)
+	router.RegisterCommand("chiphi", handlers.NewUsageHandler(sender, reporter, logger).Usage)
 
 	// Create dispatcher — channel per-chat, zero shared state
-	dispatcher := bot.NewDispatcher(router, chatService, sender, logger,
+	dispatcherOpts := []bot.DispatcherOption{
 		bot.WithBufferSize(5),
 		bot.WithIdleTTL(cfg.ConversationTTL),
 		bot.WithMaxTurns(cfg.ConversationMaxTurns),
+		bot.WithMiddleware(
+			bot.Logging(logger),
+			bot.Recover(sender, logger),
+		),
+	}
+	access := bot.NewAccessPolicy(cfg.AllowedUserIDs, cfg.AllowedChatIDs, cfg.AdminIDs)
+	if access.Open() {
+		slog.Warn("No allowlist configured, bot is open to everyone")
+	} else {
+		slog.Info("Access control enabled",
+			"users", len(cfg.AllowedUserIDs),
+			"chats", len(cfg.AllowedChatIDs),
+			"admins", len(cfg.AdminIDs),
+		)
+		dispatcherOpts = append(dispatcherOpts, bot.WithAccessPolicy(access))
+	}
+	if cfg.GroupMentionOnly {
+		dispatcherOpts = append(dispatcherOpts, bot.WithBotUser(botUser))
+	}
+	limits := bot.RateLimits{
+		UserAI:      bot.RateLimit(cfg.RateLimitUserAI),
+		ChatAI:      bot.RateLimit(cfg.RateLimitChatAI),
+		UserCommand: bot.RateLimit(cfg.RateLimitUserCommands),
+		ChatCommand: bot.RateLimit(cfg.RateLimitChatCommands),
+	}
+	dispatcherOpts = append(dispatcherOpts, bot.WithRateLimiter(bot.NewRateLimiter(limits)))
+	slog.Info("Rate limiting enabled",
+		"user_ai", fmt.Sprintf("%d/%s", limits.UserAI.Burst, limits.UserAI.Interval),
+		"chat_ai", fmt.Sprintf("%d/%s", limits.ChatAI.Burst, limits.ChatAI.Interval),
 	)
+	if cfg.ToolGroups != nil || len(cfg.ToolGroupsChats) > 0 || len(cfg.ToolGroupsUsers) > 0 {
+		checkToolGroups(cfg, append(registry.Groups(), mcpGroups...))
+		policy := bot.NewToolGroupPolicy(cfg.ToolGroups, cfg.ToolGroupsChats, cfg.ToolGroupsUsers)
+		dispatcherOpts = append(dispatcherOpts, bot.WithToolGroups(policy))
+		slog.Info("Tool groups restricted",
+			"default", cfg.ToolGroups,
+			"chats", len(cfg.ToolGroupsChats),
+			"users", len(cfg.ToolGroupsUsers),
+			"available", registry.Groups(),
+		)
+	}
+	if cfg.AIStreaming {
+		dispatcherOpts = append(dispatcherOpts, bot.WithStreaming(cfg.AIStreamEditInterval))
+	}
+	if cfg.AISummarize {
+		budget := cfg.AIContextBudget
+		if budget <= 0 {
+			budget = llm.HistoryBudget(aiClients[0].Model(), cfg.AIMaxTokens)
+		}
+		summarizer := services.NewSummarizer(completer, budget, logger)
+		dispatcherOpts = append(dispatcherOpts, bot.WithHistoryCompactor(summarizer))
+		slog.Info("History summarization enabled", "context_budget", budget)
+	}
+	historyStore, closeHistory, err := newHistoryStore(cfg)
+	if err != nil {
+		slog.Error("Failed to open history store", "type", cfg.HistoryStore, "error", err)
+		os.Exit(1)
+	}
+	defer closeHistory()
+	dispatcherOpts = append(dispatcherOpts, bot.WithHistoryStore(historyStore))
+	slog.Info("History store ready", "type", cfg.HistoryStore, "path", cfg.HistoryPath)
+	if cfg.VoiceEnabled() {
+		transcriber, err := newTranscriber(cfg, logger)
+		if err != nil {
+			slog.Error("Failed to create transcriber", "error", err)
+			os.Exit(1)
+		}
+		dispatcherOpts = append(dispatcherOpts, bot.WithTranscriber(transcriber))
+		slog.Info("Voice transcription enabled", "model", cfg.STTModel, "base_url", cfg.STTBaseURL)
+	}
+	dispatcher := bot.NewDispatcher(router, chatService, sender, logger, dispatcherOpts...)
 
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(ctx)
 
-	// Start polling with dispatcher
-	if err := poller.StartWithHandler(ctx, dispatcher.Dispatch); err != nil {
-		slog.Error("Failed to start poller", "error", err)
+	// Start receiving updates with dispatcher
+	if err := source.StartWithHandler(ctx, dispatcher.Dispatch); err != nil {
+		slog.Error("Failed to start update source", "mode", cfg.TelegramMode, "error", err)
 		os.Exit(1)
 	}
 
 	slog.Info("Bot is running. Press Ctrl+C to stop.",
+		"mode", cfg.TelegramMode,
 		"ai_provider", cfg.AIProvider,
-		"ai_model", cfg.AIModel,
+		"ai_model", aiClients[0].Model(),
+		"streaming", cfg.AIStreaming,
 	)
 
 	// Wait for interrupt signal
@@ -188,7 +319,241 @@ func main() {
 
 	slog.Info("Shutting down gracefully...")
 	cancel()
-	poller.Stop()
+	source.Stop()
 	dispatcher.Shutdown()
 	slog.Info("Bot stopped successfully.")
 }
+
+// newAIClient creates the LLM client for one backend of the fallback chain.
+func newAIClient(cfg *config.Config, backend config.AIBackend, logger *slog.Logger) (*llm.Client, error) {
+	opts := []llm.ClientOption{
+		llm.WithProvider(llm.Provider(backend.Provider)),
+		llm.WithModel(backend.Model),
+		llm.WithMaxTokens(cfg.AIMaxTokens),
+		llm.WithLLMTimeout(cfg.AITimeout),
+		llm.WithLLMLogger(logger),
+	}
+	if backend.BaseURL != "" {
+		opts = append(opts, llm.WithBaseURL(backend.BaseURL))
+	}
+	return llm.NewClient(backend.APIKey, opts...)
+}
+
+// newTranscriber creates the speech-to-text client for voice messages: OpenAI,
+// or any OpenAI-compatible server (e.g. local whisper) when STT_BASE_URL is set.
+func newTranscriber(cfg *config.Config, logger *slog.Logger) (*llm.Transcriber, error) {
+	opts := []llm.ClientOption{
+		llm.WithProvider(llm.ProviderOpenAI),
+		llm.WithModel(cfg.STTModel),
+		llm.WithLLMTimeout(cfg.AITimeout),
+		llm.WithLLMLogger(logger),
+	}
+	if cfg.STTBaseURL != "" {
+		opts = append(opts,
+			llm.WithProvider(llm.ProviderOpenAICompatible),
+			llm.WithBaseURL(cfg.STTBaseURL),
+		)
+	}
+	client, err := llm.NewClient(cfg.STTAPIKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcriberOpts []llm.TranscriberOption
+	if cfg.STTLanguage != "" {
+		transcriberOpts = append(transcriberOpts, llm.WithLanguage(cfg.STTLanguage))
+	}
+	return llm.NewTranscriber(client, transcriberOpts...)
+}
+
+// checkLocalModel lists the models served by a local AI server and verifies
+// that the configured model is among them, selecting the first one when no
+// model is configured.
+func checkLocalModel(ctx context.Context, client *llm.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	models, err := client.CheckModel(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Local AI models available",
+		"provider", client.Provider(),
+		"model", client.Model(),
+		"models", strings.Join(models, ", "),
+	)
+	return nil
+}
+
+// registerMCPTools creates a client for each enabled MCP server of
+// MCP_CONFIG and keeps its tools registered in the background: a server that
+// is down at startup joins once it is up, and its tools are listed again
+// after every reconnect. It returns the tool groups of the servers; the
+// returned func stops the registration and closes all connections on
+// shutdown.
+func registerMCPTools(ctx context.Context, cfg *config.Config, registry *tools.Registry, logger *slog.Logger) ([]string, func(), error) {
+	servers, err := mcp.LoadConfig(cfg.MCPConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	disabled := make(map[string]bool, len(cfg.MCPDisabled))
+	for _, name := range cfg.MCPDisabled {
+		disabled[name] = true
+	}
+
+	syncCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var clients []*mcp.Client
+	var groups []string
+	closeAll := func() {
+		cancel()
+		for _, client := range clients {
+			_ = client.Close()
+		}
+		wg.Wait()
+	}
+	for _, server := range servers {
+		if server.Disabled || disabled[server.Name] {
+			slog.Info("MCP server disabled", "server", server.Name)
+			continue
+		}
+		client, err := mcp.NewClient(server, mcp.WithLogger(logger))
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		clients = append(clients, client)
+		if len(server.Groups) > 0 {
+			groups = append(groups, server.Groups...)
+		} else {
+			groups = append(groups, server.Name)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mcptools.Sync(syncCtx, registry, client, server.Groups, logger)
+		}()
+		slog.Info("MCP server added", "server", server.Name, "transport", server.Transport(), "groups", server.Groups)
+	}
+
+	return groups, closeAll, nil
+}
+
+// checkToolGroups warns about configured tool groups no registered tool
+// belongs to, which are most likely typos.
+func checkToolGroups(cfg *config.Config, available []string) {
+	known := make(map[string]bool, len(available))
+	for _, group := range available {
+		known[group] = true
+	}
+	configured := append([]string(nil), cfg.ToolGroups...)
+	for _, groups := range cfg.ToolGroupsChats {
+		configured = append(configured, groups...)
+	}
+	for _, groups := range cfg.ToolGroupsUsers {
+		configured = append(configured, groups...)
+	}
+	warned := make(map[string]bool)
+	for _, group := range configured {
+		if !known[group] && !warned[group] {
+			warned[group] = true
+			slog.Warn("Unknown tool group in config", "group", group, "available", available)
+		}
+	}
+}
+
+// newHistoryStore creates the conversation history store selected by
+// HISTORY_STORE. The returned func releases it on shutdown.
+func newHistoryStore(cfg *config.Config) (bot.HistoryStore, func(), error) {
+	switch cfg.HistoryStore {
+	case "memory":
+		return bot.NewMemoryHistoryStore(), func() {}, nil
+	case "file", "":
+		return bot.NewFileHistoryStore(cfg.HistoryPath), func() {}, nil
+	case "kv":
+		db, err := kv.Open(cfg.HistoryPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bot.NewKVHistoryStore(db), func() { _ = db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown HISTORY_STORE %q (want memory, file or kv)", cfg.HistoryStore)
+	}
+}
+
+// newLedger creates the usage ledger, persisted in USAGE_PATH unless it is
+// empty. The returned func releases it on shutdown.
+func newLedger(cfg *config.Config, logger *slog.Logger) (*usage.Ledger, func(), error) {
+	prices := usage.DefaultPrices
+	if cfg.UsagePrices != "" {
+		overrides, err := usage.ParsePrices(cfg.UsagePrices)
+		if err != nil {
+			return nil, nil, err
+		}
+		prices = prices.With(overrides)
+	}
+	opts := []usage.LedgerOption{
+		usage.WithPrices(prices),
+		usage.WithBudgets(usage.Budgets{
+			Daily:       cfg.UsageBudgetDaily,
+			Monthly:     cfg.UsageBudgetMonthly,
+			UserDaily:   cfg.UsageUserBudgetDaily,
+			UserMonthly: cfg.UsageUserBudgetMonthly,
+		}),
+		usage.WithLogger(logger),
+	}
+	if cfg.UsagePath == "" {
+		ledger, err := usage.NewLedger(opts...)
+		return ledger, func() {}, err
+	}
+
+	db, err := kv.Open(cfg.UsagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	ledger, err := usage.NewLedger(append(opts, usage.WithStore(db))...)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return ledger, func() { _ = db.Close() }, nil
+}
+
+// updateSource receives Telegram updates; implemented by telegram.Poller and telegram.Webhook.
+type updateSource interface {
+	GetMe(ctx context.Context) (*types.User, error)
+	StartWithHandler(ctx context.Context, handler telegram.UpdateHandler) error
+	Stop()
+}
+
+// newUpdateSource creates the update source selected by TELEGRAM_MODE.
+func newUpdateSource(cfg *config.Config, logger *slog.Logger) (updateSource, error) {
+	switch cfg.TelegramMode {
+	case "polling", "":
+		opts := []telegram.PollerOption{
+			telegram.WithTimeout(cfg.Timeout),
+			telegram.WithPollInterval(cfg.PollInterval),
+			telegram.WithMaxRetries(cfg.MaxRetries),
+			telegram.WithLogger(logger),
+		}
+		if cfg.TelegramOffsetFile != "" {
+			opts = append(opts, telegram.WithOffsetStore(telegram.NewFileOffsetStore(cfg.TelegramOffsetFile)))
+		}
+		return telegram.NewPollerWithOptions(cfg.TelegramToken, opts...)
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("WEBHOOK_URL is required when TELEGRAM_MODE=webhook")
+		}
+		return telegram.NewWebhookWithOptions(
+			cfg.TelegramToken,
+			telegram.WithWebhookURL(cfg.WebhookURL),
+			telegram.WithWebhookListenAddr(cfg.WebhookListenAddr),
+			telegram.WithWebhookPath(cfg.WebhookPath),
+			telegram.WithWebhookSecretToken(cfg.WebhookSecretToken),
+			telegram.WithWebhookLogger(logger),
+		)
+	default:
+		return nil, fmt.Errorf("unknown TELEGRAM_MODE %q (want polling or webhook)", cfg.TelegramMode)
+	}
+}
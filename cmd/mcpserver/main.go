@@ -0,0 +1,85 @@
+// Package main provides an MCP server exposing the bot's tools to desktop AI
+// clients and scripts over stdio.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pocky-ops-bot/internal/clients/binance"
+	"github.com/pocky-ops-bot/internal/config"
+	"github.com/pocky-ops-bot/internal/tools"
+	binancetools "github.com/pocky-ops-bot/internal/tools/binance"
+	mcptools "github.com/pocky-ops-bot/internal/tools/mcp"
+)
+
+func main() {
+	// Load configuration from environment/.env file
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	// Stdout carries the protocol, so logs go to stderr
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.LogLevel))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+	}))
+	slog.SetDefault(logger)
+
+	registry := tools.NewRegistry(logger)
+	if cfg.BinanceAPIKey == "" || cfg.BinanceSecretKey == "" {
+		slog.Error("No tools to serve: BINANCE_API_KEY and BINANCE_SECRET_KEY are required")
+		os.Exit(1)
+	}
+	if err := registerBinanceTools(cfg, registry, logger); err != nil {
+		slog.Error("Failed to create Binance clients", "error", err)
+		os.Exit(1)
+	}
+
+	server := mcptools.NewServer(registry, logger,
+		mcptools.WithServerInfo("pocky-ops-bot", "1.0.0"),
+		mcptools.WithInstructions("Read-only Binance spot and futures account data: balances, prices, 24h stats, positions, orders, trades and income."),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("MCP server ready on stdio", "tools", len(registry.Definitions()))
+	if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("MCP server stopped", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("MCP server stopped")
+}
+
+// registerBinanceTools creates the spot and futures clients and registers the
+// Binance tools.
+func registerBinanceTools(cfg *config.Config, registry *tools.Registry, logger *slog.Logger) error {
+	bnOpts := []binance.ClientOption{binance.WithLogger(logger)}
+	if cfg.BinanceBaseURL != "" {
+		bnOpts = append(bnOpts, binance.WithBaseURL(cfg.BinanceBaseURL))
+	}
+	spot, err := binance.NewClient(cfg.BinanceAPIKey, cfg.BinanceSecretKey, bnOpts...)
+	if err != nil {
+		return err
+	}
+
+	futOpts := []binance.ClientOption{binance.WithLogger(logger)}
+	if cfg.BinanceFuturesBaseURL != "" {
+		futOpts = append(futOpts, binance.WithBaseURL(cfg.BinanceFuturesBaseURL))
+	}
+	futures, err := binance.NewFuturesClient(cfg.BinanceAPIKey, cfg.BinanceSecretKey, futOpts...)
+	if err != nil {
+		return err
+	}
+
+	binancetools.Register(registry, spot, futures, logger)
+	return nil
+}
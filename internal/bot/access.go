@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// accessDeniedReply is sent to users who are not on the allowlist.
+const accessDeniedReply = "⛔ Xin lỗi, bạn chưa được phép sử dụng bot này.\n" +
+	"Gửi /id để lấy ID của bạn và gửi cho quản trị viên."
+
+// AccessPolicy decides which users and chats may use the bot.
+// A user may use the bot if they are an admin, if their user ID is allowed,
+// or if the chat they write in is allowed. A policy with no IDs at all
+// allows everyone.
+type AccessPolicy struct {
+	users  map[int64]struct{}
+	chats  map[int64]struct{}
+	admins map[int64]struct{}
+}
+
+// NewAccessPolicy creates an AccessPolicy from allowed user IDs, allowed chat
+// IDs and admin user IDs.
+func NewAccessPolicy(userIDs, chatIDs, adminIDs []int64) *AccessPolicy {
+	return &AccessPolicy{
+		users:  idSet(userIDs),
+		chats:  idSet(chatIDs),
+		admins: idSet(adminIDs),
+	}
+}
+
+// Open reports whether the policy allows everyone.
+func (p *AccessPolicy) Open() bool {
+	return len(p.users) == 0 && len(p.chats) == 0 && len(p.admins) == 0
+}
+
+// Allowed reports whether userID may use the bot in chatID.
+func (p *AccessPolicy) Allowed(userID, chatID int64) bool {
+	if p.Open() {
+		return true
+	}
+	if p.IsAdmin(userID) {
+		return true
+	}
+	if _, ok := p.users[userID]; ok {
+		return true
+	}
+	_, ok := p.chats[chatID]
+	return ok
+}
+
+// IsAdmin reports whether userID is an admin.
+func (p *AccessPolicy) IsAdmin(userID int64) bool {
+	_, ok := p.admins[userID]
+	return ok
+}
+
+func idSet(ids []int64) map[int64]struct{} {
+	set := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// extractUser returns the user who sent an update, or nil.
+func extractUser(update types.Update) *types.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.CallbackQuery != nil:
+		return &update.CallbackQuery.From
+	case update.EditedMessage != nil:
+		return update.EditedMessage.From
+	}
+	return nil
+}
+
+// idReply formats the answer to /id.
+func idReply(user *types.User, chatID int64) string {
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	return fmt.Sprintf("🆔 User ID: `%d`\n💬 Chat ID: `%d`", userID, chatID)
+}
+
+// denyAccess records a rejected update in the audit log and, for direct
+// messages and commands, politely tells the user they are not allowed.
+func (d *Dispatcher) denyAccess(ctx context.Context, chatID int64, user *types.User, update types.Update) {
+	attrs := []any{
+		slog.String("audit", "access_denied"),
+		slog.Int("update_id", update.UpdateID),
+		slog.Int64("chat_id", chatID),
+	}
+	if user != nil {
+		attrs = append(attrs,
+			slog.Int64("user_id", user.ID),
+			slog.String("username", user.Username),
+		)
+	}
+	d.logger.Warn("access denied", attrs...)
+
+	msg := update.Message
+	if msg == nil {
+		return
+	}
+	// Stay quiet in groups unless the user addressed the bot with a command
+	if msg.Chat.Type != "private" && (msg.Text == "" || msg.Text[0] != '/') {
+		return
+	}
+	_ = d.sender.SendText(ctx, chatID, accessDeniedReply)
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	p := NewAccessPolicy([]int64{1}, []int64{-100}, []int64{9})
+
+	tests := []struct {
+		name   string
+		user   int64
+		chat   int64
+		expect bool
+	}{
+		{"allowed user", 1, 1, true},
+		{"allowed user in any chat", 1, -555, true},
+		{"member of allowed chat", 2, -100, true},
+		{"admin", 9, 9, true},
+		{"stranger", 2, 2, false},
+		{"stranger in other group", 2, -555, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allowed(tt.user, tt.chat); got != tt.expect {
+				t.Errorf("Allowed(%d, %d) = %v, want %v", tt.user, tt.chat, got, tt.expect)
+			}
+		})
+	}
+
+	if !p.IsAdmin(9) || p.IsAdmin(1) {
+		t.Error("IsAdmin should only be true for admin IDs")
+	}
+}
+
+func TestAccessPolicyOpen(t *testing.T) {
+	p := NewAccessPolicy(nil, nil, nil)
+	if !p.Open() || !p.Allowed(123, 456) {
+		t.Error("empty policy should allow everyone")
+	}
+}
+
+func TestDispatcher_AccessDenied(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, logger,
+		WithIdleTTL(time.Second),
+		WithAccessPolicy(NewAccessPolicy([]int64{1}, nil, nil)),
+	)
+
+	ctx := context.Background()
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 7,
+		Message: &types.Message{
+			ID:   1,
+			Text: "hello",
+			From: &types.User{ID: 2, Username: "mallory"},
+			Chat: types.Chat{ID: 2, Type: "private"},
+		},
+	})
+	d.Shutdown()
+
+	if n := d.ActiveWorkers(); n != 0 {
+		t.Errorf("ActiveWorkers = %d, want no worker for a rejected user", n)
+	}
+	if calls := chat.getCalls(); len(calls) != 0 {
+		t.Errorf("AI called %d times for a rejected user", len(calls))
+	}
+	texts := sender.getTexts()
+	if len(texts) != 1 || texts[0].text != accessDeniedReply {
+		t.Errorf("texts = %v, want the denial message", texts)
+	}
+	for _, want := range []string{"audit=access_denied", "user_id=2", "username=mallory", "chat_id=2"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("audit log missing %q: %s", want, logs.String())
+		}
+	}
+}
+
+func TestDispatcher_AccessDeniedQuietInGroups(t *testing.T) {
+	sender := &mockSender{}
+	d := NewDispatcher(NewRouter(nil), &mockChat{}, sender, nil,
+		WithAccessPolicy(NewAccessPolicy([]int64{1}, nil, nil)),
+	)
+
+	d.Dispatch(context.Background(), types.Update{Message: &types.Message{
+		Text: "chatting with friends",
+		From: &types.User{ID: 2},
+		Chat: types.Chat{ID: -100, Type: "group"},
+	}})
+	d.Shutdown()
+
+	if texts := sender.getTexts(); len(texts) != 0 {
+		t.Errorf("texts = %v, plain group messages should not be answered", texts)
+	}
+}
+
+func TestDispatcher_AccessAllowed(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithAccessPolicy(NewAccessPolicy([]int64{1}, nil, []int64{9})),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{Message: &types.Message{ID: 1, Text: "hi", From: &types.User{ID: 1}, Chat: types.Chat{ID: 1}}})
+	d.Dispatch(ctx, types.Update{Message: &types.Message{ID: 2, Text: "hi", From: &types.User{ID: 9}, Chat: types.Chat{ID: 9}}})
+	time.Sleep(100 * time.Millisecond)
+
+	if calls := chat.getCalls(); len(calls) != 2 {
+		t.Errorf("AI called %d times, want allowed user and admin answered", len(calls))
+	}
+}
+
+func TestDispatcher_IDCommand(t *testing.T) {
+	sender := &mockSender{}
+	d := NewDispatcher(NewRouter(nil), &mockChat{}, sender, nil,
+		WithAccessPolicy(NewAccessPolicy([]int64{1}, nil, nil)),
+	)
+
+	d.Dispatch(context.Background(), types.Update{Message: &types.Message{
+		Text: "/id@pocky_bot",
+		From: &types.User{ID: 555},
+		Chat: types.Chat{ID: -100, Type: "group"},
+	}})
+	d.Shutdown()
+
+	texts := sender.getTexts()
+	if len(texts) != 1 {
+		t.Fatalf("texts = %v, want one /id reply", texts)
+	}
+	if !strings.Contains(texts[0].text, "555") || !strings.Contains(texts[0].text, "-100") {
+		t.Errorf("/id reply = %q, want user and chat IDs", texts[0].text)
+	}
+	if n := d.ActiveWorkers(); n != 0 {
+		t.Errorf("ActiveWorkers = %d, /id should not spawn a worker", n)
+	}
+}
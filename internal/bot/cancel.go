@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// cancelCallbackPrefix prefixes the data of the Cancel button on a streamed
+// reply. The data ends with the ID of the message being answered, so a stale
+// button never cancels a later request.
+const cancelCallbackPrefix = "huy:"
+
+// errCancelled is the cause of a request cancelled with /huy or the Cancel
+// button.
+var errCancelled = errors.New("bot: request cancelled by user")
+
+const (
+	cancelledReply       = "🛑 Đã huỷ yêu cầu."
+	nothingToCancelReply = "🤷 Không có yêu cầu nào đang xử lý."
+	cancelDeniedReply    = "⛔ Chỉ người gửi yêu cầu hoặc quản trị viên mới có thể huỷ."
+)
+
+// inflight is the update a chat worker is handling.
+type inflight struct {
+	mu        sync.Mutex
+	messageID int   // the message being answered
+	userID    int64 // who sent it
+	cancel    context.CancelCauseFunc
+}
+
+// begin returns the context for handling update, which cancel aborts, and a
+// function to call once the update is handled.
+func (f *inflight) begin(ctx context.Context, update types.Update) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	f.mu.Lock()
+	f.messageID = updateMessageID(update)
+	f.userID = 0
+	if user := extractUser(update); user != nil {
+		f.userID = user.ID
+	}
+	f.cancel = cancel
+	f.mu.Unlock()
+
+	return ctx, func() {
+		f.mu.Lock()
+		f.cancel = nil
+		f.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// abort cancels the update in progress. messageID, when not zero, must match
+// the message being answered. allowed decides whether the requester may
+// cancel an update sent by owner. It reports whether an update was found and
+// whether it was cancelled.
+func (f *inflight) abort(messageID int, allowed func(owner int64) bool) (found, cancelled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancel == nil || (messageID != 0 && messageID != f.messageID) {
+		return false, false
+	}
+	if !allowed(f.userID) {
+		return true, false
+	}
+	f.cancel(errCancelled)
+	f.cancel = nil
+	return true, true
+}
+
+// updateMessageID returns the ID of the message an update is answered to.
+func updateMessageID(update types.Update) int {
+	if update.Message != nil {
+		return update.Message.ID
+	}
+	if cq := update.CallbackQuery; cq != nil && cq.Message != nil {
+		return cq.Message.ID
+	}
+	if update.EditedMessage != nil {
+		return update.EditedMessage.ID
+	}
+	return 0
+}
+
+// parseCancelCallback extracts the message ID from Cancel button data.
+func parseCancelCallback(data string) (int, bool) {
+	if !strings.HasPrefix(data, cancelCallbackPrefix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(data, cancelCallbackPrefix))
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// withCancelButton is the send option attaching a Cancel button for the
+// request answering message messageID.
+func withCancelButton(messageID int) telegram.SendOption {
+	return telegram.WithReplyMarkup(&types.InlineKeyboardMarkup{
+		InlineKeyboard: [][]types.InlineKeyboardButton{
+			{{Text: "❌ Huỷ", CallbackData: cancelCallbackPrefix + strconv.Itoa(messageID)}},
+		},
+	})
+}
+
+// isCancelled reports whether ctx was cancelled by the user rather than by
+// shutdown or a timeout.
+func isCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errCancelled)
+}
+
+// failureNotice returns the text telling the user that answering failed with
+// err and a context to send it on: a cancelled request is reported on a
+// context that outlives the cancellation.
+func failureNotice(ctx context.Context, err error) (context.Context, string) {
+	if isCancelled(ctx) {
+		return context.WithoutCancel(ctx), cancelledReply
+	}
+	return ctx, errorText(err)
+}
+
+// cancelRequest handles /huy and the Cancel button outside the chat's queue,
+// which is blocked by the very request being cancelled. It reports whether
+// update was such a control update. The worker tells the chat once the
+// request has stopped; only failures are answered here.
+func (d *Dispatcher) cancelRequest(ctx context.Context, key ConversationKey, userID int64, update types.Update) bool {
+	var messageID int
+	cq := update.CallbackQuery
+	switch {
+	case cq != nil:
+		id, ok := parseCancelCallback(cq.Data)
+		if !ok {
+			return false
+		}
+		messageID = id
+	case update.Message != nil && update.Message.Text != "" && update.Message.Text[0] == '/':
+		if extractCommand(update.Message.Text) != "huy" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	found, cancelled := false, false
+	if val, ok := d.workers.Load(key); ok {
+		found, cancelled = val.(*chatWorker).inflight.abort(messageID, func(owner int64) bool {
+			return owner == 0 || owner == userID || (d.access != nil && d.access.IsAdmin(userID))
+		})
+	}
+
+	d.logger.Info("cancel requested",
+		slog.Int64("chat_id", key.ChatID),
+		slog.Int("thread_id", key.ThreadID),
+		slog.Int64("user_id", userID),
+		slog.Bool("cancelled", cancelled),
+	)
+
+	text := ""
+	switch {
+	case cancelled:
+		if cq == nil {
+			return true
+		}
+		text = cancelledReply
+	case found:
+		text = cancelDeniedReply
+	default:
+		text = nothingToCancelReply
+	}
+	d.goReply(func() {
+		if cq != nil {
+			d.router.answerCallback(ctx, cq, text)
+			return
+		}
+		_ = d.sender.SendText(ctx, key.ChatID, text)
+	})
+	return true
+}
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// mockBlockingChat blocks every generation until its context is done.
+type mockBlockingChat struct {
+	mockChat
+}
+
+func (m *mockBlockingChat) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
+	m.mockChat.GenerateResponse(ctx, history, userText)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (m *mockBlockingChat) GenerateResponseStream(ctx context.Context, history []llm.ChatMessage, userText string, onPartial func(text string)) (string, error) {
+	onPartial("thinking")
+	return m.GenerateResponse(ctx, history, userText)
+}
+
+// mockCancelEditor records placeholder markups and callback answers.
+type mockCancelEditor struct {
+	mockEditor
+	cmu     sync.Mutex
+	markups []interface{}
+	toasts  []string
+}
+
+func (m *mockCancelEditor) SendMessageResult(ctx context.Context, chatID int64, text string, opts ...telegram.SendOption) (*types.Message, error) {
+	body := map[string]interface{}{}
+	for _, opt := range opts {
+		opt(body)
+	}
+	m.cmu.Lock()
+	m.markups = append(m.markups, body["reply_markup"])
+	m.cmu.Unlock()
+	return m.mockEditor.SendMessageResult(ctx, chatID, text, opts...)
+}
+
+func (m *mockCancelEditor) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	m.cmu.Lock()
+	defer m.cmu.Unlock()
+	m.toasts = append(m.toasts, text)
+	return nil
+}
+
+func textUpdate(id int, chatID, userID int64, text string) types.Update {
+	return types.Update{UpdateID: id, Message: &types.Message{
+		ID:   id,
+		Text: text,
+		Chat: types.Chat{ID: chatID},
+		From: &types.User{ID: userID},
+	}}
+}
+
+func TestDispatcher_CancelCommand(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockBlockingChat{}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, textUpdate(1, 42, 7, "/huy"))
+	d.Dispatch(ctx, textUpdate(2, 42, 7, "slow question"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, textUpdate(3, 42, 7, "/huy"))
+	time.Sleep(20 * time.Millisecond)
+
+	texts := sender.getTexts()
+	cancel()
+	d.Shutdown()
+
+	if len(texts) != 2 {
+		t.Fatalf("texts = %+v, want the idle notice and the cancellation", texts)
+	}
+	if texts[0].text != nothingToCancelReply {
+		t.Errorf("first /huy reply = %q, want %q", texts[0].text, nothingToCancelReply)
+	}
+	if texts[1].text != cancelledReply {
+		t.Errorf("reply after cancelling = %q, want %q", texts[1].text, cancelledReply)
+	}
+}
+
+func TestDispatcher_CancelDenied(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockBlockingChat{}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithAccessPolicy(NewAccessPolicy(nil, []int64{-100}, []int64{9})),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, textUpdate(1, -100, 7, "slow question"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, textUpdate(2, -100, 8, "/huy"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, textUpdate(3, -100, 9, "/huy")) // admin
+	time.Sleep(20 * time.Millisecond)
+
+	texts := sender.getTexts()
+	cancel()
+	d.Shutdown()
+
+	if len(texts) != 2 || texts[0].text != cancelDeniedReply || texts[1].text != cancelledReply {
+		t.Errorf("texts = %+v, want a denial for another member and a cancellation by the admin", texts)
+	}
+}
+
+func TestDispatcher_CancelButton(t *testing.T) {
+	sender := &mockCancelEditor{}
+	chat := &mockBlockingChat{}
+	router := NewRouter(nil)
+	router.SetCallbackAnswerer(sender)
+	d := NewDispatcher(router, chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(time.Millisecond),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	button := func(id int) types.Update {
+		return types.Update{UpdateID: id, CallbackQuery: &types.CallbackQuery{
+			ID:      "q",
+			From:    types.User{ID: 7},
+			Message: &types.Message{ID: 901, Chat: types.Chat{ID: 42}},
+			Data:    cancelCallbackPrefix + "5",
+		}}
+	}
+	stale := button(2)
+	stale.CallbackQuery.Data = cancelCallbackPrefix + "4"
+
+	d.Dispatch(ctx, textUpdate(5, 42, 7, "slow question"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, stale)
+	time.Sleep(10 * time.Millisecond)
+	d.Dispatch(ctx, button(3))
+	time.Sleep(20 * time.Millisecond)
+
+	edits := sender.getEdits()
+	sender.cmu.Lock()
+	markups, toasts := sender.markups, sender.toasts
+	sender.cmu.Unlock()
+	cancel()
+	d.Shutdown()
+
+	if len(markups) != 1 {
+		t.Fatalf("placeholders = %d, want 1", len(markups))
+	}
+	keyboard, ok := markups[0].(*types.InlineKeyboardMarkup)
+	if !ok || keyboard.InlineKeyboard[0][0].CallbackData != cancelCallbackPrefix+"5" {
+		t.Errorf("placeholder markup = %#v, want a Cancel button for message 5", markups[0])
+	}
+	if len(toasts) != 2 || toasts[0] != nothingToCancelReply || toasts[1] != cancelledReply {
+		t.Errorf("callback answers = %q, want the stale button ignored and the request cancelled", toasts)
+	}
+	if len(edits) == 0 || edits[len(edits)-1] != cancelledReply {
+		t.Errorf("edits = %q, want the placeholder to end with %q", edits, cancelledReply)
+	}
+}
+
+func TestParseCancelCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		id   int
+		ok   bool
+	}{
+		{cancelCallbackPrefix + "12", 12, true},
+		{cancelCallbackPrefix + "abc", 0, false},
+		{cancelCallbackPrefix + "0", 0, false},
+		{portfolioCallbackPrefix + "spot", 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := parseCancelCallback(tt.data)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("parseCancelCallback(%q) = %d, %v; want %d, %v", tt.data, id, ok, tt.id, tt.ok)
+		}
+	}
+}
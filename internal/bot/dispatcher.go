@@ -2,6 +2,7 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 	"sync/atomic"
@@ -9,6 +10,9 @@ import (
 
 	"github.com/pocky-ops-bot/internal/bot/types"
 	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+	"github.com/pocky-ops-bot/internal/tools"
+	"github.com/pocky-ops-bot/internal/usage"
 )
 
 // MessageSender sends text messages and chat actions to Telegram.
@@ -17,31 +21,103 @@ type MessageSender interface {
 	SendChatAction(ctx context.Context, chatID int64, action string) error
 }
 
+// MessageEditor is implemented by senders that can edit a sent message in place.
+// It enables progressive (streamed) replies.
+type MessageEditor interface {
+	SendMessageResult(ctx context.Context, chatID int64, text string, opts ...telegram.SendOption) (*types.Message, error)
+	EditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...telegram.SendOption) error
+}
+
+// NonBlockingEditor is implemented by editors that can skip an edit the
+// chat cannot take right now instead of waiting for it. Intermediate edits of
+// streamed replies use it so generation never waits on flood limits.
+type NonBlockingEditor interface {
+	TryEditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...telegram.SendOption) (bool, error)
+}
+
+// LongMessageSender is implemented by senders that split text longer than
+// Telegram's limit into several messages threaded as replies.
+type LongMessageSender interface {
+	SendLongMessage(ctx context.Context, chatID int64, text string, opts ...telegram.SendOption) ([]*types.Message, error)
+}
+
+// MessageDeleter is implemented by senders that can delete a sent message.
+type MessageDeleter interface {
+	DeleteMessage(ctx context.Context, chatID int64, messageID int) error
+}
+
 // ChatCompleter generates an AI response given conversation history and user text.
 type ChatCompleter interface {
 	GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error)
 }
 
+// StreamingChatCompleter is a ChatCompleter that reports the partial reply while generating.
+type StreamingChatCompleter interface {
+	GenerateResponseStream(ctx context.Context, history []llm.ChatMessage, userText string, onPartial func(text string)) (string, error)
+}
+
+// MessageChatCompleter is a ChatCompleter that accepts a complete user
+// message, e.g. a caption with attached images. onPartial may be nil.
+type MessageChatCompleter interface {
+	GenerateMessageResponse(ctx context.Context, history []llm.ChatMessage, msg llm.ChatMessage, onPartial func(text string)) (string, error)
+}
+
+// HistoryCompactor shrinks a conversation history that no longer fits the
+// model's context budget, e.g. by summarizing its oldest turns. On error it
+// may still return a usable (trimmed) history.
+type HistoryCompactor interface {
+	Compact(ctx context.Context, history []llm.ChatMessage) ([]llm.ChatMessage, error)
+}
+
+// queuedUpdate is an update waiting in a chat worker's queue. ack commits
+// it to the update source once the worker has handled it.
+type queuedUpdate struct {
+	update types.Update
+	ack    func()
+}
+
 // chatWorker represents an active per-chat goroutine.
 type chatWorker struct {
-	ch chan types.Update
+	ch chan queuedUpdate
+	// mu orders queueing against retiring: once stopped is set the worker
+	// reads no more updates and Dispatch starts a new one.
+	mu      sync.Mutex
+	stopped bool
+	// busyWarned is set when the chat was told its queue is full and cleared
+	// when the worker takes the next update, so a flood gets one reply.
+	busyWarned atomic.Bool
+	// inflight is the update being handled, cancelled by /huy.
+	inflight inflight
+	// last is the most recently answered turn, which editing its question
+	// regenerates. Only the worker goroutine touches it.
+	last answeredTurn
 }
 
 // Dispatcher routes Telegram updates to per-chat worker goroutines.
-// Each chat gets its own goroutine and channel, ensuring sequential
-// processing per chat while allowing concurrent processing across chats.
+// Each chat (or forum topic) gets its own goroutine and channel, ensuring
+// sequential processing per conversation while allowing concurrent
+// processing across conversations.
 // Conversation history is owned locally by each worker goroutine — no shared state.
 type Dispatcher struct {
-	workers  sync.Map // map[int64]*chatWorker
-	router   *Router
-	chat     ChatCompleter
-	sender   MessageSender
-	bufSize  int
-	idleTTL  time.Duration
-	maxTurns int
-	logger   *slog.Logger
-	wg       sync.WaitGroup
-	active   atomic.Int64
+	workers        sync.Map // map[ConversationKey]*chatWorker
+	router         *Router
+	chat           ChatCompleter
+	sender         MessageSender
+	bufSize        int
+	idleTTL        time.Duration
+	maxTurns       int
+	streamInterval time.Duration
+	middlewares    []Middleware
+	access         *AccessPolicy
+	limiter        *RateLimiter
+	store          HistoryStore
+	compactor      HistoryCompactor
+	transcriber    Transcriber
+	botUser        *types.User
+	toolGroups     *ToolGroupPolicy
+	logger         *slog.Logger
+	wg             sync.WaitGroup
+	active         atomic.Int64
 }
 
 // DispatcherOption is a functional option for configuring the Dispatcher.
@@ -61,13 +137,90 @@ func WithIdleTTL(ttl time.Duration) DispatcherOption {
 	}
 }
 
-// WithMaxTurns sets the maximum conversation history length.
+// WithMaxTurns sets the maximum conversation history length. It is ignored
+// when a HistoryCompactor is set.
 func WithMaxTurns(n int) DispatcherOption {
 	return func(d *Dispatcher) {
 		d.maxTurns = n
 	}
 }
 
+// WithStreaming enables progressive replies: a placeholder message is sent and
+// edited with the partial answer at most once per interval. It only takes
+// effect when the sender implements MessageEditor and the chat completer
+// implements StreamingChatCompleter.
+func WithStreaming(interval time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.streamInterval = interval
+	}
+}
+
+// WithMiddleware wraps the handling of every update in a chat worker with
+// mws. The first middleware is the outermost.
+func WithMiddleware(mws ...Middleware) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.middlewares = append(d.middlewares, mws...)
+	}
+}
+
+// WithAccessPolicy restricts the bot to the users and chats allowed by p.
+// Updates from anyone else are rejected before a chat worker is spawned.
+func WithAccessPolicy(p *AccessPolicy) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.access = p
+	}
+}
+
+// WithRateLimiter limits how fast each user and chat may send updates.
+// Rejected senders are told when to retry; admins are never limited.
+func WithRateLimiter(l *RateLimiter) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.limiter = l
+	}
+}
+
+// WithHistoryStore persists conversation history in s: a worker loads its
+// chat's history when spawned and saves it after every turn, so history
+// survives idle shutdown and restarts.
+func WithHistoryStore(s HistoryStore) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.store = s
+	}
+}
+
+// WithHistoryCompactor replaces message-count trimming with c, which keeps
+// each chat's history within a token budget after every turn.
+func WithHistoryCompactor(c HistoryCompactor) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.compactor = c
+	}
+}
+
+// WithTranscriber enables voice messages: they are transcribed, echoed back
+// and answered like text.
+func WithTranscriber(t Transcriber) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.transcriber = t
+	}
+}
+
+// WithBotUser enables group mode for the bot account bot (from getMe): in
+// groups only commands, replies to the bot and messages mentioning it are
+// handled, and everything else is ignored.
+func WithBotUser(bot *types.User) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.botUser = bot
+	}
+}
+
+// WithToolGroups restricts the tools the AI may use in each conversation to
+// the groups p enables for its chat and sender.
+func WithToolGroups(p *ToolGroupPolicy) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.toolGroups = p
+	}
+}
+
 // NewDispatcher creates a new Dispatcher.
 func NewDispatcher(router *Router, chat ChatCompleter, sender MessageSender, logger *slog.Logger, opts ...DispatcherOption) *Dispatcher {
 	if logger == nil {
@@ -89,42 +242,166 @@ func NewDispatcher(router *Router, chat ChatCompleter, sender MessageSender, log
 }
 
 // Dispatch routes an update to the appropriate chat worker.
-// It implements the UpdateHandler signature for use with Poller.StartWithHandler.
+// It implements the UpdateHandler signature for use with Poller.StartWithHandler,
+// and defers the poller's commit of a queued update until its worker has
+// handled it.
 func (d *Dispatcher) Dispatch(ctx context.Context, update types.Update) error {
 	chatID := extractChatID(update)
 	if chatID == 0 {
 		return nil
 	}
 
-	// Get or create worker for this chat
-	val, loaded := d.workers.LoadOrStore(chatID, &chatWorker{
-		ch: make(chan types.Update, d.bufSize),
-	})
-	worker := val.(*chatWorker)
+	// In group mode, chatter not addressed to the bot is ignored before it
+	// can cost a rate-limit token
+	if msg := update.Message; msg != nil {
+		addressed, ok := d.addressedMessage(msg)
+		if !ok {
+			return nil
+		}
+		update.Message = addressed
+	}
+	if msg := update.EditedMessage; msg != nil {
+		addressed, ok := d.addressedMessage(msg)
+		if !ok {
+			return nil
+		}
+		update.EditedMessage = addressed
+	}
 
-	if !loaded {
-		// New worker — spawn goroutine
-		d.wg.Add(1)
-		d.active.Add(1)
-		d.logger.Debug("spawning chat worker",
-			slog.Int64("chat_id", chatID),
-		)
-		go d.runWorker(ctx, chatID, worker.ch)
+	// Replies to an update in a forum topic stay in the topic
+	key := conversationKey(update)
+	if key.ThreadID != 0 {
+		ctx = telegram.ContextWithThreadID(ctx, key.ThreadID)
+	}
+
+	user := extractUser(update)
+	var userID int64
+	if user != nil {
+		userID = user.ID
 	}
 
-	// Non-blocking send
-	select {
-	case worker.ch <- update:
-	default:
+	// /id, access control and rate limiting run before a worker exists, so
+	// rejected users never cost a goroutine or an AI call. Only allowed
+	// updates take rate-limit tokens, so strangers cannot drain the buckets
+	// of an allowed chat. /huy and the Cancel button bypass the rate limiter
+	// and the queue: a throttled user must still be able to stop the request
+	// that uses up their tokens, and it is blocking the queue.
+	if msg := update.Message; msg != nil && msg.Text != "" && msg.Text[0] == '/' && extractCommand(msg.Text) == "id" {
+		d.goReply(func() {
+			_ = d.sender.SendText(ctx, chatID, idReply(msg.From, chatID))
+		})
+		return nil
+	}
+	if d.access != nil {
+		if !d.access.Allowed(userID, chatID) {
+			d.goReply(func() {
+				d.denyAccess(ctx, chatID, user, update)
+			})
+			return nil
+		}
+	}
+	if d.cancelRequest(ctx, key, userID, update) {
+		return nil
+	}
+	if d.limiter != nil && (d.access == nil || !d.access.IsAdmin(userID)) {
+		kind := requestKind(update)
+		if wait, warn := d.limiter.Allow(kind, userID, chatID); wait > 0 {
+			d.goReply(func() {
+				d.rejectRateLimited(ctx, chatID, userID, update, kind, wait, warn)
+			})
+			return nil
+		}
+	}
+
+	// Non-blocking send. A queued update is committed only once the worker
+	// has handled it, so it is redelivered if the bot stops before it is
+	// handled.
+	ack := telegram.DeferAck(ctx)
+	queued := queuedUpdate{update: update, ack: ack}
+	worker, sent := d.enqueue(ctx, key, queued)
+	if !sent {
+		ack()
 		d.logger.Warn("chat queue full, dropping update",
 			slog.Int64("chat_id", chatID),
 			slog.Int("update_id", update.UpdateID),
 		)
+		if update.Message != nil && worker.busyWarned.CompareAndSwap(false, true) {
+			d.goReply(func() {
+				_ = d.sender.SendText(ctx, chatID, busyReply)
+			})
+		}
 	}
 
 	return nil
 }
 
+// enqueue queues an update on the worker of key, starting one if there is
+// none or the current one is retiring. It reports false if the queue is
+// full.
+func (d *Dispatcher) enqueue(ctx context.Context, key ConversationKey, queued queuedUpdate) (*chatWorker, bool) {
+	for {
+		val, loaded := d.workers.LoadOrStore(key, &chatWorker{
+			ch: make(chan queuedUpdate, d.bufSize),
+		})
+		worker := val.(*chatWorker)
+
+		if !loaded {
+			// New worker — spawn goroutine
+			d.wg.Add(1)
+			d.active.Add(1)
+			d.logger.Debug("spawning chat worker",
+				slog.Int64("chat_id", key.ChatID),
+				slog.Int("thread_id", key.ThreadID),
+			)
+			go d.runWorker(ctx, key, worker)
+		}
+
+		worker.mu.Lock()
+		if worker.stopped {
+			// Retired after the lookup; its replacement takes the update
+			worker.mu.Unlock()
+			continue
+		}
+		select {
+		case worker.ch <- queued:
+			worker.mu.Unlock()
+			return worker, true
+		default:
+			worker.mu.Unlock()
+			return worker, false
+		}
+	}
+}
+
+// retire stops worker from taking updates and removes it from the workers,
+// unless updates are still queued and force is false. It reports whether the
+// worker was retired. Updates left in the queue of a forced worker are not
+// acknowledged, so they are redelivered after a restart.
+func (d *Dispatcher) retire(key ConversationKey, worker *chatWorker, force bool) bool {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+
+	if !force && len(worker.ch) > 0 {
+		return false
+	}
+	worker.stopped = true
+	d.workers.CompareAndDelete(key, worker)
+	return true
+}
+
+// busyReply is sent when a chat's queue is full and an update is dropped.
+const busyReply = "⏳ Bot đang xử lý các tin nhắn trước, vui lòng gửi lại sau ít phút."
+
+// goReply runs fn in a tracked goroutine so Dispatch never blocks on
+// Telegram while answering outside a chat worker.
+func (d *Dispatcher) goReply(fn func()) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		fn()
+	}()
+}
+
 // Shutdown waits for all worker goroutines to finish.
 func (d *Dispatcher) Shutdown() {
 	d.wg.Wait()
@@ -135,22 +412,29 @@ func (d *Dispatcher) ActiveWorkers() int {
 	return int(d.active.Load())
 }
 
-// runWorker is the per-chat goroutine that processes updates sequentially.
-func (d *Dispatcher) runWorker(ctx context.Context, chatID int64, ch <-chan types.Update) {
+// runWorker is the per-conversation goroutine that processes updates sequentially.
+func (d *Dispatcher) runWorker(ctx context.Context, key ConversationKey, worker *chatWorker) {
 	defer d.wg.Done()
 	defer d.active.Add(-1)
-	defer d.workers.Delete(chatID)
+	defer d.retire(key, worker, true)
 
-	history := make([]llm.ChatMessage, 0)
+	history := d.loadHistory(key)
 	idle := time.NewTimer(d.idleTTL)
 	defer idle.Stop()
 
+	handle := chain(func(ctx context.Context, update types.Update) error {
+		history = d.handleUpdate(ctx, key, worker, update, history)
+		return nil
+	}, d.middlewares)
+
 	for {
 		select {
-		case update, ok := <-ch:
+		case queued, ok := <-worker.ch:
 			if !ok {
 				return
 			}
+			update := queued.update
+			worker.busyWarned.Store(false)
 			if !idle.Stop() {
 				select {
 				case <-idle.C:
@@ -159,11 +443,20 @@ func (d *Dispatcher) runWorker(ctx context.Context, chatID int64, ch <-chan type
 			}
 			idle.Reset(d.idleTTL)
 
-			history = d.handleUpdate(ctx, chatID, update, history)
+			handleCtx, done := worker.inflight.begin(ctx, update)
+			_ = handle(handleCtx, update)
+			done()
+			queued.ack()
 
 		case <-idle.C:
+			if !d.retire(key, worker, false) {
+				// An update arrived as the timer fired
+				idle.Reset(d.idleTTL)
+				continue
+			}
 			d.logger.Debug("chat worker idle, shutting down",
-				slog.Int64("chat_id", chatID),
+				slog.Int64("chat_id", key.ChatID),
+				slog.Int("thread_id", key.ThreadID),
 			)
 			return
 
@@ -175,7 +468,47 @@ func (d *Dispatcher) runWorker(ctx context.Context, chatID int64, ch <-chan type
 
 // handleUpdate processes a single update within the worker goroutine.
 // It returns the (possibly updated) history.
-func (d *Dispatcher) handleUpdate(ctx context.Context, chatID int64, update types.Update, history []llm.ChatMessage) []llm.ChatMessage {
+func (d *Dispatcher) handleUpdate(ctx context.Context, key ConversationKey, worker *chatWorker, update types.Update, history []llm.ChatMessage) []llm.ChatMessage {
+	chatID := key.ChatID
+
+	// Attribute AI usage of this update to its chat and sender
+	scope := usage.Scope{ChatID: chatID}
+	user := extractUser(update)
+	if user != nil {
+		scope.UserID = user.ID
+	}
+	ctx = usage.ContextWithScope(ctx, scope)
+
+	// Offer the AI only the tool groups enabled for this chat and sender
+	if d.toolGroups != nil {
+		if groups, restricted := d.toolGroups.Groups(chatID, scope.UserID); restricted {
+			ctx = tools.ContextWithGroups(ctx, groups)
+		}
+	}
+
+	// In groups every turn is prefixed with its sender's name
+	var speaker string
+	if msg := extractMessage(update); msg != nil && isGroup(msg.Chat) {
+		speaker = speakerName(user)
+	}
+	ask := func(replyTo int, user llm.ChatMessage, opts ...telegram.SendOption) []llm.ChatMessage {
+		history, _ := d.converse(ctx, key, worker, replyTo, 0, history, attribute(user, speaker), opts...)
+		return history
+	}
+
+	// An edited question is answered again in place of the old answer
+	if edited := update.EditedMessage; edited != nil {
+		return d.regenerate(ctx, key, worker, edited, history, speaker)
+	}
+
+	// /dautu buttons continue the conversation; other callbacks go to the router
+	if cq := update.CallbackQuery; cq != nil && cq.Message != nil {
+		if scope, ok := parsePortfolioCallback(cq.Data); ok {
+			d.router.AnswerCallback(ctx, cq)
+			return ask(cq.Message.ID, userMessage(portfolioPrompts[scope]), withPortfolioKeyboard(scope))
+		}
+	}
+
 	msg := update.Message
 	if msg == nil {
 		// Handle callback queries, etc. through router
@@ -185,6 +518,20 @@ func (d *Dispatcher) handleUpdate(ctx context.Context, chatID int64, update type
 
 	text := msg.Text
 	if text == "" {
+		// Voice note → transcript → AI
+		if msg.Voice != nil {
+			if transcript, ok := d.transcribeVoice(ctx, chatID, msg); ok {
+				return ask(msg.ID, userMessage(transcript))
+			}
+			return history
+		}
+
+		// Photo (with optional caption) → AI
+		if fileID, isImage := imageFileID(msg); isImage {
+			if image, ok := d.imageMessage(ctx, chatID, msg, fileID); ok {
+				return ask(msg.ID, image)
+			}
+		}
 		return history
 	}
 
@@ -194,6 +541,15 @@ func (d *Dispatcher) handleUpdate(ctx context.Context, chatID int64, update type
 		switch cmd {
 		case "xoa":
 			history = history[:0]
+			worker.last = answeredTurn{}
+			if d.store != nil {
+				if err := d.store.Delete(key); err != nil {
+					d.logger.Warn("failed to delete history",
+						slog.Int64("chat_id", chatID),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
 			d.logger.Info("conversation cleared",
 				slog.Int64("chat_id", chatID),
 			)
@@ -201,10 +557,7 @@ func (d *Dispatcher) handleUpdate(ctx context.Context, chatID int64, update type
 			return history
 
 		case "dautu", "dautư":
-			text = "Hiển thị tổng quan danh mục đầu tư Binance của tôi, bao gồm cả Spot và Futures:\n" +
-				"1. Spot: liệt kê từng tài sản với giá trị USDT, tổng giá trị portfolio, và % lãi/lỗ 24h.\n" +
-				"2. Futures: tổng số dư ví, lãi/lỗ chưa thực hiện, margin khả dụng, tất cả vị thế đang mở (giá vào, giá mark, P&L, đòn bẩy, giá thanh lý), và các lệnh đang chờ.\n" +
-				"Dùng các tool có sẵn để lấy dữ liệu realtime."
+			return ask(msg.ID, userMessage(portfolioPrompts[portfolioAll]), withPortfolioKeyboard(portfolioAll))
 
 		default:
 			// Other commands (/start, /help) — delegate to router
@@ -213,32 +566,231 @@ func (d *Dispatcher) handleUpdate(ctx context.Context, chatID int64, update type
 		}
 	}
 
-	// Text message (or /balance prompt) → AI
-	_ = d.sender.SendChatAction(ctx, chatID, "typing")
+	// Text message → AI
+	return ask(msg.ID, userMessage(text))
+}
+
+// userMessage returns a plain text user message.
+func userMessage(text string) llm.ChatMessage {
+	return llm.ChatMessage{Role: llm.RoleUser, Content: text}
+}
 
-	reply, err := d.chat.GenerateResponse(ctx, history, text)
+// converse answers the user message with the AI as a reply to the message
+// replyTo, or by editing the bot's message editID when it is not zero, and
+// records the turn in history and as the worker's last turn. opts apply to
+// the final reply message. It reports whether the AI answered; otherwise
+// history is returned unchanged.
+func (d *Dispatcher) converse(ctx context.Context, key ConversationKey, worker *chatWorker, replyTo, editID int, history []llm.ChatMessage, user llm.ChatMessage, opts ...telegram.SendOption) ([]llm.ChatMessage, bool) {
+	chatID := key.ChatID
+	reply, replyIDs, err := d.reply(ctx, chatID, replyTo, editID, history, user, opts...)
+	if err != nil && isCancelled(ctx) {
+		LoggerFromContext(ctx, d.logger).Info("ai response cancelled",
+			slog.Int64("chat_id", chatID),
+		)
+		return history, false
+	}
 	if err != nil {
-		d.logger.Error("ai response failed",
+		LoggerFromContext(ctx, d.logger).Error("ai response failed",
 			slog.Int64("chat_id", chatID),
 			slog.String("error", err.Error()),
 		)
-		_ = d.sender.SendText(ctx, chatID, "Sorry, I couldn't process that. Please try again.")
-		return history
+		return history, false
 	}
 
 	// Update local history
+	question := historyMessage(user)
 	history = append(history,
-		llm.ChatMessage{Role: llm.RoleUser, Content: text},
+		question,
 		llm.ChatMessage{Role: llm.RoleAssistant, Content: reply},
 	)
+	worker.last = answeredTurn{messageID: replyTo, replyIDs: replyIDs, question: question.Content}
+
+	history = d.trimHistory(ctx, chatID, history)
+	d.saveHistory(ctx, key, history)
+	return history, true
+}
+
+// trimHistory keeps history within the context budget when a compactor is
+// set, or within maxTurns messages otherwise.
+func (d *Dispatcher) trimHistory(ctx context.Context, chatID int64, history []llm.ChatMessage) []llm.ChatMessage {
+	if d.compactor == nil {
+		if len(history) > d.maxTurns {
+			history = history[len(history)-d.maxTurns:]
+		}
+		return history
+	}
+
+	compacted, err := d.compactor.Compact(ctx, history)
+	if err != nil {
+		LoggerFromContext(ctx, d.logger).Warn("history compaction failed",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+	}
+	if compacted == nil {
+		return history
+	}
+	return compacted
+}
+
+// loadHistory returns the stored history of a conversation, or an empty
+// history if there is no store or loading fails.
+func (d *Dispatcher) loadHistory(key ConversationKey) []llm.ChatMessage {
+	history := make([]llm.ChatMessage, 0)
+	if d.store == nil {
+		return history
+	}
+
+	saved, err := d.store.Load(key)
+	if err != nil {
+		d.logger.Warn("failed to load history, starting fresh",
+			slog.Int64("chat_id", key.ChatID),
+			slog.Int("thread_id", key.ThreadID),
+			slog.String("error", err.Error()),
+		)
+		return history
+	}
+	if d.compactor == nil && len(saved) > d.maxTurns {
+		saved = saved[len(saved)-d.maxTurns:]
+	}
+	return append(history, saved...)
+}
 
-	// Trim to max turns
-	if len(history) > d.maxTurns {
-		history = history[len(history)-d.maxTurns:]
+// saveHistory persists history after a turn. Failures are logged; the
+// conversation continues from the in-memory copy.
+func (d *Dispatcher) saveHistory(ctx context.Context, key ConversationKey, history []llm.ChatMessage) {
+	if d.store == nil {
+		return
+	}
+	if err := d.store.Save(key, history); err != nil {
+		LoggerFromContext(ctx, d.logger).Warn("failed to save history",
+			slog.Int64("chat_id", key.ChatID),
+			slog.Int("thread_id", key.ThreadID),
+			slog.String("error", err.Error()),
+		)
 	}
+}
+
+// errorReply is shown to the user when the AI fails to answer.
+const errorReply = "Sorry, I couldn't process that. Please try again."
 
-	_ = d.sender.SendText(ctx, chatID, reply)
-	return history
+// userFacingError is implemented by errors that carry their own explanation
+// for the user, such as an exhausted usage budget.
+type userFacingError interface {
+	UserMessage() string
+}
+
+// errorText returns the message shown to the user when the AI fails with err.
+func errorText(err error) string {
+	var uf userFacingError
+	if errors.As(err, &uf) {
+		return uf.UserMessage()
+	}
+	return errorReply
+}
+
+// reply generates the AI answer to the user message and delivers it to the
+// chat as a reply to the message replyTo, either progressively through message
+// edits or as one or more messages. When editID is set and the sender can edit
+// messages, the answer replaces that earlier reply instead. A streamed reply
+// carries a Cancel button until it is complete. It returns the answer and the
+// IDs of its messages in order, nil if unknown. On failure the user is
+// notified and the error is returned.
+func (d *Dispatcher) reply(ctx context.Context, chatID int64, replyTo, editID int, history []llm.ChatMessage, user llm.ChatMessage, opts ...telegram.SendOption) (string, []int, error) {
+	editor, canEdit := d.sender.(MessageEditor)
+	if editID != 0 && canEdit {
+		err := editor.EditMessageText(ctx, chatID, editID, streamPlaceholder,
+			telegram.WithParseMode(""),
+			withCancelButton(replyTo),
+		)
+		if err == nil || telegram.IsMessageNotModified(err) {
+			return d.replyStreaming(ctx, chatID, replyTo, editID, editor, history, user, opts...)
+		}
+		d.logger.Warn("failed to edit previous reply, answering anew",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+	}
+	if d.streamInterval > 0 && canEdit && d.canStream() {
+		placeholder, err := editor.SendMessageResult(ctx, chatID, streamPlaceholder,
+			telegram.WithParseMode(""),
+			telegram.WithReplyToMessageID(replyTo),
+			withCancelButton(replyTo),
+		)
+		if err == nil {
+			return d.replyStreaming(ctx, chatID, replyTo, placeholder.ID, editor, history, user, opts...)
+		}
+		d.logger.Warn("failed to send stream placeholder, falling back",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	_ = d.sender.SendChatAction(ctx, chatID, "typing")
+
+	reply, err := d.generate(ctx, history, user, nil)
+	if err != nil {
+		noticeCtx, notice := failureNotice(ctx, err)
+		_ = d.sender.SendText(noticeCtx, chatID, notice)
+		return "", nil, err
+	}
+
+	return reply, d.sendReply(ctx, chatID, replyTo, reply, opts...), nil
+}
+
+// canStream reports whether the chat completer can report partial replies.
+func (d *Dispatcher) canStream() bool {
+	switch d.chat.(type) {
+	case MessageChatCompleter, StreamingChatCompleter:
+		return true
+	}
+	return false
+}
+
+// generate asks the chat completer for the reply to user, reporting partial
+// text through onPartial when it is set. Completers that only take text get
+// the user message's text.
+func (d *Dispatcher) generate(ctx context.Context, history []llm.ChatMessage, user llm.ChatMessage, onPartial func(text string)) (string, error) {
+	if mc, ok := d.chat.(MessageChatCompleter); ok {
+		return mc.GenerateMessageResponse(ctx, history, user, onPartial)
+	}
+	if streamer, ok := d.chat.(StreamingChatCompleter); ok && onPartial != nil {
+		return streamer.GenerateResponseStream(ctx, history, user.Content, onPartial)
+	}
+	return d.chat.GenerateResponse(ctx, history, user.Content)
+}
+
+// sendReply delivers an AI reply, splitting it into several messages when it
+// exceeds Telegram's length limit. The first message replies to replyTo.
+// opts (e.g. a keyboard) are only honored by a LongMessageSender, which also
+// reports the IDs of the messages sent; otherwise nil is returned.
+func (d *Dispatcher) sendReply(ctx context.Context, chatID int64, replyTo int, text string, opts ...telegram.SendOption) []int {
+	if long, ok := d.sender.(LongMessageSender); ok {
+		opts = append([]telegram.SendOption{telegram.WithReplyToMessageID(replyTo)}, opts...)
+		sent, err := long.SendLongMessage(ctx, chatID, text, opts...)
+		if err != nil {
+			d.logger.Warn("failed to send reply",
+				slog.Int64("chat_id", chatID),
+				slog.String("error", err.Error()),
+			)
+		}
+		ids := make([]int, 0, len(sent))
+		for _, msg := range sent {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+
+	for _, chunk := range telegram.SplitMessage(text, telegram.MaxMessageLength) {
+		if err := d.sender.SendText(ctx, chatID, chunk); err != nil {
+			d.logger.Warn("failed to send reply",
+				slog.Int64("chat_id", chatID),
+				slog.String("error", err.Error()),
+			)
+			return nil
+		}
+	}
+	return nil
 }
 
 // extractChatID extracts the chat ID from an update.
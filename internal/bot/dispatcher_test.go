@@ -2,12 +2,17 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pocky-ops-bot/internal/bot/types"
 	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+	"github.com/pocky-ops-bot/internal/usage"
 )
 
 // mockSender implements MessageSender for testing.
@@ -111,6 +116,32 @@ func TestDispatcher_TextMessage(t *testing.T) {
 	}
 }
 
+func TestDispatcher_LongReplySplit(t *testing.T) {
+	sender := &mockSender{}
+	para := strings.Repeat("a", 3000)
+	chat := &mockChat{reply: para + "\n\n" + para}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "/dautu", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	texts := sender.getTexts()
+	if len(texts) != 2 {
+		t.Fatalf("expected reply split into 2 messages, got %d", len(texts))
+	}
+	for i, m := range texts {
+		if m.text != para {
+			t.Errorf("message %d has %d chars, want one paragraph", i, len(m.text))
+		}
+	}
+}
+
 func TestDispatcher_SequentialSameChat(t *testing.T) {
 	sender := &mockSender{}
 	chat := &mockChat{reply: "reply"}
@@ -267,6 +298,47 @@ func TestDispatcher_IdleCleanup(t *testing.T) {
 	}
 }
 
+func TestDispatcher_RetiringWorker(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "one", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(30 * time.Millisecond)
+
+	// A worker that is leaving takes no more updates; a new one does
+	key := ConversationKey{ChatID: 42}
+	val, _ := d.workers.Load(key)
+	if !d.retire(key, val.(*chatWorker), false) {
+		t.Fatal("retire() = false for a worker with an empty queue")
+	}
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 2,
+		Message:  &types.Message{ID: 2, Text: "two", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(30 * time.Millisecond)
+
+	if calls := chat.getCalls(); len(calls) != 2 || calls[1].userText != "two" {
+		t.Fatalf("calls = %+v, want the update after retiring handled", calls)
+	}
+	if d.ActiveWorkers() != 2 {
+		t.Errorf("active workers = %d, want the retired one and its replacement", d.ActiveWorkers())
+	}
+
+	// An idle worker with queued updates keeps running
+	busy := &chatWorker{ch: make(chan queuedUpdate, 1)}
+	busy.ch <- queuedUpdate{ack: func() {}}
+	if d.retire(ConversationKey{ChatID: 7}, busy, false) || busy.stopped {
+		t.Error("retire() stopped a worker with queued updates")
+	}
+}
+
 func TestDispatcher_GracefulShutdown(t *testing.T) {
 	sender := &mockSender{}
 	chat := &mockChat{reply: "reply"}
@@ -426,3 +498,169 @@ func TestDispatcher_CommandRouting(t *testing.T) {
 		t.Errorf("AI should not be called for commands, got %d calls", len(calls))
 	}
 }
+
+// mockKeyboardSender implements MessageSender, LongMessageSender and
+// CallbackAnswerer for testing.
+type mockKeyboardSender struct {
+	mockSender
+	bodies   []map[string]interface{}
+	answered []string
+}
+
+func (m *mockKeyboardSender) SendLongMessage(ctx context.Context, chatID int64, text string, opts ...telegram.SendOption) ([]*types.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body := map[string]interface{}{"chat_id": chatID, "text": text}
+	for _, opt := range opts {
+		opt(body)
+	}
+	m.bodies = append(m.bodies, body)
+	return []*types.Message{{ID: 500}}, nil
+}
+
+func (m *mockKeyboardSender) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answered = append(m.answered, callbackQueryID)
+	return nil
+}
+
+func TestDispatcher_PortfolioButtons(t *testing.T) {
+	sender := &mockKeyboardSender{}
+	chat := &mockChat{reply: "portfolio"}
+	router := NewRouter(nil)
+	router.SetCallbackAnswerer(sender)
+	d := NewDispatcher(router, chat, sender, nil, WithIdleTTL(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 10, Text: "/dautu", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 2,
+		CallbackQuery: &types.CallbackQuery{
+			ID:      "cb1",
+			Data:    "dautu:spot",
+			Message: &types.Message{ID: 500, Chat: types.Chat{ID: 42}},
+		},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	if len(sender.bodies) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(sender.bodies))
+	}
+	markup, ok := sender.bodies[0]["reply_markup"].(*types.InlineKeyboardMarkup)
+	if !ok || len(markup.InlineKeyboard) != 2 {
+		t.Fatalf("/dautu reply_markup = %v, want portfolio keyboard", sender.bodies[0]["reply_markup"])
+	}
+	if refresh := sender.bodies[1]["reply_markup"].(*types.InlineKeyboardMarkup).InlineKeyboard[1][0]; refresh.CallbackData != "dautu:spot" {
+		t.Errorf("refresh callback = %q, want dautu:spot", refresh.CallbackData)
+	}
+	if sender.bodies[1]["reply_to_message_id"] != 500 {
+		t.Errorf("reply_to_message_id = %v, want 500", sender.bodies[1]["reply_to_message_id"])
+	}
+	if len(sender.answered) != 1 || sender.answered[0] != "cb1" {
+		t.Errorf("answered = %v, want [cb1]", sender.answered)
+	}
+
+	calls := chat.getCalls()
+	if len(calls) != 2 || calls[1].userText != portfolioPrompts[portfolioSpot] {
+		t.Fatalf("expected spot prompt on second call, got %+v", calls)
+	}
+	if len(calls[1].history) != 2 {
+		t.Errorf("button press should continue the conversation, history = %d", len(calls[1].history))
+	}
+}
+
+// summaryCompactor replaces everything but the last exchange with a summary.
+type summaryCompactor struct {
+	calls atomic.Int32
+}
+
+func (c *summaryCompactor) Compact(ctx context.Context, history []llm.ChatMessage) ([]llm.ChatMessage, error) {
+	c.calls.Add(1)
+	if len(history) <= 2 {
+		return history, nil
+	}
+	summary := llm.ChatMessage{Role: llm.RoleSystem, Content: "summary"}
+	return append([]llm.ChatMessage{summary}, history[len(history)-2:]...), nil
+}
+
+func TestDispatcher_HistoryCompactor(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	compactor := &summaryCompactor{}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithMaxTurns(2),
+		WithHistoryCompactor(compactor),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 1; i <= 3; i++ {
+		d.Dispatch(ctx, types.Update{Message: &types.Message{ID: i, Text: "msg", Chat: types.Chat{ID: 42}}})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	calls := chat.getCalls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 AI calls, got %d", len(calls))
+	}
+	last := calls[2].history
+	if len(last) != 3 || last[0].Content != "summary" {
+		t.Errorf("history = %+v, want summary + last exchange instead of maxTurns trimming", last)
+	}
+	if n := compactor.calls.Load(); n != 3 {
+		t.Errorf("compactor called %d times, want once per turn", n)
+	}
+}
+
+// mockBudgetChat rejects every request with a budget error and records the
+// usage scope it was called with.
+type mockBudgetChat struct {
+	mu    sync.Mutex
+	scope usage.Scope
+}
+
+func (m *mockBudgetChat) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scope = usage.ScopeFromContext(ctx)
+	return "", fmt.Errorf("chat: %w", &usage.BudgetError{User: true, Limit: 1, Spent: 1})
+}
+
+func TestDispatcher_BudgetExhausted(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockBudgetChat{}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, types.Update{UpdateID: 1, Message: &types.Message{
+		ID:   1,
+		Text: "hello",
+		Chat: types.Chat{ID: 42},
+		From: &types.User{ID: 7},
+	}})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	d.Shutdown()
+
+	if chat.scope != (usage.Scope{ChatID: 42, UserID: 7}) {
+		t.Errorf("scope = %+v, want chat 42 and user 7", chat.scope)
+	}
+	texts := sender.getTexts()
+	want := (&usage.BudgetError{User: true, Limit: 1, Spent: 1}).UserMessage()
+	if len(texts) != 1 || texts[0].text != want {
+		t.Errorf("texts = %+v, want the budget message", texts)
+	}
+}
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// answeredTurn links the last question of a conversation to the bot's answer.
+type answeredTurn struct {
+	messageID int    // the user's message
+	replyIDs  []int  // the bot's reply messages in order, nil if unknown
+	question  string // the user turn as kept in history
+	failed    bool   // answering again failed; history ends with the question
+}
+
+// regenerate answers an edited message again. Only the last answered question
+// can be edited: its turn is rolled back from history and the new answer
+// replaces the old one in place, or is sent anew when the old message cannot
+// be edited. If the new answer fails, history keeps the edited question
+// without an answer. Edits of older messages and of commands are ignored.
+func (d *Dispatcher) regenerate(ctx context.Context, key ConversationKey, worker *chatWorker, edited *types.Message, history []llm.ChatMessage, speaker string) []llm.ChatMessage {
+	last := worker.last
+	if last.messageID == 0 || edited.ID != last.messageID {
+		return history
+	}
+	if edited.Text != "" && edited.Text[0] == '/' {
+		return history
+	}
+
+	// The turn may have been trimmed or compacted away since
+	turn := 2
+	if last.failed {
+		turn = 1
+	}
+	n := len(history)
+	if n < turn || history[n-turn].Role != llm.RoleUser || history[n-turn].Content != last.question {
+		LoggerFromContext(ctx, d.logger).Debug("edited turn no longer in history",
+			slog.Int64("chat_id", key.ChatID),
+			slog.Int("message_id", edited.ID),
+		)
+		return history
+	}
+
+	var user llm.ChatMessage
+	if edited.Text != "" {
+		user = userMessage(edited.Text)
+	} else if fileID, isImage := imageFileID(edited); isImage {
+		image, ok := d.imageMessage(ctx, key.ChatID, edited, fileID)
+		if !ok {
+			return history
+		}
+		user = image
+	} else {
+		return history
+	}
+
+	LoggerFromContext(ctx, d.logger).Info("regenerating edited question",
+		slog.Int64("chat_id", key.ChatID),
+		slog.Int("message_id", edited.ID),
+		slog.Any("reply_ids", last.replyIDs),
+	)
+
+	// The new answer goes in the first message of the old one; the rest of
+	// a long old answer would stay on screen below it
+	var replyIDs []int
+	editID := 0
+	if len(last.replyIDs) > 0 {
+		replyIDs, editID = last.replyIDs[:1], last.replyIDs[0]
+		d.deleteReplies(ctx, key.ChatID, last.replyIDs[1:])
+	}
+
+	user = attribute(user, speaker)
+	history, answered := d.converse(ctx, key, worker, edited.ID, editID, history[:n-turn], user)
+	if answered {
+		return history
+	}
+
+	// The old answer has already been replaced by the error notice; keep
+	// the edited question instead of the stale turn, so it is not lost and
+	// can be edited again
+	question := historyMessage(user)
+	history = append(history, question)
+	worker.last = answeredTurn{messageID: edited.ID, replyIDs: replyIDs, question: question.Content, failed: true}
+	d.saveHistory(ctx, key, history)
+	return history
+}
+
+// deleteReplies deletes the bot's messages ids when the sender can delete
+// messages. Failures are logged.
+func (d *Dispatcher) deleteReplies(ctx context.Context, chatID int64, ids []int) {
+	deleter, ok := d.sender.(MessageDeleter)
+	if !ok {
+		return
+	}
+	for _, id := range ids {
+		if err := deleter.DeleteMessage(ctx, chatID, id); err != nil {
+			LoggerFromContext(ctx, d.logger).Warn("failed to delete previous reply",
+				slog.Int64("chat_id", chatID),
+				slog.Int("message_id", id),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// mockEditTarget records which messages are edited and deleted.
+type mockEditTarget struct {
+	mockEditor
+	tmu     sync.Mutex
+	edited  []int
+	deleted []int
+}
+
+func (m *mockEditTarget) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
+	m.tmu.Lock()
+	defer m.tmu.Unlock()
+	m.deleted = append(m.deleted, messageID)
+	return nil
+}
+
+func (m *mockEditTarget) getDeleted() []int {
+	m.tmu.Lock()
+	defer m.tmu.Unlock()
+	result := make([]int, len(m.deleted))
+	copy(result, m.deleted)
+	return result
+}
+
+// failingChat is a mockChat that fails while fail is set.
+type failingChat struct {
+	mockChat
+	fail atomic.Bool
+}
+
+func (m *failingChat) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
+	if m.fail.Load() {
+		return "", errors.New("provider down")
+	}
+	return m.mockChat.GenerateResponse(ctx, history, userText)
+}
+
+func (m *mockEditTarget) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...telegram.SendOption) error {
+	m.tmu.Lock()
+	m.edited = append(m.edited, messageID)
+	m.tmu.Unlock()
+	return m.mockEditor.EditMessageText(ctx, chatID, messageID, text, opts...)
+}
+
+func (m *mockEditTarget) getEdited() []int {
+	m.tmu.Lock()
+	defer m.tmu.Unlock()
+	result := make([]int, len(m.edited))
+	copy(result, m.edited)
+	return result
+}
+
+func editedUpdate(id int, chatID int64, text string) types.Update {
+	return types.Update{UpdateID: 100 + id, EditedMessage: &types.Message{
+		ID:   id,
+		Text: text,
+		Chat: types.Chat{ID: chatID},
+		From: &types.User{ID: 7},
+	}}
+}
+
+func TestDispatcher_EditedQuestion(t *testing.T) {
+	sender := &mockEditTarget{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: "AI reply"}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(time.Millisecond),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	step := func(update types.Update) {
+		d.Dispatch(ctx, update)
+		time.Sleep(30 * time.Millisecond)
+	}
+	step(textUpdate(1, 42, 7, "giá BTC?"))
+	step(textUpdate(2, 42, 7, "giá ETH?"))
+	placeholders := len(sender.getSent())
+	edited := len(sender.getEdited())
+
+	step(editedUpdate(1, 42, "giá BNB?")) // not the last question
+	step(editedUpdate(2, 42, "/start"))   // commands are not answered again
+	step(editedUpdate(2, 42, "giá SOL?"))
+	sent := sender.getSent()
+	edits := sender.getEdited()[edited:]
+	step(textUpdate(3, 42, 7, "còn gì nữa?"))
+
+	calls := chat.getCalls()
+	cancel()
+	d.Shutdown()
+
+	if len(calls) != 4 {
+		t.Fatalf("AI calls = %d, want 4 (two questions, one edit, one follow-up)", len(calls))
+	}
+	if calls[2].userText != "giá SOL?" {
+		t.Errorf("regenerated question = %q, want the edited text", calls[2].userText)
+	}
+	if h := calls[2].history; len(h) != 2 || h[0].Content != "giá BTC?" {
+		t.Errorf("history when regenerating = %+v, want the edited turn rolled back", h)
+	}
+	if h := calls[3].history; len(h) != 4 || h[2].Content != "giá SOL?" {
+		t.Errorf("history after the edit = %+v, want the edited question in place", h)
+	}
+
+	// The answer to message 2 was the second placeholder, 902
+	if placeholders != 2 || len(sent) != 2 {
+		t.Errorf("placeholders = %d then %d, want no new message for the edit", placeholders, len(sent))
+	}
+	if len(edits) == 0 {
+		t.Error("the previous answer was not edited")
+	}
+	for _, id := range edits {
+		if id != 902 {
+			t.Errorf("regeneration edited message %d, want 902", id)
+		}
+	}
+}
+
+func TestDispatcher_EditedQuestionWithoutEditor(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, textUpdate(1, 42, 7, "giá BTC?"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, editedUpdate(1, 42, "giá ETH?"))
+	time.Sleep(20 * time.Millisecond)
+
+	calls := chat.getCalls()
+	texts := sender.getTexts()
+	cancel()
+	d.Shutdown()
+
+	if len(calls) != 2 || len(calls[1].history) != 0 {
+		t.Fatalf("calls = %+v, want the edit answered with the turn rolled back", calls)
+	}
+	if len(texts) != 2 {
+		t.Errorf("texts = %+v, want the new answer sent as a new message", texts)
+	}
+}
+
+func TestDispatcher_EditedQuestionFails(t *testing.T) {
+	store := NewMemoryHistoryStore()
+	sender := &mockSender{}
+	chat := &failingChat{mockChat: mockChat{reply: "AI reply"}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithHistoryStore(store),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	key := ConversationKey{ChatID: 42}
+
+	step := func(update types.Update) {
+		d.Dispatch(ctx, update)
+		time.Sleep(20 * time.Millisecond)
+	}
+	step(textUpdate(1, 42, 7, "giá BTC?"))
+	chat.fail.Store(true)
+	step(editedUpdate(1, 42, "giá ETH?"))
+
+	// The stale turn is replaced by the edited question
+	saved, _ := store.Load(key)
+	if len(saved) != 1 || saved[0].Role != llm.RoleUser || saved[0].Content != "giá ETH?" {
+		t.Fatalf("saved after the failed edit = %+v, want only the edited question", saved)
+	}
+
+	// Editing it again answers it in place of the unanswered question
+	chat.fail.Store(false)
+	step(editedUpdate(1, 42, "giá SOL?"))
+	calls := chat.getCalls()
+	cancel()
+	d.Shutdown()
+
+	if len(calls) != 2 || calls[1].userText != "giá SOL?" || len(calls[1].history) != 0 {
+		t.Fatalf("calls = %+v, want the edit answered with the unanswered question rolled back", calls)
+	}
+	saved, _ = store.Load(key)
+	if len(saved) != 2 || saved[0].Content != "giá SOL?" || saved[1].Content != "AI reply" {
+		t.Errorf("saved after the second edit = %+v, want the new turn", saved)
+	}
+}
+
+func TestDispatcher_EditedLongAnswer(t *testing.T) {
+	sender := &mockEditTarget{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: strings.Repeat("a", 3000) + " " + strings.Repeat("b", 3000)}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(time.Millisecond),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	step := func(update types.Update) {
+		d.Dispatch(ctx, update)
+		time.Sleep(50 * time.Millisecond)
+	}
+	step(textUpdate(1, 42, 7, "viết bài dài"))
+	if sent := sender.getSent(); len(sent) != 2 {
+		t.Fatalf("sent %d messages, want the placeholder and one continuation", len(sent))
+	}
+
+	// The continuation 902 of the old answer is deleted, and the new one
+	// continues in 903
+	step(editedUpdate(1, 42, "viết bài ngắn"))
+	if deleted := sender.getDeleted(); len(deleted) != 1 || deleted[0] != 902 {
+		t.Fatalf("deleted = %v, want the old continuation 902", deleted)
+	}
+	for _, id := range sender.getEdited() {
+		if id != 901 {
+			t.Errorf("edited message %d, want only the first message 901", id)
+		}
+	}
+
+	step(editedUpdate(1, 42, "viết bài khác"))
+	cancel()
+	d.Shutdown()
+	if deleted := sender.getDeleted(); len(deleted) != 2 || deleted[1] != 903 {
+		t.Errorf("deleted = %v, want the new continuation 903 next", deleted)
+	}
+}
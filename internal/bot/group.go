@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// ConversationKey identifies one conversation: a chat, or a topic of a forum
+// supergroup. Each conversation has its own worker and history.
+type ConversationKey struct {
+	ChatID   int64
+	ThreadID int // forum topic, 0 outside forum topics
+}
+
+// String returns "<chat>" or "<chat>_<topic>", used to name stored histories.
+func (k ConversationKey) String() string {
+	s := strconv.FormatInt(k.ChatID, 10)
+	if k.ThreadID != 0 {
+		s += "_" + strconv.Itoa(k.ThreadID)
+	}
+	return s
+}
+
+// conversationKey returns the conversation an update belongs to. Only forum
+// topics split a chat: other supergroup messages may carry a thread ID for
+// reply threads, which share the chat's conversation.
+func conversationKey(update types.Update) ConversationKey {
+	key := ConversationKey{ChatID: extractChatID(update)}
+	if msg := extractMessage(update); msg != nil && msg.IsTopicMessage {
+		key.ThreadID = msg.MessageThreadID
+	}
+	return key
+}
+
+// extractMessage returns the message an update is about: the new or edited
+// message, or the one carrying the pressed button.
+func extractMessage(update types.Update) *types.Message {
+	switch {
+	case update.Message != nil:
+		return update.Message
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Message
+	}
+	return update.EditedMessage
+}
+
+// isGroup reports whether chat is a group or supergroup.
+func isGroup(chat types.Chat) bool {
+	return chat.Type == "group" || chat.Type == "supergroup"
+}
+
+// addressedMessage decides whether a message should be handled. Outside
+// group mode and in private chats every message is. In groups only commands
+// for this bot, replies to its messages and messages mentioning it are; the
+// mention is removed from the text the AI sees.
+func (d *Dispatcher) addressedMessage(msg *types.Message) (*types.Message, bool) {
+	if d.botUser == nil || !isGroup(msg.Chat) {
+		return msg, true
+	}
+
+	if msg.Text != "" && msg.Text[0] == '/' {
+		// "/cmd@other_bot" is for another bot in the group
+		first := strings.Fields(msg.Text)[0]
+		if i := strings.IndexByte(first, '@'); i != -1 {
+			return msg, strings.EqualFold(first[i+1:], d.botUser.Username)
+		}
+		return msg, true
+	}
+
+	text, entities := msg.Text, msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+	stripped, mentioned := d.stripMention(text, entities)
+	if !mentioned {
+		return msg, d.repliesToBot(msg)
+	}
+
+	addressed := *msg
+	if msg.Text != "" {
+		addressed.Text, addressed.Entities = stripped, nil
+	} else {
+		addressed.Caption, addressed.CaptionEntities = stripped, nil
+	}
+	return &addressed, true
+}
+
+// repliesToBot reports whether msg replies to one of the bot's messages. In
+// forum topics every message replies to the topic's creation message, which
+// does not count.
+func (d *Dispatcher) repliesToBot(msg *types.Message) bool {
+	reply := msg.ReplyToMessage
+	return reply != nil && reply.ForumTopicCreated == nil &&
+		reply.From != nil && reply.From.ID == d.botUser.ID
+}
+
+// stripMention looks for a mention of the bot in text and returns the text
+// without it. Entity offsets count UTF-16 code units. A message that is only
+// a mention is kept as is, so the AI still has something to answer.
+func (d *Dispatcher) stripMention(text string, entities []types.MessageEntity) (string, bool) {
+	units := utf16.Encode([]rune(text))
+	for _, e := range entities {
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(units) {
+			continue
+		}
+		span := string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+		mention := (e.Type == "mention" && strings.EqualFold(span, "@"+d.botUser.Username)) ||
+			(e.Type == "text_mention" && e.User != nil && e.User.ID == d.botUser.ID)
+		if !mention {
+			continue
+		}
+		before := strings.TrimRight(string(utf16.Decode(units[:e.Offset])), " ")
+		after := strings.TrimLeft(string(utf16.Decode(units[e.Offset+e.Length:])), " ,:")
+		rest := strings.TrimSpace(before + " " + after)
+		if rest == "" {
+			return text, true
+		}
+		return rest, true
+	}
+	return text, false
+}
+
+// speakerName returns how the sender of a group message is named to the AI.
+func speakerName(user *types.User) string {
+	if user == nil {
+		return ""
+	}
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		return name
+	}
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return ""
+}
+
+// attribute prefixes a group member's message with their name, so the AI
+// and later turns know who said what.
+func attribute(user llm.ChatMessage, name string) llm.ChatMessage {
+	if name == "" {
+		return user
+	}
+	user.Content = strings.TrimSpace(name + ": " + user.Content)
+	return user
+}
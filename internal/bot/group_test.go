@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+var testBot = &types.User{ID: 999, IsBot: true, FirstName: "Pocky", Username: "pocky_bot"}
+
+func groupMessage(text string) *types.Message {
+	return &types.Message{
+		ID:   1,
+		Text: text,
+		Chat: types.Chat{ID: -100, Type: "supergroup"},
+		From: &types.User{ID: 7, FirstName: "Lan"},
+	}
+}
+
+func TestAddressedMessage(t *testing.T) {
+	d := NewDispatcher(NewRouter(nil), &mockChat{}, &mockSender{}, nil, WithBotUser(testBot))
+
+	mention := groupMessage("@pocky_bot giá BTC?")
+	mention.Entities = []types.MessageEntity{{Type: "mention", Offset: 0, Length: 10}}
+
+	// Offsets count UTF-16 units: the emoji takes two
+	emoji := groupMessage("🚀 hỏi @Pocky_Bot, giá ETH?")
+	emoji.Entities = []types.MessageEntity{{Type: "mention", Offset: 7, Length: 10}}
+
+	other := groupMessage("@someone_else xem này")
+	other.Entities = []types.MessageEntity{{Type: "mention", Offset: 0, Length: 13}}
+
+	reply := groupMessage("còn ETH thì sao?")
+	reply.ReplyToMessage = &types.Message{ID: 0, From: testBot}
+
+	topicStart := groupMessage("chào cả nhà")
+	topicStart.ReplyToMessage = &types.Message{From: testBot, ForumTopicCreated: &types.ForumTopicCreated{Name: "Bot"}}
+
+	caption := groupMessage("")
+	caption.Caption = "@pocky_bot đọc biểu đồ này"
+	caption.CaptionEntities = []types.MessageEntity{{Type: "mention", Offset: 0, Length: 10}}
+
+	private := groupMessage("xin chào")
+	private.Chat = types.Chat{ID: 7, Type: "private"}
+
+	tests := []struct {
+		name     string
+		msg      *types.Message
+		want     bool
+		wantText string
+	}{
+		{"mention", mention, true, "giá BTC?"},
+		{"mention after emoji", emoji, true, "🚀 hỏi giá ETH?"},
+		{"other mention", other, false, ""},
+		{"chatter", groupMessage("hôm nay trời đẹp"), false, ""},
+		{"reply to bot", reply, true, "còn ETH thì sao?"},
+		{"topic creation is not a reply", topicStart, false, ""},
+		{"command", groupMessage("/dautu"), true, "/dautu"},
+		{"command for this bot", groupMessage("/dautu@Pocky_bot"), true, "/dautu@Pocky_bot"},
+		{"command for another bot", groupMessage("/start@other_bot"), false, ""},
+		{"caption mention", caption, true, "đọc biểu đồ này"},
+		{"private chat", private, true, "xin chào"},
+	}
+	for _, tt := range tests {
+		got, ok := d.addressedMessage(tt.msg)
+		if ok != tt.want {
+			t.Errorf("%s: addressed = %v, want %v", tt.name, ok, tt.want)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		text := got.Text
+		if text == "" {
+			text = got.Caption
+		}
+		if text != tt.wantText {
+			t.Errorf("%s: text = %q, want %q", tt.name, text, tt.wantText)
+		}
+	}
+
+	if mention.Text != "@pocky_bot giá BTC?" {
+		t.Error("addressedMessage modified the original message")
+	}
+}
+
+func TestDispatcher_GroupMode(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithBotUser(testBot),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	send := func(id int, text string, from *types.User, threadID int, entities ...types.MessageEntity) {
+		d.Dispatch(ctx, types.Update{UpdateID: id, Message: &types.Message{
+			ID:              id,
+			Text:            text,
+			Entities:        entities,
+			Chat:            types.Chat{ID: -100, Type: "supergroup", IsForum: threadID != 0},
+			From:            from,
+			MessageThreadID: threadID,
+			IsTopicMessage:  threadID != 0,
+		}})
+		time.Sleep(30 * time.Millisecond)
+	}
+	lan := &types.User{ID: 7, FirstName: "Lan"}
+	minh := &types.User{ID: 8, FirstName: "Minh", LastName: "Trần"}
+	mention := types.MessageEntity{Type: "mention", Offset: 0, Length: 10}
+
+	send(1, "chuyện riêng của nhóm", lan, 0)
+	send(2, "@pocky_bot giá BTC?", lan, 0, mention)
+	send(3, "@pocky_bot còn ETH?", minh, 0, mention)
+	send(4, "@pocky_bot chủ đề khác", lan, 5, mention)
+
+	calls := chat.getCalls()
+	cancel()
+	d.Shutdown()
+
+	if len(calls) != 3 {
+		t.Fatalf("AI calls = %d, want 3 (chatter ignored)", len(calls))
+	}
+	if calls[0].userText != "Lan: giá BTC?" {
+		t.Errorf("first turn = %q, want it attributed to Lan without the mention", calls[0].userText)
+	}
+	if h := calls[1].history; len(h) != 2 || h[0].Role != llm.RoleUser || h[0].Content != "Lan: giá BTC?" || calls[1].userText != "Minh Trần: còn ETH?" {
+		t.Errorf("second turn = %q with history %+v, want Minh's question after Lan's turn", calls[1].userText, calls[1].history)
+	}
+	if len(calls[2].history) != 0 {
+		t.Errorf("forum topic history = %+v, want a separate empty conversation", calls[2].history)
+	}
+}
+
+func TestConversationKey(t *testing.T) {
+	topic := types.Update{Message: &types.Message{Chat: types.Chat{ID: -100}, MessageThreadID: 5, IsTopicMessage: true}}
+	replyThread := types.Update{Message: &types.Message{Chat: types.Chat{ID: -100}, MessageThreadID: 5}}
+	button := types.Update{CallbackQuery: &types.CallbackQuery{Message: &types.Message{Chat: types.Chat{ID: -100}, MessageThreadID: 5, IsTopicMessage: true}}}
+
+	if got := conversationKey(topic); got != (ConversationKey{ChatID: -100, ThreadID: 5}) || got.String() != "-100_5" {
+		t.Errorf("topic key = %+v (%s)", got, got)
+	}
+	if got := conversationKey(replyThread); got != (ConversationKey{ChatID: -100}) || got.String() != "-100" {
+		t.Errorf("reply thread key = %+v (%s), want the chat", got, got)
+	}
+	if got := conversationKey(button); got.ThreadID != 5 {
+		t.Errorf("button key = %+v, want the topic", got)
+	}
+}
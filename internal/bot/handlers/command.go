@@ -39,14 +39,14 @@ func (h *CommandHandler) Start(ctx context.Context, msg *types.Message) error {
 		name = msg.From.FirstName
 	}
 
-	text := fmt.Sprintf("Xin chào %s! Mình là Pocky Bot 🤖\n\nGửi tin nhắn cho mình, mình sẽ trả lời bằng AI nhé.\n\n📋 Lệnh:\n/dautu - 💰 Xem danh mục đầu tư Spot & Futures\n/trogiup - ❓ Hướng dẫn sử dụng\n/xoa - 🗑️ Xoá lịch sử trò chuyện", name)
+	text := fmt.Sprintf("Xin chào %s! Mình là Pocky Bot 🤖\n\nGửi tin nhắn cho mình, mình sẽ trả lời bằng AI nhé.\n\n📋 Lệnh:\n/dautu - 💰 Xem danh mục đầu tư Spot & Futures\n/chiphi - 💸 Xem chi phí AI\n/huy - 🛑 Huỷ yêu cầu đang xử lý\n/trogiup - ❓ Hướng dẫn sử dụng\n/xoa - 🗑️ Xoá lịch sử trò chuyện", name)
 
 	return h.sender.SendText(ctx, msg.Chat.ID, text)
 }
 
 // Help handles the /help command.
 func (h *CommandHandler) Help(ctx context.Context, msg *types.Message) error {
-	text := "📋 Các lệnh có sẵn:\n\n🚀 /start - Bắt đầu sử dụng bot\n💰 /dautu - Xem danh mục đầu tư Spot & Futures\n❓ /trogiup - Hướng dẫn sử dụng\n🗑️ /xoa - Xoá lịch sử trò chuyện"
+	text := "📋 Các lệnh có sẵn:\n\n🚀 /start - Bắt đầu sử dụng bot\n💰 /dautu - Xem danh mục đầu tư Spot & Futures\n💸 /chiphi - Xem chi phí AI\n🛑 /huy - Huỷ yêu cầu đang xử lý\n❓ /trogiup - Hướng dẫn sử dụng\n🗑️ /xoa - Xoá lịch sử trò chuyện\n🆔 /id - Xem User ID và Chat ID"
 
 	return h.sender.SendText(ctx, msg.Chat.ID, text)
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/usage"
+)
+
+// UsageReporter summarizes AI spending.
+// Defined at the consumer side for testability.
+type UsageReporter interface {
+	Report(scope usage.Scope) usage.Report
+}
+
+// UsageHandler handles the /chiphi command.
+type UsageHandler struct {
+	sender   MessageSender
+	reporter UsageReporter
+	logger   *slog.Logger
+}
+
+// NewUsageHandler creates a new UsageHandler.
+func NewUsageHandler(sender MessageSender, reporter UsageReporter, logger *slog.Logger) *UsageHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &UsageHandler{
+		sender:   sender,
+		reporter: reporter,
+		logger:   logger,
+	}
+}
+
+// Usage handles the /chiphi command: the sender's AI spending today and this
+// month, the chat's spending in groups, the whole bot's spending and budgets.
+// Without a reporter it explains that usage tracking is disabled.
+func (h *UsageHandler) Usage(ctx context.Context, msg *types.Message) error {
+	if h.reporter == nil {
+		return h.sender.SendText(ctx, msg.Chat.ID, "💸 Tính năng theo dõi chi phí AI đang tắt.")
+	}
+
+	scope := usage.Scope{ChatID: msg.Chat.ID}
+	if msg.From != nil {
+		scope.UserID = msg.From.ID
+	}
+	r := h.reporter.Report(scope)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💸 Chi phí AI của bạn\n\n")
+	fmt.Fprintf(&b, "📅 Hôm nay (%s): %s\n", r.Day, formatTotals(r.UserToday))
+	fmt.Fprintf(&b, "🗓️ Tháng này (%s): %s\n", r.Month, formatTotals(r.UserMonth))
+
+	if models := r.Models(); len(models) > 0 {
+		b.WriteString("\n🤖 Theo model (tháng này):\n")
+		for _, model := range models {
+			fmt.Fprintf(&b, "• %s: %s\n", model, formatTotals(r.UserModels[model]))
+		}
+	}
+
+	if scope.ChatID != scope.UserID {
+		fmt.Fprintf(&b, "\n👥 Nhóm này: hôm nay %s, tháng này %s\n",
+			usage.FormatCost(r.ChatToday.Cost), usage.FormatCost(r.ChatMonth.Cost))
+	}
+	fmt.Fprintf(&b, "\n🌐 Toàn bot: hôm nay %s, tháng này %s\n",
+		usage.FormatCost(r.BotToday.Cost), usage.FormatCost(r.BotMonth.Cost))
+
+	if budgets := r.Budgets; budgets.Enabled() {
+		b.WriteString("\n🚧 Ngân sách:\n")
+		writeBudget(&b, "Bạn / ngày", r.UserToday.Cost, budgets.UserDaily)
+		writeBudget(&b, "Bạn / tháng", r.UserMonth.Cost, budgets.UserMonthly)
+		writeBudget(&b, "Bot / ngày", r.BotToday.Cost, budgets.Daily)
+		writeBudget(&b, "Bot / tháng", r.BotMonth.Cost, budgets.Monthly)
+	}
+
+	b.WriteString("\nℹ️ Chi phí là ước tính theo bảng giá model.")
+	return h.sender.SendText(ctx, msg.Chat.ID, b.String())
+}
+
+// formatTotals formats the cost, request count and token counts of t.
+func formatTotals(t usage.Totals) string {
+	return fmt.Sprintf("%s · %d lượt · %d/%d token",
+		usage.FormatCost(t.Cost), t.Requests, t.InputTokens, t.OutputTokens)
+}
+
+// writeBudget writes one budget line, skipping disabled limits.
+func writeBudget(b *strings.Builder, label string, spent, limit float64) {
+	if limit <= 0 {
+		return
+	}
+	fmt.Fprintf(b, "• %s: %s/%s\n", label, usage.FormatCost(spent), usage.FormatCost(limit))
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/usage"
+)
+
+// mockReporter returns a fixed report and records the requested scope.
+type mockReporter struct {
+	report usage.Report
+	scope  usage.Scope
+}
+
+func (m *mockReporter) Report(scope usage.Scope) usage.Report {
+	m.scope = scope
+	return m.report
+}
+
+func TestUsageHandler_Usage(t *testing.T) {
+	sender := &mockSender{}
+	reporter := &mockReporter{report: usage.Report{
+		Day:        "2026-03-15",
+		Month:      "2026-03",
+		UserToday:  usage.Totals{Requests: 2, InputTokens: 1200, OutputTokens: 300, Cost: 0.0042},
+		UserMonth:  usage.Totals{Requests: 10, Cost: 1.5},
+		UserModels: map[string]usage.Totals{"gpt-4o": {Requests: 10, Cost: 1.5}},
+		BotMonth:   usage.Totals{Cost: 3},
+		Budgets:    usage.Budgets{UserMonthly: 5},
+	}}
+	handler := NewUsageHandler(sender, reporter, nil)
+
+	msg := &types.Message{ID: 1, Chat: types.Chat{ID: -100}, From: &types.User{ID: 7}}
+	if err := handler.Usage(context.Background(), msg); err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+
+	if reporter.scope != (usage.Scope{ChatID: -100, UserID: 7}) {
+		t.Errorf("scope = %+v, want chat -100 and user 7", reporter.scope)
+	}
+	if len(sender.messages) != 1 {
+		t.Fatalf("expected 1 message sent, got %d", len(sender.messages))
+	}
+	text := sender.messages[0].text
+	for _, want := range []string{
+		"$0.0042 · 2 lượt · 1200/300 token",
+		"• gpt-4o: $1.50",
+		"👥 Nhóm này",
+		"Toàn bot: hôm nay $0.00, tháng này $3.00",
+		"• Bạn / tháng: $1.50/$5.00",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Bot / ngày") {
+		t.Errorf("text should skip disabled budgets:\n%s", text)
+	}
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/kv"
+)
+
+// HistoryStore persists per-conversation history so it survives idle worker
+// shutdown and restarts. A conversation is a chat or a forum topic. The
+// Dispatcher loads a conversation's history when it spawns its worker and
+// saves it after every turn; only that worker touches the entry, so
+// implementations need only be safe for concurrent use across different
+// conversations.
+type HistoryStore interface {
+	// Load returns the saved history of a conversation, or nil if there is none.
+	Load(key ConversationKey) ([]llm.ChatMessage, error)
+
+	// Save replaces the saved history of a conversation.
+	Save(key ConversationKey, history []llm.ChatMessage) error
+
+	// Delete removes the saved history of a conversation.
+	Delete(key ConversationKey) error
+}
+
+// MemoryHistoryStore keeps histories in memory. They survive idle worker
+// shutdown but not a restart.
+type MemoryHistoryStore struct {
+	mu    sync.Mutex
+	chats map[ConversationKey][]llm.ChatMessage
+}
+
+// NewMemoryHistoryStore creates an empty MemoryHistoryStore.
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{chats: make(map[ConversationKey][]llm.ChatMessage)}
+}
+
+// Load returns a copy of the in-memory history.
+func (s *MemoryHistoryStore) Load(key ConversationKey) ([]llm.ChatMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.ChatMessage(nil), s.chats[key]...), nil
+}
+
+// Save stores a copy of history, since the worker keeps reusing its slice.
+func (s *MemoryHistoryStore) Save(key ConversationKey, history []llm.ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats[key] = append([]llm.ChatMessage(nil), history...)
+	return nil
+}
+
+// Delete forgets the history of a conversation.
+func (s *MemoryHistoryStore) Delete(key ConversationKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chats, key)
+	return nil
+}
+
+// FileHistoryStore keeps one JSON file per conversation in a directory. Writes go
+// through a temporary file and rename so a crash never leaves a truncated
+// history behind.
+type FileHistoryStore struct {
+	dir string
+}
+
+// NewFileHistoryStore creates a FileHistoryStore writing to dir.
+// The directory is created on the first Save.
+func NewFileHistoryStore(dir string) *FileHistoryStore {
+	return &FileHistoryStore{dir: dir}
+}
+
+func (s *FileHistoryStore) path(key ConversationKey) string {
+	return filepath.Join(s.dir, key.String()+".json")
+}
+
+// Load reads the history of a conversation. A missing file yields nil.
+func (s *FileHistoryStore) Load(key ConversationKey) ([]llm.ChatMessage, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bot: failed to read history file: %w", err)
+	}
+	return decodeHistory(data)
+}
+
+// Save atomically writes the history of a conversation to disk.
+func (s *FileHistoryStore) Save(key ConversationKey, history []llm.ChatMessage) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("bot: failed to encode history: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("bot: failed to create history directory: %w", err)
+	}
+
+	path := s.path(key)
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("bot: failed to create temp history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("bot: failed to write history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("bot: failed to write history: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("bot: failed to replace history file: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the history file of a chat.
+func (s *FileHistoryStore) Delete(key ConversationKey) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("bot: failed to delete history file: %w", err)
+	}
+	return nil
+}
+
+// KVHistoryStore keeps all histories in a single embedded key-value store
+// file, keyed by conversation.
+type KVHistoryStore struct {
+	db *kv.Store
+}
+
+// NewKVHistoryStore creates a KVHistoryStore backed by db.
+func NewKVHistoryStore(db *kv.Store) *KVHistoryStore {
+	return &KVHistoryStore{db: db}
+}
+
+func historyKey(key ConversationKey) string {
+	return "history/" + key.String()
+}
+
+// Load reads the history of a conversation from the store.
+func (s *KVHistoryStore) Load(key ConversationKey) ([]llm.ChatMessage, error) {
+	data, ok, err := s.db.Get(historyKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("bot: failed to load history: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return decodeHistory(data)
+}
+
+// Save writes the history of a conversation to the store.
+func (s *KVHistoryStore) Save(key ConversationKey, history []llm.ChatMessage) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("bot: failed to encode history: %w", err)
+	}
+	if err := s.db.Put(historyKey(key), data); err != nil {
+		return fmt.Errorf("bot: failed to save history: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the history of a conversation from the store.
+func (s *KVHistoryStore) Delete(key ConversationKey) error {
+	if err := s.db.Delete(historyKey(key)); err != nil {
+		return fmt.Errorf("bot: failed to delete history: %w", err)
+	}
+	return nil
+}
+
+func decodeHistory(data []byte) ([]llm.ChatMessage, error) {
+	var history []llm.ChatMessage
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("bot: invalid history: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/kv"
+)
+
+func testHistoryStore(t *testing.T, store HistoryStore) {
+	t.Helper()
+
+	history, err := store.Load(ConversationKey{ChatID: 42})
+	if err != nil || len(history) != 0 {
+		t.Fatalf("Load() on empty store = %v, %v; want nothing", history, err)
+	}
+
+	want := []llm.ChatMessage{
+		{Role: llm.RoleUser, Content: "hello"},
+		{Role: llm.RoleAssistant, Content: "hi there"},
+	}
+	if err := store.Save(ConversationKey{ChatID: 42}, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	history, err = store.Load(ConversationKey{ChatID: 42})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Content != "hello" || history[1].Role != llm.RoleAssistant {
+		t.Errorf("Load() = %+v, want saved history", history)
+	}
+
+	// Other chats are independent
+	if other, _ := store.Load(ConversationKey{ChatID: 7}); len(other) != 0 {
+		t.Errorf("Load(7) = %+v, want empty", other)
+	}
+
+	if err := store.Delete(ConversationKey{ChatID: 42}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if history, _ := store.Load(ConversationKey{ChatID: 42}); len(history) != 0 {
+		t.Errorf("Load() after Delete = %+v, want empty", history)
+	}
+	if err := store.Delete(ConversationKey{ChatID: 42}); err != nil {
+		t.Errorf("Delete() of missing history error = %v", err)
+	}
+}
+
+func TestMemoryHistoryStore(t *testing.T) {
+	testHistoryStore(t, NewMemoryHistoryStore())
+}
+
+func TestMemoryHistoryStore_Copies(t *testing.T) {
+	store := NewMemoryHistoryStore()
+	history := []llm.ChatMessage{{Role: llm.RoleUser, Content: "a"}}
+	store.Save(ConversationKey{ChatID: 1}, history)
+	history[0].Content = "changed"
+
+	saved, _ := store.Load(ConversationKey{ChatID: 1})
+	if saved[0].Content != "a" {
+		t.Error("Save() should copy the worker's slice")
+	}
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	testHistoryStore(t, NewFileHistoryStore(dir))
+
+	// No temp files left behind
+	NewFileHistoryStore(dir).Save(ConversationKey{ChatID: 1}, []llm.ChatMessage{{Role: llm.RoleUser, Content: "x"}})
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "1.json" {
+		t.Errorf("history dir = %v, want only 1.json", entries)
+	}
+}
+
+func TestFileHistoryStore_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "5.json"), []byte("{not json"), 0o644)
+
+	if _, err := NewFileHistoryStore(dir).Load(ConversationKey{ChatID: 5}); err == nil {
+		t.Error("Load() should fail on a corrupt history file")
+	}
+}
+
+func TestKVHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.kv")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHistoryStore(t, NewKVHistoryStore(db))
+
+	// Survives reopening
+	NewKVHistoryStore(db).Save(ConversationKey{ChatID: 3}, []llm.ChatMessage{{Role: llm.RoleUser, Content: "persisted"}})
+	db.Close()
+
+	db, _ = kv.Open(path)
+	defer db.Close()
+	history, _ := NewKVHistoryStore(db).Load(ConversationKey{ChatID: 3})
+	if len(history) != 1 || history[0].Content != "persisted" {
+		t.Errorf("Load() after reopen = %+v", history)
+	}
+}
+
+func TestDispatcher_HistoryStore(t *testing.T) {
+	store := NewMemoryHistoryStore()
+	store.Save(ConversationKey{ChatID: 42}, []llm.ChatMessage{
+		{Role: llm.RoleUser, Content: "earlier question"},
+		{Role: llm.RoleAssistant, Content: "earlier answer"},
+	})
+
+	sender := &mockSender{}
+	chat := &mockChat{reply: "AI reply"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(50*time.Millisecond),
+		WithHistoryStore(store),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{Message: &types.Message{ID: 1, Text: "new question", Chat: types.Chat{ID: 42}}})
+	time.Sleep(150 * time.Millisecond)
+
+	calls := chat.getCalls()
+	if len(calls) != 1 || len(calls[0].history) != 2 || calls[0].history[0].Content != "earlier question" {
+		t.Fatalf("calls = %+v, want the worker to start from the stored history", calls)
+	}
+
+	saved, _ := store.Load(ConversationKey{ChatID: 42})
+	if len(saved) != 4 || saved[2].Content != "new question" || saved[3].Content != "AI reply" {
+		t.Errorf("saved = %+v, want the new turn persisted", saved)
+	}
+
+	// The worker has gone idle; /xoa from a fresh worker clears the store
+	d.Dispatch(ctx, types.Update{Message: &types.Message{ID: 2, Text: "/xoa", Chat: types.Chat{ID: 42}}})
+	time.Sleep(20 * time.Millisecond)
+
+	if saved, _ := store.Load(ConversationKey{ChatID: 42}); len(saved) != 0 {
+		t.Errorf("saved after /xoa = %+v, want empty", saved)
+	}
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// FileDownloader is implemented by senders that can download files sent to
+// the bot. It enables image understanding.
+type FileDownloader interface {
+	DownloadFile(ctx context.Context, fileID string) ([]byte, error)
+}
+
+// imagePlaceholder replaces an image in the stored history. Image bytes are
+// not kept: every later turn would resend (and pay for) them.
+const imagePlaceholder = "[photo]"
+
+const (
+	imageUnsupportedReply = "🖼️ Bot chưa hỗ trợ đọc ảnh."
+	imageFailedReply      = "🖼️ Không tải được ảnh, vui lòng thử lại."
+	imageTooLargeReply    = "🖼️ Ảnh quá lớn (tối đa 20 MB), vui lòng gửi ảnh nhỏ hơn."
+)
+
+// imageFileID returns the file to download for a photo message, or for an
+// image sent as a file (uncompressed screenshots). Of the sizes of a photo,
+// the largest one bots may download is picked. ok is false if msg has no
+// image; fileID is "" if it has one that is too large to download.
+func imageFileID(msg *types.Message) (fileID string, ok bool) {
+	if len(msg.Photo) > 0 {
+		// Sizes are ordered from smallest to largest
+		for i := len(msg.Photo) - 1; i >= 0; i-- {
+			if msg.Photo[i].FileSize <= telegram.MaxDownloadSize {
+				return msg.Photo[i].FileID, true
+			}
+		}
+		return "", true
+	}
+	if doc := msg.Document; doc != nil && strings.HasPrefix(doc.MimeType, "image/") {
+		if doc.FileSize > telegram.MaxDownloadSize {
+			return "", true
+		}
+		return doc.FileID, true
+	}
+	return "", false
+}
+
+// imageMessage downloads the image of msg and returns it as a multi-part user
+// message with the caption as text. fileID is "" for an image too large to
+// download. If the image cannot be used, the user is told and ok is false.
+func (d *Dispatcher) imageMessage(ctx context.Context, chatID int64, msg *types.Message, fileID string) (user llm.ChatMessage, ok bool) {
+	downloader, canDownload := d.sender.(FileDownloader)
+	_, canSee := d.chat.(MessageChatCompleter)
+	if !canDownload || !canSee {
+		_ = d.sender.SendText(ctx, chatID, imageUnsupportedReply)
+		return user, false
+	}
+	if fileID == "" {
+		_ = d.sender.SendText(ctx, chatID, imageTooLargeReply)
+		return user, false
+	}
+
+	_ = d.sender.SendChatAction(ctx, chatID, "typing")
+
+	data, err := downloader.DownloadFile(ctx, fileID)
+	if err != nil {
+		LoggerFromContext(ctx, d.logger).Warn("image download failed",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+		_ = d.sender.SendText(ctx, chatID, imageFailedReply)
+		return user, false
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		// Telegram re-encodes photos as JPEG
+		mimeType = "image/jpeg"
+	}
+
+	return llm.ChatMessage{
+		Role:    llm.RoleUser,
+		Content: msg.Caption,
+		Images:  []llm.Image{{MimeType: mimeType, Data: data}},
+	}, true
+}
+
+// historyMessage returns the form of a user message kept in history, with
+// images replaced by a text marker.
+func historyMessage(user llm.ChatMessage) llm.ChatMessage {
+	if len(user.Images) == 0 {
+		return user
+	}
+	content := imagePlaceholder
+	if user.Content != "" {
+		content += " " + user.Content
+	}
+	return llm.ChatMessage{Role: llm.RoleUser, Content: content}
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// pngHeader is enough for content type detection.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// mockDownloadSender is a mockSender that can download files.
+type mockDownloadSender struct {
+	mockSender
+	files map[string][]byte
+}
+
+func (m *mockDownloadSender) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	data, ok := m.files[fileID]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return data, nil
+}
+
+// mockVisionChat implements MessageChatCompleter.
+type mockVisionChat struct {
+	mockChat
+	mu   sync.Mutex
+	msgs []llm.ChatMessage
+}
+
+func (m *mockVisionChat) GenerateMessageResponse(ctx context.Context, history []llm.ChatMessage, msg llm.ChatMessage, onPartial func(text string)) (string, error) {
+	m.mu.Lock()
+	m.msgs = append(m.msgs, msg)
+	m.mu.Unlock()
+	return m.GenerateResponse(ctx, history, msg.Content)
+}
+
+func photoUpdate(id int, caption string, fileID string) types.Update {
+	return types.Update{
+		UpdateID: id,
+		Message: &types.Message{
+			ID:      id,
+			Chat:    types.Chat{ID: 42, Type: "private"},
+			Caption: caption,
+			Photo: []types.PhotoSize{
+				{FileID: "thumb", Width: 90, Height: 60},
+				{FileID: fileID, Width: 1280, Height: 853},
+			},
+		},
+	}
+}
+
+func TestDispatcher_PhotoWithCaption(t *testing.T) {
+	sender := &mockDownloadSender{files: map[string][]byte{"large": pngHeader}}
+	chat := &mockVisionChat{mockChat: mockChat{reply: "Biểu đồ BTC đang tăng"}}
+	store := NewMemoryHistoryStore()
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second), WithHistoryStore(store))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, photoUpdate(1, "chart này thế nào?", "large"))
+	time.Sleep(50 * time.Millisecond)
+	d.Dispatch(ctx, types.Update{UpdateID: 2, Message: &types.Message{ID: 2, Text: "còn ETH?", Chat: types.Chat{ID: 42}}})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	d.Shutdown()
+
+	if len(chat.msgs) != 2 {
+		t.Fatalf("got %d AI calls, want 2", len(chat.msgs))
+	}
+	first := chat.msgs[0]
+	if first.Content != "chart này thế nào?" || len(first.Images) != 1 {
+		t.Fatalf("first message = %+v, want caption and image", first)
+	}
+	if img := first.Images[0]; img.MimeType != "image/png" || string(img.Data) != string(pngHeader) {
+		t.Errorf("image = %s %q, want the largest photo size as image/png", img.MimeType, img.Data)
+	}
+
+	// The follow-up turn sees the photo as a text marker, not the bytes
+	history := chat.getCalls()[1].history
+	if len(history) != 2 || history[0].Content != "[photo] chart này thế nào?" || len(history[0].Images) != 0 {
+		t.Errorf("history = %+v, want the image replaced by a marker", history)
+	}
+}
+
+func TestDispatcher_PhotoErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender MessageSender
+		chat   ChatCompleter
+		want   string
+	}{
+		{"no downloader", &mockSender{}, &mockVisionChat{}, imageUnsupportedReply},
+		{"text-only completer", &mockDownloadSender{files: map[string][]byte{"large": pngHeader}}, &mockChat{}, imageUnsupportedReply},
+		{"download fails", &mockDownloadSender{}, &mockVisionChat{}, imageFailedReply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDispatcher(NewRouter(nil), tt.chat, tt.sender, nil, WithIdleTTL(time.Second))
+			ctx, cancel := context.WithCancel(context.Background())
+			d.Dispatch(ctx, photoUpdate(1, "", "large"))
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			d.Shutdown()
+
+			var texts []mockText
+			switch s := tt.sender.(type) {
+			case *mockSender:
+				texts = s.getTexts()
+			case *mockDownloadSender:
+				texts = s.getTexts()
+			}
+			if len(texts) != 1 || texts[0].text != tt.want {
+				t.Errorf("texts = %+v, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_PhotoTooLarge(t *testing.T) {
+	sender := &mockDownloadSender{files: map[string][]byte{"large": pngHeader}}
+	chat := &mockVisionChat{}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	update := photoUpdate(1, "", "large")
+	for i := range update.Message.Photo {
+		update.Message.Photo[i].FileSize = 30 << 20
+	}
+	d.Dispatch(ctx, update)
+	time.Sleep(50 * time.Millisecond)
+
+	texts := sender.getTexts()
+	if len(texts) != 1 || texts[0].text != imageTooLargeReply {
+		t.Errorf("texts = %+v, want %q", texts, imageTooLargeReply)
+	}
+	if calls := chat.getCalls(); len(calls) != 0 {
+		t.Errorf("AI called %d times, want 0", len(calls))
+	}
+}
+
+func TestImageFileID(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    types.Message
+		want   string
+		wantOK bool
+	}{
+		{"text", types.Message{Text: "hi"}, "", false},
+		{"photo", types.Message{Photo: []types.PhotoSize{{FileID: "s"}, {FileID: "l"}}}, "l", true},
+		{"largest photo too large", types.Message{Photo: []types.PhotoSize{
+			{FileID: "s", FileSize: 1 << 20},
+			{FileID: "m", FileSize: 10 << 20},
+			{FileID: "l", FileSize: 30 << 20},
+		}}, "m", true},
+		{"every photo too large", types.Message{Photo: []types.PhotoSize{{FileID: "l", FileSize: 30 << 20}}}, "", true},
+		{"image document", types.Message{Document: &types.Document{FileID: "d", MimeType: "image/png"}}, "d", true},
+		{"pdf document", types.Message{Document: &types.Document{FileID: "d", MimeType: "application/pdf"}}, "", false},
+		{"too large", types.Message{Document: &types.Document{FileID: "d", MimeType: "image/png", FileSize: 50 << 20}}, "", true},
+	}
+	for _, tt := range tests {
+		got, ok := imageFileID(&tt.msg)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: imageFileID() = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
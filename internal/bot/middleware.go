@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// Middleware wraps an UpdateHandler with cross-cutting behavior such as
+// logging, authorization or panic recovery.
+type Middleware func(next UpdateHandler) UpdateHandler
+
+// chain wraps h with mws so that mws[0] is the outermost middleware.
+func chain(h UpdateHandler, mws []Middleware) UpdateHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// loggerKey is the context key for the request-scoped logger.
+type loggerKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying logger.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the request-scoped logger stored by the Logging
+// middleware, or fallback if there is none.
+func LoggerFromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// Logging returns a middleware that derives a request-scoped logger with the
+// update_id and chat_id attributes, stores it in the context and logs how
+// each update was handled.
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update types.Update) error {
+			scoped := logger.With(
+				slog.Int("update_id", update.UpdateID),
+				slog.Int64("chat_id", extractChatID(update)),
+			)
+			ctx = ContextWithLogger(ctx, scoped)
+
+			start := time.Now()
+			scoped.Debug("handling update")
+
+			err := next(ctx, update)
+			if err != nil {
+				scoped.Warn("update handler failed",
+					slog.Duration("duration", time.Since(start)),
+					slog.String("error", err.Error()),
+				)
+				return err
+			}
+
+			scoped.Debug("update handled",
+				slog.Duration("duration", time.Since(start)),
+			)
+			return nil
+		}
+	}
+}
+
+// TextSender sends a plain text message to a chat.
+type TextSender interface {
+	SendText(ctx context.Context, chatID int64, text string) error
+}
+
+// panicReply is sent to the chat when a handler panics.
+const panicReply = "⚠️ Đã xảy ra lỗi, vui lòng thử lại sau."
+
+// Recover returns a middleware that turns a panic in the handler into an
+// error, logs it with the stack trace and tells the chat something went wrong.
+func Recover(sender TextSender, logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update types.Update) (err error) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				err = fmt.Errorf("bot: panic handling update %d: %v", update.UpdateID, rec)
+				LoggerFromContext(ctx, logger).Error("recovered from panic",
+					slog.Int("update_id", update.UpdateID),
+					slog.Any("panic", rec),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				if chatID := extractChatID(update); chatID != 0 && sender != nil {
+					_ = sender.SendText(ctx, chatID, panicReply)
+				}
+			}()
+
+			return next(ctx, update)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// tagMiddleware records its name before and after calling next.
+func tagMiddleware(name string, trace *[]string) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return func(ctx context.Context, update types.Update) error {
+			*trace = append(*trace, name+">")
+			err := next(ctx, update)
+			*trace = append(*trace, "<"+name)
+			return err
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var trace []string
+	h := chain(func(ctx context.Context, update types.Update) error {
+		trace = append(trace, "handler")
+		return nil
+	}, []Middleware{tagMiddleware("a", &trace), tagMiddleware("b", &trace)})
+
+	h(context.Background(), types.Update{})
+
+	if got := strings.Join(trace, " "); got != "a> b> handler <b <a" {
+		t.Errorf("trace = %q, want first middleware outermost", got)
+	}
+}
+
+func TestRouterUseAndGroup(t *testing.T) {
+	var trace []string
+	router := NewRouter(nil)
+	router.Use(tagMiddleware("router", &trace))
+
+	admin := router.Group(tagMiddleware("group", &trace))
+	admin.RegisterCommand("admin", func(ctx context.Context, msg *types.Message) error {
+		trace = append(trace, "admin")
+		return nil
+	})
+	router.RegisterCommand("start", func(ctx context.Context, msg *types.Message) error {
+		trace = append(trace, "start")
+		return nil
+	})
+
+	router.Handle(context.Background(), types.Update{Message: &types.Message{Text: "/admin", Chat: types.Chat{ID: 1}}})
+	if got := strings.Join(trace, " "); got != "router> group> admin <group <router" {
+		t.Errorf("group trace = %q", got)
+	}
+
+	trace = nil
+	router.Handle(context.Background(), types.Update{Message: &types.Message{Text: "/start", Chat: types.Chat{ID: 1}}})
+	if got := strings.Join(trace, " "); got != "router> start <router" {
+		t.Errorf("ungrouped trace = %q, group middleware should not apply", got)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	h := Logging(logger)(func(ctx context.Context, update types.Update) error {
+		LoggerFromContext(ctx, nil).Info("inside handler")
+		return nil
+	})
+	h(context.Background(), types.Update{
+		UpdateID: 77,
+		Message:  &types.Message{Chat: types.Chat{ID: 42}},
+	})
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, "update_id=77") || !strings.Contains(line, "chat_id=42") {
+			t.Errorf("log line missing request attributes: %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), "inside handler") {
+		t.Error("handler should log through the request-scoped logger")
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	sender := &mockSender{}
+	h := Recover(sender, nil)(func(ctx context.Context, update types.Update) error {
+		panic("boom")
+	})
+
+	err := h(context.Background(), types.Update{
+		UpdateID: 5,
+		Message:  &types.Message{Chat: types.Chat{ID: 42}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("error = %v, want panic converted to error", err)
+	}
+
+	texts := sender.getTexts()
+	if len(texts) != 1 || texts[0].text != panicReply || texts[0].chatID != 42 {
+		t.Errorf("texts = %v, want friendly error sent to chat 42", texts)
+	}
+}
+
+// panicChat panics on the first call and replies afterwards.
+type panicChat struct {
+	mockChat
+	panicked bool
+}
+
+func (p *panicChat) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
+	if !p.panicked {
+		p.panicked = true
+		panic("provider bug")
+	}
+	return p.mockChat.GenerateResponse(ctx, history, userText)
+}
+
+func TestDispatcher_MiddlewareRecoversWorker(t *testing.T) {
+	sender := &mockSender{}
+	chat := &panicChat{mockChat: mockChat{reply: "ok"}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithMiddleware(Recover(sender, nil)),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{UpdateID: 1, Message: &types.Message{ID: 1, Text: "a", Chat: types.Chat{ID: 42}}})
+	d.Dispatch(ctx, types.Update{UpdateID: 2, Message: &types.Message{ID: 2, Text: "b", Chat: types.Chat{ID: 42}}})
+	time.Sleep(100 * time.Millisecond)
+
+	texts := sender.getTexts()
+	if len(texts) != 2 || texts[0].text != panicReply || texts[1].text != "ok" {
+		t.Errorf("texts = %v, want panic reply then normal reply from the same worker", texts)
+	}
+}
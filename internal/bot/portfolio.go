@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// portfolioCallbackPrefix prefixes the callback data of /dautu buttons.
+const portfolioCallbackPrefix = "dautu:"
+
+// portfolioScope selects which part of the Binance portfolio /dautu shows.
+type portfolioScope string
+
+const (
+	portfolioAll     portfolioScope = "all"
+	portfolioSpot    portfolioScope = "spot"
+	portfolioFutures portfolioScope = "futures"
+)
+
+// portfolioPrompts are the AI prompts behind /dautu and its buttons.
+var portfolioPrompts = map[portfolioScope]string{
+	portfolioAll: "Hiển thị tổng quan danh mục đầu tư Binance của tôi, bao gồm cả Spot và Futures:\n" +
+		"1. Spot: liệt kê từng tài sản với giá trị USDT, tổng giá trị portfolio, và % lãi/lỗ 24h.\n" +
+		"2. Futures: tổng số dư ví, lãi/lỗ chưa thực hiện, margin khả dụng, tất cả vị thế đang mở (giá vào, giá mark, P&L, đòn bẩy, giá thanh lý), và các lệnh đang chờ.\n" +
+		"Dùng các tool có sẵn để lấy dữ liệu realtime.",
+	portfolioSpot: "Hiển thị danh mục Spot Binance của tôi: liệt kê từng tài sản với giá trị USDT, tổng giá trị portfolio, và % lãi/lỗ 24h.\n" +
+		"Dùng các tool có sẵn để lấy dữ liệu realtime.",
+	portfolioFutures: "Hiển thị tài khoản Futures Binance của tôi: tổng số dư ví, lãi/lỗ chưa thực hiện, margin khả dụng, tất cả vị thế đang mở (giá vào, giá mark, P&L, đòn bẩy, giá thanh lý), và các lệnh đang chờ.\n" +
+		"Dùng các tool có sẵn để lấy dữ liệu realtime.",
+}
+
+// parsePortfolioCallback extracts the scope from /dautu button data.
+func parsePortfolioCallback(data string) (portfolioScope, bool) {
+	if !strings.HasPrefix(data, portfolioCallbackPrefix) {
+		return "", false
+	}
+	scope := portfolioScope(strings.TrimPrefix(data, portfolioCallbackPrefix))
+	if _, ok := portfolioPrompts[scope]; !ok {
+		return "", false
+	}
+	return scope, true
+}
+
+// portfolioKeyboard returns the buttons attached to a /dautu answer.
+// Refresh repeats the scope of the answer it is attached to.
+func portfolioKeyboard(scope portfolioScope) *types.InlineKeyboardMarkup {
+	return &types.InlineKeyboardMarkup{
+		InlineKeyboard: [][]types.InlineKeyboardButton{
+			{
+				{Text: "Spot only", CallbackData: portfolioCallbackPrefix + string(portfolioSpot)},
+				{Text: "Futures only", CallbackData: portfolioCallbackPrefix + string(portfolioFutures)},
+			},
+			{
+				{Text: "🔄 Refresh", CallbackData: portfolioCallbackPrefix + string(scope)},
+			},
+		},
+	}
+}
+
+// withPortfolioKeyboard is the send option attaching portfolioKeyboard.
+func withPortfolioKeyboard(scope portfolioScope) telegram.SendOption {
+	return telegram.WithReplyMarkup(portfolioKeyboard(scope))
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// RequestKind separates expensive updates, answered by the AI, from cheap
+// ones such as commands, so they can be limited independently.
+type RequestKind int
+
+const (
+	// RequestCommand is a command, button or other update that does not
+	// reach the AI.
+	RequestCommand RequestKind = iota
+	// RequestAI is an update answered by the AI.
+	RequestAI
+)
+
+func (k RequestKind) String() string {
+	if k == RequestAI {
+		return "ai"
+	}
+	return "command"
+}
+
+// RateLimit is a token bucket: up to Burst requests at once, refilled by one
+// request every Interval. A zero Burst or Interval disables the limit.
+type RateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Burst > 0 && l.Interval > 0
+}
+
+// RateLimits configures the buckets of a RateLimiter. Each user and each chat
+// has its own bucket per request kind; a request needs a token from both.
+type RateLimits struct {
+	UserAI      RateLimit
+	ChatAI      RateLimit
+	UserCommand RateLimit
+	ChatCommand RateLimit
+}
+
+// bucketKey identifies one token bucket.
+type bucketKey struct {
+	kind RequestKind
+	chat bool // chat bucket, not user bucket
+	id   int64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// warnedUntil suppresses repeated "slow down" replies while the sender
+	// keeps being rejected.
+	warnedUntil time.Time
+}
+
+// sweepInterval is how often full buckets are forgotten.
+const sweepInterval = time.Minute
+
+// RateLimiter enforces RateLimits with one token bucket per user and per
+// chat. It is safe for concurrent use.
+type RateLimiter struct {
+	limits RateLimits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a RateLimiter.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// limitFor returns the limit of a bucket.
+func (r *RateLimiter) limitFor(key bucketKey) RateLimit {
+	switch {
+	case key.kind == RequestAI && key.chat:
+		return r.limits.ChatAI
+	case key.kind == RequestAI:
+		return r.limits.UserAI
+	case key.chat:
+		return r.limits.ChatCommand
+	default:
+		return r.limits.UserCommand
+	}
+}
+
+// Allow takes a token for a request of kind from userID in chatID. If either
+// bucket is empty nothing is taken, wait is how long until the request would
+// be allowed, and warn reports whether this is the first rejection since the
+// sender was last told to slow down.
+func (r *RateLimiter) Allow(kind RequestKind, userID, chatID int64) (wait time.Duration, warn bool) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+
+	keys := []bucketKey{{kind: kind, chat: true, id: chatID}}
+	if userID != 0 {
+		keys = append(keys, bucketKey{kind: kind, id: userID})
+	}
+
+	var limited []*tokenBucket
+	for _, key := range keys {
+		limit := r.limitFor(key)
+		if !limit.enabled() {
+			continue
+		}
+		b := r.refill(key, limit, now)
+		if b.tokens >= 1 {
+			continue
+		}
+		if w := time.Duration((1 - b.tokens) * float64(limit.Interval)); w > wait {
+			wait = w
+		}
+		limited = append(limited, b)
+	}
+
+	if wait > 0 {
+		warn = true
+		for _, b := range limited {
+			if now.Before(b.warnedUntil) {
+				warn = false
+			}
+		}
+		for _, b := range limited {
+			b.warnedUntil = now.Add(wait)
+		}
+		return wait, warn
+	}
+
+	for _, key := range keys {
+		if b, ok := r.buckets[key]; ok {
+			b.tokens--
+		}
+	}
+	return 0, false
+}
+
+// refill returns the bucket of key, topped up for the time since it was last
+// used. Callers hold r.mu.
+func (r *RateLimiter) refill(key bucketKey, limit RateLimit, now time.Time) *tokenBucket {
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		r.buckets[key] = b
+		return b
+	}
+	elapsed := now.Sub(b.last)
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+float64(elapsed)/float64(limit.Interval))
+	b.last = now
+	return b
+}
+
+// sweep forgets buckets that have refilled completely, since a new bucket is
+// equivalent. Callers hold r.mu.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for key, b := range r.buckets {
+		limit := r.limitFor(key)
+		full := b.last.Add(time.Duration((float64(limit.Burst) - b.tokens) * float64(limit.Interval)))
+		if !now.Before(full) && !now.Before(b.warnedUntil) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// requestKind classifies an update for rate limiting.
+func requestKind(update types.Update) RequestKind {
+	if cq := update.CallbackQuery; cq != nil {
+		if _, ok := parsePortfolioCallback(cq.Data); ok {
+			return RequestAI
+		}
+		return RequestCommand
+	}
+
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil {
+		return RequestCommand
+	}
+	if msg.Text != "" && msg.Text[0] == '/' {
+		switch extractCommand(msg.Text) {
+		case "dautu", "dautư":
+			return RequestAI
+		}
+		return RequestCommand
+	}
+	return RequestAI
+}
+
+// rateLimitedReply tells the user how long to wait.
+func rateLimitedReply(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	return fmt.Sprintf("🐢 Bạn gửi hơi nhanh, vui lòng thử lại sau %d giây.", seconds)
+}
+
+// rejectRateLimited logs a rate-limited update and tells the sender when to
+// retry: button presses get a notification on the button, messages get a
+// reply unless the sender was already warned.
+func (d *Dispatcher) rejectRateLimited(ctx context.Context, chatID int64, userID int64, update types.Update, kind RequestKind, wait time.Duration, warn bool) {
+	d.logger.Info("rate limited",
+		slog.Int64("chat_id", chatID),
+		slog.Int64("user_id", userID),
+		slog.Int("update_id", update.UpdateID),
+		slog.String("kind", kind.String()),
+		slog.Duration("retry_after", wait),
+	)
+
+	if cq := update.CallbackQuery; cq != nil {
+		d.router.answerCallback(ctx, cq, rateLimitedReply(wait))
+		return
+	}
+	if warn {
+		_ = d.sender.SendText(ctx, chatID, rateLimitedReply(wait))
+	}
+}
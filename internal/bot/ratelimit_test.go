@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(RateLimits{
+		UserAI:      RateLimit{Burst: 2, Interval: 10 * time.Second},
+		UserCommand: RateLimit{Burst: 1, Interval: time.Second},
+	})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if wait, _ := l.Allow(RequestAI, 1, 1); wait != 0 {
+			t.Fatalf("request %d: wait = %v, want the burst allowed", i, wait)
+		}
+	}
+	wait, warn := l.Allow(RequestAI, 1, 1)
+	if wait != 10*time.Second || !warn {
+		t.Errorf("Allow() = %v, %v; want 10s and a warning", wait, warn)
+	}
+	if _, warn := l.Allow(RequestAI, 1, 1); warn {
+		t.Error("repeated rejections should not warn again")
+	}
+
+	// Other users and cheap commands have their own buckets
+	if wait, _ := l.Allow(RequestAI, 2, 2); wait != 0 {
+		t.Errorf("other user wait = %v, want 0", wait)
+	}
+	if wait, _ := l.Allow(RequestCommand, 1, 1); wait != 0 {
+		t.Errorf("command wait = %v, want 0", wait)
+	}
+
+	// One token refills per interval
+	now = now.Add(4 * time.Second)
+	if wait, _ := l.Allow(RequestAI, 1, 1); wait != 6*time.Second {
+		t.Errorf("wait after 4s = %v, want 6s", wait)
+	}
+	now = now.Add(6 * time.Second)
+	if wait, _ := l.Allow(RequestAI, 1, 1); wait != 0 {
+		t.Errorf("wait after refill = %v, want 0", wait)
+	}
+}
+
+func TestRateLimiter_ChatBucket(t *testing.T) {
+	l := NewRateLimiter(RateLimits{
+		UserAI: RateLimit{Burst: 5, Interval: time.Minute},
+		ChatAI: RateLimit{Burst: 2, Interval: time.Minute},
+	})
+
+	l.Allow(RequestAI, 1, -100)
+	l.Allow(RequestAI, 2, -100)
+	if wait, _ := l.Allow(RequestAI, 3, -100); wait == 0 {
+		t.Error("a third user in the same chat should hit the chat limit")
+	}
+
+	// A rejection takes no token from the user's own bucket
+	for i := 0; i < 5; i++ {
+		if wait, _ := l.Allow(RequestAI, 3, int64(i+1)); wait != 0 {
+			t.Fatalf("request %d in another chat: wait = %v, want 0", i, wait)
+		}
+	}
+}
+
+func TestRequestKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		update types.Update
+		want   RequestKind
+	}{
+		{"text", types.Update{Message: &types.Message{Text: "hello"}}, RequestAI},
+		{"photo", types.Update{Message: &types.Message{Photo: []types.PhotoSize{{FileID: "p"}}}}, RequestAI},
+		{"help", types.Update{Message: &types.Message{Text: "/trogiup"}}, RequestCommand},
+		{"portfolio", types.Update{Message: &types.Message{Text: "/dautu@pocky_bot"}}, RequestAI},
+		{"portfolio button", types.Update{CallbackQuery: &types.CallbackQuery{Data: portfolioCallbackPrefix + "spot"}}, RequestAI},
+		{"other button", types.Update{CallbackQuery: &types.CallbackQuery{Data: "page:2"}}, RequestCommand},
+	}
+	for _, tt := range tests {
+		if got := requestKind(tt.update); got != tt.want {
+			t.Errorf("%s: requestKind() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcher_RateLimited(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "reply"}
+	limiter := NewRateLimiter(RateLimits{UserAI: RateLimit{Burst: 1, Interval: time.Minute}})
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithRateLimiter(limiter),
+		WithAccessPolicy(NewAccessPolicy([]int64{7}, nil, []int64{1})),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	message := func(id int, userID int64) types.Update {
+		return types.Update{UpdateID: id, Message: &types.Message{
+			ID:   id,
+			Text: "hello",
+			Chat: types.Chat{ID: userID, Type: "private"},
+			From: &types.User{ID: userID},
+		}}
+	}
+	for i := 1; i <= 3; i++ {
+		d.Dispatch(ctx, message(i, 7))
+		d.Dispatch(ctx, message(10+i, 1)) // admin
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	d.Shutdown()
+
+	if calls := len(chat.getCalls()); calls != 4 {
+		t.Errorf("AI calls = %d, want 1 for the user and 3 for the admin", calls)
+	}
+	var warnings int
+	for _, text := range sender.getTexts() {
+		if text.chatID == 7 && text.text == rateLimitedReply(time.Minute) {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("rate limit warnings = %d, want exactly 1: %+v", warnings, sender.getTexts())
+	}
+}
+
+func TestDispatcher_DeniedUsersTakeNoTokens(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockChat{reply: "reply"}
+	limiter := NewRateLimiter(RateLimits{ChatAI: RateLimit{Burst: 1, Interval: time.Minute}})
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithRateLimiter(limiter),
+		WithAccessPolicy(NewAccessPolicy([]int64{7}, nil, nil)),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	message := func(id int, userID int64, text string) types.Update {
+		return types.Update{UpdateID: id, Message: &types.Message{
+			ID:   id,
+			Text: text,
+			Chat: types.Chat{ID: -100, Type: "group"},
+			From: &types.User{ID: userID},
+		}}
+	}
+	// A stranger floods the group the allowed user talks to the bot in
+	for i := 1; i <= 5; i++ {
+		d.Dispatch(ctx, message(i, 666, "hello"))
+	}
+	d.Dispatch(ctx, message(10, 7, "hello"))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	d.Shutdown()
+
+	if calls := len(chat.getCalls()); calls != 1 {
+		t.Errorf("AI calls = %d, want the allowed user served", calls)
+	}
+	for _, text := range sender.getTexts() {
+		if text.text != accessDeniedReply && text.text != "reply" {
+			t.Errorf("unexpected reply %q, want only access denials for the stranger", text.text)
+		}
+	}
+}
+
+func TestDispatcher_CancelNotRateLimited(t *testing.T) {
+	sender := &mockSender{}
+	chat := &mockBlockingChat{}
+	limiter := NewRateLimiter(RateLimits{
+		UserAI:      RateLimit{Burst: 1, Interval: time.Minute},
+		UserCommand: RateLimit{Burst: 1, Interval: time.Minute},
+	})
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithRateLimiter(limiter),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The user used up both buckets, then stops the slow request
+	d.Dispatch(ctx, textUpdate(1, 42, 7, "slow question"))
+	d.Dispatch(ctx, textUpdate(2, 42, 7, "/start"))
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(ctx, textUpdate(3, 42, 7, "/huy"))
+	time.Sleep(20 * time.Millisecond)
+
+	texts := sender.getTexts()
+	cancel()
+	d.Shutdown()
+
+	cancelled := false
+	for _, text := range texts {
+		cancelled = cancelled || text.text == cancelledReply
+	}
+	if !cancelled {
+		t.Errorf("texts = %+v, want the request cancelled despite the rate limit", texts)
+	}
+}
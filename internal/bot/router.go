@@ -15,9 +15,27 @@ type CommandHandler func(ctx context.Context, msg *types.Message) error
 // UpdateHandler is a function type for processing updates.
 type UpdateHandler func(ctx context.Context, update types.Update) error
 
+// CallbackHandler processes a callback query from an inline keyboard button.
+type CallbackHandler func(ctx context.Context, query *types.CallbackQuery) error
+
+// CallbackAnswerer acknowledges callback queries so Telegram stops showing
+// the button's loading indicator.
+type CallbackAnswerer interface {
+	AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error
+}
+
+// callbackRoute maps a callback data prefix to its handler.
+type callbackRoute struct {
+	prefix  string
+	handler UpdateHandler
+}
+
 // Router dispatches Telegram updates to the appropriate handler.
 type Router struct {
-	commands    map[string]CommandHandler
+	commands    map[string]UpdateHandler
+	callbacks   []callbackRoute
+	middlewares []Middleware
+	answerer    CallbackAnswerer
 	chatHandler UpdateHandler
 	logger      *slog.Logger
 }
@@ -28,15 +46,39 @@ func NewRouter(logger *slog.Logger) *Router {
 		logger = slog.Default()
 	}
 	return &Router{
-		commands: make(map[string]CommandHandler),
+		commands: make(map[string]UpdateHandler),
 		logger:   logger,
 	}
 }
 
+// Use appends middlewares that wrap every update handled by the router.
+// The first middleware is the outermost.
+func (r *Router) Use(mws ...Middleware) {
+	r.middlewares = append(r.middlewares, mws...)
+}
+
+// Group returns a route group whose handlers are additionally wrapped by mws,
+// inside the router's own middlewares.
+func (r *Router) Group(mws ...Middleware) *RouteGroup {
+	return &RouteGroup{router: r, middlewares: mws}
+}
+
 // RegisterCommand registers a handler for a /command.
 // The command should be without the leading slash (e.g. "start", "help").
 func (r *Router) RegisterCommand(cmd string, handler CommandHandler) {
-	r.commands[cmd] = handler
+	r.commands[cmd] = commandRoute(handler)
+}
+
+// RegisterCallback registers a handler for callback queries whose data starts
+// with prefix (e.g. "dautu:"). When several prefixes match, the longest wins.
+func (r *Router) RegisterCallback(prefix string, handler CallbackHandler) {
+	r.callbacks = append(r.callbacks, callbackRoute{prefix: prefix, handler: callbackQueryRoute(handler)})
+}
+
+// SetCallbackAnswerer sets the client used to answer callback queries.
+// Every callback query is answered before its handler runs.
+func (r *Router) SetCallbackAnswerer(answerer CallbackAnswerer) {
+	r.answerer = answerer
 }
 
 // SetChatHandler sets the fallback handler for non-command text messages.
@@ -44,9 +86,18 @@ func (r *Router) SetChatHandler(handler UpdateHandler) {
 	r.chatHandler = handler
 }
 
-// Handle dispatches an incoming update to the appropriate handler.
-// It implements the UpdateHandler signature.
+// Handle dispatches an incoming update to the appropriate handler through
+// the router's middlewares. It implements the UpdateHandler signature.
 func (r *Router) Handle(ctx context.Context, update types.Update) error {
+	return chain(r.route, r.middlewares)(ctx, update)
+}
+
+// route dispatches an update to the matching handler.
+func (r *Router) route(ctx context.Context, update types.Update) error {
+	if update.CallbackQuery != nil {
+		return r.handleCallback(ctx, update)
+	}
+
 	if update.Message == nil {
 		return nil
 	}
@@ -64,7 +115,7 @@ func (r *Router) Handle(ctx context.Context, update types.Update) error {
 				slog.String("command", cmd),
 				slog.Int64("chat_id", update.Message.Chat.ID),
 			)
-			return handler(ctx, update.Message)
+			return handler(ctx, update)
 		}
 		r.logger.Debug("unknown command, ignoring",
 			slog.String("command", cmd),
@@ -80,6 +131,104 @@ func (r *Router) Handle(ctx context.Context, update types.Update) error {
 	return nil
 }
 
+// handleCallback answers a callback query and routes it by data prefix.
+func (r *Router) handleCallback(ctx context.Context, update types.Update) error {
+	query := update.CallbackQuery
+	r.AnswerCallback(ctx, query)
+
+	handler := r.matchCallback(query.Data)
+	if handler == nil {
+		r.logger.Debug("unknown callback, ignoring",
+			slog.String("data", query.Data),
+		)
+		return nil
+	}
+
+	r.logger.Debug("routing to callback handler",
+		slog.String("data", query.Data),
+		slog.Int64("user_id", query.From.ID),
+	)
+	return handler(ctx, update)
+}
+
+// matchCallback returns the handler with the longest prefix matching data.
+func (r *Router) matchCallback(data string) UpdateHandler {
+	var best *callbackRoute
+	for i := range r.callbacks {
+		route := &r.callbacks[i]
+		if strings.HasPrefix(data, route.prefix) && (best == nil || len(route.prefix) > len(best.prefix)) {
+			best = route
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.handler
+}
+
+// AnswerCallback acknowledges query if a CallbackAnswerer is set.
+// Failures are logged; the button only keeps spinning a little longer.
+func (r *Router) AnswerCallback(ctx context.Context, query *types.CallbackQuery) {
+	r.answerCallback(ctx, query, "")
+}
+
+// answerCallback answers a callback query, showing text as a notification
+// when it is not empty.
+func (r *Router) answerCallback(ctx context.Context, query *types.CallbackQuery, text string) {
+	if r.answerer == nil {
+		return
+	}
+	if err := r.answerer.AnswerCallbackQuery(ctx, query.ID, text); err != nil {
+		r.logger.Warn("failed to answer callback query",
+			slog.String("callback_query_id", query.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// RouteGroup registers handlers on a Router that share a set of middlewares.
+type RouteGroup struct {
+	router      *Router
+	middlewares []Middleware
+}
+
+// Use appends middlewares to the group. They also apply to handlers
+// registered before the call.
+func (g *RouteGroup) Use(mws ...Middleware) {
+	g.middlewares = append(g.middlewares, mws...)
+}
+
+// RegisterCommand registers a /command handler wrapped by the group's middlewares.
+func (g *RouteGroup) RegisterCommand(cmd string, handler CommandHandler) {
+	g.router.commands[cmd] = g.wrap(commandRoute(handler))
+}
+
+// RegisterCallback registers a callback handler wrapped by the group's middlewares.
+func (g *RouteGroup) RegisterCallback(prefix string, handler CallbackHandler) {
+	g.router.callbacks = append(g.router.callbacks, callbackRoute{prefix: prefix, handler: g.wrap(callbackQueryRoute(handler))})
+}
+
+// wrap applies the group's current middlewares at call time.
+func (g *RouteGroup) wrap(h UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update types.Update) error {
+		return chain(h, g.middlewares)(ctx, update)
+	}
+}
+
+// commandRoute adapts a CommandHandler to an UpdateHandler.
+func commandRoute(handler CommandHandler) UpdateHandler {
+	return func(ctx context.Context, update types.Update) error {
+		return handler(ctx, update.Message)
+	}
+}
+
+// callbackQueryRoute adapts a CallbackHandler to an UpdateHandler.
+func callbackQueryRoute(handler CallbackHandler) UpdateHandler {
+	return func(ctx context.Context, update types.Update) error {
+		return handler(ctx, update.CallbackQuery)
+	}
+}
+
 // extractCommand parses a command from message text.
 // "/start" → "start"
 // "/help@botname" → "help"
@@ -257,3 +257,66 @@ func TestRouterHandle_CommandError(t *testing.T) {
 		t.Errorf("Handle() error = %v, want %v", err, expectedErr)
 	}
 }
+
+// mockAnswerer implements CallbackAnswerer for testing.
+type mockAnswerer struct {
+	answered []string
+}
+
+func (m *mockAnswerer) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	m.answered = append(m.answered, callbackQueryID)
+	return nil
+}
+
+func TestRouterHandle_Callback(t *testing.T) {
+	router := NewRouter(nil)
+	answerer := &mockAnswerer{}
+	router.SetCallbackAnswerer(answerer)
+
+	var handled []string
+	router.RegisterCallback("order:", func(ctx context.Context, q *types.CallbackQuery) error {
+		handled = append(handled, "order:"+q.Data)
+		return nil
+	})
+	router.RegisterCallback("order:cancel:", func(ctx context.Context, q *types.CallbackQuery) error {
+		handled = append(handled, "cancel:"+q.Data)
+		return nil
+	})
+
+	for i, data := range []string{"order:view:1", "order:cancel:2", "unknown"} {
+		err := router.Handle(context.Background(), types.Update{
+			UpdateID: i,
+			CallbackQuery: &types.CallbackQuery{
+				ID:   fmt.Sprintf("cb%d", i),
+				Data: data,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Handle(%q) error = %v", data, err)
+		}
+	}
+
+	want := []string{"order:order:view:1", "cancel:order:cancel:2"}
+	if fmt.Sprint(handled) != fmt.Sprint(want) {
+		t.Errorf("handled = %v, want %v (longest prefix wins)", handled, want)
+	}
+	if fmt.Sprint(answerer.answered) != "[cb0 cb1 cb2]" {
+		t.Errorf("answered = %v, want every callback answered", answerer.answered)
+	}
+}
+
+func TestRouterHandle_CallbackError(t *testing.T) {
+	router := NewRouter(nil)
+
+	expectedErr := fmt.Errorf("callback failed")
+	router.RegisterCallback("x", func(ctx context.Context, q *types.CallbackQuery) error {
+		return expectedErr
+	})
+
+	err := router.Handle(context.Background(), types.Update{
+		CallbackQuery: &types.CallbackQuery{ID: "1", Data: "x"},
+	})
+	if err != expectedErr {
+		t.Errorf("Handle() error = %v, want %v", err, expectedErr)
+	}
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// streamPlaceholder is the initial text of a streamed reply.
+const streamPlaceholder = "…"
+
+// emptyReply replaces a blank final reply, which Telegram would refuse as
+// message text.
+const emptyReply = "The AI returned an empty answer. Please try again."
+
+// streamCursor is appended to partial text to show generation is in progress.
+const streamCursor = " ▌"
+
+// streamEditor throttles progressive edits of a placeholder message.
+type streamEditor struct {
+	ctx       context.Context
+	editor    MessageEditor
+	chatID    int64
+	messageID int
+	interval  time.Duration
+	lastEdit  time.Time
+	lastText  string
+	// keep are send options repeated on every intermediate edit, such as
+	// the Cancel button, which an edit without them would remove.
+	keep   []telegram.SendOption
+	logger *slog.Logger
+}
+
+// update edits the placeholder with the partial text if the throttle interval
+// has elapsed since the previous edit. Intermediate edits are sent without a
+// parse mode because partial Markdown is usually unbalanced. With a
+// NonBlockingEditor an edit the chat cannot take right now is skipped, and
+// the next partial text tries again.
+func (s *streamEditor) update(text string) {
+	if text == "" || time.Since(s.lastEdit) < s.interval {
+		return
+	}
+
+	display := telegram.TruncateMessage(text, telegram.MaxMessageLength-telegram.MessageLength(streamCursor)) + streamCursor
+	if display == s.lastText {
+		return
+	}
+
+	opts := append([]telegram.SendOption{telegram.WithParseMode("")}, s.keep...)
+	sent := true
+	var err error
+	if editor, ok := s.editor.(NonBlockingEditor); ok {
+		sent, err = editor.TryEditMessageText(s.ctx, s.chatID, s.messageID, display, opts...)
+	} else {
+		err = s.editor.EditMessageText(s.ctx, s.chatID, s.messageID, display, opts...)
+	}
+	if err == nil && !sent {
+		return
+	}
+	s.lastEdit = time.Now()
+	if err != nil && !telegram.IsMessageNotModified(err) {
+		s.logger.Debug("stream edit failed",
+			slog.Int64("chat_id", s.chatID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	s.lastText = display
+}
+
+// finish replaces the placeholder with the final reply. A reply longer than
+// Telegram's limit continues in new messages, each replying to the previous
+// one; opts (e.g. a keyboard) apply to the last message. If Telegram rejects
+// the formatted text, it retries as plain text. A blank reply is replaced by
+// emptyReply. It returns the IDs of the messages holding the reply, the
+// placeholder first, even on failure.
+func (s *streamEditor) finish(text string, opts ...telegram.SendOption) ([]int, error) {
+	if strings.TrimSpace(text) == "" {
+		text = emptyReply
+		opts = append(opts[:len(opts):len(opts)], telegram.WithParseMode(""))
+	}
+	chunks := telegram.SplitMessage(text, telegram.MaxMessageLength)
+
+	optsFor := func(i int) []telegram.SendOption {
+		if i == len(chunks)-1 {
+			return opts
+		}
+		return nil
+	}
+
+	ids := []int{s.messageID}
+	if err := s.edit(chunks[0], optsFor(0)...); err != nil {
+		return ids, err
+	}
+
+	for i, chunk := range chunks[1:] {
+		msg, err := s.send(chunk, ids[len(ids)-1], optsFor(i+1)...)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids, nil
+}
+
+// edit replaces the placeholder text, falling back to plain text.
+func (s *streamEditor) edit(text string, opts ...telegram.SendOption) error {
+	err := s.editor.EditMessageText(s.ctx, s.chatID, s.messageID, text, opts...)
+	if err == nil || telegram.IsMessageNotModified(err) {
+		return nil
+	}
+
+	s.logger.Debug("final stream edit failed, retrying as plain text",
+		slog.Int64("chat_id", s.chatID),
+		slog.String("error", err.Error()),
+	)
+	err = s.editor.EditMessageText(s.ctx, s.chatID, s.messageID, text, append(opts, telegram.WithParseMode(""))...)
+	if telegram.IsMessageNotModified(err) {
+		return nil
+	}
+	return err
+}
+
+// send delivers a continuation chunk as a reply to replyTo, falling back to
+// plain text.
+func (s *streamEditor) send(text string, replyTo int, opts ...telegram.SendOption) (*types.Message, error) {
+	opts = append(opts, telegram.WithReplyToMessageID(replyTo))
+	msg, err := s.editor.SendMessageResult(s.ctx, s.chatID, text, opts...)
+	if err == nil {
+		return msg, nil
+	}
+
+	s.logger.Debug("stream continuation failed, retrying as plain text",
+		slog.Int64("chat_id", s.chatID),
+		slog.String("error", err.Error()),
+	)
+	return s.editor.SendMessageResult(s.ctx, s.chatID, text, append(opts, telegram.WithParseMode(""))...)
+}
+
+// replyStreaming generates the reply to the message replyTo and puts it in
+// the placeholder message identified by messageID, progressively when
+// streaming is enabled. opts apply to the final message. It returns the reply
+// and the IDs of its messages, as reply does.
+func (d *Dispatcher) replyStreaming(ctx context.Context, chatID int64, replyTo, messageID int, editor MessageEditor, history []llm.ChatMessage, user llm.ChatMessage, opts ...telegram.SendOption) (string, []int, error) {
+	s := &streamEditor{
+		ctx:       ctx,
+		editor:    editor,
+		chatID:    chatID,
+		messageID: messageID,
+		interval:  d.streamInterval,
+		lastEdit:  time.Now(),
+		keep:      []telegram.SendOption{withCancelButton(replyTo)},
+		logger:    d.logger,
+	}
+
+	var onPartial func(text string)
+	if d.streamInterval > 0 {
+		onPartial = s.update
+	}
+	reply, err := d.generate(ctx, history, user, onPartial)
+	if err != nil {
+		noticeCtx, notice := failureNotice(ctx, err)
+		_ = editor.EditMessageText(noticeCtx, chatID, messageID, notice, telegram.WithParseMode(""))
+		return "", nil, err
+	}
+
+	ids, err := s.finish(reply, opts...)
+	if err != nil {
+		d.logger.Warn("failed to deliver streamed reply",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return reply, ids, nil
+}
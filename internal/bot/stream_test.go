@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// mockEditor implements MessageSender and MessageEditor for testing.
+type mockEditor struct {
+	mockSender
+	emu   sync.Mutex
+	sent  []string
+	edits []string
+}
+
+func (m *mockEditor) SendMessageResult(ctx context.Context, chatID int64, text string, opts ...telegram.SendOption) (*types.Message, error) {
+	m.emu.Lock()
+	defer m.emu.Unlock()
+	m.sent = append(m.sent, text)
+	return &types.Message{ID: 900 + len(m.sent), Chat: types.Chat{ID: chatID}}, nil
+}
+
+func (m *mockEditor) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...telegram.SendOption) error {
+	m.emu.Lock()
+	defer m.emu.Unlock()
+	m.edits = append(m.edits, text)
+	return nil
+}
+
+func (m *mockEditor) getSent() []string {
+	m.emu.Lock()
+	defer m.emu.Unlock()
+	result := make([]string, len(m.sent))
+	copy(result, m.sent)
+	return result
+}
+
+func (m *mockEditor) getEdits() []string {
+	m.emu.Lock()
+	defer m.emu.Unlock()
+	result := make([]string, len(m.edits))
+	copy(result, m.edits)
+	return result
+}
+
+// mockStreamChat implements StreamingChatCompleter, emitting one partial per word.
+type mockStreamChat struct {
+	mockChat
+	delay time.Duration
+	err   error
+}
+
+func (m *mockStreamChat) GenerateResponseStream(ctx context.Context, history []llm.ChatMessage, userText string, onPartial func(text string)) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	words := strings.Fields(m.reply)
+	for i := range words {
+		time.Sleep(m.delay)
+		onPartial(strings.Join(words[:i+1], " "))
+	}
+	return m.GenerateResponse(ctx, history, userText)
+}
+
+func TestDispatcher_StreamingReply(t *testing.T) {
+	sender := &mockEditor{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: "one two three four five"}, delay: 15 * time.Millisecond}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(20*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "count", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	if sent := sender.getSent(); len(sent) != 1 || sent[0] != streamPlaceholder {
+		t.Fatalf("sent = %v, want single placeholder", sent)
+	}
+	if texts := sender.getTexts(); len(texts) != 0 {
+		t.Errorf("SendText called %d times, want 0 when streaming", len(texts))
+	}
+
+	edits := sender.getEdits()
+	if len(edits) < 2 {
+		t.Fatalf("expected partial edits plus a final edit, got %v", edits)
+	}
+	// Throttled: fewer edits than partials (5) plus final
+	if len(edits) >= 6 {
+		t.Errorf("edits = %d, expected throttling below 6", len(edits))
+	}
+	if edits[len(edits)-1] != "one two three four five" {
+		t.Errorf("final edit = %q, want full reply", edits[len(edits)-1])
+	}
+	for _, e := range edits[:len(edits)-1] {
+		if !strings.HasSuffix(e, streamCursor) {
+			t.Errorf("partial edit %q missing cursor", e)
+		}
+	}
+
+	// History is still recorded for the next turn
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 2,
+		Message:  &types.Message{ID: 2, Text: "again", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	calls := chat.getCalls()
+	if len(calls) != 2 || len(calls[1].history) != 2 {
+		t.Errorf("expected second call with 2 history messages, got %+v", calls)
+	}
+}
+
+// busyEditor is a NonBlockingEditor whose chat has no free slot for
+// intermediate edits.
+type busyEditor struct {
+	mockEditor
+	tries int
+}
+
+func (b *busyEditor) TryEditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...telegram.SendOption) (bool, error) {
+	b.emu.Lock()
+	defer b.emu.Unlock()
+	b.tries++
+	return false, nil
+}
+
+func TestDispatcher_StreamingSkipsBusyEdits(t *testing.T) {
+	sender := &busyEditor{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: "one two three four five"}, delay: 15 * time.Millisecond}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(10*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "count", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	// Partial edits are only tried; the final reply waits for its slot
+	sender.emu.Lock()
+	tries := sender.tries
+	sender.emu.Unlock()
+	if tries == 0 {
+		t.Error("intermediate edits were not tried without blocking")
+	}
+	if edits := sender.getEdits(); len(edits) != 1 || edits[0] != "one two three four five" {
+		t.Errorf("edits = %v, want only the final reply", edits)
+	}
+}
+
+func TestDispatcher_StreamingLongReply(t *testing.T) {
+	sender := &mockEditor{}
+	para := strings.Repeat("a", 3000)
+	chat := &mockStreamChat{mockChat: mockChat{reply: para + "\n\n" + para}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(time.Hour),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "/dautu", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	edits := sender.getEdits()
+	if len(edits) != 1 || edits[0] != para {
+		t.Errorf("expected placeholder edited with first chunk, got %d edits", len(edits))
+	}
+	sent := sender.getSent()
+	if len(sent) != 2 || sent[0] != streamPlaceholder || sent[1] != para {
+		t.Errorf("expected placeholder plus one continuation message, got %d messages", len(sent))
+	}
+}
+
+func TestDispatcher_StreamingError(t *testing.T) {
+	sender := &mockEditor{}
+	chat := &mockStreamChat{err: errors.New("boom")}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(10*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "hi", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	edits := sender.getEdits()
+	if len(edits) != 1 || edits[0] != errorReply {
+		t.Errorf("edits = %v, want placeholder replaced by error reply", edits)
+	}
+}
+
+func TestDispatcher_StreamingEmptyReply(t *testing.T) {
+	sender := &mockEditor{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: " \n"}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithStreaming(10*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "hi", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	edits := sender.getEdits()
+	if len(edits) != 1 || edits[0] != emptyReply {
+		t.Errorf("edits = %v, want placeholder replaced by the empty reply notice", edits)
+	}
+}
+
+func TestDispatcher_StreamingDisabled(t *testing.T) {
+	sender := &mockEditor{}
+	chat := &mockStreamChat{mockChat: mockChat{reply: "plain"}}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil, WithIdleTTL(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Dispatch(ctx, types.Update{
+		UpdateID: 1,
+		Message:  &types.Message{ID: 1, Text: "hi", Chat: types.Chat{ID: 42}},
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	texts := sender.getTexts()
+	if len(texts) != 1 || texts[0].text != "plain" {
+		t.Errorf("texts = %v, want single plain reply", texts)
+	}
+	if len(sender.getEdits()) != 0 {
+		t.Error("no edits expected without WithStreaming")
+	}
+}
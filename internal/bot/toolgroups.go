@@ -0,0 +1,52 @@
+package bot
+
+// ToolGroupPolicy decides which tool groups (e.g. "spot", "futures", "ops")
+// the AI may use in a conversation, so that chats unrelated to trading do not
+// even see the portfolio tools.
+//
+// A chat with an entry gets at most the groups listed for it: they are
+// intersected with the sender's entry, if any. In other chats the sender's
+// entry applies, and otherwise the default. Tools without a group are always
+// available.
+type ToolGroupPolicy struct {
+	defaults []string // nil = all groups
+	chats    map[int64][]string
+	users    map[int64][]string
+}
+
+// NewToolGroupPolicy creates a ToolGroupPolicy from the default groups
+// (nil = all) and the groups enabled per chat and per user. An empty,
+// non-nil list enables no groups.
+func NewToolGroupPolicy(defaults []string, chats, users map[int64][]string) *ToolGroupPolicy {
+	return &ToolGroupPolicy{defaults: defaults, chats: chats, users: users}
+}
+
+// Groups returns the tool groups enabled for userID in chatID. It reports
+// false if every group is enabled.
+func (p *ToolGroupPolicy) Groups(chatID, userID int64) ([]string, bool) {
+	userGroups, hasUser := p.users[userID]
+	if chatGroups, ok := p.chats[chatID]; ok {
+		if !hasUser {
+			return chatGroups, true
+		}
+		return intersect(chatGroups, userGroups), true
+	}
+	if hasUser {
+		return userGroups, true
+	}
+	return p.defaults, p.defaults != nil
+}
+
+// intersect returns the elements of a that are also in b.
+func intersect(a, b []string) []string {
+	result := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				result = append(result, x)
+				break
+			}
+		}
+	}
+	return result
+}
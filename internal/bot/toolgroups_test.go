@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+func TestToolGroupPolicy(t *testing.T) {
+	p := NewToolGroupPolicy(
+		[]string{"spot"},
+		map[int64][]string{-100: {"ops"}, -200: {"spot", "futures"}, -300: {}},
+		map[int64][]string{7: {"spot", "futures", "ops"}},
+	)
+
+	tests := []struct {
+		name       string
+		chat, user int64
+		want       string
+	}{
+		{"default", 1, 1, "spot"},
+		{"user entry replaces the default", 7, 7, "spot,futures,ops"},
+		{"chat entry", -200, 1, "spot,futures"},
+		{"chat entry caps the user", -100, 7, "ops"},
+		{"chat without groups", -300, 7, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, restricted := p.Groups(tt.chat, tt.user)
+			if !restricted {
+				t.Fatalf("Groups(%d, %d) not restricted", tt.chat, tt.user)
+			}
+			if got := strings.Join(groups, ","); got != tt.want {
+				t.Errorf("Groups(%d, %d) = %s, want %s", tt.chat, tt.user, got, tt.want)
+			}
+		})
+	}
+
+	// Without a default, chats and users without an entry get every group
+	p = NewToolGroupPolicy(nil, map[int64][]string{-100: {"ops"}}, nil)
+	if _, restricted := p.Groups(1, 1); restricted {
+		t.Error("Groups() restricted without any entry or default")
+	}
+}
+
+// mockGroupsChat records the tool groups enabled in each request's context.
+type mockGroupsChat struct {
+	mu     sync.Mutex
+	groups map[string][]string // by user text; nil slice if unrestricted
+}
+
+func (m *mockGroupsChat) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	groups, _ := tools.GroupsFromContext(ctx)
+	m.groups[userText] = groups
+	return "ok", nil
+}
+
+func TestDispatcher_ToolGroups(t *testing.T) {
+	chat := &mockGroupsChat{groups: make(map[string][]string)}
+	policy := NewToolGroupPolicy(nil, map[int64][]string{-100: {"ops"}}, nil)
+	d := NewDispatcher(NewRouter(nil), chat, &mockSender{}, nil, WithIdleTTL(time.Second), WithToolGroups(policy))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, textUpdate(1, -100, 7, "ops chat"))
+	d.Dispatch(ctx, textUpdate(2, 42, 7, "private chat"))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	d.Shutdown()
+
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if got := strings.Join(chat.groups["ops chat"], ","); got != "ops" {
+		t.Errorf("ops chat groups = %q, want ops", got)
+	}
+	if groups, ok := chat.groups["private chat"]; !ok || groups != nil {
+		t.Errorf("private chat groups = %v (answered %v), want unrestricted", groups, ok)
+	}
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/clients/telegram"
+)
+
+// Transcriber converts recorded speech to text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, filename string) (string, error)
+}
+
+// voiceFilename tells the transcription API the format of Telegram voice
+// notes, which are OGG/Opus.
+const voiceFilename = "voice.ogg"
+
+const (
+	voiceUnsupportedReply = "🎤 Bot chưa hỗ trợ tin nhắn thoại."
+	voiceFailedReply      = "🎤 Không nhận dạng được tin nhắn thoại, vui lòng thử lại."
+	voiceEmptyReply       = "🎤 Không nghe rõ nội dung, vui lòng thử lại."
+)
+
+// transcribeVoice downloads and transcribes the voice note of msg and echoes
+// the recognized text as a reply, so the user can see what the AI will
+// answer. If there is no usable transcript, the user is told and ok is false.
+func (d *Dispatcher) transcribeVoice(ctx context.Context, chatID int64, msg *types.Message) (text string, ok bool) {
+	downloader, canDownload := d.sender.(FileDownloader)
+	if d.transcriber == nil || !canDownload {
+		_ = d.sender.SendText(ctx, chatID, voiceUnsupportedReply)
+		return "", false
+	}
+	if msg.Voice.FileSize > telegram.MaxDownloadSize {
+		_ = d.sender.SendText(ctx, chatID, voiceFailedReply)
+		return "", false
+	}
+
+	_ = d.sender.SendChatAction(ctx, chatID, "typing")
+
+	logger := LoggerFromContext(ctx, d.logger)
+	audio, err := downloader.DownloadFile(ctx, msg.Voice.FileID)
+	if err == nil {
+		text, err = d.transcriber.Transcribe(ctx, audio, voiceFilename)
+	}
+	if err != nil {
+		logger.Warn("voice transcription failed",
+			slog.Int64("chat_id", chatID),
+			slog.Int("duration", msg.Voice.Duration),
+			slog.String("error", err.Error()),
+		)
+		_ = d.sender.SendText(ctx, chatID, voiceFailedReply)
+		return "", false
+	}
+	if text == "" {
+		_ = d.sender.SendText(ctx, chatID, voiceEmptyReply)
+		return "", false
+	}
+
+	logger.Info("voice transcribed",
+		slog.Int64("chat_id", chatID),
+		slog.Int("duration", msg.Voice.Duration),
+		slog.Int("text_len", len(text)),
+	)
+
+	// Transcripts are sent unformatted: speech has no Markdown
+	d.sendReply(ctx, chatID, msg.ID, "🎤 "+text, telegram.WithParseMode(""))
+	return text, true
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// mockTranscriber returns a fixed transcript for any audio.
+type mockTranscriber struct {
+	text string
+	err  error
+}
+
+func (m *mockTranscriber) Transcribe(ctx context.Context, audio []byte, filename string) (string, error) {
+	if filename != voiceFilename {
+		return "", errors.New("unexpected filename " + filename)
+	}
+	return m.text, m.err
+}
+
+func voiceUpdate(id int) types.Update {
+	return types.Update{
+		UpdateID: id,
+		Message: &types.Message{
+			ID:    id,
+			Chat:  types.Chat{ID: 42, Type: "private"},
+			Voice: &types.Voice{FileID: "voice-1", Duration: 3, MimeType: "audio/ogg"},
+		},
+	}
+}
+
+func TestDispatcher_VoiceMessage(t *testing.T) {
+	sender := &mockDownloadSender{files: map[string][]byte{"voice-1": []byte("OggS")}}
+	chat := &mockChat{reply: "BTC đang ở 100k"}
+	d := NewDispatcher(NewRouter(nil), chat, sender, nil,
+		WithIdleTTL(time.Second),
+		WithTranscriber(&mockTranscriber{text: "giá BTC bao nhiêu"}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.Dispatch(ctx, voiceUpdate(1))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	d.Shutdown()
+
+	texts := sender.getTexts()
+	if len(texts) != 2 {
+		t.Fatalf("sent %d messages, want transcript echo + reply: %+v", len(texts), texts)
+	}
+	if texts[0].text != "🎤 giá BTC bao nhiêu" || texts[1].text != "BTC đang ở 100k" {
+		t.Errorf("texts = %+v", texts)
+	}
+
+	calls := chat.getCalls()
+	if len(calls) != 1 || calls[0].userText != "giá BTC bao nhiêu" {
+		t.Errorf("AI calls = %+v, want the transcript as user text", calls)
+	}
+}
+
+func TestDispatcher_VoiceErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		transcriber Transcriber
+		files       map[string][]byte
+		want        string
+	}{
+		{"no transcriber", nil, map[string][]byte{"voice-1": []byte("OggS")}, voiceUnsupportedReply},
+		{"download fails", &mockTranscriber{text: "hi"}, nil, voiceFailedReply},
+		{"transcription fails", &mockTranscriber{err: errors.New("boom")}, map[string][]byte{"voice-1": []byte("OggS")}, voiceFailedReply},
+		{"silence", &mockTranscriber{text: ""}, map[string][]byte{"voice-1": []byte("OggS")}, voiceEmptyReply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &mockDownloadSender{files: tt.files}
+			chat := &mockChat{reply: "reply"}
+			opts := []DispatcherOption{WithIdleTTL(time.Second)}
+			if tt.transcriber != nil {
+				opts = append(opts, WithTranscriber(tt.transcriber))
+			}
+			d := NewDispatcher(NewRouter(nil), chat, sender, nil, opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+
+			d.Dispatch(ctx, voiceUpdate(1))
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			d.Shutdown()
+
+			texts := sender.getTexts()
+			if len(texts) != 1 || texts[0].text != tt.want {
+				t.Errorf("texts = %+v, want %q", texts, tt.want)
+			}
+			if len(chat.getCalls()) != 0 {
+				t.Error("AI should not be called without a transcript")
+			}
+		})
+	}
+}
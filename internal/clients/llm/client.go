@@ -4,11 +4,14 @@ package llm
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,10 +22,10 @@ type HTTPClient interface {
 
 // ClientConfig holds configuration options for the AI client.
 type ClientConfig struct {
-	// Provider is the AI service provider (gemini, claude, openai, qwen).
+	// Provider is the AI service provider (gemini, claude, openai, qwen, ollama, openai-compatible).
 	Provider Provider
 
-	// APIKey is the API key for authentication.
+	// APIKey is the API key for authentication. Optional for local providers.
 	APIKey string
 
 	// Model is the model name to use.
@@ -47,14 +50,14 @@ type ClientConfig struct {
 
 // validate checks the configuration and applies defaults.
 func (c *ClientConfig) validate() error {
-	if c.APIKey == "" {
-		return fmt.Errorf("ai: api key is required")
-	}
-
 	if c.Provider == "" {
 		c.Provider = ProviderGemini
 	}
 
+	if c.APIKey == "" && !c.Provider.Local() {
+		return fmt.Errorf("ai: api key is required")
+	}
+
 	if c.Model == "" {
 		switch c.Provider {
 		case ProviderGemini:
@@ -65,6 +68,8 @@ func (c *ClientConfig) validate() error {
 			c.Model = "gpt-4o"
 		case ProviderQwen:
 			c.Model = "qwen-plus"
+		case ProviderOllama:
+			c.Model = "llama3.1"
 		}
 	}
 
@@ -178,26 +183,60 @@ func (c *Client) Complete(ctx context.Context, req ChatRequest) (*ChatResponse,
 		slog.Int("messages", len(req.Messages)),
 	)
 
+	var (
+		resp *ChatResponse
+		err  error
+	)
 	switch c.config.Provider {
 	case ProviderGemini:
-		return c.completeGemini(ctx, req)
+		resp, err = c.completeGemini(ctx, req)
 	case ProviderClaude:
-		return c.completeClaude(ctx, req)
-	case ProviderOpenAI, ProviderQwen:
-		return c.completeOpenAICompatible(ctx, req)
+		resp, err = c.completeClaude(ctx, req)
+	case ProviderOpenAI, ProviderQwen, ProviderOpenAICompatible:
+		resp, err = c.completeOpenAICompatible(ctx, req)
+	case ProviderOllama:
+		resp, err = c.completeOllama(ctx, req)
 	default:
 		return nil, fmt.Errorf("ai: unsupported provider: %s", c.config.Provider)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Provider = c.config.Provider
+	return resp, nil
+}
+
+// Provider returns the AI provider the client talks to.
+func (c *Client) Provider() Provider {
+	return c.config.Provider
+}
+
+// Model returns the default model of the client.
+func (c *Client) Model() string {
+	return c.config.Model
 }
 
 // completeGemini sends a request to Google Gemini API.
 // POST https://generativelanguage.googleapis.com/v1beta/models/{model}:generateContent
 func (c *Client) completeGemini(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	httpReq, err := c.buildGeminiRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(httpReq, c.config.Provider, c.parseGeminiResponse)
+}
+
+// buildGeminiRequest builds the HTTP request for a Gemini generateContent call.
+// With stream set, it targets streamGenerateContent with server-sent events.
+func (c *Client) buildGeminiRequest(ctx context.Context, req ChatRequest, stream bool) (*http.Request, error) {
 	// Build Gemini request body
 	type part struct {
 		Text             string          `json:"text,omitempty"`
 		FunctionCall     *functionCall   `json:"functionCall,omitempty"`
 		FunctionResponse *functionResp   `json:"functionResponse,omitempty"`
+		InlineData       *inlineData     `json:"inlineData,omitempty"`
 	}
 	type content struct {
 		Role  string `json:"role"`
@@ -291,9 +330,17 @@ func (c *Client) completeGemini(ctx context.Context, req ChatRequest) (*ChatResp
 			if msg.Role == RoleAssistant {
 				role = "model"
 			}
+			// Images go first as inline data, followed by the text part
+			var parts []part
+			for _, img := range msg.Images {
+				parts = append(parts, part{InlineData: &inlineData{MimeType: img.MimeType, Data: img.Data}})
+			}
+			if msg.Content != "" || len(parts) == 0 {
+				parts = append(parts, part{Text: msg.Content})
+			}
 			gemReq.Contents = append(gemReq.Contents, content{
 				Role:  role,
-				Parts: []part{{Text: msg.Content}},
+				Parts: parts,
 			})
 		}
 	}
@@ -306,6 +353,9 @@ func (c *Client) completeGemini(ctx context.Context, req ChatRequest) (*ChatResp
 	}
 
 	apiURL := fmt.Sprintf("%s/v1beta/models/%s:generateContent", c.baseURL(), req.Model)
+	if stream {
+		apiURL = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", c.baseURL(), req.Model)
+	}
 
 	httpReq, err := c.buildRequest(ctx, http.MethodPost, apiURL, gemReq)
 	if err != nil {
@@ -313,7 +363,7 @@ func (c *Client) completeGemini(ctx context.Context, req ChatRequest) (*ChatResp
 	}
 	httpReq.Header.Set("x-goog-api-key", c.config.APIKey)
 
-	return c.doRequest(httpReq, c.config.Provider, c.parseGeminiResponse)
+	return httpReq, nil
 }
 
 // Gemini function calling types (package-level for reuse in request/response).
@@ -326,9 +376,31 @@ type functionResp struct {
 	Response json.RawMessage `json:"response"`
 }
 
+// inlineData is a Gemini part carrying base64-encoded media.
+type inlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"`
+}
+
 // completeClaude sends a request to Anthropic Claude API.
 // POST https://api.anthropic.com/v1/messages
 func (c *Client) completeClaude(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	httpReq, err := c.buildClaudeRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(httpReq, c.config.Provider, c.parseClaudeResponse)
+}
+
+// buildClaudeRequest builds the HTTP request for a Claude messages call.
+func (c *Client) buildClaudeRequest(ctx context.Context, req ChatRequest, stream bool) (*http.Request, error) {
+	type claudeSource struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      []byte `json:"data"`
+	}
+
 	type claudeContentBlock struct {
 		Type      string          `json:"type"`
 		Text      string          `json:"text,omitempty"`
@@ -337,6 +409,7 @@ func (c *Client) completeClaude(ctx context.Context, req ChatRequest) (*ChatResp
 		Input     json.RawMessage `json:"input,omitempty"`
 		ToolUseID string          `json:"tool_use_id,omitempty"`
 		Content   string          `json:"content,omitempty"`
+		Source    *claudeSource   `json:"source,omitempty"`
 	}
 
 	type claudeMessage struct {
@@ -356,12 +429,14 @@ func (c *Client) completeClaude(ctx context.Context, req ChatRequest) (*ChatResp
 		MaxTokens int             `json:"max_tokens"`
 		System    string          `json:"system,omitempty"`
 		Tools     []claudeTool    `json:"tools,omitempty"`
+		Stream    bool            `json:"stream,omitempty"`
 	}
 
 	claudeReq := claudeRequest{
 		Model:     req.Model,
 		MaxTokens: req.MaxTokens,
 		System:    req.System,
+		Stream:    stream,
 	}
 
 	// Add tool definitions if provided
@@ -414,6 +489,26 @@ func (c *Client) completeClaude(ctx context.Context, req ChatRequest) (*ChatResp
 				}},
 			})
 
+		case len(msg.Images) > 0:
+			// Multi-part message → image blocks followed by the text block
+			var blocks []claudeContentBlock
+			for _, img := range msg.Images {
+				blocks = append(blocks, claudeContentBlock{
+					Type:   "image",
+					Source: &claudeSource{Type: "base64", MediaType: img.MimeType, Data: img.Data},
+				})
+			}
+			if msg.Content != "" {
+				blocks = append(blocks, claudeContentBlock{
+					Type: "text",
+					Text: msg.Content,
+				})
+			}
+			claudeReq.Messages = append(claudeReq.Messages, claudeMessage{
+				Role:    string(msg.Role),
+				Content: blocks,
+			})
+
 		default:
 			claudeReq.Messages = append(claudeReq.Messages, claudeMessage{
 				Role:    string(msg.Role),
@@ -431,7 +526,7 @@ func (c *Client) completeClaude(ctx context.Context, req ChatRequest) (*ChatResp
 	httpReq.Header.Set("x-api-key", c.config.APIKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 
-	return c.doRequest(httpReq, c.config.Provider, c.parseClaudeResponse)
+	return httpReq, nil
 }
 
 // defaultBaseURL returns the default API base URL for a provider.
@@ -445,6 +540,10 @@ func defaultBaseURL(provider Provider) string {
 		return "https://api.openai.com"
 	case ProviderQwen:
 		return "https://dashscope.aliyuncs.com/compatible-mode"
+	case ProviderOllama:
+		return "http://localhost:11434"
+	case ProviderOpenAICompatible:
+		return "http://localhost:8000"
 	default:
 		return ""
 	}
@@ -458,8 +557,39 @@ func (c *Client) baseURL() string {
 	return defaultBaseURL(c.config.Provider)
 }
 
-// completeOpenAICompatible sends a request to OpenAI-compatible APIs (OpenAI, Qwen).
+// openAIURL returns the URL of an OpenAI API endpoint such as
+// "/chat/completions". The built-in default base URLs get the "/v1" prefix;
+// a configured base URL is used as given, since OpenAI-compatible APIs put
+// their endpoints under different paths (e.g. Gemini's "/v1beta/openai"). A
+// configured URL of the full chat completions endpoint is accepted as well.
+func (c *Client) openAIURL(endpoint string) string {
+	if c.config.BaseURL == "" {
+		return defaultBaseURL(c.config.Provider) + "/v1" + endpoint
+	}
+	base := strings.TrimSuffix(c.config.BaseURL, "/")
+	base = strings.TrimSuffix(base, "/chat/completions")
+	return base + endpoint
+}
+
+// setBearerAuth sets the Authorization header when an API key is configured.
+func (c *Client) setBearerAuth(req *http.Request) {
+	if c.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+}
+
+// completeOpenAICompatible sends a request to OpenAI-compatible APIs (OpenAI, Qwen, local servers).
 func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	httpReq, err := c.buildOpenAIRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(httpReq, c.config.Provider, c.parseOpenAIResponse)
+}
+
+// buildOpenAIRequest builds the HTTP request for an OpenAI-compatible chat completion.
+func (c *Client) buildOpenAIRequest(ctx context.Context, req ChatRequest, stream bool) (*http.Request, error) {
 	type oaiToolCallFunc struct {
 		Name      string `json:"name"`
 		Arguments string `json:"arguments"`
@@ -469,9 +599,17 @@ func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest)
 		Type     string          `json:"type"`
 		Function oaiToolCallFunc `json:"function"`
 	}
+	type oaiImageURL struct {
+		URL string `json:"url"`
+	}
+	type oaiContentPart struct {
+		Type     string       `json:"type"`
+		Text     string       `json:"text,omitempty"`
+		ImageURL *oaiImageURL `json:"image_url,omitempty"`
+	}
 	type openAIMessage struct {
 		Role       string        `json:"role"`
-		Content    string        `json:"content,omitempty"`
+		Content    interface{}   `json:"content,omitempty"` // string or []oaiContentPart
 		ToolCalls  []oaiToolCall `json:"tool_calls,omitempty"`
 		ToolCallID string        `json:"tool_call_id,omitempty"`
 	}
@@ -485,17 +623,27 @@ func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest)
 		Function oaiFunction `json:"function"`
 	}
 
+	type oaiStreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	}
+
 	type openAIRequest struct {
-		Model     string          `json:"model"`
-		Messages  []openAIMessage `json:"messages"`
-		MaxTokens int             `json:"max_tokens,omitempty"`
-		Tools     []oaiTool       `json:"tools,omitempty"`
+		Model         string            `json:"model"`
+		Messages      []openAIMessage   `json:"messages"`
+		MaxTokens     int               `json:"max_tokens,omitempty"`
+		Tools         []oaiTool         `json:"tools,omitempty"`
+		Stream        bool              `json:"stream,omitempty"`
+		StreamOptions *oaiStreamOptions `json:"stream_options,omitempty"`
 	}
 
 	oaiReq := openAIRequest{
 		Model:     req.Model,
 		MaxTokens: req.MaxTokens,
 	}
+	if stream {
+		oaiReq.Stream = true
+		oaiReq.StreamOptions = &oaiStreamOptions{IncludeUsage: true}
+	}
 
 	// Add tool definitions if provided
 	if len(req.Tools) > 0 {
@@ -538,11 +686,14 @@ func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest)
 					},
 				})
 			}
-			oaiReq.Messages = append(oaiReq.Messages, openAIMessage{
+			oaiMsg := openAIMessage{
 				Role:      "assistant",
-				Content:   msg.Content,
 				ToolCalls: calls,
-			})
+			}
+			if msg.Content != "" {
+				oaiMsg.Content = msg.Content
+			}
+			oaiReq.Messages = append(oaiReq.Messages, oaiMsg)
 
 		case msg.Role == RoleTool:
 			// Tool result
@@ -552,6 +703,23 @@ func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest)
 				ToolCallID: msg.ToolCallID,
 			})
 
+		case len(msg.Images) > 0:
+			// Multi-part message → image data URLs followed by the text part
+			var parts []oaiContentPart
+			for _, img := range msg.Images {
+				parts = append(parts, oaiContentPart{
+					Type:     "image_url",
+					ImageURL: &oaiImageURL{URL: "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)},
+				})
+			}
+			if msg.Content != "" {
+				parts = append(parts, oaiContentPart{Type: "text", Text: msg.Content})
+			}
+			oaiReq.Messages = append(oaiReq.Messages, openAIMessage{
+				Role:    string(msg.Role),
+				Content: parts,
+			})
+
 		default:
 			oaiReq.Messages = append(oaiReq.Messages, openAIMessage{
 				Role:    string(msg.Role),
@@ -560,15 +728,15 @@ func (c *Client) completeOpenAICompatible(ctx context.Context, req ChatRequest)
 		}
 	}
 
-	apiURL := c.baseURL()
+	apiURL := c.openAIURL("/chat/completions")
 
 	httpReq, err := c.buildRequest(ctx, http.MethodPost, apiURL, oaiReq)
 	if err != nil {
 		return nil, err
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	c.setBearerAuth(httpReq)
 
-	return c.doRequest(httpReq, c.config.Provider, c.parseOpenAIResponse)
+	return httpReq, nil
 }
 
 // buildRequest creates an HTTP request with JSON body.
@@ -604,14 +772,15 @@ func (c *Client) doRequest(req *http.Request, provider Provider, parser response
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, c.parseErrorResponse(body, resp.StatusCode, provider)
+		return nil, c.parseErrorResponse(body, resp.StatusCode, resp.Header, provider)
 	}
 
 	return parser(body)
 }
 
 // parseErrorResponse extracts an LLMError from a failed response.
-func (c *Client) parseErrorResponse(body []byte, statusCode int, provider Provider) error {
+// A Retry-After header (in seconds) takes precedence over the body.
+func (c *Client) parseErrorResponse(body []byte, statusCode int, header http.Header, provider Provider) error {
 	aiErr := &LLMError{
 		Code:     statusCode,
 		Provider: provider,
@@ -623,14 +792,24 @@ func (c *Client) parseErrorResponse(body []byte, statusCode int, provider Provid
 			Message string `json:"message"`
 		} `json:"error"`
 	}
+	var plainErr struct {
+		Error string `json:"error"`
+	}
 	if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
 		aiErr.Description = errResp.Error.Message
+	} else if json.Unmarshal(body, &plainErr) == nil && plainErr.Error != "" {
+		// Ollama and some local servers return {"error": "..."}
+		aiErr.Description = plainErr.Error
 	} else {
 		aiErr.Description = string(body)
 	}
 
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		aiErr.RetryAfter = seconds
+	}
+
 	// Check for retry-after header info in the response body
-	if statusCode == 429 {
+	if statusCode == 429 && aiErr.RetryAfter == 0 {
 		var rateLimitResp struct {
 			Error struct {
 				RetryAfter float64 `json:"retry_after"`
@@ -685,3 +685,97 @@ func (c *urlRewriteClient) Do(req *http.Request) (*http.Response, error) {
 	req.URL.Host = strings.TrimPrefix(c.target, "http://")
 	return c.inner.Do(req)
 }
+
+func TestCompleteWithImages(t *testing.T) {
+	image := Image{MimeType: "image/png", Data: []byte("png-bytes")}
+	encoded := "cG5nLWJ5dGVz" // base64 of "png-bytes"
+
+	tests := []struct {
+		provider Provider
+		reply    string
+		check    func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			provider: ProviderGemini,
+			reply:    `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				parts := body["contents"].([]interface{})[0].(map[string]interface{})["parts"].([]interface{})
+				inline := parts[0].(map[string]interface{})["inlineData"].(map[string]interface{})
+				if inline["mimeType"] != "image/png" || inline["data"] != encoded {
+					t.Errorf("inlineData = %v", inline)
+				}
+				if parts[1].(map[string]interface{})["text"] != "what is this?" {
+					t.Errorf("text part = %v", parts[1])
+				}
+			},
+		},
+		{
+			provider: ProviderClaude,
+			reply:    `{"content":[{"type":"text","text":"ok"}]}`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				blocks := body["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})
+				image := blocks[0].(map[string]interface{})
+				source := image["source"].(map[string]interface{})
+				if image["type"] != "image" || source["type"] != "base64" || source["media_type"] != "image/png" || source["data"] != encoded {
+					t.Errorf("image block = %v", image)
+				}
+				if blocks[1].(map[string]interface{})["text"] != "what is this?" {
+					t.Errorf("text block = %v", blocks[1])
+				}
+			},
+		},
+		{
+			provider: ProviderOpenAI,
+			reply:    `{"choices":[{"message":{"content":"ok"}}]}`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				parts := body["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})
+				url := parts[0].(map[string]interface{})["image_url"].(map[string]interface{})["url"]
+				if url != "data:image/png;base64,"+encoded {
+					t.Errorf("image_url = %v", url)
+				}
+				if parts[1].(map[string]interface{})["text"] != "what is this?" {
+					t.Errorf("text part = %v", parts[1])
+				}
+			},
+		},
+		{
+			provider: ProviderOllama,
+			reply:    `{"message":{"role":"assistant","content":"ok"},"done":true}`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				msg := body["messages"].([]interface{})[0].(map[string]interface{})
+				images := msg["images"].([]interface{})
+				if len(images) != 1 || images[0] != encoded || msg["content"] != "what is this?" {
+					t.Errorf("message = %v", msg)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.reply))
+			}))
+			defer server.Close()
+
+			client, err := NewClient("test-key",
+				WithProvider(tt.provider),
+				WithLLMHTTPClient(&urlRewriteClient{target: server.URL, inner: http.DefaultClient}),
+			)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = client.Complete(context.Background(), ChatRequest{
+				Messages: []ChatMessage{{Role: RoleUser, Content: "what is this?", Images: []Image{image}}},
+			})
+			if err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			tt.check(t, body)
+		})
+	}
+}
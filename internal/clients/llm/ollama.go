@@ -0,0 +1,309 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ollamaMessage is a message of Ollama's native /api/chat endpoint.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    [][]byte         `json:"images,omitempty"` // base64-encoded
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChunk is a /api/chat response, or one line of its NDJSON stream.
+type ollamaChunk struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// completeOllama sends a request to Ollama's native chat API.
+// POST {base}/api/chat
+func (c *Client) completeOllama(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	httpReq, err := c.buildOllamaRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(httpReq, c.config.Provider, c.parseOllamaResponse)
+}
+
+// buildOllamaRequest builds the HTTP request for an Ollama /api/chat call.
+// With stream set, the response is newline-delimited JSON.
+func (c *Client) buildOllamaRequest(ctx context.Context, req ChatRequest, stream bool) (*http.Request, error) {
+	type ollamaFunction struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	}
+	type ollamaTool struct {
+		Type     string         `json:"type"`
+		Function ollamaFunction `json:"function"`
+	}
+	type ollamaOptions struct {
+		NumPredict int `json:"num_predict,omitempty"`
+	}
+	type ollamaRequest struct {
+		Model    string          `json:"model"`
+		Messages []ollamaMessage `json:"messages"`
+		Tools    []ollamaTool    `json:"tools,omitempty"`
+		Stream   bool            `json:"stream"`
+		Options  ollamaOptions   `json:"options"`
+	}
+
+	olReq := ollamaRequest{
+		Model:   req.Model,
+		Stream:  stream,
+		Options: ollamaOptions{NumPredict: req.MaxTokens},
+	}
+
+	for _, t := range req.Tools {
+		olReq.Tools = append(olReq.Tools, ollamaTool{
+			Type: "function",
+			Function: ollamaFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+
+	if req.System != "" {
+		olReq.Messages = append(olReq.Messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+
+	// Ollama has no tool call IDs; tool results are matched by tool name
+	toolNames := make(map[string]string)
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == RoleSystem:
+			continue
+
+		case msg.Role == RoleAssistant && len(msg.ToolCalls) > 0:
+			out := ollamaMessage{Role: "assistant", Content: msg.Content}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				var call ollamaToolCall
+				call.Function.Name = tc.Name
+				call.Function.Arguments = tc.Arguments
+				if len(call.Function.Arguments) == 0 {
+					call.Function.Arguments = json.RawMessage("{}")
+				}
+				out.ToolCalls = append(out.ToolCalls, call)
+			}
+			olReq.Messages = append(olReq.Messages, out)
+
+		case msg.Role == RoleTool:
+			olReq.Messages = append(olReq.Messages, ollamaMessage{
+				Role:     "tool",
+				Content:  msg.Content,
+				ToolName: toolNames[msg.ToolCallID],
+			})
+
+		default:
+			out := ollamaMessage{Role: string(msg.Role), Content: msg.Content}
+			for _, img := range msg.Images {
+				out.Images = append(out.Images, img.Data)
+			}
+			olReq.Messages = append(olReq.Messages, out)
+		}
+	}
+
+	httpReq, err := c.buildRequest(ctx, http.MethodPost, c.baseURL()+"/api/chat", olReq)
+	if err != nil {
+		return nil, err
+	}
+	c.setBearerAuth(httpReq)
+
+	return httpReq, nil
+}
+
+// parseOllamaResponse parses a non-streaming Ollama chat response.
+func (c *Client) parseOllamaResponse(body []byte) (*ChatResponse, error) {
+	var chunk ollamaChunk
+	if err := json.Unmarshal(body, &chunk); err != nil {
+		return nil, fmt.Errorf("ai: failed to parse ollama response: %w", err)
+	}
+	if chunk.Error != "" {
+		return nil, &LLMError{Code: http.StatusInternalServerError, Description: chunk.Error, Provider: c.config.Provider}
+	}
+
+	result := &ChatResponse{
+		Content:      chunk.Message.Content,
+		Model:        chunk.Model,
+		InputTokens:  chunk.PromptEvalCount,
+		OutputTokens: chunk.EvalCount,
+	}
+	result.ToolCalls = ollamaToolCalls(chunk.Message.ToolCalls, 0)
+
+	if result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, fmt.Errorf("ai: ollama returned no content")
+	}
+	return result, nil
+}
+
+// parseOllamaStream parses Ollama's newline-delimited JSON stream.
+func (c *Client) parseOllamaStream(r io.Reader, onDelta StreamHandler) (*ChatResponse, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+
+	result := &ChatResponse{}
+	var content strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("ai: failed to parse ollama stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, &LLMError{Code: http.StatusInternalServerError, Description: chunk.Error, Provider: c.config.Provider}
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		result.ToolCalls = append(result.ToolCalls, ollamaToolCalls(chunk.Message.ToolCalls, len(result.ToolCalls))...)
+		if chunk.Done {
+			result.InputTokens = chunk.PromptEvalCount
+			result.OutputTokens = chunk.EvalCount
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ai: failed to read stream: %w", err)
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// ollamaToolCalls converts Ollama tool calls, assigning the IDs Ollama lacks.
+// offset numbers calls already seen earlier in the same response.
+func ollamaToolCalls(calls []ollamaToolCall, offset int) []ToolCall {
+	var out []ToolCall
+	for i, tc := range calls {
+		args := tc.Function.Arguments
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		out = append(out, ToolCall{
+			ID:        fmt.Sprintf("call_%d", offset+i),
+			Name:      tc.Function.Name,
+			Arguments: args,
+		})
+	}
+	return out
+}
+
+// ListModels returns the models available on the provider's server.
+// It is supported by Ollama (GET /api/tags) and OpenAI-compatible servers
+// (GET /v1/models).
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	var url string
+	switch c.config.Provider {
+	case ProviderOllama:
+		url = c.baseURL() + "/api/tags"
+	case ProviderOpenAI, ProviderQwen, ProviderOpenAICompatible:
+		url = c.openAIURL("/models")
+	default:
+		return nil, fmt.Errorf("ai: listing models is not supported by %s", c.config.Provider)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ai: failed to create request: %w", err)
+	}
+	c.setBearerAuth(httpReq)
+
+	resp, err := c.config.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ai: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ai: failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, c.parseErrorResponse(body, resp.StatusCode, resp.Header, c.config.Provider)
+	}
+
+	var list struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("ai: failed to parse model list: %w", err)
+	}
+
+	var models []string
+	for _, m := range list.Models {
+		models = append(models, m.Name)
+	}
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// CheckModel verifies that the configured model is served by the provider.
+// If no model is configured, the first available one is selected. It returns
+// the available models and must be called before the client is shared.
+func (c *Client) CheckModel(ctx context.Context) ([]string, error) {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("ai: %s serves no models", c.config.Provider)
+	}
+
+	if c.config.Model == "" {
+		c.config.Model = models[0]
+		return models, nil
+	}
+	for _, m := range models {
+		if sameModel(m, c.config.Model) {
+			return models, nil
+		}
+	}
+	return models, fmt.Errorf("ai: model %q is not available on %s (available: %s)",
+		c.config.Model, c.baseURL(), strings.Join(models, ", "))
+}
+
+// sameModel compares model names, treating Ollama's implicit ":latest" tag
+// as optional.
+func sameModel(a, b string) bool {
+	return strings.TrimSuffix(a, ":latest") == strings.TrimSuffix(b, ":latest")
+}
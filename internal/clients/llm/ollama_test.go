@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func ollamaTestClient(t *testing.T, url, model string) *Client {
+	t.Helper()
+	client, err := NewClient("", WithProvider(ProviderOllama), WithModel(model), WithBaseURL(url))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestNewClient_LocalProvidersNeedNoKey(t *testing.T) {
+	for _, p := range []Provider{ProviderOllama, ProviderOpenAICompatible} {
+		if _, err := NewClient("", WithProvider(p)); err != nil {
+			t.Errorf("NewClient(%s) without key error = %v", p, err)
+		}
+	}
+	if _, err := NewClient("", WithProvider(ProviderOpenAI)); err == nil {
+		t.Error("NewClient(openai) without key should fail")
+	}
+
+	client, _ := NewClient("", WithProvider(ProviderOllama))
+	if client.Model() != "llama3.1" || client.baseURL() != "http://localhost:11434" {
+		t.Errorf("ollama defaults = %q %q", client.Model(), client.baseURL())
+	}
+}
+
+func TestCompleteOllama_ToolCalls(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Authorization header sent without an API key")
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"model":"llama3.1","message":{"role":"assistant","content":"",
+			"tool_calls":[{"function":{"name":"get_price","arguments":{"symbol":"BTC"}}}]},
+			"done":true,"prompt_eval_count":30,"eval_count":5}`)
+	}))
+	defer server.Close()
+
+	client := ollamaTestClient(t, server.URL, "llama3.1")
+	resp, err := client.Complete(context.Background(), ChatRequest{
+		System: "be brief",
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "price?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Name: "get_time", Arguments: json.RawMessage(`{}`)}}},
+			{Role: RoleTool, ToolCallID: "call_0", Content: "12:00"},
+		},
+		Tools: []ToolDefinition{{Name: "get_price", Description: "Get a price", Parameters: json.RawMessage(`{"type":"object"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "get_price" || resp.ToolCalls[0].ID == "" {
+		t.Fatalf("ToolCalls = %+v", resp.ToolCalls)
+	}
+	if string(resp.ToolCalls[0].Arguments) != `{"symbol":"BTC"}` {
+		t.Errorf("Arguments = %s", resp.ToolCalls[0].Arguments)
+	}
+	if resp.InputTokens != 30 || resp.OutputTokens != 5 || resp.Provider != ProviderOllama {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	msgs := got["messages"].([]interface{})
+	if len(msgs) != 4 || msgs[0].(map[string]interface{})["role"] != "system" {
+		t.Fatalf("messages = %v", msgs)
+	}
+	if name := msgs[3].(map[string]interface{})["tool_name"]; name != "get_time" {
+		t.Errorf("tool result tool_name = %v, want get_time", name)
+	}
+	if got["stream"] != false || len(got["tools"].([]interface{})) != 1 {
+		t.Errorf("request = %v", got)
+	}
+}
+
+func TestCompleteStreamOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":"Xin "},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":"chào"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":7,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	client := ollamaTestClient(t, server.URL, "llama3.1")
+	var deltas []string
+	resp, err := client.CompleteStream(context.Background(), helloRequest, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if resp.Content != "Xin chào" || len(deltas) != 2 {
+		t.Errorf("Content = %q, deltas = %q", resp.Content, deltas)
+	}
+	if resp.InputTokens != 7 || resp.OutputTokens != 2 {
+		t.Errorf("tokens = %d/%d, want 7/2", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestOllamaErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"mistral\" not found, try pulling it first"}`)
+	}))
+	defer server.Close()
+
+	_, err := ollamaTestClient(t, server.URL, "mistral").Complete(context.Background(), helloRequest)
+	if err == nil || !strings.Contains(err.Error(), "try pulling it first") {
+		t.Errorf("error = %v, want the server's message", err)
+	}
+}
+
+func TestCheckModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("path = %s, want /api/tags", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"llama3.1:latest"},{"name":"qwen2.5:7b"}]}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		model   string
+		wantErr bool
+	}{
+		{"llama3.1", false},
+		{"qwen2.5:7b", false},
+		{"mistral", true},
+	}
+	for _, tt := range tests {
+		models, err := ollamaTestClient(t, server.URL, tt.model).CheckModel(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckModel(%q) error = %v, wantErr %v", tt.model, err, tt.wantErr)
+		}
+		if len(models) != 2 {
+			t.Errorf("CheckModel(%q) models = %v", tt.model, models)
+		}
+	}
+}
+
+func TestCheckModel_OpenAICompatibleSelectsFirst(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v1/models" {
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"Qwen/Qwen2.5-7B-Instruct"}]}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"model":"Qwen/Qwen2.5-7B-Instruct"`) {
+			t.Errorf("request body = %s, want the discovered model", body)
+		}
+		fmt.Fprint(w, `{"model":"Qwen/Qwen2.5-7B-Instruct","choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient("", WithProvider(ProviderOpenAICompatible), WithBaseURL(server.URL+"/v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CheckModel(context.Background()); err != nil {
+		t.Fatalf("CheckModel() error = %v", err)
+	}
+	if client.Model() != "Qwen/Qwen2.5-7B-Instruct" {
+		t.Errorf("Model() = %q, want the first served model", client.Model())
+	}
+	if _, err := client.Complete(context.Background(), helloRequest); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if len(paths) != 2 || paths[1] != "/v1/chat/completions" {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+func TestOpenAIURL(t *testing.T) {
+	tests := []struct {
+		provider Provider
+		base     string
+		want     string
+	}{
+		// Built-in default base URLs get the /v1 prefix
+		{ProviderOpenAI, "", "https://api.openai.com/v1/chat/completions"},
+		{ProviderQwen, "", "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions"},
+		{ProviderOpenAICompatible, "", "http://localhost:8000/v1/chat/completions"},
+		// Configured base URLs are used as given
+		{ProviderOpenAI, "https://api.openai.com/v1", "https://api.openai.com/v1/chat/completions"},
+		{ProviderOpenAICompatible, "http://localhost:8000/v1/", "http://localhost:8000/v1/chat/completions"},
+		{ProviderOpenAI, "https://generativelanguage.googleapis.com/v1beta/openai", "https://generativelanguage.googleapis.com/v1beta/openai/chat/completions"},
+		// A full chat completions endpoint is accepted
+		{ProviderOpenAI, "https://api.openai.com/v1/chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{ProviderQwen, "https://example.com/compatible-mode/v1/chat/completions/", "https://example.com/compatible-mode/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		client, err := NewClient("test-key", WithProvider(tt.provider), WithBaseURL(tt.base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.openAIURL("/chat/completions"); got != tt.want {
+			t.Errorf("openAIURL(%s, %q) = %q, want %q", tt.provider, tt.base, got, tt.want)
+		}
+	}
+
+	// Other endpoints share the base of a full chat completions URL
+	client, _ := NewClient("test-key", WithProvider(ProviderOpenAI), WithBaseURL("https://api.openai.com/v1/chat/completions"))
+	if got := client.openAIURL("/models"); got != "https://api.openai.com/v1/models" {
+		t.Errorf("openAIURL(/models) = %q", got)
+	}
+}
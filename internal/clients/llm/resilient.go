@@ -0,0 +1,254 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ResilientClient wraps an ordered chain of Clients. Each request goes to the
+// first client; retryable failures (rate limits, server errors, network
+// errors) are retried with jittered exponential backoff, honoring RetryAfter,
+// and when a client keeps failing the request falls over to the next one in
+// the chain (e.g. Gemini → Claude → OpenAI).
+type ResilientClient struct {
+	clients       []*Client
+	maxRetries    int
+	initialDelay  time.Duration
+	maxDelay      time.Duration
+	maxRetryAfter time.Duration
+	logger        *slog.Logger
+	sleep         func(ctx context.Context, d time.Duration) error
+}
+
+// ResilientOption is a functional option for configuring ResilientClient.
+type ResilientOption func(*ResilientClient)
+
+// WithMaxRetries sets how many times a request is retried on the same client
+// before falling over to the next one.
+func WithMaxRetries(n int) ResilientOption {
+	return func(r *ResilientClient) {
+		r.maxRetries = n
+	}
+}
+
+// WithRetryBackoff sets the initial and maximum delay between retries.
+func WithRetryBackoff(initial, max time.Duration) ResilientOption {
+	return func(r *ResilientClient) {
+		r.initialDelay = initial
+		r.maxDelay = max
+	}
+}
+
+// WithMaxRetryAfter sets the longest RetryAfter the client waits for; a
+// provider asking for a longer pause is skipped in favor of the next one.
+func WithMaxRetryAfter(d time.Duration) ResilientOption {
+	return func(r *ResilientClient) {
+		r.maxRetryAfter = d
+	}
+}
+
+// WithResilientLogger sets the logger.
+func WithResilientLogger(logger *slog.Logger) ResilientOption {
+	return func(r *ResilientClient) {
+		r.logger = logger
+	}
+}
+
+// NewResilientClient creates a ResilientClient trying clients in order.
+func NewResilientClient(clients []*Client, opts ...ResilientOption) (*ResilientClient, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("ai: at least one client is required")
+	}
+	r := &ResilientClient{
+		clients:       clients,
+		maxRetries:    2,
+		initialDelay:  500 * time.Millisecond,
+		maxDelay:      10 * time.Second,
+		maxRetryAfter: 30 * time.Second,
+		logger:        slog.Default(),
+		sleep:         sleepContext,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// Complete sends the request through the chain until a client succeeds.
+func (r *ResilientClient) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return r.do(ctx, req, func(c *Client, req ChatRequest) (*ChatResponse, error) {
+		return c.Complete(ctx, req)
+	})
+}
+
+// CompleteStream streams the request through the chain until a client
+// succeeds. Once a client has emitted text the request is no longer retried,
+// since the caller would see the text twice.
+func (r *ResilientClient) CompleteStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	var emitted bool
+	return r.do(ctx, req, func(c *Client, req ChatRequest) (*ChatResponse, error) {
+		resp, err := c.CompleteStream(ctx, req, func(delta string) {
+			emitted = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		if err != nil && emitted {
+			return nil, &partialStreamError{err: err}
+		}
+		return resp, err
+	})
+}
+
+// partialStreamError marks a stream that failed after emitting text.
+type partialStreamError struct {
+	err error
+}
+
+func (e *partialStreamError) Error() string { return e.err.Error() }
+func (e *partialStreamError) Unwrap() error { return e.err }
+
+// do runs call against each client in turn, retrying transient failures.
+func (r *ResilientClient) do(ctx context.Context, req ChatRequest, call func(*Client, ChatRequest) (*ChatResponse, error)) (*ChatResponse, error) {
+	var lastErr error
+	for i, client := range r.clients {
+		// The model in the request belongs to the primary client
+		clientReq := req
+		if i > 0 {
+			clientReq.Model = ""
+		}
+
+		for attempt := 0; ; attempt++ {
+			resp, err := call(client, clientReq)
+			if err == nil {
+				r.logger.Info("ai response served",
+					slog.String("provider", string(client.Provider())),
+					slog.String("model", client.Model()),
+					slog.Int("attempt", attempt+1),
+					slog.Bool("fallback", i > 0),
+				)
+				return resp, nil
+			}
+			lastErr = err
+
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			var partial *partialStreamError
+			if errors.As(err, &partial) {
+				return nil, partial.err
+			}
+
+			delay, retry := r.retryDelay(err, attempt)
+			if !retry {
+				r.logger.Warn("ai provider failed",
+					slog.String("provider", string(client.Provider())),
+					slog.String("model", client.Model()),
+					slog.Int("attempt", attempt+1),
+					slog.String("error", err.Error()),
+				)
+				break
+			}
+
+			r.logger.Warn("ai request failed, retrying",
+				slog.String("provider", string(client.Provider())),
+				slog.Int("attempt", attempt+1),
+				slog.Duration("delay", delay),
+				slog.String("error", err.Error()),
+			)
+			if err := r.sleep(ctx, delay); err != nil {
+				return nil, lastErr
+			}
+		}
+
+		if i+1 < len(r.clients) {
+			next := r.clients[i+1]
+			r.logger.Warn("ai falling back to next provider",
+				slog.String("from", string(client.Provider())),
+				slog.String("to", string(next.Provider())),
+				slog.String("model", next.Model()),
+			)
+		}
+	}
+
+	if len(r.clients) > 1 {
+		return nil, fmt.Errorf("ai: all %d providers failed: %w", len(r.clients), lastErr)
+	}
+	return nil, lastErr
+}
+
+// retryDelay reports whether err should be retried on the same client after
+// attempt, and how long to wait first.
+func (r *ResilientClient) retryDelay(err error, attempt int) (time.Duration, bool) {
+	if attempt >= r.maxRetries {
+		return 0, false
+	}
+
+	var llmErr *LLMError
+	if !errors.As(err, &llmErr) {
+		if !transient(err) {
+			// E.g. a request that cannot be built; it would fail again
+			return 0, false
+		}
+		return r.backoff(attempt), true
+	}
+	if !llmErr.IsRetryable() {
+		return 0, false
+	}
+
+	delay := r.backoff(attempt)
+	if llmErr.RetryAfter > 0 {
+		retryAfter := time.Duration(llmErr.RetryAfter) * time.Second
+		if retryAfter > r.maxRetryAfter {
+			return 0, false
+		}
+		delay = max(delay, retryAfter)
+	}
+	return delay, true
+}
+
+// transient reports whether err, which carries no answer of the provider,
+// comes from the network or the attempt timing out, so trying again may
+// succeed.
+func transient(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var urlErr *url.Error
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		errors.As(err, &urlErr) && urlErr.Timeout() ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoff returns the jittered exponential delay before retry attempt+1:
+// a random duration between half and all of initialDelay·2^attempt.
+func (r *ResilientClient) backoff(attempt int) time.Duration {
+	d := r.initialDelay
+	for i := 0; i < attempt && d < r.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, r.maxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
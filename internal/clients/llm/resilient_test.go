@@ -0,0 +1,244 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers OpenAI-style requests with the given status codes in
+// order, then with a successful reply.
+func scriptedServer(t *testing.T, reply string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(statuses) {
+			if statuses[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(statuses[n-1])
+			fmt.Fprint(w, `{"error":{"message":"try later"}}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":   "test-model",
+			"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": reply}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func openAITestClient(t *testing.T, url, model string) *Client {
+	t.Helper()
+	client, err := NewClient("test-key",
+		WithProvider(ProviderOpenAI),
+		WithModel(model),
+		WithBaseURL(url),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// recordSleeps replaces real waiting with a log of requested delays.
+func recordSleeps(r *ResilientClient) *[]time.Duration {
+	var delays []time.Duration
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return &delays
+}
+
+var helloRequest = ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: "hi"}}}
+
+func TestResilientClient_RetriesHonoringRetryAfter(t *testing.T) {
+	server, calls := scriptedServer(t, "hello", http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	r, _ := NewResilientClient([]*Client{openAITestClient(t, server.URL, "primary")},
+		WithRetryBackoff(10*time.Millisecond, 100*time.Millisecond),
+	)
+	delays := recordSleeps(r)
+
+	resp, err := r.Complete(context.Background(), helloRequest)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "hello" || resp.Provider != ProviderOpenAI {
+		t.Errorf("resp = %+v, want reply from the primary", resp)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+	if len(*delays) != 2 || (*delays)[0] < time.Second {
+		t.Errorf("delays = %v, want first wait to honor Retry-After of 1s", *delays)
+	}
+	if d := (*delays)[1]; d < 10*time.Millisecond || d > 20*time.Millisecond {
+		t.Errorf("second delay = %v, want jittered backoff between 10ms and 20ms", d)
+	}
+}
+
+func TestResilientClient_FallsBack(t *testing.T) {
+	primary, primaryCalls := scriptedServer(t, "primary", 503, 503, 503, 503)
+	secondary, _ := scriptedServer(t, "secondary")
+
+	r, _ := NewResilientClient([]*Client{
+		openAITestClient(t, primary.URL, "model-a"),
+		openAITestClient(t, secondary.URL, "model-b"),
+	}, WithMaxRetries(1))
+	recordSleeps(r)
+
+	resp, err := r.Complete(context.Background(), ChatRequest{Model: "model-a", Messages: helloRequest.Messages})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "secondary" {
+		t.Errorf("Content = %q, want reply from the fallback", resp.Content)
+	}
+	if primaryCalls.Load() != 2 {
+		t.Errorf("primary called %d times, want 1 try + 1 retry", primaryCalls.Load())
+	}
+}
+
+func TestResilientClient_NonRetryableSkipsToFallback(t *testing.T) {
+	primary, primaryCalls := scriptedServer(t, "primary", http.StatusUnauthorized)
+	secondary, _ := scriptedServer(t, "secondary")
+
+	r, _ := NewResilientClient([]*Client{
+		openAITestClient(t, primary.URL, "a"),
+		openAITestClient(t, secondary.URL, "b"),
+	})
+	delays := recordSleeps(r)
+
+	resp, err := r.Complete(context.Background(), helloRequest)
+	if err != nil || resp.Content != "secondary" {
+		t.Fatalf("Complete() = %v, %v; want fallback reply", resp, err)
+	}
+	if primaryCalls.Load() != 1 || len(*delays) != 0 {
+		t.Errorf("401 should not be retried (calls=%d, sleeps=%d)", primaryCalls.Load(), len(*delays))
+	}
+}
+
+func TestResilientClient_RetriesOnlyNetworkErrors(t *testing.T) {
+	// Nothing listens on a closed server's address
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	r, _ := NewResilientClient([]*Client{openAITestClient(t, closed.URL, "a")}, WithMaxRetries(2))
+	delays := recordSleeps(r)
+	if _, err := r.Complete(context.Background(), helloRequest); err == nil {
+		t.Fatal("Complete() error = nil, want connection refused")
+	}
+	if len(*delays) != 2 {
+		t.Errorf("connection failures retried %d times, want 2", len(*delays))
+	}
+
+	// A request that cannot be built goes straight to the fallback
+	secondary, _ := scriptedServer(t, "secondary")
+	r, _ = NewResilientClient([]*Client{
+		openAITestClient(t, "http://bad host", "a"),
+		openAITestClient(t, secondary.URL, "b"),
+	}, WithMaxRetries(2))
+	delays = recordSleeps(r)
+	resp, err := r.Complete(context.Background(), helloRequest)
+	if err != nil || resp.Content != "secondary" {
+		t.Fatalf("Complete() = %v, %v; want fallback reply", resp, err)
+	}
+	if len(*delays) != 0 {
+		t.Errorf("invalid request retried %d times, want 0", len(*delays))
+	}
+}
+
+func TestResilientClient_AllFail(t *testing.T) {
+	server, _ := scriptedServer(t, "", 500, 500, 500, 500, 500, 500)
+	r, _ := NewResilientClient([]*Client{
+		openAITestClient(t, server.URL, "a"),
+		openAITestClient(t, server.URL, "b"),
+	}, WithMaxRetries(1))
+	recordSleeps(r)
+
+	_, err := r.Complete(context.Background(), helloRequest)
+	var llmErr *LLMError
+	if !errors.As(err, &llmErr) || llmErr.Code != 500 {
+		t.Fatalf("error = %v, want the last LLMError wrapped", err)
+	}
+	if !strings.Contains(err.Error(), "all 2 providers failed") {
+		t.Errorf("error = %q", err)
+	}
+}
+
+func TestResilientClient_LongRetryAfterFallsBack(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer primary.Close()
+	secondary, _ := scriptedServer(t, "secondary")
+
+	r, _ := NewResilientClient([]*Client{
+		openAITestClient(t, primary.URL, "a"),
+		openAITestClient(t, secondary.URL, "b"),
+	})
+	delays := recordSleeps(r)
+
+	resp, err := r.Complete(context.Background(), helloRequest)
+	if err != nil || resp.Content != "secondary" {
+		t.Fatalf("Complete() = %v, %v; want fallback reply", resp, err)
+	}
+	if len(*delays) != 0 {
+		t.Errorf("delays = %v, an hour-long Retry-After should not be waited for", *delays)
+	}
+}
+
+func TestResilientClient_StreamNotRetriedAfterText(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"busy\"}}\n\n")
+	}))
+	defer server.Close()
+	secondary, secondaryCalls := scriptedServer(t, "secondary")
+
+	claude, err := NewClient("test-key", WithProvider(ProviderClaude), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := NewResilientClient([]*Client{
+		claude,
+		openAITestClient(t, secondary.URL, "b"),
+	})
+	recordSleeps(r)
+
+	var text strings.Builder
+	_, err = r.CompleteStream(context.Background(), helloRequest, func(delta string) {
+		text.WriteString(delta)
+	})
+	if err == nil {
+		t.Fatal("CompleteStream() should fail after a partial stream")
+	}
+	if calls.Load() != 1 || secondaryCalls.Load() != 0 || text.String() != "Hel" {
+		t.Errorf("calls=%d secondary=%d text=%q, want no retry after text was emitted",
+			calls.Load(), secondaryCalls.Load(), text.String())
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	c := &Client{}
+	header := http.Header{}
+	header.Set("Retry-After", "12")
+	err := c.parseErrorResponse([]byte(`{}`), http.StatusServiceUnavailable, header, ProviderClaude).(*LLMError)
+	if err.RetryAfter != 12 {
+		t.Errorf("RetryAfter = %d, want 12 from the header", err.RetryAfter)
+	}
+}
@@ -0,0 +1,404 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// StreamHandler receives incremental text deltas as the model generates them.
+type StreamHandler func(delta string)
+
+// maxSSELineSize bounds a single server-sent event line (large tool-call chunks).
+const maxSSELineSize = 1 << 20
+
+// CompleteStream sends a streaming chat completion request to the configured
+// AI provider. Text deltas are passed to onDelta as they arrive; the returned
+// ChatResponse aggregates the full content, tool calls and token usage.
+func (c *Client) CompleteStream(ctx context.Context, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	if req.Model == "" {
+		req.Model = c.config.Model
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = c.config.MaxTokens
+	}
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+
+	c.config.Logger.Debug("ai streaming request",
+		slog.String("provider", string(c.config.Provider)),
+		slog.String("model", req.Model),
+		slog.Int("messages", len(req.Messages)),
+	)
+
+	var (
+		httpReq *http.Request
+		err     error
+		parse   func(io.Reader, StreamHandler) (*ChatResponse, error)
+	)
+
+	switch c.config.Provider {
+	case ProviderGemini:
+		httpReq, err = c.buildGeminiRequest(ctx, req, true)
+		parse = c.parseGeminiStream
+	case ProviderClaude:
+		httpReq, err = c.buildClaudeRequest(ctx, req, true)
+		parse = c.parseClaudeStream
+	case ProviderOpenAI, ProviderQwen, ProviderOpenAICompatible:
+		httpReq, err = c.buildOpenAIRequest(ctx, req, true)
+		parse = c.parseOpenAIStream
+	case ProviderOllama:
+		httpReq, err = c.buildOllamaRequest(ctx, req, true)
+		parse = c.parseOllamaStream
+	default:
+		return nil, fmt.Errorf("ai: unsupported provider: %s", c.config.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Provider != ProviderOllama {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.config.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ai: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("ai: failed to read response: %w", err)
+		}
+		return nil, c.parseErrorResponse(body, resp.StatusCode, resp.Header, c.config.Provider)
+	}
+
+	result, err := parse(resp.Body, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, fmt.Errorf("ai: %s stream returned no content", c.config.Provider)
+	}
+
+	result.Provider = c.config.Provider
+	return result, nil
+}
+
+// readSSE reads a server-sent event stream and calls fn for every event with
+// its event name (may be empty) and the concatenated data lines.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+
+	var event string
+	var data []string
+
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event = ""
+		data = data[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ai: failed to read stream: %w", err)
+	}
+
+	// Flush a trailing event without a terminating blank line
+	return dispatch()
+}
+
+// parseGeminiStream parses a Gemini streamGenerateContent SSE stream.
+// Each event carries a partial GenerateContentResponse.
+func (c *Client) parseGeminiStream(r io.Reader, onDelta StreamHandler) (*ChatResponse, error) {
+	result := &ChatResponse{}
+	var content strings.Builder
+
+	err := readSSE(r, func(_, data string) error {
+		var chunk struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text         string        `json:"text,omitempty"`
+						FunctionCall *functionCall `json:"functionCall,omitempty"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+			ModelVersion string `json:"modelVersion"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("ai: failed to parse gemini stream chunk: %w", err)
+		}
+
+		if chunk.ModelVersion != "" {
+			result.Model = chunk.ModelVersion
+		}
+		if chunk.UsageMetadata.PromptTokenCount > 0 {
+			result.InputTokens = chunk.UsageMetadata.PromptTokenCount
+		}
+		if chunk.UsageMetadata.CandidatesTokenCount > 0 {
+			result.OutputTokens = chunk.UsageMetadata.CandidatesTokenCount
+		}
+
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.FunctionCall != nil {
+				result.ToolCalls = append(result.ToolCalls, ToolCall{
+					ID:        part.FunctionCall.Name, // Gemini uses name as ID
+					Name:      part.FunctionCall.Name,
+					Arguments: part.FunctionCall.Args,
+				})
+			} else if part.Text != "" {
+				content.WriteString(part.Text)
+				onDelta(part.Text)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// parseClaudeStream parses an Anthropic messages SSE stream.
+func (c *Client) parseClaudeStream(r io.Reader, onDelta StreamHandler) (*ChatResponse, error) {
+	type toolBlock struct {
+		id   string
+		name string
+		args strings.Builder
+	}
+
+	result := &ChatResponse{}
+	var content strings.Builder
+	blocks := make(map[int]*toolBlock)
+	var order []int
+
+	err := readSSE(r, func(event, data string) error {
+		var ev struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				Model string `json:"model"`
+				Usage struct {
+					InputTokens  int `json:"input_tokens"`
+					OutputTokens int `json:"output_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("ai: failed to parse claude stream event: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			result.Model = ev.Message.Model
+			result.InputTokens = ev.Message.Usage.InputTokens
+			result.OutputTokens = ev.Message.Usage.OutputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				blocks[ev.Index] = &toolBlock{id: ev.ContentBlock.ID, name: ev.ContentBlock.Name}
+				order = append(order, ev.Index)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				content.WriteString(ev.Delta.Text)
+				onDelta(ev.Delta.Text)
+			case "input_json_delta":
+				if b, ok := blocks[ev.Index]; ok {
+					b.args.WriteString(ev.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if ev.Usage.OutputTokens > 0 {
+				result.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "error":
+			code := http.StatusInternalServerError
+			if ev.Error.Type == "overloaded_error" {
+				code = 529
+			}
+			return &LLMError{
+				Code:        code,
+				Description: ev.Error.Message,
+				Provider:    ProviderClaude,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = content.String()
+	for _, idx := range order {
+		b := blocks[idx]
+		args := b.args.String()
+		if args == "" {
+			args = "{}"
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        b.id,
+			Name:      b.name,
+			Arguments: json.RawMessage(args),
+		})
+	}
+
+	return result, nil
+}
+
+// parseOpenAIStream parses an OpenAI-compatible chat completion SSE stream.
+// Tool call fragments are merged by their index.
+func (c *Client) parseOpenAIStream(r io.Reader, onDelta StreamHandler) (*ChatResponse, error) {
+	type toolAcc struct {
+		id   string
+		name string
+		args strings.Builder
+	}
+
+	result := &ChatResponse{}
+	var content strings.Builder
+	calls := make(map[int]*toolAcc)
+
+	err := readSSE(r, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("ai: failed to parse openai stream chunk: %w", err)
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.InputTokens = chunk.Usage.PromptTokens
+			result.OutputTokens = chunk.Usage.CompletionTokens
+		}
+
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+		for _, tc := range delta.ToolCalls {
+			acc, ok := calls[tc.Index]
+			if !ok {
+				acc = &toolAcc{}
+				calls[tc.Index] = acc
+			}
+			if tc.ID != "" {
+				acc.id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				acc.name = tc.Function.Name
+			}
+			acc.args.WriteString(tc.Function.Arguments)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = content.String()
+
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		acc := calls[idx]
+		args := acc.args.String()
+		if args == "" {
+			args = "{}"
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        acc.id,
+			Name:      acc.name,
+			Arguments: json.RawMessage(args),
+		})
+	}
+
+	return result, nil
+}
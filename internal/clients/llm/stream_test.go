@@ -0,0 +1,205 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sseServer returns a test server that replies with the given SSE payload and
+// records the decoded request body.
+func sseServer(t *testing.T, payload string, reqBody *map[string]interface{}, path *string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path != nil {
+			*path = r.URL.Path + "?" + r.URL.RawQuery
+		}
+		if reqBody != nil {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, reqBody)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, payload)
+	}))
+}
+
+func TestCompleteStreamGemini(t *testing.T) {
+	payload := "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n" +
+		"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"lo!\"}]}}],\"usageMetadata\":{\"promptTokenCount\":7,\"candidatesTokenCount\":2},\"modelVersion\":\"gemini-2.0-flash\"}\n\n"
+
+	var path string
+	server := sseServer(t, payload, nil, &path)
+	defer server.Close()
+
+	client, _ := NewClient("test-key",
+		WithProvider(ProviderGemini),
+		WithLLMHTTPClient(&urlRewriteClient{target: server.URL, inner: http.DefaultClient}),
+	)
+
+	var deltas []string
+	resp, err := client.CompleteStream(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Hi"}},
+	}, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+
+	if !strings.Contains(path, ":streamGenerateContent") || !strings.Contains(path, "alt=sse") {
+		t.Errorf("path = %q, want streamGenerateContent with alt=sse", path)
+	}
+	if resp.Content != "Hello!" {
+		t.Errorf("Content = %q, want %q", resp.Content, "Hello!")
+	}
+	if strings.Join(deltas, "|") != "Hel|lo!" {
+		t.Errorf("deltas = %v, want [Hel lo!]", deltas)
+	}
+	if resp.InputTokens != 7 || resp.OutputTokens != 2 {
+		t.Errorf("tokens = %d/%d, want 7/2", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestCompleteStreamClaude(t *testing.T) {
+	payload := "event: message_start\n" +
+		"data: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-sonnet-4-20250514\",\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n" +
+		"event: content_block_start\n" +
+		"data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+		"event: content_block_delta\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Checking \"}}\n\n" +
+		"event: content_block_start\n" +
+		"data: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"get_ticker_prices\",\"input\":{}}}\n\n" +
+		"event: content_block_delta\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"symbols\\\":\"}}\n\n" +
+		"event: content_block_delta\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"[\\\"BTCUSDT\\\"]}\"}}\n\n" +
+		"event: message_delta\n" +
+		"data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":30}}\n\n" +
+		"event: message_stop\n" +
+		"data: {\"type\":\"message_stop\"}\n\n"
+
+	var reqBody map[string]interface{}
+	server := sseServer(t, payload, &reqBody, nil)
+	defer server.Close()
+
+	client, _ := NewClient("test-key",
+		WithProvider(ProviderClaude),
+		WithBaseURL(server.URL),
+	)
+
+	resp, err := client.CompleteStream(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "BTC price?"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+
+	if reqBody["stream"] != true {
+		t.Errorf("stream = %v, want true", reqBody["stream"])
+	}
+	if resp.Content != "Checking " {
+		t.Errorf("Content = %q, want %q", resp.Content, "Checking ")
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %d", len(resp.ToolCalls))
+	}
+	if resp.ToolCalls[0].ID != "toolu_1" || resp.ToolCalls[0].Name != "get_ticker_prices" {
+		t.Errorf("ToolCalls[0] = %+v", resp.ToolCalls[0])
+	}
+	if string(resp.ToolCalls[0].Arguments) != `{"symbols":["BTCUSDT"]}` {
+		t.Errorf("Arguments = %s", resp.ToolCalls[0].Arguments)
+	}
+	if resp.InputTokens != 12 || resp.OutputTokens != 30 {
+		t.Errorf("tokens = %d/%d, want 12/30", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestCompleteStreamClaudeError(t *testing.T) {
+	payload := "event: error\n" +
+		"data: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+
+	server := sseServer(t, payload, nil, nil)
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithProvider(ProviderClaude), WithBaseURL(server.URL))
+
+	_, err := client.CompleteStream(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Hi"}},
+	}, nil)
+
+	llmErr, ok := err.(*LLMError)
+	if !ok {
+		t.Fatalf("expected *LLMError, got %T (%v)", err, err)
+	}
+	if !llmErr.IsRetryable() {
+		t.Error("overloaded stream error should be retryable")
+	}
+}
+
+func TestCompleteStreamOpenAI(t *testing.T) {
+	payload := "data: {\"model\":\"gpt-4o\",\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_spot_balances\",\"arguments\":\"\"}}]}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{}\"}}]}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"get_futures_account\"}}]}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Done\"}}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":4}}\n\n" +
+		"data: [DONE]\n\n"
+
+	var reqBody map[string]interface{}
+	server := sseServer(t, payload, &reqBody, nil)
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithProvider(ProviderOpenAI), WithBaseURL(server.URL))
+
+	var got strings.Builder
+	resp, err := client.CompleteStream(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Balances"}},
+	}, func(d string) { got.WriteString(d) })
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+
+	if reqBody["stream"] != true {
+		t.Errorf("stream = %v, want true", reqBody["stream"])
+	}
+	if opts, ok := reqBody["stream_options"].(map[string]interface{}); !ok || opts["include_usage"] != true {
+		t.Errorf("stream_options = %v, want include_usage=true", reqBody["stream_options"])
+	}
+	if resp.Content != "Done" || got.String() != "Done" {
+		t.Errorf("Content = %q, deltas = %q, want %q", resp.Content, got.String(), "Done")
+	}
+	if len(resp.ToolCalls) != 2 || resp.ToolCalls[0].ID != "call_1" || string(resp.ToolCalls[0].Arguments) != "{}" {
+		t.Fatalf("ToolCalls = %+v", resp.ToolCalls)
+	}
+	// A call streamed without argument deltas gets an empty object
+	if call := resp.ToolCalls[1]; call.ID != "call_2" || string(call.Arguments) != "{}" {
+		t.Errorf("ToolCalls[1] = %+v, want call_2 with {} arguments", call)
+	}
+	if resp.InputTokens != 20 || resp.OutputTokens != 4 {
+		t.Errorf("tokens = %d/%d, want 20/4", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestCompleteStreamHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit exceeded"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("test-key", WithProvider(ProviderOpenAI), WithBaseURL(server.URL))
+
+	_, err := client.CompleteStream(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Hi"}},
+	}, nil)
+
+	llmErr, ok := err.(*LLMError)
+	if !ok {
+		t.Fatalf("expected *LLMError, got %T (%v)", err, err)
+	}
+	if llmErr.Code != http.StatusTooManyRequests {
+		t.Errorf("Code = %d, want 429", llmErr.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// messageOverhead approximates the tokens each message costs for its role and
+// framing, independent of its content.
+const messageOverhead = 4
+
+// EstimateTokens approximates the number of tokens in text without a
+// provider-specific tokenizer. ASCII text averages about four characters per
+// token; other scripts (including Vietnamese diacritics) tokenize far less
+// efficiently, so each non-ASCII rune is counted as half a token. The estimate
+// errs on the high side.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	var ascii, other int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + (other+1)/2
+}
+
+// imageTokens approximates the tokens of one attached image. Providers charge
+// between a few hundred and about 1600 tokens depending on resolution.
+const imageTokens = 1000
+
+// EstimateMessageTokens approximates the tokens a message occupies in the
+// context window, including tool calls, their arguments and images.
+func EstimateMessageTokens(msg ChatMessage) int {
+	n := messageOverhead + EstimateTokens(msg.Content) + len(msg.Images)*imageTokens
+	for _, call := range msg.ToolCalls {
+		n += messageOverhead + EstimateTokens(call.Name) + EstimateTokens(string(call.Arguments))
+	}
+	return n
+}
+
+// EstimateMessagesTokens approximates the tokens of a whole conversation.
+func EstimateMessagesTokens(msgs []ChatMessage) int {
+	var n int
+	for _, msg := range msgs {
+		n += EstimateMessageTokens(msg)
+	}
+	return n
+}
+
+// defaultContextWindow is assumed for models missing from contextWindows.
+const defaultContextWindow = 32_768
+
+// contextWindows maps model name prefixes to their context window in tokens.
+// The longest matching prefix wins.
+var contextWindows = map[string]int{
+	"gemini-1.5-pro":   2_097_152,
+	"gemini-1.5-flash": 1_048_576,
+	"gemini-2":         1_048_576,
+	"gemini-pro":       32_768,
+	"claude":           200_000,
+	"gpt-4.1":          1_047_576,
+	"gpt-4o":           128_000,
+	"gpt-4-turbo":      128_000,
+	"gpt-4":            8_192,
+	"gpt-3.5-turbo":    16_385,
+	"o1":               200_000,
+	"o3":               200_000,
+	"o4":               200_000,
+	"qwen-turbo":       1_000_000,
+	"qwen-plus":        131_072,
+	"qwen-max":         32_768,
+	"qwen":             32_768,
+}
+
+// ContextWindow returns the context window of model in tokens, or a
+// conservative default for unknown models.
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	best, window := -1, defaultContextWindow
+	for prefix, n := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, window = len(prefix), n
+		}
+	}
+	return window
+}
+
+// promptReserve is kept free in the context window for the system prompt,
+// tool definitions and the new user message.
+const promptReserve = 4096
+
+// maxAutoHistoryBudget caps the automatic history budget: long before a
+// million-token window fills up, every turn becomes slow and expensive.
+const maxAutoHistoryBudget = 32_000
+
+// HistoryBudget returns how many tokens of conversation history fit into the
+// context window of model next to a reply of up to maxOutputTokens.
+func HistoryBudget(model string, maxOutputTokens int) int {
+	budget := ContextWindow(model) - maxOutputTokens - promptReserve
+	return min(max(budget, 1024), maxAutoHistoryBudget)
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{strings.Repeat("a", 400), 100},
+		{"đầu tư", 3}, // 3 ASCII runes = 1 token, 3 accented runes = 2 tokens
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateMessageTokens(t *testing.T) {
+	plain := EstimateMessageTokens(ChatMessage{Role: RoleUser, Content: "hello"})
+	if plain != messageOverhead+2 {
+		t.Errorf("plain message = %d tokens, want %d", plain, messageOverhead+2)
+	}
+
+	withCall := EstimateMessageTokens(ChatMessage{
+		Role: RoleAssistant,
+		ToolCalls: []ToolCall{
+			{Name: "get_price", Arguments: json.RawMessage(`{"symbol":"BTCUSDT"}`)},
+		},
+	})
+	if withCall <= messageOverhead*2 {
+		t.Errorf("tool call message = %d tokens, want arguments counted", withCall)
+	}
+
+	withImage := EstimateMessageTokens(ChatMessage{Role: RoleUser, Content: "hello", Images: []Image{{MimeType: "image/jpeg"}}})
+	if withImage != plain+imageTokens {
+		t.Errorf("image message = %d tokens, want %d", withImage, plain+imageTokens)
+	}
+
+	total := EstimateMessagesTokens([]ChatMessage{{Content: "hello"}, {Content: "hello"}})
+	if total != 2*plain {
+		t.Errorf("EstimateMessagesTokens = %d, want %d", total, 2*plain)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gemini-2.0-flash", 1_048_576},
+		{"gemini-1.5-pro-latest", 2_097_152},
+		{"claude-sonnet-4-20250514", 200_000},
+		{"gpt-4o-mini", 128_000},
+		{"gpt-4", 8_192},
+		{"GPT-4.1", 1_047_576},
+		{"qwen-plus", 131_072},
+		{"llama3", defaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := ContextWindow(tt.model); got != tt.want {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryBudget(t *testing.T) {
+	if got := HistoryBudget("gemini-2.0-flash", 1024); got != maxAutoHistoryBudget {
+		t.Errorf("large window budget = %d, want capped at %d", got, maxAutoHistoryBudget)
+	}
+	if got := HistoryBudget("gpt-4", 1024); got != 8_192-1024-promptReserve {
+		t.Errorf("gpt-4 budget = %d, want window minus output and reserve", got)
+	}
+}
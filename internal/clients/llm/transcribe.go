@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// DefaultTranscriptionModel is OpenAI's speech-to-text model. Local whisper
+// servers usually accept it as an alias for their loaded model.
+const DefaultTranscriptionModel = "whisper-1"
+
+// Transcriber converts speech to text through an OpenAI-compatible
+// /audio/transcriptions endpoint: OpenAI itself, or a local whisper server
+// (faster-whisper-server, whisper.cpp, LocalAI, ...).
+type Transcriber struct {
+	client   *Client
+	language string
+}
+
+// TranscriberOption is a functional option for configuring a Transcriber.
+type TranscriberOption func(*Transcriber)
+
+// WithLanguage sets the spoken language as an ISO-639-1 code (e.g. "vi").
+// It improves accuracy and latency; by default the language is detected.
+func WithLanguage(lang string) TranscriberOption {
+	return func(t *Transcriber) {
+		t.language = lang
+	}
+}
+
+// NewTranscriber creates a Transcriber on top of client, which supplies the
+// base URL, API key, model and HTTP settings. The client must use the openai
+// or openai-compatible provider and be created with a transcription model
+// (e.g. WithModel(DefaultTranscriptionModel)).
+func NewTranscriber(client *Client, opts ...TranscriberOption) (*Transcriber, error) {
+	switch client.Provider() {
+	case ProviderOpenAI, ProviderOpenAICompatible:
+	default:
+		return nil, fmt.Errorf("ai: transcription is not supported by %s", client.Provider())
+	}
+
+	t := &Transcriber{client: client}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+// Transcribe returns the text spoken in audio. filename tells the server the
+// audio format by its extension (e.g. "voice.ogg" for Telegram voice notes).
+// POST {base}/v1/audio/transcriptions
+func (t *Transcriber) Transcribe(ctx context.Context, audio []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	model := t.client.Model()
+	if model == "" {
+		model = DefaultTranscriptionModel
+	}
+	fields := map[string]string{
+		"model":           model,
+		"response_format": "json",
+	}
+	if t.language != "" {
+		fields["language"] = t.language
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("ai: failed to build transcription request: %w", err)
+		}
+	}
+
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return "", fmt.Errorf("ai: failed to build transcription request: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("ai: failed to build transcription request: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("ai: failed to build transcription request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.client.openAIURL("/audio/transcriptions"), &body)
+	if err != nil {
+		return "", fmt.Errorf("ai: failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+	t.client.setBearerAuth(httpReq)
+
+	resp, err := t.client.config.HTTPClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("ai: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("ai: failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return "", t.client.parseErrorResponse(respBody, resp.StatusCode, resp.Header, t.client.Provider())
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("ai: failed to parse transcription: %w", err)
+	}
+
+	t.client.config.Logger.Debug("audio transcribed",
+		slog.String("model", model),
+		slog.Int("audio_bytes", len(audio)),
+		slog.Int("text_len", len(result.Text)),
+	)
+	return strings.TrimSpace(result.Text), nil
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTranscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("path = %s, want /v1/audio/transcriptions", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm() error = %v", err)
+		}
+		if got := r.FormValue("model"); got != "whisper-1" {
+			t.Errorf("model = %q, want whisper-1", got)
+		}
+		if got := r.FormValue("language"); got != "vi" {
+			t.Errorf("language = %q, want vi", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile() error = %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "voice.ogg" || string(data) != "OggS-audio" {
+			t.Errorf("file = %s %q", header.Filename, data)
+		}
+		fmt.Fprint(w, `{"text":" Giá BTC hôm nay bao nhiêu? "}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient("", WithProvider(ProviderOpenAICompatible), WithModel(DefaultTranscriptionModel), WithBaseURL(server.URL+"/v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcriber, err := NewTranscriber(client, WithLanguage("vi"))
+	if err != nil {
+		t.Fatalf("NewTranscriber() error = %v", err)
+	}
+
+	text, err := transcriber.Transcribe(context.Background(), []byte("OggS-audio"), "voice.ogg")
+	if err != nil {
+		t.Fatalf("Transcribe() error = %v", err)
+	}
+	if text != "Giá BTC hôm nay bao nhiêu?" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestTranscribeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"Incorrect API key provided"}}`)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient("bad-key", WithProvider(ProviderOpenAI), WithModel(DefaultTranscriptionModel), WithBaseURL(server.URL))
+	transcriber, _ := NewTranscriber(client)
+
+	_, err := transcriber.Transcribe(context.Background(), []byte("audio"), "voice.ogg")
+	llmErr, ok := err.(*LLMError)
+	if !ok || llmErr.Code != http.StatusUnauthorized {
+		t.Errorf("error = %v, want LLMError 401", err)
+	}
+}
+
+func TestNewTranscriberUnsupportedProvider(t *testing.T) {
+	client, _ := NewClient("key", WithProvider(ProviderClaude))
+	if _, err := NewTranscriber(client); err == nil {
+		t.Error("NewTranscriber() should reject providers without a transcription API")
+	}
+}
@@ -11,8 +11,21 @@ const (
 	ProviderClaude Provider = "claude"
 	ProviderOpenAI Provider = "openai"
 	ProviderQwen   Provider = "qwen"
+
+	// ProviderOllama talks to a local Ollama server through its native API.
+	ProviderOllama Provider = "ollama"
+
+	// ProviderOpenAICompatible talks to any server implementing the OpenAI
+	// chat completions API (vLLM, llama.cpp, LM Studio, LocalAI, ...).
+	ProviderOpenAICompatible Provider = "openai-compatible"
 )
 
+// Local reports whether the provider is typically self-hosted, in which case
+// no API key is required.
+func (p Provider) Local() bool {
+	return p == ProviderOllama || p == ProviderOpenAICompatible
+}
+
 // Role represents the role of a message participant.
 type Role string
 
@@ -37,11 +50,22 @@ type ToolCall struct {
 	Arguments json.RawMessage `json:"arguments"`
 }
 
+// Image is an image attached to a message, e.g. a photo sent by the user.
+type Image struct {
+	MimeType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
 // ChatMessage represents a single message in a conversation.
+// A user message is multi-part when it carries Images: the images come first,
+// followed by Content as the text part (which may be empty).
 type ChatMessage struct {
 	Role    Role   `json:"role"`
 	Content string `json:"content"`
 
+	// Images are sent with the text to vision-capable models (Role=user).
+	Images []Image `json:"images,omitempty"`
+
 	// ToolCalls is populated when Role=assistant and the LLM wants to call tools.
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 
@@ -63,6 +87,7 @@ type ChatRequest struct {
 type ChatResponse struct {
 	Content      string
 	Model        string
+	Provider     Provider
 	InputTokens  int
 	OutputTokens int
 
@@ -0,0 +1,363 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed reports that a request could not be sent because the connection
+// to the server is gone. The server never saw the request, so it is retried
+// once on a new connection.
+var ErrClosed = errors.New("mcp: connection closed")
+
+// errConnLost reports that the connection broke while a request was in
+// flight. The server may have handled it, so it is not retried, but the next
+// call reconnects.
+var errConnLost = errors.New("mcp: connection lost")
+
+// transport carries JSON-RPC messages to one server.
+type transport interface {
+	// send delivers msg. For a request it waits for and returns the
+	// response; for a notification it returns nil.
+	send(ctx context.Context, msg *Message) (*Message, error)
+	close() error
+}
+
+// Client is a connection to one MCP server. It connects lazily again after
+// the server goes away, backing off between failed attempts. It is safe for
+// concurrent use.
+type Client struct {
+	cfg        ServerConfig
+	httpClient HTTPClient
+	clientInfo Implementation
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     *slog.Logger
+	now        func() time.Time
+
+	// dial connects a transport; replaceable in tests.
+	dial func(ctx context.Context) (transport, error)
+
+	nextID atomic.Int64
+
+	// sessions is signalled whenever a session opens.
+	sessions chan struct{}
+
+	mu         sync.Mutex
+	conn       transport
+	connecting chan struct{} // closed when the attempt in progress ends
+	server     Implementation
+	failures   int
+	retryAt    time.Time
+	closed     bool
+}
+
+// ClientOption is a functional option for configuring the Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client of the streamable HTTP transport.
+func WithHTTPClient(client HTTPClient) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithClientInfo sets the name and version the client announces.
+func WithClientInfo(name, version string) ClientOption {
+	return func(c *Client) {
+		c.clientInfo = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithReconnectBackoff sets the delay before reconnecting after a failed
+// attempt, doubling from min up to max (defaults 1s and 1m).
+func WithReconnectBackoff(min, max time.Duration) ClientOption {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithLogger sets the structured logger.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// NewClient creates a client for the server described by cfg without
+// connecting to it.
+func NewClient(cfg ServerConfig, opts ...ClientOption) (*Client, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	c := &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{},
+		clientInfo: Implementation{Name: "pocky-ops-bot", Version: "1.0.0"},
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		logger:     slog.Default(),
+		now:        time.Now,
+		sessions:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.logger = c.logger.With(slog.String("mcp_server", cfg.Name))
+	c.dial = c.dialTransport
+	return c, nil
+}
+
+// Connect creates a client and opens a session with the server.
+func Connect(ctx context.Context, cfg ServerConfig, opts ...ClientOption) (*Client, error) {
+	c, err := NewClient(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.connection(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Name returns the configured server name.
+func (c *Client) Name() string {
+	return c.cfg.Name
+}
+
+// ServerInfo returns the name and version the server announced.
+func (c *Client) ServerInfo() Implementation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// Sessions returns a channel that receives a value after a session with the
+// server opens, such as on reconnecting after a restart, when the server's
+// tools may have changed. Sessions opened before the value is taken are
+// reported once.
+func (c *Client) Sessions() <-chan struct{} {
+	return c.sessions
+}
+
+// ListTools returns all tools of the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	params := ListToolsParams{}
+	for {
+		var page ListToolsResult
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool. A tool that fails reports it in the result's
+// IsError; the error return is for protocol and connection failures.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the session and, for a stdio server, stops its process.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.closed = true
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.close()
+}
+
+// call sends a request and decodes its result into out. A request that could
+// not be sent because the connection was gone is retried once on a new one.
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		conn, err := c.connection(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.request(ctx, conn, method, params, out)
+		if !errors.Is(err, ErrClosed) && !errors.Is(err, errConnLost) {
+			return err
+		}
+
+		// The connection is broken: drop it so the next call reconnects
+		c.drop(conn, err)
+		if !errors.Is(err, ErrClosed) || attempt > 0 {
+			return err
+		}
+	}
+}
+
+// request sends one request on conn.
+func (c *Client) request(ctx context.Context, conn transport, method string, params, out interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("mcp: encode params: %w", err)
+	}
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	resp, err := conn.send(ctx, &Message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: raw})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("mcp: failed to parse %s result: %w", method, err)
+	}
+	return nil
+}
+
+// connection returns the open connection, connecting and initializing a new
+// one if needed. Only one attempt runs at a time, outside c.mu, and
+// concurrent callers wait for its outcome. After a failed attempt no new one
+// is made before the backoff delay has passed.
+func (c *Client) connection(ctx context.Context) (transport, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if c.conn != nil {
+			conn := c.conn
+			c.mu.Unlock()
+			return conn, nil
+		}
+		if wait := c.retryAt.Sub(c.now()); wait > 0 {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("mcp: server %s unavailable, next attempt in %s", c.cfg.Name, wait.Round(time.Second))
+		}
+		if pending := c.connecting; pending != nil {
+			c.mu.Unlock()
+			select {
+			case <-pending:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		c.connecting = done
+		c.mu.Unlock()
+
+		conn, info, err := c.open(ctx)
+		return c.connected(done, conn, info, err)
+	}
+}
+
+// connected publishes the outcome of the connection attempt done and wakes
+// the callers waiting for it.
+func (c *Client) connected(done chan struct{}, conn transport, info Implementation, err error) (transport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connecting = nil
+	close(done)
+
+	if err != nil {
+		c.failures++
+		backoff := c.minBackoff << (c.failures - 1)
+		if backoff > c.maxBackoff || backoff <= 0 {
+			backoff = c.maxBackoff
+		}
+		c.retryAt = c.now().Add(backoff)
+		c.logger.Warn("mcp connect failed",
+			slog.String("error", err.Error()),
+			slog.Int("failures", c.failures),
+			slog.Duration("retry_in", backoff),
+		)
+		return nil, err
+	}
+	if c.closed {
+		// Closed while connecting
+		_ = conn.close()
+		return nil, ErrClosed
+	}
+
+	if c.failures > 0 {
+		c.logger.Info("mcp reconnected", slog.Int("failures", c.failures))
+	}
+	c.conn, c.server, c.failures, c.retryAt = conn, info, 0, time.Time{}
+	select {
+	case c.sessions <- struct{}{}:
+	default:
+	}
+	return conn, nil
+}
+
+// open dials the server and performs the initialize handshake.
+func (c *Client) open(ctx context.Context) (transport, Implementation, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, Implementation{}, err
+	}
+
+	var result InitializeResult
+	err = c.request(ctx, conn, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    json.RawMessage(`{}`),
+		ClientInfo:      c.clientInfo,
+	}, &result)
+	if err == nil {
+		_, err = conn.send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/initialized"})
+	}
+	if err != nil {
+		_ = conn.close()
+		return nil, Implementation{}, fmt.Errorf("mcp: initialize %s: %w", c.cfg.Name, err)
+	}
+
+	c.logger.Info("mcp session opened",
+		slog.String("transport", c.cfg.Transport()),
+		slog.String("server", result.ServerInfo.Name),
+		slog.String("server_version", result.ServerInfo.Version),
+		slog.String("protocol", result.ProtocolVersion),
+	)
+	return conn, result.ServerInfo, nil
+}
+
+// dialTransport connects the configured transport.
+func (c *Client) dialTransport(ctx context.Context) (transport, error) {
+	if c.cfg.Transport() == "http" {
+		return newHTTPTransport(c.cfg, c.httpClient, c.logger), nil
+	}
+	return startStdio(c.cfg, c.logger)
+}
+
+// drop closes conn after it failed with err, unless it was already replaced.
+func (c *Client) drop(conn transport, err error) {
+	c.mu.Lock()
+	if c.conn != conn {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	c.mu.Unlock()
+
+	c.logger.Warn("mcp connection lost", slog.String("error", err.Error()))
+	_ = conn.close()
+}
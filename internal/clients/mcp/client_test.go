@@ -0,0 +1,518 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMain runs the test binary as a fake stdio MCP server when asked to, so
+// the stdio transport is exercised against a real subprocess.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_SERVER") == "1" {
+		serveStdio(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveStdio is the fake server: two pages of tools, an "echo" tool, a "ping"
+// tool that pings the client before answering, and a "crash" tool that exits.
+func serveStdio(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	write := func(msg Message) {
+		msg.JSONRPC = "2.0"
+		data, _ := json.Marshal(msg)
+		fmt.Fprintf(out, "%s\n", data)
+	}
+	result := func(v interface{}) json.RawMessage {
+		data, _ := json.Marshal(v)
+		return data
+	}
+
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || !msg.IsRequest() {
+			continue
+		}
+		switch msg.Method {
+		case "initialize":
+			write(Message{ID: msg.ID, Result: result(InitializeResult{
+				ProtocolVersion: ProtocolVersion,
+				ServerInfo:      Implementation{Name: "fake", Version: os.Getenv("MCP_TEST_VERSION")},
+			})})
+		case "tools/list":
+			var params ListToolsParams
+			_ = json.Unmarshal(msg.Params, &params)
+			if params.Cursor == "" {
+				write(Message{ID: msg.ID, Result: result(ListToolsResult{Tools: []Tool{{Name: "echo"}}, NextCursor: "2"})})
+			} else {
+				write(Message{ID: msg.ID, Result: result(ListToolsResult{Tools: []Tool{{Name: "ping"}, {Name: "crash"}}})})
+			}
+		case "tools/call":
+			var params CallToolParams
+			_ = json.Unmarshal(msg.Params, &params)
+			switch params.Name {
+			case "echo":
+				write(Message{ID: msg.ID, Result: result(TextResult(string(params.Arguments), false))})
+			case "ping":
+				write(Message{ID: json.RawMessage(`"s1"`), Method: "ping"})
+				if !scanner.Scan() {
+					return
+				}
+				var pong Message
+				_ = json.Unmarshal(scanner.Bytes(), &pong)
+				write(Message{ID: msg.ID, Result: result(TextResult(string(pong.ID)+" "+string(pong.Result), false))})
+			case "crash":
+				os.Exit(3)
+			default:
+				write(Message{ID: msg.ID, Error: &RPCError{Code: CodeInvalidParams, Message: "unknown tool"}})
+			}
+		default:
+			write(Message{ID: msg.ID, Error: &RPCError{Code: CodeMethodNotFound, Message: "not found"}})
+		}
+	}
+}
+
+func stdioConfig(t *testing.T) ServerConfig {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("executable: %v", err)
+	}
+	return ServerConfig{
+		Name:    "fake",
+		Command: exe,
+		Env:     map[string]string{"MCP_TEST_SERVER": "1", "MCP_TEST_VERSION": "1.2.3"},
+	}
+}
+
+func TestClient_Stdio(t *testing.T) {
+	ctx := context.Background()
+	client, err := Connect(ctx, stdioConfig(t))
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if info := client.ServerInfo(); info.Name != "fake" || info.Version != "1.2.3" {
+		t.Errorf("ServerInfo() = %+v", info)
+	}
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "echo,ping,crash" {
+		t.Errorf("ListTools() = %s, want echo,ping,crash", got)
+	}
+
+	result, err := client.CallTool(ctx, "echo", json.RawMessage(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("CallTool(echo) error = %v", err)
+	}
+	if result.Text() != `{"a":1}` || result.IsError {
+		t.Errorf("CallTool(echo) = %+v", result)
+	}
+
+	result, err = client.CallTool(ctx, "ping", nil)
+	if err != nil {
+		t.Fatalf("CallTool(ping) error = %v", err)
+	}
+	if result.Text() != `"s1" {}` {
+		t.Errorf("server ping answered with %q", result.Text())
+	}
+
+	_, err = client.CallTool(ctx, "missing", nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("CallTool(missing) error = %v, want rpc error %d", err, CodeInvalidParams)
+	}
+}
+
+func TestClient_StdioReconnectsAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	client, err := Connect(ctx, stdioConfig(t))
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	// The server dies mid-call: the call fails and is not retried
+	if _, err := client.CallTool(ctx, "crash", nil); !errors.Is(err, errConnLost) {
+		t.Fatalf("CallTool(crash) error = %v, want errConnLost", err)
+	}
+
+	// The next call starts a new server process
+	result, err := client.CallTool(ctx, "echo", json.RawMessage(`"again"`))
+	if err != nil {
+		t.Fatalf("CallTool() after crash error = %v", err)
+	}
+	if result.Text() != `"again"` {
+		t.Errorf("CallTool() after crash = %q", result.Text())
+	}
+}
+
+func TestClient_StdioStartFailure(t *testing.T) {
+	_, err := Connect(context.Background(), ServerConfig{Name: "missing", Command: "/nonexistent/mcp-server"})
+	if err == nil {
+		t.Fatal("Connect() error = nil, want start failure")
+	}
+}
+
+// httpServer is a fake streamable HTTP server.
+type httpServer struct {
+	mu       sync.Mutex
+	sessions int
+	session  string
+	sse      bool
+	methods  []string
+	deleted  []string
+}
+
+func (s *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.deleted = append(s.deleted, r.Header.Get(sessionHeader))
+		return
+	}
+
+	var msg Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	s.methods = append(s.methods, msg.Method)
+
+	if msg.Method == "initialize" {
+		s.sessions++
+		s.session = fmt.Sprintf("session-%d", s.sessions)
+		w.Header().Set(sessionHeader, s.session)
+	} else if r.Header.Get(sessionHeader) != s.session {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	if msg.IsNotification() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		result = InitializeResult{ProtocolVersion: ProtocolVersion, ServerInfo: Implementation{Name: "http-fake", Version: "2.0"}}
+	case "tools/list":
+		result = ListToolsResult{Tools: []Tool{{Name: "search", Description: "Search the web"}}}
+	case "tools/call":
+		result = TextResult("results", false)
+	}
+	raw, _ := json.Marshal(result)
+	resp, _ := json.Marshal(Message{JSONRPC: "2.0", ID: msg.ID, Result: raw})
+
+	if !s.sse {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", resp)
+}
+
+func httpConfig(url string) ServerConfig {
+	return ServerConfig{Name: "web", URL: url, Headers: map[string]string{"Authorization": "Bearer secret"}}
+}
+
+func TestClient_HTTP(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sse=%v", sse), func(t *testing.T) {
+			fake := &httpServer{sse: sse}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			ctx := context.Background()
+			client, err := Connect(ctx, httpConfig(server.URL))
+			if err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			if info := client.ServerInfo(); info.Name != "http-fake" {
+				t.Errorf("ServerInfo() = %+v", info)
+			}
+
+			tools, err := client.ListTools(ctx)
+			if err != nil {
+				t.Fatalf("ListTools() error = %v", err)
+			}
+			if len(tools) != 1 || tools[0].Name != "search" {
+				t.Errorf("ListTools() = %+v", tools)
+			}
+			result, err := client.CallTool(ctx, "search", json.RawMessage(`{"q":"btc"}`))
+			if err != nil {
+				t.Fatalf("CallTool() error = %v", err)
+			}
+			if result.Text() != "results" {
+				t.Errorf("CallTool() = %q, want results", result.Text())
+			}
+
+			if err := client.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			want := "initialize,notifications/initialized,tools/list,tools/call"
+			if got := strings.Join(fake.methods, ","); got != want {
+				t.Errorf("methods = %s, want %s", got, want)
+			}
+			if len(fake.deleted) != 1 || fake.deleted[0] != "session-1" {
+				t.Errorf("deleted sessions = %v, want [session-1]", fake.deleted)
+			}
+		})
+	}
+}
+
+func TestClient_HTTPSessionExpired(t *testing.T) {
+	fake := &httpServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := Connect(ctx, httpConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	// The server restarts and forgets the session
+	fake.mu.Lock()
+	fake.session = "lost"
+	fake.mu.Unlock()
+
+	result, err := client.CallTool(ctx, "search", nil)
+	if err != nil {
+		t.Fatalf("CallTool() error = %v, want retry on a new session", err)
+	}
+	if result.Text() != "results" {
+		t.Errorf("CallTool() = %q, want results", result.Text())
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.sessions != 2 {
+		t.Errorf("sessions = %d, want 2", fake.sessions)
+	}
+}
+
+func TestClient_HTTPError(t *testing.T) {
+	server := httptest.NewServer(&httpServer{})
+	defer server.Close()
+
+	cfg := httpConfig(server.URL)
+	cfg.Headers = nil
+	_, err := Connect(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "http status 401") {
+		t.Errorf("Connect() error = %v, want http status 401", err)
+	}
+}
+
+// fakeTransport is a transport whose answers are scripted by tests.
+type fakeTransport struct {
+	err    error
+	closed bool
+}
+
+func (f *fakeTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(msg.ID) == 0 {
+		return nil, nil
+	}
+	return &Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(`{"content":[]}`)}, nil
+}
+
+func (f *fakeTransport) close() error {
+	f.closed = true
+	return nil
+}
+
+func TestClient_ReconnectBackoff(t *testing.T) {
+	client, err := NewClient(ServerConfig{Name: "flaky", Command: "unused"}, WithReconnectBackoff(time.Second, 4*time.Second))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	now := time.Unix(1000, 0)
+	client.now = func() time.Time { return now }
+	dials := 0
+	var dialErr error = errors.New("refused")
+	client.dial = func(ctx context.Context) (transport, error) {
+		dials++
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		return &fakeTransport{}, nil
+	}
+	ctx := context.Background()
+
+	// Failed attempts back off 1s, 2s, 4s, 4s
+	for i, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if _, err := client.CallTool(ctx, "x", nil); err == nil {
+			t.Fatalf("attempt %d: CallTool() error = nil", i)
+		}
+		if _, err := client.CallTool(ctx, "x", nil); err == nil || !strings.Contains(err.Error(), "next attempt") {
+			t.Fatalf("attempt %d: CallTool() during backoff error = %v", i, err)
+		}
+		if dials != i+1 {
+			t.Fatalf("attempt %d: dials = %d, want %d", i, dials, i+1)
+		}
+		now = now.Add(backoff)
+	}
+
+	// The server comes back
+	dialErr = nil
+	if _, err := client.CallTool(ctx, "x", nil); err != nil {
+		t.Fatalf("CallTool() after recovery error = %v", err)
+	}
+	if client.failures != 0 {
+		t.Errorf("failures = %d after recovery, want 0", client.failures)
+	}
+}
+
+func TestClient_LostConnectionNotRetried(t *testing.T) {
+	client, _ := NewClient(ServerConfig{Name: "s", Command: "unused"})
+	var conns []*fakeTransport
+	client.dial = func(ctx context.Context) (transport, error) {
+		conn := &fakeTransport{}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	ctx := context.Background()
+	if _, err := client.CallTool(ctx, "x", nil); err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	<-client.Sessions()
+
+	conns[0].err = errConnLost
+	if _, err := client.CallTool(ctx, "x", nil); !errors.Is(err, errConnLost) {
+		t.Fatalf("CallTool() error = %v, want errConnLost", err)
+	}
+	if len(conns) != 1 || !conns[0].closed {
+		t.Fatalf("conns = %d, closed = %v; want the lost connection closed and no retry", len(conns), conns[0].closed)
+	}
+
+	if _, err := client.CallTool(ctx, "x", nil); err != nil {
+		t.Fatalf("CallTool() after loss error = %v", err)
+	}
+	if len(conns) != 2 {
+		t.Errorf("conns = %d, want a new connection", len(conns))
+	}
+	select {
+	case <-client.Sessions():
+	default:
+		t.Error("Sessions() not signalled after reconnecting")
+	}
+}
+
+func TestClient_Closed(t *testing.T) {
+	client, _ := NewClient(ServerConfig{Name: "s", Command: "unused"})
+	client.dial = func(ctx context.Context) (transport, error) { return &fakeTransport{}, nil }
+	client.Close()
+	if _, err := client.CallTool(context.Background(), "x", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("CallTool() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestClient_ConnectOutsideLock(t *testing.T) {
+	client, _ := NewClient(ServerConfig{Name: "slow", Command: "unused"})
+	var dials atomic.Int32
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	conn := &fakeTransport{}
+	client.dial = func(ctx context.Context) (transport, error) {
+		if dials.Add(1) == 1 {
+			close(dialing)
+		}
+		<-release
+		return conn, nil
+	}
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := client.CallTool(context.Background(), "x", nil)
+			errs <- err
+		}()
+	}
+	<-dialing
+
+	// The client stays usable while the server is slow to start
+	info := make(chan Implementation)
+	go func() { info <- client.ServerInfo() }()
+	select {
+	case <-info:
+	case <-time.After(time.Second):
+		t.Fatal("ServerInfo() blocked while connecting")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "x", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CallTool() waiting for the connection error = %v, want the deadline", err)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("CallTool() error = %v", err)
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("dials = %d, want 1 shared by all callers", got)
+	}
+}
+
+func TestClient_ClosedWhileConnecting(t *testing.T) {
+	client, _ := NewClient(ServerConfig{Name: "s", Command: "unused"})
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	conn := &fakeTransport{}
+	client.dial = func(ctx context.Context) (transport, error) {
+		close(dialing)
+		<-release
+		return conn, nil
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.CallTool(context.Background(), "x", nil)
+		errc <- err
+	}()
+	<-dialing
+	client.Close()
+	close(release)
+
+	if err := <-errc; !errors.Is(err, ErrClosed) {
+		t.Errorf("CallTool() error = %v, want ErrClosed", err)
+	}
+	if !conn.closed {
+		t.Error("connection opened after Close was not closed")
+	}
+}
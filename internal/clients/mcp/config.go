@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ServerConfig describes how to reach one MCP server: a command to run with
+// the stdio transport, or the URL of a streamable HTTP endpoint.
+type ServerConfig struct {
+	// Name identifies the server; it prefixes the names of its tools.
+	Name string `json:"-"`
+
+	// Command, Args and Env start a stdio server. Env is added to the
+	// bot's own environment.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	// URL and Headers reach a streamable HTTP server.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Groups are the tool groups the server's tools belong to (default:
+	// the server name).
+	Groups []string `json:"groups,omitempty"`
+
+	// Disabled servers are skipped at startup.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Transport returns "stdio" or "http".
+func (c ServerConfig) Transport() string {
+	if c.URL != "" {
+		return "http"
+	}
+	return "stdio"
+}
+
+// validate checks that exactly one transport is configured.
+func (c ServerConfig) validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("mcp: server name is required")
+	case c.Command == "" && c.URL == "":
+		return fmt.Errorf("mcp: server %q needs a command or a url", c.Name)
+	case c.Command != "" && c.URL != "":
+		return fmt.Errorf("mcp: server %q has both a command and a url", c.Name)
+	}
+	return nil
+}
+
+// configFile is the JSON layout shared with desktop MCP clients.
+type configFile struct {
+	Servers map[string]ServerConfig `json:"mcpServers"`
+}
+
+// LoadConfig reads the servers of a JSON file of the form
+//
+//	{"mcpServers": {"name": {"command": "...", "args": [...]}, "other": {"url": "..."}}}
+//
+// ordered by name. ${VAR} references in args, env and headers are expanded
+// from the environment, so secrets stay out of the file.
+func LoadConfig(path string) ([]ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: read config: %w", err)
+	}
+	var file configFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("mcp: parse config %s: %w", path, err)
+	}
+
+	servers := make([]ServerConfig, 0, len(file.Servers))
+	for name, cfg := range file.Servers {
+		cfg.Name = name
+		for i, arg := range cfg.Args {
+			cfg.Args[i] = os.ExpandEnv(arg)
+		}
+		cfg.Env = expandValues(cfg.Env)
+		cfg.Headers = expandValues(cfg.Headers)
+		cfg.URL = os.ExpandEnv(cfg.URL)
+		if len(cfg.Groups) == 0 {
+			cfg.Groups = []string{name}
+		}
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+		servers = append(servers, cfg)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+
+	// Tool names carry the server name reduced to the characters every
+	// provider accepts, so "my.srv" and "my_srv" would share their tools
+	prefixes := make(map[string]string, len(servers))
+	for _, cfg := range servers {
+		prefix := toolPrefix(cfg.Name)
+		if other, ok := prefixes[prefix]; ok {
+			return nil, fmt.Errorf("mcp: servers %q and %q would give their tools the same names, rename one", other, cfg.Name)
+		}
+		prefixes[prefix] = cfg.Name
+	}
+	return servers, nil
+}
+
+// toolPrefix returns name as it prefixes tool names: characters outside
+// [A-Za-z0-9_-] replaced with underscores.
+func toolPrefix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func expandValues(values map[string]string) map[string]string {
+	for k, v := range values {
+		values[k] = os.ExpandEnv(v)
+	}
+	return values
+}
@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("MCP_TEST_TOKEN", "secret")
+	path := writeConfig(t, `{
+		"mcpServers": {
+			"web": {"url": "https://mcp.example.com/mcp", "headers": {"Authorization": "Bearer ${MCP_TEST_TOKEN}"}},
+			"files": {"command": "mcp-files", "args": ["--token", "$MCP_TEST_TOKEN"], "env": {"TOKEN": "${MCP_TEST_TOKEN}"}, "disabled": true}
+		}
+	}`)
+
+	servers, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("LoadConfig() = %d servers, want 2", len(servers))
+	}
+
+	files, web := servers[0], servers[1]
+	if files.Name != "files" || web.Name != "web" {
+		t.Fatalf("servers = %s, %s; want sorted by name", files.Name, web.Name)
+	}
+	if len(web.Groups) != 1 || web.Groups[0] != "web" {
+		t.Errorf("web groups = %v, want the server name", web.Groups)
+	}
+	if files.Transport() != "stdio" || !files.Disabled {
+		t.Errorf("files = %+v, want disabled stdio", files)
+	}
+	if files.Args[1] != "secret" || files.Env["TOKEN"] != "secret" {
+		t.Errorf("files args/env not expanded: %v %v", files.Args, files.Env)
+	}
+	if web.Transport() != "http" || web.Headers["Authorization"] != "Bearer secret" {
+		t.Errorf("web = %+v, want http with expanded header", web)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "invalid json", content: `{`, want: "parse config"},
+		{name: "no transport", content: `{"mcpServers": {"a": {}}}`, want: "needs a command or a url"},
+		{name: "both transports", content: `{"mcpServers": {"a": {"command": "x", "url": "http://y"}}}`, want: "both a command and a url"},
+		{name: "same tool prefix", content: `{"mcpServers": {"my.srv": {"command": "x"}, "my_srv": {"command": "y"}}}`, want: `"my.srv" and "my_srv"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadConfig(missing) error = nil")
+	}
+}
@@ -0,0 +1,180 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionHeader carries the session ID assigned by a streamable HTTP server.
+const sessionHeader = "Mcp-Session-Id"
+
+// HTTPClient defines the interface for HTTP operations.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// httpTransport speaks the streamable HTTP transport: every message is
+// POSTed to the server's endpoint, which answers a request with either a
+// JSON response or an SSE stream carrying it.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  HTTPClient
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	session string
+}
+
+// newHTTPTransport creates the transport for the server at cfg.URL.
+func newHTTPTransport(cfg ServerConfig, client HTTPClient, logger *slog.Logger) *httpTransport {
+	return &httpTransport{url: cfg.URL, headers: cfg.Headers, client: client, logger: logger}
+}
+
+// send POSTs msg and, for a request, returns the server's response.
+func (t *httpTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: encode message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("mcp: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.session = id
+		t.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && t.sessionID() != "":
+		// The server forgot the session; the request was not processed
+		return nil, fmt.Errorf("%w: session expired", ErrClosed)
+	case resp.StatusCode >= 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("mcp: http status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if len(msg.ID) == 0 {
+		return nil, nil
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return t.readStream(resp.Body, msg.ID)
+	}
+
+	var answer Message
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("mcp: failed to parse response: %w", err)
+	}
+	return &answer, nil
+}
+
+// readStream reads SSE events until the response to the request id arrives.
+// Notifications and server requests on the stream are skipped: answering
+// them would need another POST, and a client without capabilities gets none
+// that matter.
+func (t *httpTransport) readStream(body io.Reader, id json.RawMessage) (*Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	var data strings.Builder
+
+	// dispatch handles a complete event and reports the response to id
+	dispatch := func() *Message {
+		if data.Len() == 0 {
+			return nil
+		}
+		var msg Message
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err != nil {
+			t.logger.Warn("mcp invalid event from server", slog.String("error", err.Error()))
+			return nil
+		}
+		if msg.IsResponse() && bytes.Equal(msg.ID, id) {
+			return &msg
+		}
+		t.logger.Debug("mcp skipped server message", slog.String("method", msg.Method))
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line ends the event
+			if msg := dispatch(); msg != nil {
+				return msg, nil
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mcp: failed to read event stream: %w", err)
+	}
+	if msg := dispatch(); msg != nil {
+		return msg, nil
+	}
+	return nil, fmt.Errorf("mcp: event stream ended without a response")
+}
+
+// setHeaders adds the configured headers and the session ID to req.
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if id := t.sessionID(); id != "" {
+		req.Header.Set(sessionHeader, id)
+		req.Header.Set("Mcp-Protocol-Version", ProtocolVersion)
+	}
+}
+
+func (t *httpTransport) sessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// close ends the session on the server, if one was opened.
+func (t *httpTransport) close() error {
+	if t.sessionID() == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package mcp implements a Model Context Protocol client: JSON-RPC 2.0 over
+// a stdio subprocess or the streamable HTTP transport, with the subset of the
+// protocol needed to list and call a server's tools.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the MCP revision this client speaks.
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response. A request
+// has a Method and an ID, a notification only a Method, and a response an ID
+// with either a Result or an Error.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// IsRequest reports whether m is a request expecting a response.
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether m is a notification.
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether m answers a request.
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// RPCError is a JSON-RPC error returned by a server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error implements the error interface for RPCError.
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp: rpc error %d: %s", e.Code, e.Message)
+}
+
+// Implementation names an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are sent by the client to open a session.
+type InitializeParams struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities"`
+	ClientInfo      Implementation  `json:"clientInfo"`
+}
+
+// InitializeResult is the server's answer to initialize.
+type InitializeResult struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities"`
+	ServerInfo      Implementation  `json:"serverInfo"`
+	Instructions    string          `json:"instructions,omitempty"`
+}
+
+// Tool describes a tool offered by a server.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ListToolsParams request a page of tools.
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ListToolsResult is one page of tools.
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams invoke a tool.
+type CallToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Content is one block of a tool result.
+type Content struct {
+	Type     string `json:"type"` // text, image, audio or resource
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"` // base64, for image and audio
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// CallToolResult is the outcome of a tool call. IsError marks a failure of
+// the tool itself, described in Content, as opposed to a protocol error.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text returns the text blocks of the result joined by newlines. Other blocks
+// are replaced by a marker naming their type.
+func (r *CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+			continue
+		}
+		marker := "[" + c.Type
+		if c.MimeType != "" {
+			marker += " " + c.MimeType
+		}
+		parts = append(parts, marker+"]")
+	}
+	return strings.Join(parts, "\n")
+}
+
+// TextResult returns a result made of one text block.
+func TextResult(text string, isError bool) *CallToolResult {
+	return &CallToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: isError}
+}
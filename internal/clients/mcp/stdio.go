@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxMessageSize bounds one newline-delimited message from a stdio server.
+const maxMessageSize = 16 << 20
+
+// stdioTransport runs a server as a subprocess and exchanges newline-delimited
+// JSON-RPC messages over its stdin and stdout. Its stderr is logged.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	logger *slog.Logger
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *Message
+	err     error         // set once the server is gone
+	done    chan struct{} // closed with err
+}
+
+// startStdio starts the server process of cfg.
+func startStdio(cfg ServerConfig, logger *slog.Logger) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("mcp: stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("mcp: stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("mcp: stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp: start %s: %w", cfg.Command, err)
+	}
+
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		logger:  logger,
+		pending: make(map[string]chan *Message),
+		done:    make(chan struct{}),
+	}
+	go t.logStderr(stderr)
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+// send writes msg and, for a request, waits for its response.
+func (t *stdioTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	var ch chan *Message
+	if len(msg.ID) > 0 {
+		ch = make(chan *Message, 1)
+		t.mu.Lock()
+		if t.err != nil {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("%w: %v", ErrClosed, t.err)
+		}
+		t.pending[string(msg.ID)] = ch
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+		}()
+	}
+
+	if err := t.write(msg); err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, nil
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, fmt.Errorf("%w: server exited: %v", errConnLost, t.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// write sends one message as a line on the server's stdin.
+func (t *stdioTransport) write(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("mcp: encode message: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	return nil
+}
+
+// readLoop delivers responses to their waiting requests and answers the
+// server's own requests until stdout is closed.
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.logger.Warn("mcp invalid message from server", slog.String("error", err.Error()))
+			continue
+		}
+		switch {
+		case msg.IsResponse():
+			t.mu.Lock()
+			ch := t.pending[string(msg.ID)]
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		case msg.IsRequest():
+			if err := t.write(answerServerRequest(&msg)); err != nil {
+				t.logger.Debug("mcp failed to answer server request", slog.String("error", err.Error()))
+			}
+		default:
+			t.logger.Debug("mcp server notification", slog.String("method", msg.Method))
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// logStderr logs what the server writes to stderr.
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		t.logger.Debug("mcp server stderr", slog.String("line", scanner.Text()))
+	}
+}
+
+// close closes the server's stdin, which asks it to exit, and kills it if it
+// is still running after a grace period.
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- t.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
+
+// answerServerRequest answers a request sent by the server: pings succeed,
+// everything else (sampling, roots, ...) is not supported by this client.
+func answerServerRequest(req *Message) *Message {
+	resp := &Message{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "ping" {
+		resp.Result = json.RawMessage(`{}`)
+		return resp
+	}
+	resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not supported: " + req.Method}
+	return resp
+}
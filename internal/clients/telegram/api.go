@@ -2,8 +2,11 @@
 package telegram
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 )
@@ -58,3 +61,50 @@ type BackoffStrategy interface {
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// callMethod performs a POST request with a JSON body to the given Telegram Bot API
+// method and returns the raw "result" field of a successful response.
+func callMethod(ctx context.Context, client HTTPClient, baseURL, token, method string, body interface{}) (json.RawMessage, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to marshal request body: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/bot%s/%s", baseURL, token, method)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to read response: %w", err)
+	}
+
+	var apiResp APIResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return nil, fmt.Errorf("telegram: failed to parse response: %w", err)
+	}
+
+	if !apiResp.OK {
+		apiErr := &APIError{
+			Code:        apiResp.ErrorCode,
+			Description: apiResp.Description,
+		}
+		if apiResp.Parameters != nil {
+			apiErr.RetryAfter = apiResp.Parameters.RetryAfter
+		}
+		return nil, apiErr
+	}
+
+	return apiResp.Result, nil
+}
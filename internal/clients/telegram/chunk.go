@@ -0,0 +1,344 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxMessageLength is Telegram's limit for the text of a single message,
+// measured in UTF-16 code units.
+const MaxMessageLength = 4096
+
+// chunkReserve is the room kept free in every chunk for the markers that
+// close entities left open at the split point.
+const chunkReserve = 16
+
+// maxFenceLangLength bounds the language tag carried over when a code block
+// is split, so reopening it never eats into the chunk budget noticeably.
+const maxFenceLangLength = 32
+
+// SplitMessage splits text into chunks of at most limit UTF-16 code units.
+// It prefers to split at paragraph breaks, then at code-block boundaries,
+// then at line breaks and finally at spaces. Markdown entities (code blocks,
+// inline code, bold, italic) left open at a split point are closed at the end
+// of the chunk and reopened at the start of the next one, so every chunk can
+// be parsed on its own. A non-positive limit means MaxMessageLength.
+func SplitMessage(text string, limit int) []string {
+	if limit <= 0 {
+		limit = MaxMessageLength
+	}
+
+	rest := []rune(text)
+	if utf16Len(rest) <= limit {
+		return []string{text}
+	}
+
+	budget := limit - chunkReserve
+	if budget < 1 {
+		budget = limit
+	}
+
+	var chunks []string
+	reopened := 0 // runes at the start of rest reopening entities of the last chunk
+	for len(rest) > 0 {
+		if utf16Len(rest) <= limit {
+			chunks = append(chunks, string(rest))
+			break
+		}
+
+		end, next := splitPoint(rest, budget, reopened)
+		head := rest[:end]
+
+		state := scanMarkdown(head)
+		prefix := state.reopen()
+		chunks = append(chunks, string(head)+state.close())
+
+		remainder := rest[next:]
+		rest = make([]rune, 0, len(prefix)+len(remainder))
+		rest = append(rest, []rune(prefix)...)
+		rest = append(rest, remainder...)
+		reopened = len([]rune(prefix))
+	}
+
+	return chunks
+}
+
+// splitPoint picks where to cut r so that r[:end] fits in budget UTF-16 code
+// units. The chunk that follows starts at r[next:]; runes between end and next
+// (the separator) are dropped. The first reopened runes of r only restart the
+// entities of the previous chunk, so the cut comes after them: every chunk
+// takes at least one rune of the text and splitting always ends.
+func splitPoint(r []rune, budget, reopened int) (end, next int) {
+	maxIdx := fitRunes(r, budget)
+	if maxIdx <= reopened {
+		// A single rune wider than what the budget leaves; take it anyway
+		return reopened + 1, reopened + 1
+	}
+
+	para, block, line, space := -1, -1, -1, -1
+	inFence := false
+	lineStart := 0
+
+	for i := 0; i <= maxIdx && i < len(r); i++ {
+		switch r[i] {
+		case '\n':
+			wasFence := inFence
+			if hasRunePrefix(trimLeftSpace(r[lineStart:i]), "```") {
+				inFence = !inFence
+			}
+			if i > 0 && (!inFence || wasFence) {
+				// Not just after an opening fence, which would leave an empty block
+				line = i
+			}
+			if !inFence && i > 0 {
+				if wasFence {
+					// Just after a closing fence
+					block = i
+				} else if hasRunePrefix(trimLeftSpace(r[i+1:]), "```") {
+					// Just before an opening fence
+					block = i
+				}
+				if i+1 < len(r) && r[i+1] == '\n' {
+					para = i
+				}
+			}
+			lineStart = i + 1
+		case ' ':
+			if i > 0 {
+				space = i
+			}
+		}
+	}
+
+	// Prefer boundaries in the second half of the chunk so chunks stay large
+	min := maxIdx / 2
+	candidates := []int{para, block, line, space}
+	for i, c := range candidates {
+		if c <= reopened {
+			candidates[i] = -1
+		}
+	}
+	pick := -1
+	for _, c := range candidates {
+		if c >= min && c > 0 {
+			pick = c
+			break
+		}
+	}
+	if pick < 0 {
+		for _, c := range candidates {
+			if c > 0 {
+				pick = c
+				break
+			}
+		}
+	}
+	if pick < 0 {
+		return maxIdx, maxIdx
+	}
+
+	next = pick + 1
+	if pick == para {
+		for next < len(r) && r[next] == '\n' {
+			next++
+		}
+	}
+	return pick, next
+}
+
+// markdownState records the entities that are still open at the end of a chunk.
+type markdownState struct {
+	fence      bool
+	fenceLang  string
+	inlineCode bool
+	markers    []string // open emphasis delimiters ("*", "**", "_", "__", "~~"), innermost last
+}
+
+// scanMarkdown walks r and reports which Markdown entities are left open at
+// its end. Emphasis follows CommonMark, as produced by language models:
+// doubled delimiters are one entity, and underscores inside words (as in
+// BTC_USDT) or delimiters surrounded by spaces are literal.
+func scanMarkdown(r []rune) markdownState {
+	var st markdownState
+
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+
+		if st.fence {
+			if hasRunePrefix(r[i:], "```") {
+				st.fence = false
+				i += 2
+			}
+			continue
+		}
+
+		if st.inlineCode {
+			if c == '`' {
+				st.inlineCode = false
+			}
+			continue
+		}
+
+		switch c {
+		case '\\':
+			i++
+		case '`':
+			if hasRunePrefix(r[i:], "```") {
+				st.fence = true
+				st.fenceLang = fenceLang(r[i+3:])
+				i += 2 + len([]rune(st.fenceLang))
+				continue
+			}
+			st.inlineCode = true
+		case '*', '_', '~':
+			marker := string(c)
+			if i+1 < len(r) && r[i+1] == c {
+				marker += string(c)
+			} else if !isEmphasisDelimiter(r, i) {
+				continue
+			}
+			i += len(marker) - 1
+
+			if n := len(st.markers); n > 0 && st.markers[n-1] == marker {
+				st.markers = st.markers[:n-1]
+			} else {
+				st.markers = append(st.markers, marker)
+			}
+		}
+	}
+
+	return st
+}
+
+// close returns the markers that end every open entity.
+func (s markdownState) close() string {
+	var b strings.Builder
+	if s.inlineCode {
+		b.WriteByte('`')
+	}
+	if s.fence {
+		b.WriteString("\n```")
+	}
+	for i := len(s.markers) - 1; i >= 0; i-- {
+		b.WriteString(s.markers[i])
+	}
+	return b.String()
+}
+
+// reopen returns the markers that restart the open entities in the next chunk.
+func (s markdownState) reopen() string {
+	var b strings.Builder
+	for _, m := range s.markers {
+		b.WriteString(m)
+	}
+	if s.fence {
+		b.WriteString("```")
+		b.WriteString(s.fenceLang)
+		b.WriteByte('\n')
+	}
+	if s.inlineCode {
+		b.WriteByte('`')
+	}
+	return b.String()
+}
+
+// isEmphasisDelimiter reports whether the single '*', '_' or '~' at i can
+// open or close emphasis.
+func isEmphasisDelimiter(r []rune, i int) bool {
+	c := r[i]
+	if c == '~' {
+		return false
+	}
+
+	prevSpace := i == 0 || unicode.IsSpace(r[i-1])
+	nextSpace := i+1 == len(r) || unicode.IsSpace(r[i+1])
+	if prevSpace && nextSpace {
+		return false
+	}
+
+	if c == '_' && i > 0 && i+1 < len(r) && isWordRune(r[i-1]) && isWordRune(r[i+1]) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// fenceLang returns the language tag following an opening fence, if any.
+func fenceLang(r []rune) string {
+	end := 0
+	for end < len(r) && r[end] != '\n' {
+		if unicode.IsSpace(r[end]) || r[end] == '`' {
+			return ""
+		}
+		end++
+	}
+	if end == len(r) || end > maxFenceLangLength {
+		return ""
+	}
+	return string(r[:end])
+}
+
+// MessageLength returns the length of text in UTF-16 code units, the unit
+// of MaxMessageLength.
+func MessageLength(text string) int {
+	return utf16Len([]rune(text))
+}
+
+// TruncateMessage shortens text to at most limit UTF-16 code units without
+// splitting a character.
+func TruncateMessage(text string, limit int) string {
+	r := []rune(text)
+	return string(r[:fitRunes(r, limit)])
+}
+
+// fitRunes returns the number of leading runes of r that fit in n UTF-16 code units.
+func fitRunes(r []rune, n int) int {
+	size := 0
+	for i, c := range r {
+		size += utf16RuneLen(c)
+		if size > n {
+			return i
+		}
+	}
+	return len(r)
+}
+
+// utf16Len returns the length of r in UTF-16 code units, which is how
+// Telegram measures message length.
+func utf16Len(r []rune) int {
+	n := 0
+	for _, c := range r {
+		n += utf16RuneLen(c)
+	}
+	return n
+}
+
+func utf16RuneLen(c rune) int {
+	if c >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func hasRunePrefix(r []rune, prefix string) bool {
+	p := []rune(prefix)
+	if len(r) < len(p) {
+		return false
+	}
+	for i := range p {
+		if r[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func trimLeftSpace(r []rune) []rune {
+	for len(r) > 0 && (r[0] == ' ' || r[0] == '\t') {
+		r = r[1:]
+	}
+	return r
+}
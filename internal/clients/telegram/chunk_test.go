@@ -0,0 +1,197 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessageShortText(t *testing.T) {
+	chunks := SplitMessage("hello *world*", 0)
+	if len(chunks) != 1 || chunks[0] != "hello *world*" {
+		t.Errorf("chunks = %q, want the text unchanged", chunks)
+	}
+}
+
+func TestSplitMessageParagraphs(t *testing.T) {
+	para := strings.Repeat("a", 30)
+	text := para + "\n\n" + para + "\n\n" + para
+
+	chunks := SplitMessage(text, 80)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2: %q", len(chunks), chunks)
+	}
+	if chunks[0] != para+"\n\n"+para {
+		t.Errorf("chunks[0] = %q, want first two paragraphs", chunks[0])
+	}
+	if chunks[1] != para {
+		t.Errorf("chunks[1] = %q, want last paragraph", chunks[1])
+	}
+}
+
+func TestSplitMessageLines(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, "line of text")
+	}
+	text := strings.Join(lines, "\n")
+
+	chunks := SplitMessage(text, 60)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 60 {
+			t.Errorf("chunk %d has %d chars, want <= 60", i, len(c))
+		}
+		if strings.HasPrefix(c, "\n") || strings.HasSuffix(c, "\n") {
+			t.Errorf("chunk %d = %q, should not start or end with a newline", i, c)
+		}
+		for _, l := range strings.Split(c, "\n") {
+			if l != "line of text" {
+				t.Errorf("chunk %d split a line: %q", i, l)
+			}
+		}
+	}
+	if got := strings.Join(chunks, "\n"); got != text {
+		t.Error("joined chunks do not reproduce the original text")
+	}
+}
+
+func TestSplitMessageHardCut(t *testing.T) {
+	text := strings.Repeat("x", 250)
+
+	chunks := SplitMessage(text, 100)
+	if strings.Join(chunks, "") != text {
+		t.Error("joined chunks do not reproduce the original text")
+	}
+	for i, c := range chunks {
+		if len(c) > 100 {
+			t.Errorf("chunk %d has %d chars, want <= 100", i, len(c))
+		}
+	}
+}
+
+func TestSplitMessageCodeBlock(t *testing.T) {
+	var code []string
+	for i := 0; i < 12; i++ {
+		code = append(code, "fmt.Println(i)")
+	}
+	text := "Example:\n```go\n" + strings.Join(code, "\n") + "\n```"
+
+	chunks := SplitMessage(text, 100)
+	if len(chunks) < 2 {
+		t.Fatalf("expected code block to be split, got %d chunks", len(chunks))
+	}
+	for i, c := range chunks {
+		if strings.Count(c, "```")%2 != 0 {
+			t.Errorf("chunk %d has unbalanced code fences: %q", i, c)
+		}
+		if len(c) > 100 {
+			t.Errorf("chunk %d has %d chars, want <= 100", i, len(c))
+		}
+	}
+	if !strings.HasPrefix(chunks[1], "```go\n") {
+		t.Errorf("chunks[1] = %q, want code block reopened with language", chunks[1])
+	}
+}
+
+func TestSplitMessageLongCodeLine(t *testing.T) {
+	text := "```python\n" + strings.Repeat("x", 9000)
+
+	chunks := SplitMessage(text, MaxMessageLength)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	total := 0
+	for i, c := range chunks {
+		if !strings.HasPrefix(c, "```python\n") {
+			t.Errorf("chunk %d = %.20q..., want a python block", i, c)
+		}
+		if i < len(chunks)-1 && !strings.HasSuffix(c, "\n```") {
+			t.Errorf("chunk %d = ...%q, want the block closed", i, c[len(c)-10:])
+		}
+		if len(c) > MaxMessageLength {
+			t.Errorf("chunk %d has %d chars, want <= %d", i, len(c), MaxMessageLength)
+		}
+		total += strings.Count(c, "x")
+	}
+	if total != 9000 {
+		t.Errorf("chunks hold %d of the 9000 x", total)
+	}
+}
+
+func TestSplitMessageBalancesInlineEntities(t *testing.T) {
+	text := "*" + strings.Repeat("bold words ", 15) + "end*"
+
+	chunks := SplitMessage(text, 80)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if !strings.HasPrefix(c, "*") || !strings.HasSuffix(c, "*") {
+			t.Errorf("chunk %d = %q, want bold entity opened and closed", i, c)
+		}
+	}
+}
+
+func TestSplitMessageBalancesDoubleDelimiters(t *testing.T) {
+	text := "**" + strings.Repeat("bold words ", 15) + "end**"
+
+	chunks := SplitMessage(text, 80)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if !strings.HasPrefix(c, "**") || !strings.HasSuffix(c, "**") {
+			t.Errorf("chunk %d = %q, want bold entity opened and closed", i, c)
+		}
+	}
+}
+
+func TestSplitMessageIgnoresIdentifiers(t *testing.T) {
+	text := "BTC_USDT " + strings.Repeat("word ", 30)
+
+	chunks := SplitMessage(text, 60)
+	if strings.HasSuffix(chunks[0], "_") || strings.HasPrefix(chunks[1], "_") {
+		t.Errorf("chunks = %q, underscore inside a word should not be balanced", chunks)
+	}
+}
+
+func TestSplitMessageIgnoresEscapedMarkers(t *testing.T) {
+	text := `BTC\_USDT ` + strings.Repeat("word ", 30)
+
+	chunks := SplitMessage(text, 60)
+	if strings.HasSuffix(chunks[0], "_") {
+		t.Errorf("chunks[0] = %q, escaped underscore should not be balanced", chunks[0])
+	}
+}
+
+func TestSplitMessageCountsUTF16(t *testing.T) {
+	// Each emoji is two UTF-16 code units
+	text := strings.Repeat("🚀", 60)
+
+	chunks := SplitMessage(text, 50)
+	for i, c := range chunks {
+		if n := utf16Len([]rune(c)); n > 50 {
+			t.Errorf("chunk %d is %d UTF-16 units, want <= 50", i, n)
+		}
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("joined chunks do not reproduce the original text")
+	}
+}
+
+func TestTruncateMessageCountsUTF16(t *testing.T) {
+	text := "ab" + strings.Repeat("🚀", 10)
+
+	got := TruncateMessage(text, 7)
+	if got != "ab🚀🚀" {
+		t.Errorf("TruncateMessage() = %q, want %q", got, "ab🚀🚀")
+	}
+	if n := MessageLength(got); n != 6 {
+		t.Errorf("MessageLength() = %d, want 6", n)
+	}
+	if got := TruncateMessage("short", 10); got != "short" {
+		t.Errorf("TruncateMessage() = %q, want text unchanged", got)
+	}
+}
@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// MaxDownloadSize is the largest file the Bot API lets bots download (20 MB).
+const MaxDownloadSize = 20 << 20
+
+// GetFile returns the metadata of a file sent to the bot, including the
+// file_path used to download it. The path stays valid for at least an hour.
+func (s *Sender) GetFile(ctx context.Context, fileID string) (*types.File, error) {
+	body := map[string]interface{}{
+		"file_id": fileID,
+	}
+
+	result, err := s.call(ctx, "getFile", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var file types.File
+	if err := json.Unmarshal(result, &file); err != nil {
+		return nil, fmt.Errorf("telegram: failed to parse file: %w", err)
+	}
+	if file.FilePath == "" {
+		return nil, fmt.Errorf("telegram: file %s has no download path", fileID)
+	}
+	return &file, nil
+}
+
+// DownloadFile fetches the content of a file sent to the bot, e.g. the
+// largest size of a photo. Files over MaxDownloadSize are rejected.
+func (s *Sender) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	file, err := s.GetFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.FileSize > MaxDownloadSize {
+		return nil, fmt.Errorf("telegram: file is too large (%d bytes)", file.FileSize)
+	}
+
+	fileURL := fmt.Sprintf("%s/file/bot%s/%s", s.config.BaseURL, s.config.Token, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to create request: %w", err)
+	}
+
+	s.config.Logger.Debug("downloading file",
+		slog.String("file_id", fileID),
+		slog.Int64("file_size", file.FileSize),
+	)
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telegram: download failed with status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to read file: %w", err)
+	}
+	if len(data) > MaxDownloadSize {
+		return nil, fmt.Errorf("telegram: file is too large (over %d bytes)", MaxDownloadSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottest-token/getFile":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["file_id"] != "photo-1" {
+				t.Errorf("file_id = %v, want photo-1", body["file_id"])
+			}
+			w.Write([]byte(`{"ok":true,"result":{"file_id":"photo-1","file_unique_id":"u","file_size":4,"file_path":"photos/file_1.jpg"}}`))
+		case "/file/bottest-token/photos/file_1.jpg":
+			w.Write([]byte("\xff\xd8\xff\xe0"))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sender, _ := NewSender("test-token", WithSenderBaseURL(server.URL))
+	data, err := sender.DownloadFile(context.Background(), "photo-1")
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	if string(data) != "\xff\xd8\xff\xe0" {
+		t.Errorf("data = %q", data)
+	}
+}
+
+func TestDownloadFileTooLarge(t *testing.T) {
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/file/") {
+			downloads++
+		}
+		w.Write([]byte(`{"ok":true,"result":{"file_id":"doc","file_unique_id":"u","file_size":30000000,"file_path":"documents/big.png"}}`))
+	}))
+	defer server.Close()
+
+	sender, _ := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if _, err := sender.DownloadFile(context.Background(), "doc"); err == nil {
+		t.Fatal("DownloadFile() should reject files over MaxDownloadSize")
+	}
+	if downloads != 0 {
+		t.Errorf("downloads = %d, want the size checked before downloading", downloads)
+	}
+}
+
+func TestGetFileAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`))
+	}))
+	defer server.Close()
+
+	sender, _ := NewSender("test-token", WithSenderBaseURL(server.URL))
+	_, err := sender.GetFile(context.Background(), "nope")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != 400 {
+		t.Errorf("error = %v, want APIError 400", err)
+	}
+}
@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OffsetStore persists the getUpdates offset so the Poller can resume after a restart.
+// The stored value is the ID of the next update to receive (last handled UpdateID + 1).
+type OffsetStore interface {
+	// Load returns the last saved offset, or 0 if nothing was saved yet.
+	Load() (int64, error)
+
+	// Save persists the offset.
+	Save(offset int64) error
+}
+
+// MemoryOffsetStore keeps the offset in memory only. Useful for tests.
+type MemoryOffsetStore struct {
+	mu     sync.Mutex
+	offset int64
+}
+
+// Load returns the in-memory offset.
+func (s *MemoryOffsetStore) Load() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset, nil
+}
+
+// Save stores the offset in memory.
+func (s *MemoryOffsetStore) Save(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+	return nil
+}
+
+// FileOffsetStore persists the offset as a decimal number in a plain text file.
+// Writes go through a temporary file and rename so a crash never leaves a
+// truncated offset behind.
+type FileOffsetStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileOffsetStore creates a FileOffsetStore writing to path.
+// Parent directories are created on the first Save.
+func NewFileOffsetStore(path string) *FileOffsetStore {
+	return &FileOffsetStore{path: path}
+}
+
+// Load reads the offset from disk. A missing file yields 0.
+func (s *FileOffsetStore) Load() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("telegram: failed to read offset file: %w", err)
+	}
+
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return 0, nil
+	}
+
+	offset, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("telegram: invalid offset in %s: %w", s.path, err)
+	}
+
+	return offset, nil
+}
+
+// Save atomically writes the offset to disk.
+func (s *FileOffsetStore) Save(offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("telegram: failed to create offset directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("telegram: failed to create temp offset file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatInt(offset, 10) + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("telegram: failed to write offset: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("telegram: failed to write offset: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("telegram: failed to replace offset file: %w", err)
+	}
+
+	return nil
+}
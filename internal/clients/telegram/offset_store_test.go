@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileOffsetStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "offset")
+	store := NewFileOffsetStore(path)
+
+	// Missing file yields zero
+	offset, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if offset != 0 {
+		t.Errorf("Load() = %d, want 0", offset)
+	}
+
+	if err := store.Save(12345); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// A fresh store on the same path sees the saved value
+	offset, err = NewFileOffsetStore(path).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if offset != 12345 {
+		t.Errorf("Load() = %d, want 12345", offset)
+	}
+
+	// No temp files left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected 1 file in state dir, got %d", len(entries))
+	}
+}
+
+func TestFileOffsetStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offset")
+	if err := os.WriteFile(path, []byte("not-a-number"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileOffsetStore(path).Load(); err == nil {
+		t.Error("Load() should fail on a corrupt offset file")
+	}
+}
+
+func TestMemoryOffsetStore(t *testing.T) {
+	store := &MemoryOffsetStore{}
+	if err := store.Save(42); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	offset, _ := store.Load()
+	if offset != 42 {
+		t.Errorf("Load() = %d, want 42", offset)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -57,16 +58,43 @@ type PollerConfig struct {
 	// Logger is the structured logger for debug output.
 	// Defaults to slog.Default() if nil.
 	Logger *slog.Logger
+
+	// OffsetStore persists the committed update offset across restarts.
+	// If nil, the offset lives in memory only.
+	OffsetStore OffsetStore
+
+	// StallTimeout bounds the wait for a commit while a whole batch is in
+	// flight. When it passes, the oldest unhandled update is given up on
+	// and committed, so one stuck handler cannot stop the bot.
+	// Defaults to DefaultStallTimeout.
+	StallTimeout time.Duration
 }
 
 // Poller handles long-polling for Telegram Bot API updates.
+//
+// Two offsets are tracked: offset is the committed offset sent to Telegram
+// (updates below it are acknowledged and never redelivered), and fetched is
+// the next update ID not yet pushed into the updates channel. Updates between
+// the two are in flight and are skipped if Telegram returns them again.
+//
+// Only the committed offset is sent to Telegram, because Telegram forgets
+// every update below the offset it is sent. When a whole batch is already in
+// flight, the poller therefore waits for a commit before polling again.
 type Poller struct {
-	config  PollerConfig
-	updates chan types.Update
-	offset  atomic.Int64
-	running atomic.Bool
-	wg      sync.WaitGroup
-	stopCh  chan struct{}
+	config     PollerConfig
+	updates    chan types.Update
+	offset     atomic.Int64
+	fetched    atomic.Int64
+	autoCommit bool
+	pendingMu  sync.Mutex
+	pending    []*ack        // handler's in-flight updates in fetch order
+	progress   chan struct{} // signalled when the committed offset advances
+	saveMu     sync.Mutex
+	saved      int64 // last offset persisted to OffsetStore, guarded by saveMu
+	unhooked   bool  // deleteWebhook was called after a 409, used by pollLoop only
+	running    atomic.Bool
+	wg         sync.WaitGroup
+	stopCh     chan struct{}
 }
 
 // validate checks the configuration and applies defaults.
@@ -103,6 +131,10 @@ func (c *PollerConfig) validate() error {
 		c.UpdatesChanSize = DefaultUpdatesChanSize
 	}
 
+	if c.StallTimeout <= 0 {
+		c.StallTimeout = DefaultStallTimeout
+	}
+
 	if c.HTTPClient == nil {
 		c.HTTPClient = &http.Client{
 			Timeout: c.Timeout + 10*time.Second, // Add buffer for network overhead
@@ -123,9 +155,10 @@ func NewPoller(config PollerConfig) (*Poller, error) {
 	}
 
 	return &Poller{
-		config:  config,
-		updates: make(chan types.Update, config.UpdatesChanSize),
-		stopCh:  make(chan struct{}),
+		config:   config,
+		updates:  make(chan types.Update, config.UpdatesChanSize),
+		progress: make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
 	}, nil
 }
 
@@ -135,18 +168,45 @@ func (p *Poller) Updates() <-chan types.Update {
 }
 
 // Start begins the polling loop in a goroutine.
-// It returns an error if the poller is already running.
+// Updates are committed as soon as they are pushed into the Updates channel.
+// It returns an error if the poller is already running or the stored offset
+// cannot be loaded.
 func (p *Poller) Start(ctx context.Context) error {
+	return p.start(ctx, true)
+}
+
+// start loads the stored offset and launches the polling goroutine.
+func (p *Poller) start(ctx context.Context, autoCommit bool) error {
 	if !p.running.CompareAndSwap(false, true) {
 		return fmt.Errorf("telegram: poller is already running")
 	}
 
+	if p.config.OffsetStore != nil {
+		stored, err := p.config.OffsetStore.Load()
+		if err != nil {
+			p.running.Store(false)
+			return err
+		}
+		if stored > p.offset.Load() {
+			p.offset.Store(stored)
+		}
+		p.saveMu.Lock()
+		p.saved = stored
+		p.saveMu.Unlock()
+	}
+	if p.offset.Load() > p.fetched.Load() {
+		p.fetched.Store(p.offset.Load())
+	}
+
+	p.autoCommit = autoCommit
+
 	p.wg.Add(1)
 	go p.pollLoop(ctx)
 
 	p.config.Logger.Info("telegram poller started",
 		slog.Duration("timeout", p.config.Timeout),
 		slog.Duration("poll_interval", p.config.PollInterval),
+		slog.Int64("offset", p.offset.Load()),
 	)
 
 	return nil
@@ -172,11 +232,51 @@ func (p *Poller) IsRunning() bool {
 	return p.running.Load()
 }
 
-// Offset returns the current update offset.
+// Offset returns the current committed update offset.
 func (p *Poller) Offset() int64 {
 	return p.offset.Load()
 }
 
+// commit marks every update below next as handled and persists the offset.
+// The offset never moves backwards.
+func (p *Poller) commit(next int64) {
+	for {
+		cur := p.offset.Load()
+		if next <= cur {
+			return
+		}
+		if p.offset.CompareAndSwap(cur, next) {
+			break
+		}
+	}
+	select {
+	case p.progress <- struct{}{}:
+	default:
+	}
+
+	if p.config.OffsetStore != nil {
+		p.save(next)
+	}
+}
+
+// save persists next unless a higher offset was already saved. Saves are
+// serialized so concurrent commits cannot leave a lower offset on disk.
+func (p *Poller) save(next int64) {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	if next <= p.saved {
+		return
+	}
+	if err := p.config.OffsetStore.Save(next); err != nil {
+		p.config.Logger.Error("failed to persist update offset",
+			slog.Int64("offset", next),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	p.saved = next
+}
+
 // SetOffset sets the update offset for the next poll.
 func (p *Poller) SetOffset(offset int64) {
 	p.offset.Store(offset)
@@ -214,15 +314,43 @@ func (p *Poller) pollLoop(ctx context.Context) {
 			p.config.Backoff.Reset()
 
 			// Process updates
+			delivered := 0
 			for _, update := range updates {
+				next := int64(update.UpdateID) + 1
+				if next <= p.fetched.Load() {
+					// Already delivered and awaiting commit
+					continue
+				}
+
 				select {
 				case <-ctx.Done():
 					return
 				case <-p.stopCh:
 					return
 				case p.updates <- update:
-					// Update offset to acknowledge this update
-					p.offset.Store(int64(update.UpdateID + 1))
+					delivered++
+					p.fetched.Store(next)
+					if p.autoCommit {
+						p.commit(next)
+					}
+				}
+			}
+
+			// Telegram sent only updates still in flight: polling again
+			// would return the same batch until one of them is committed
+			if len(updates) > 0 && delivered == 0 {
+				stall := time.NewTimer(p.config.StallTimeout)
+				select {
+				case <-ctx.Done():
+					stall.Stop()
+					return
+				case <-p.stopCh:
+					stall.Stop()
+					return
+				case <-p.progress:
+					stall.Stop()
+				case <-stall.C:
+					p.skipStalled()
 				}
 			}
 		}
@@ -244,6 +372,27 @@ func (p *Poller) handleError(ctx context.Context, err error, retryCount *int) bo
 		slog.Int("retry_count", *retryCount),
 	)
 
+	// A webhook left registered (e.g. by an earlier run in webhook mode)
+	// makes getUpdates fail with 409 Conflict; remove it once and poll again.
+	// Telegram also answers 409 when another poller uses the same token,
+	// which deleting a webhook cannot fix.
+	if isAPIErr && apiErr.Code == http.StatusConflict && !isWebhookConflict(apiErr) {
+		p.config.Logger.Error("another getUpdates request is using this bot token, make sure only one bot instance is running",
+			slog.String("description", apiErr.Description),
+		)
+	}
+	if isAPIErr && isWebhookConflict(apiErr) && !p.unhooked {
+		p.unhooked = true
+		if err := p.DeleteWebhook(ctx, false); err != nil {
+			p.config.Logger.Error("failed to delete webhook",
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+		p.config.Logger.Info("deleted webhook to resume polling")
+		return true
+	}
+
 	// Check if we should retry
 	if *retryCount >= p.config.MaxRetries {
 		p.config.Logger.Error("max retries exceeded, stopping poller",
@@ -284,6 +433,12 @@ func (p *Poller) handleError(ctx context.Context, err error, retryCount *int) bo
 	}
 }
 
+// isWebhookConflict reports whether err is the 409 Conflict getUpdates
+// returns while a webhook is registered.
+func isWebhookConflict(err *APIError) bool {
+	return err.Code == http.StatusConflict && strings.Contains(strings.ToLower(err.Description), "webhook")
+}
+
 // getUpdates calls the Telegram getUpdates API method.
 func (p *Poller) getUpdates(ctx context.Context) ([]types.Update, error) {
 	// Build query parameters
@@ -373,6 +528,19 @@ func (p *Poller) getUpdates(ctx context.Context) ([]types.Update, error) {
 	return updates, nil
 }
 
+// DeleteWebhook calls the deleteWebhook API method, which getUpdates needs
+// when a webhook is registered. If dropPending is true, queued updates are
+// discarded.
+func (p *Poller) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	body := map[string]interface{}{}
+	if dropPending {
+		body["drop_pending_updates"] = true
+	}
+
+	_, err := callMethod(ctx, p.config.HTTPClient, p.config.BaseURL, p.config.Token, "deleteWebhook", body)
+	return err
+}
+
 // GetMe calls the getMe API method to test the bot token and get bot info.
 func (p *Poller) GetMe(ctx context.Context) (*types.User, error) {
 	apiURL := fmt.Sprintf("%s/bot%s/getMe", p.config.BaseURL, p.config.Token)
@@ -425,6 +593,14 @@ func WithPollInterval(d time.Duration) PollerOption {
 	}
 }
 
+// WithStallTimeout sets how long the poller waits for a stuck update to be
+// handled before committing past it.
+func WithStallTimeout(d time.Duration) PollerOption {
+	return func(c *PollerConfig) {
+		c.StallTimeout = d
+	}
+}
+
 // WithTimeout sets the long-polling timeout.
 func WithTimeout(d time.Duration) PollerOption {
 	return func(c *PollerConfig) {
@@ -474,6 +650,13 @@ func WithBaseURL(url string) PollerOption {
 	}
 }
 
+// WithOffsetStore sets the store used to persist the update offset.
+func WithOffsetStore(store OffsetStore) PollerOption {
+	return func(c *PollerConfig) {
+		c.OffsetStore = store
+	}
+}
+
 // NewPollerWithOptions creates a new Poller with functional options.
 func NewPollerWithOptions(token string, opts ...PollerOption) (*Poller, error) {
 	config := PollerConfig{
@@ -491,22 +674,123 @@ func NewPollerWithOptions(token string, opts ...PollerOption) (*Poller, error) {
 type UpdateHandler func(ctx context.Context, update types.Update) error
 
 // StartWithHandler starts the poller and processes updates with the given handler.
-// This is a convenience method that handles the common pattern of consuming updates.
+// Each update is committed only after it has been handled, so updates that
+// were fetched but not handled before a crash are redelivered on the next
+// start (at-least-once delivery). An update counts as handled when the
+// handler returns, or, if the handler called DeferAck, when the func it
+// returned is called. The committed offset only advances past updates that
+// are all handled, whatever order they finish in.
 func (p *Poller) StartWithHandler(ctx context.Context, handler UpdateHandler) error {
-	if err := p.Start(ctx); err != nil {
+	if err := p.start(ctx, false); err != nil {
 		return err
 	}
 
 	go func() {
 		for update := range p.Updates() {
-			if err := handler(ctx, update); err != nil {
+			a := p.track(int64(update.UpdateID) + 1)
+			if err := handler(contextWithAck(ctx, a), update); err != nil {
 				p.config.Logger.Error("handler error",
 					slog.String("error", err.Error()),
 					slog.Int("update_id", update.UpdateID),
 				)
 			}
+			// Commit even on handler error: retrying a failing update forever
+			// would block every update behind it.
+			if !a.deferred {
+				p.done(a)
+			}
 		}
 	}()
 
 	return nil
 }
+
+// ack is an update handed to the handler of StartWithHandler and not yet
+// handled.
+type ack struct {
+	poller   *Poller
+	next     int64 // update ID + 1
+	handled  bool  // guarded by poller.pendingMu
+	deferred bool  // set by DeferAck during the handler call
+	once     sync.Once
+}
+
+// track starts tracking the handling of the update below next.
+func (p *Poller) track(next int64) *ack {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	a := &ack{poller: p, next: next}
+	p.pending = append(p.pending, a)
+	return a
+}
+
+// done marks the update of a as handled and commits every handled update
+// that no unhandled one precedes.
+func (p *Poller) done(a *ack) {
+	p.pendingMu.Lock()
+	a.handled = true
+	next := p.popHandled()
+	p.pendingMu.Unlock()
+
+	if next > 0 {
+		p.commit(next)
+	}
+}
+
+// popHandled stops tracking the handled updates no unhandled one precedes
+// and returns the offset to commit, or 0 if there is none. Callers hold
+// p.pendingMu.
+func (p *Poller) popHandled() int64 {
+	var next int64
+	for len(p.pending) > 0 && p.pending[0].handled {
+		next = p.pending[0].next
+		p.pending = p.pending[1:]
+	}
+	return next
+}
+
+// skipStalled gives up on the oldest unhandled update, which has held back
+// every later one for StallTimeout, and commits past it.
+func (p *Poller) skipStalled() {
+	p.pendingMu.Lock()
+	if len(p.pending) == 0 {
+		p.pendingMu.Unlock()
+		return
+	}
+	stalled := p.pending[0]
+	stalled.handled = true
+	next := p.popHandled()
+	p.pendingMu.Unlock()
+
+	p.config.Logger.Error("update not acknowledged in time, committing past it",
+		slog.Int64("update_id", stalled.next-1),
+		slog.Duration("stall_timeout", p.config.StallTimeout),
+	)
+	p.commit(next)
+}
+
+type ackKey struct{}
+
+func contextWithAck(ctx context.Context, a *ack) context.Context {
+	return context.WithValue(ctx, ackKey{}, a)
+}
+
+// DeferAck is called by a StartWithHandler handler that finishes the update
+// after returning, e.g. in a worker goroutine. The update is then committed
+// only once the returned func is called; calling it more than once is
+// harmless. Outside such a handler, or when called twice for one update, it
+// returns a no-op.
+//
+// Since an update is redelivered after a crash until it is committed, a
+// handler that never calls the func holds back the offset of every later
+// update.
+func DeferAck(ctx context.Context) func() {
+	a, ok := ctx.Value(ackKey{}).(*ack)
+	if !ok || a.deferred {
+		return func() {}
+	}
+	a.deferred = true
+	return func() {
+		a.once.Do(func() { a.poller.done(a) })
+	}
+}
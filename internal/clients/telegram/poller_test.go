@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -507,3 +508,339 @@ func TestAllowedUpdateTypeString(t *testing.T) {
 		t.Errorf("UpdateTypeMessage.String() = %q, want %q", UpdateTypeMessage.String(), "message")
 	}
 }
+
+func TestPollerLoadsStoredOffset(t *testing.T) {
+	store := &MemoryOffsetStore{}
+	store.Save(500)
+
+	mockClient := &mockHTTPClient{}
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(mockClient),
+		WithPollInterval(10*time.Millisecond),
+		WithTimeout(time.Second),
+		WithOffsetStore(store),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	if err := poller.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	poller.Stop()
+
+	if poller.Offset() != 500 {
+		t.Errorf("Offset() = %d, want 500", poller.Offset())
+	}
+	if len(mockClient.requests) == 0 {
+		t.Fatal("expected at least one getUpdates request")
+	}
+	if got := mockClient.requests[0].URL.Query().Get("offset"); got != "500" {
+		t.Errorf("offset query = %q, want %q", got, "500")
+	}
+}
+
+// slowOffsetStore records every saved offset, taking a while for each save.
+type slowOffsetStore struct {
+	mu    sync.Mutex
+	saves []int64
+}
+
+func (s *slowOffsetStore) Load() (int64, error) { return 0, nil }
+
+func (s *slowOffsetStore) Save(offset int64) error {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves = append(s.saves, offset)
+	return nil
+}
+
+func TestPollerCommitSavesInOrder(t *testing.T) {
+	store := &slowOffsetStore{}
+	poller, err := NewPollerWithOptions("test-token", WithOffsetStore(store))
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for next := int64(1); next <= 20; next++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			poller.commit(next)
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i < len(store.saves); i++ {
+		if store.saves[i] <= store.saves[i-1] {
+			t.Fatalf("saves = %v, want strictly increasing", store.saves)
+		}
+	}
+	if last := store.saves[len(store.saves)-1]; last != poller.Offset() {
+		t.Errorf("last saved offset = %d, want %d", last, poller.Offset())
+	}
+}
+
+func TestPollerDeletesWebhookOnConflict(t *testing.T) {
+	updatesJSON, _ := json.Marshal([]types.Update{{UpdateID: 7, Message: &types.Message{ID: 100}}})
+	responseBody, _ := json.Marshal(APIResponse{OK: true, Result: updatesJSON})
+
+	mockClient := &mockHTTPClient{
+		responses: []mockResponse{
+			{statusCode: http.StatusConflict, body: `{"ok":false,"error_code":409,"description":"Conflict: can't use getUpdates method while webhook is active"}`},
+			{statusCode: http.StatusOK, body: `{"ok":true,"result":true}`},
+			{statusCode: http.StatusOK, body: string(responseBody)},
+		},
+	}
+
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(mockClient),
+		WithPollInterval(10*time.Millisecond),
+		WithTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := poller.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer poller.Stop()
+
+	select {
+	case update := <-poller.Updates():
+		if update.UpdateID != 7 {
+			t.Errorf("UpdateID = %d, want 7", update.UpdateID)
+		}
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("no update received after the conflict")
+	}
+
+	req := mockClient.requests[1]
+	if !strings.HasSuffix(req.URL.Path, "/deleteWebhook") {
+		t.Fatalf("second request = %s, want deleteWebhook", req.URL.Path)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if strings.Contains(string(body), "drop_pending_updates") {
+		t.Errorf("deleteWebhook body = %s, want pending updates kept", body)
+	}
+}
+
+func TestPollerKeepsWebhookOnOtherConflict(t *testing.T) {
+	mockClient := &mockHTTPClient{
+		responses: []mockResponse{
+			{statusCode: http.StatusConflict, body: `{"ok":false,"error_code":409,"description":"Conflict: terminated by other getUpdates request; make sure that only one bot instance is running"}`},
+		},
+	}
+
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(mockClient),
+		WithPollInterval(10*time.Millisecond),
+		WithTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	if err := poller.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	// The poller gives up on the conflict without another request
+	time.Sleep(100 * time.Millisecond)
+	poller.Stop()
+
+	for _, req := range mockClient.requests {
+		if strings.HasSuffix(req.URL.Path, "/deleteWebhook") {
+			t.Fatal("deleteWebhook called for a conflict with another poller")
+		}
+	}
+	if len(mockClient.requests) != 1 {
+		t.Errorf("requests = %d, want polling to stop after the conflict", len(mockClient.requests))
+	}
+}
+
+func TestStartWithHandler_CommitsAfterHandler(t *testing.T) {
+	updates := []types.Update{
+		{UpdateID: 10, Message: &types.Message{ID: 100}},
+	}
+	updatesJSON, _ := json.Marshal(updates)
+	responseBody, _ := json.Marshal(APIResponse{OK: true, Result: updatesJSON})
+
+	// Telegram returns the same in-flight update again until it is committed.
+	mockClient := &mockHTTPClient{
+		responses: []mockResponse{
+			{statusCode: http.StatusOK, body: string(responseBody)},
+			{statusCode: http.StatusOK, body: string(responseBody)},
+			{statusCode: http.StatusOK, body: string(responseBody)},
+		},
+	}
+
+	store := &MemoryOffsetStore{}
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(mockClient),
+		WithPollInterval(10*time.Millisecond),
+		WithTimeout(time.Second),
+		WithOffsetStore(store),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	release := make(chan struct{})
+	var handled atomic.Int32
+	handler := func(ctx context.Context, update types.Update) error {
+		handled.Add(1)
+		<-release
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := poller.StartWithHandler(ctx, handler); err != nil {
+		t.Fatalf("StartWithHandler() error = %v", err)
+	}
+
+	// While the handler is blocked nothing is committed
+	time.Sleep(60 * time.Millisecond)
+	if offset, _ := store.Load(); offset != 0 {
+		t.Errorf("stored offset before handler returned = %d, want 0", offset)
+	}
+
+	close(release)
+	time.Sleep(30 * time.Millisecond)
+	poller.Stop()
+
+	if offset, _ := store.Load(); offset != 11 {
+		t.Errorf("stored offset = %d, want 11", offset)
+	}
+	if count := handled.Load(); count != 1 {
+		t.Errorf("handler called %d times, want 1 (duplicates must be skipped)", count)
+	}
+}
+
+func TestStartWithHandler_DeferAck(t *testing.T) {
+	updates := []types.Update{
+		{UpdateID: 10, Message: &types.Message{ID: 100}},
+		{UpdateID: 11, Message: &types.Message{ID: 101}},
+		{UpdateID: 12, Message: &types.Message{ID: 102}},
+	}
+	updatesJSON, _ := json.Marshal(updates)
+	responseBody, _ := json.Marshal(APIResponse{OK: true, Result: updatesJSON})
+
+	// Telegram keeps returning the in-flight batch until it is committed
+	var responses []mockResponse
+	for i := 0; i < 20; i++ {
+		responses = append(responses, mockResponse{statusCode: http.StatusOK, body: string(responseBody)})
+	}
+	mockClient := &mockHTTPClient{responses: responses}
+
+	store := &MemoryOffsetStore{}
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(mockClient),
+		WithPollInterval(5*time.Millisecond),
+		WithTimeout(time.Second),
+		WithOffsetStore(store),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	// Updates 10 and 11 finish later, like an AI turn in a chat worker;
+	// 12 is handled when the handler returns
+	acks := make(chan func(), 2)
+	handler := func(ctx context.Context, update types.Update) error {
+		if update.UpdateID < 12 {
+			acks <- DeferAck(ctx)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := poller.StartWithHandler(ctx, handler); err != nil {
+		t.Fatalf("StartWithHandler() error = %v", err)
+	}
+	ack10, ack11 := <-acks, <-acks
+
+	// The batch is in flight: the poller waits instead of polling again
+	time.Sleep(60 * time.Millisecond)
+	if offset, _ := store.Load(); offset != 0 {
+		t.Errorf("stored offset with 10 unhandled = %d, want 0", offset)
+	}
+
+	// Handling 11 first commits nothing: 10 is still unhandled
+	ack11()
+	time.Sleep(20 * time.Millisecond)
+	if offset, _ := store.Load(); offset != 0 {
+		t.Errorf("stored offset with 10 unhandled = %d, want 0", offset)
+	}
+
+	ack10()
+	ack10()
+	time.Sleep(20 * time.Millisecond)
+	poller.Stop()
+
+	if offset, _ := store.Load(); offset != 13 {
+		t.Errorf("stored offset = %d, want 13", offset)
+	}
+	// One poll for the batch, one after each commit
+	if n := len(mockClient.requests); n > 3 {
+		t.Errorf("getUpdates called %d times, want no polling while the batch was in flight", n)
+	}
+}
+
+func TestStartWithHandler_StalledAck(t *testing.T) {
+	updates := []types.Update{
+		{UpdateID: 10, Message: &types.Message{ID: 100}},
+		{UpdateID: 11, Message: &types.Message{ID: 101}},
+	}
+	updatesJSON, _ := json.Marshal(updates)
+	responseBody, _ := json.Marshal(APIResponse{OK: true, Result: updatesJSON})
+	var responses []mockResponse
+	for i := 0; i < 20; i++ {
+		responses = append(responses, mockResponse{statusCode: http.StatusOK, body: string(responseBody)})
+	}
+
+	store := &MemoryOffsetStore{}
+	poller, err := NewPollerWithOptions("test-token",
+		WithHTTPClient(&mockHTTPClient{responses: responses}),
+		WithPollInterval(5*time.Millisecond),
+		WithTimeout(time.Second),
+		WithOffsetStore(store),
+		WithStallTimeout(30*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewPollerWithOptions() error = %v", err)
+	}
+
+	// Update 10 is never acknowledged, as if its handler hung
+	handler := func(ctx context.Context, update types.Update) error {
+		if update.UpdateID == 10 {
+			DeferAck(ctx)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := poller.StartWithHandler(ctx, handler); err != nil {
+		t.Fatalf("StartWithHandler() error = %v", err)
+	}
+	time.Sleep(15 * time.Millisecond)
+	if offset, _ := store.Load(); offset != 0 {
+		t.Errorf("stored offset before the stall timeout = %d, want 0", offset)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	poller.Stop()
+	if offset, _ := store.Load(); offset != 12 {
+		t.Errorf("stored offset after the stall timeout = %d, want 12", offset)
+	}
+}
@@ -0,0 +1,244 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SendLimits paces outgoing messages to stay under Telegram's flood limits.
+// A zero field disables that limit.
+type SendLimits struct {
+	// GlobalPerSecond caps messages per second across all chats.
+	GlobalPerSecond int
+
+	// ChatInterval is the sustained minimum interval between messages to one
+	// chat; ChatBurst messages may be sent at once before it applies.
+	ChatInterval time.Duration
+	ChatBurst    int
+
+	// GroupPerMinute caps messages per minute to one group or channel.
+	GroupPerMinute int
+}
+
+// DefaultSendLimits follow the Bot API FAQ: about 30 messages per second
+// overall, one per second in a chat and 20 per minute in a group.
+var DefaultSendLimits = SendLimits{
+	GlobalPerSecond: 30,
+	ChatInterval:    time.Second,
+	ChatBurst:       3,
+	GroupPerMinute:  20,
+}
+
+// queuedMethods are the methods paced by the send queue: the ones that post
+// or change messages in a chat.
+var queuedMethods = map[string]bool{
+	"sendMessage":     true,
+	"editMessageText": true,
+}
+
+// gcra is a token bucket expressed as a theoretical arrival time (the
+// generic cell rate algorithm): burst requests at once, then one per interval.
+type gcra struct {
+	burst    int
+	interval time.Duration
+	tat      time.Time
+}
+
+func newGCRA(burst int, interval time.Duration) *gcra {
+	if burst <= 0 || interval <= 0 {
+		return nil
+	}
+	return &gcra{burst: burst, interval: interval}
+}
+
+// earliest returns the first time at or after now a request conforms.
+func (g *gcra) earliest(now time.Time) time.Time {
+	if g == nil {
+		return now
+	}
+	t := g.tat.Add(-time.Duration(g.burst-1) * g.interval)
+	if t.After(now) {
+		return t
+	}
+	return now
+}
+
+// spare reports whether a request at now conforms and leaves another one
+// conforming right after it, unless the burst is a single request.
+func (g *gcra) spare(now time.Time) bool {
+	if g == nil {
+		return true
+	}
+	headroom := g.burst - 2
+	if headroom < 0 {
+		headroom = 0
+	}
+	return !g.tat.After(now.Add(time.Duration(headroom) * g.interval))
+}
+
+// take records a request sent at t.
+func (g *gcra) take(t time.Time) {
+	if g == nil {
+		return
+	}
+	if g.tat.Before(t) {
+		g.tat = t
+	}
+	g.tat = g.tat.Add(g.interval)
+}
+
+// idle reports whether the bucket is full at now, so forgetting it changes
+// nothing.
+func (g *gcra) idle(now time.Time) bool {
+	return g == nil || !g.tat.After(now)
+}
+
+// chatQueue is the pacing state of one chat.
+type chatQueue struct {
+	chat  *gcra
+	group *gcra
+	// blockedUntil is set when Telegram answers 429 for the chat.
+	blockedUntil time.Time
+}
+
+// queueSweepInterval is how often idle chat states are forgotten.
+const queueSweepInterval = time.Minute
+
+// sendQueue hands out send times in request order, so concurrent callers
+// queue up behind each other instead of tripping Telegram's flood control.
+// It is safe for concurrent use.
+type sendQueue struct {
+	limits SendLimits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	global    *gcra
+	chats     map[int64]*chatQueue
+	lastSweep time.Time
+}
+
+func newSendQueue(limits SendLimits) *sendQueue {
+	q := &sendQueue{
+		limits: limits,
+		now:    time.Now,
+		chats:  make(map[int64]*chatQueue),
+	}
+	if limits.GlobalPerSecond > 0 {
+		q.global = newGCRA(limits.GlobalPerSecond, time.Second/time.Duration(limits.GlobalPerSecond))
+	}
+	return q
+}
+
+// reserve books the next send slot for chatID and returns how long the
+// caller must wait before taking a global slot with reserveGlobal.
+func (q *sendQueue) reserve(chatID int64) time.Duration {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sweep(now)
+	c := q.chat(chatID)
+
+	at := now
+	for _, t := range []time.Time{c.chat.earliest(now), c.group.earliest(now), c.blockedUntil} {
+		if t.After(at) {
+			at = t
+		}
+	}
+	c.chat.take(at)
+	c.group.take(at)
+	return at.Sub(now)
+}
+
+// tryReserve books a chat and a global slot for chatID only if both are
+// free now and the chat keeps one for its next message, and reports whether
+// it did. Optional messages, such as the intermediate edits of a streamed
+// reply, thus use spare capacity without waiting or delaying the others.
+func (q *sendQueue) tryReserve(chatID int64) bool {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sweep(now)
+	c := q.chat(chatID)
+	if c.blockedUntil.After(now) || !c.chat.spare(now) || !c.group.spare(now) || q.global.earliest(now).After(now) {
+		return false
+	}
+	c.chat.take(now)
+	c.group.take(now)
+	q.global.take(now)
+	return true
+}
+
+// chat returns the pacing state of chatID, creating it if needed. Callers
+// hold q.mu.
+func (q *sendQueue) chat(chatID int64) *chatQueue {
+	c, ok := q.chats[chatID]
+	if !ok {
+		c = &chatQueue{chat: newGCRA(q.limits.ChatBurst, q.limits.ChatInterval)}
+		// Group and channel IDs are negative
+		if chatID < 0 && q.limits.GroupPerMinute > 0 {
+			c.group = newGCRA(q.limits.GroupPerMinute, time.Minute/time.Duration(q.limits.GroupPerMinute))
+		}
+		q.chats[chatID] = c
+	}
+	return c
+}
+
+// reserveGlobal books the next slot of the global limit and returns how long
+// the caller must wait before sending. It is taken only once the chat slot
+// is due, so a message held back in one chat never delays the others.
+func (q *sendQueue) reserveGlobal() time.Duration {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	at := q.global.earliest(now)
+	q.global.take(at)
+	return at.Sub(now)
+}
+
+// block holds back every message to chatID for d, after Telegram asked the
+// bot to retry later.
+func (q *sendQueue) block(chatID int64, d time.Duration) {
+	until := q.now().Add(d)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if c, ok := q.chats[chatID]; ok && until.After(c.blockedUntil) {
+		c.blockedUntil = until
+	}
+}
+
+// sweep forgets chats whose buckets are full. Callers hold q.mu.
+func (q *sendQueue) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < queueSweepInterval {
+		return
+	}
+	q.lastSweep = now
+	for id, c := range q.chats {
+		if c.chat.idle(now) && c.group.idle(now) && !c.blockedUntil.After(now) {
+			delete(q.chats, id)
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
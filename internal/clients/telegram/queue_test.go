@@ -0,0 +1,251 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendQueue_ChatPacing(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := newSendQueue(SendLimits{ChatInterval: time.Second, ChatBurst: 3})
+	q.now = func() time.Time { return now }
+
+	// The burst goes out at once, then one message per interval
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second}
+	for i, w := range want {
+		if got := q.reserve(42); got != w {
+			t.Errorf("reserve %d = %v, want %v", i, got, w)
+		}
+	}
+	if got := q.reserve(43); got != 0 {
+		t.Errorf("other chat waits %v, want 0", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	if got := q.reserve(42); got != 0 {
+		t.Errorf("after a pause the chat waits %v, want 0", got)
+	}
+}
+
+func TestSendQueue_Group(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := newSendQueue(SendLimits{GroupPerMinute: 2})
+	q.now = func() time.Time { return now }
+
+	q.reserve(-100)
+	q.reserve(-100)
+	if got := q.reserve(-100); got != 30*time.Second {
+		t.Errorf("third group message waits %v, want 30s", got)
+	}
+	if got := q.reserve(1); got != 0 {
+		t.Errorf("private message waits %v, want 0", got)
+	}
+}
+
+func TestSendQueue_Global(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := newSendQueue(SendLimits{GlobalPerSecond: 4})
+	q.now = func() time.Time { return now }
+
+	want := []time.Duration{0, 0, 0, 0, 250 * time.Millisecond, 500 * time.Millisecond}
+	for i, w := range want {
+		if got := q.reserveGlobal(); got != w {
+			t.Errorf("reserveGlobal %d = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestSendQueue_Block(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := newSendQueue(SendLimits{})
+	q.now = func() time.Time { return now }
+
+	q.reserve(42)
+	q.block(42, 5*time.Second)
+	if got := q.reserve(42); got != 5*time.Second {
+		t.Errorf("blocked chat waits %v, want 5s", got)
+	}
+	if got := q.reserve(43); got != 0 {
+		t.Errorf("other chat waits %v, want 0", got)
+	}
+}
+
+func TestSendQueue_TryReserve(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := newSendQueue(SendLimits{ChatInterval: time.Second, ChatBurst: 3, GroupPerMinute: 2})
+	q.now = func() time.Time { return now }
+
+	// Optional messages leave one slot of the burst for the next message
+	if !q.tryReserve(42) || !q.tryReserve(42) {
+		t.Fatal("tryReserve() = false within the burst")
+	}
+	if q.tryReserve(42) {
+		t.Error("tryReserve() took the chat's last slot")
+	}
+	if got := q.reserve(42); got != 0 {
+		t.Errorf("message after skipped edits waits %v, want 0", got)
+	}
+
+	// In a group the group limit counts as well
+	if !q.tryReserve(-100) || q.tryReserve(-100) {
+		t.Error("tryReserve() in a group, want only the first of 2 per minute")
+	}
+
+	q.reserve(43)
+	q.block(43, time.Second)
+	if q.tryReserve(43) {
+		t.Error("tryReserve() = true in a blocked chat")
+	}
+}
+
+// retryServer answers with the given status codes in turn, then succeeds.
+func retryServer(t *testing.T, failures ...string) (*httptest.Server, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if calls <= len(failures) {
+			fmt.Fprint(w, failures[calls-1])
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":42,"type":"private"}}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+const (
+	tooManyRequests = `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 2","parameters":{"retry_after":2}}`
+	badGateway      = `{"ok":false,"error_code":502,"description":"Bad Gateway"}`
+	chatNotFound    = `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+)
+
+func TestSenderRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  []string
+		send      func(s *Sender) error
+		wantErr   bool
+		wantCalls int
+		wantSleep []time.Duration
+	}{
+		{
+			name:      "429 waits retry_after",
+			failures:  []string{tooManyRequests},
+			send:      func(s *Sender) error { return s.SendText(context.Background(), 42, "hi") },
+			wantCalls: 2,
+			wantSleep: []time.Duration{2 * time.Second},
+		},
+		{
+			name:      "5xx uses backoff",
+			failures:  []string{badGateway, badGateway},
+			send:      func(s *Sender) error { return s.SendText(context.Background(), 42, "hi") },
+			wantCalls: 3,
+			wantSleep: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		{
+			name:      "gives up after max retries",
+			failures:  []string{badGateway, badGateway, badGateway},
+			send:      func(s *Sender) error { return s.SendText(context.Background(), 42, "hi") },
+			wantErr:   true,
+			wantCalls: 3,
+			wantSleep: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		{
+			name:      "client errors are not retried",
+			failures:  []string{chatNotFound},
+			send:      func(s *Sender) error { return s.SendText(context.Background(), 42, "hi") },
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:     "skippable edits are not retried",
+			failures: []string{tooManyRequests},
+			send: func(s *Sender) error {
+				_, err := s.TryEditMessageText(context.Background(), 42, 1, "partial")
+				return err
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "chat actions are not retried",
+			failures:  []string{tooManyRequests},
+			send:      func(s *Sender) error { return s.SendChatAction(context.Background(), 42, "typing") },
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := retryServer(t, tt.failures...)
+			sender, err := NewSender("test-token",
+				WithSenderBaseURL(server.URL),
+				WithSenderMaxRetries(2),
+				WithSenderBackoff(&ExponentialBackoff{InitialInterval: 10 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}),
+				WithSendLimits(SendLimits{}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+			sender.queue.now = func() time.Time { return now }
+			var slept []time.Duration
+			sender.sleep = func(ctx context.Context, d time.Duration) error {
+				if d > 0 {
+					slept = append(slept, d)
+				}
+				return nil
+			}
+
+			err = tt.send(sender)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("requests = %d, want %d", *calls, tt.wantCalls)
+			}
+			if fmt.Sprint(slept) != fmt.Sprint(tt.wantSleep) {
+				t.Errorf("waits = %v, want %v", slept, tt.wantSleep)
+			}
+		})
+	}
+}
+
+func TestTryEditMessageText(t *testing.T) {
+	server, calls := retryServer(t, tooManyRequests)
+	sender, err := NewSender("test-token",
+		WithSenderBaseURL(server.URL),
+		WithSendLimits(SendLimits{ChatInterval: time.Second, ChatBurst: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.sleep = func(ctx context.Context, d time.Duration) error {
+		t.Errorf("sender waited %v, want no waits", d)
+		return nil
+	}
+
+	// A 429 fails the edit and holds back the chat...
+	if sent, err := sender.TryEditMessageText(context.Background(), 42, 1, "one"); sent || err == nil {
+		t.Errorf("TryEditMessageText() = %v, %v; want the 429", sent, err)
+	}
+	// ...so the next edit is skipped without a request
+	sent, err := sender.TryEditMessageText(context.Background(), 42, 1, "two")
+	if sent || err != nil {
+		t.Errorf("TryEditMessageText() = %v, %v; want skipped", sent, err)
+	}
+	if *calls != 1 {
+		t.Errorf("requests = %d, want 1", *calls)
+	}
+}
@@ -2,14 +2,17 @@
 package telegram
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/formatting"
 )
 
 // SenderConfig holds configuration options for the Sender.
@@ -32,6 +35,40 @@ type SenderConfig struct {
 	// Timeout is the HTTP client timeout.
 	// Defaults to 30s. Used only when HTTPClient is nil.
 	Timeout time.Duration
+
+	// ParseMode is the default parse mode for message text.
+	// With MarkdownV2 or HTML, text is treated as CommonMark and converted
+	// before sending. Defaults to Markdown (text is sent as is).
+	ParseMode formatting.Mode
+
+	// SendLimits paces sendMessage and editMessageText requests.
+	// Defaults to DefaultSendLimits if nil.
+	SendLimits *SendLimits
+
+	// MaxRetries is how often a request is retried after a 429 or 5xx
+	// answer. Defaults to DefaultSendRetries if negative.
+	MaxRetries int
+
+	// Backoff is the delay strategy for retrying 5xx answers (429 answers
+	// wait for their retry_after). Defaults to ExponentialBackoff if nil.
+	Backoff BackoffStrategy
+
+	// MaxRetryAfter is the longest retry_after the sender waits for; a 429
+	// asking for more is returned to the caller. Defaults to DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+}
+
+// Default retry settings of the Sender.
+const (
+	DefaultSendRetries   = 3
+	DefaultMaxRetryAfter = 20 * time.Second
+)
+
+// ephemeralMethods are never retried: a late chat action or callback answer
+// is useless and would only hold up the caller.
+var ephemeralMethods = map[string]bool{
+	"sendChatAction":      true,
+	"answerCallbackQuery": true,
 }
 
 // validate checks the configuration and applies defaults.
@@ -58,12 +95,37 @@ func (c *SenderConfig) validate() error {
 		c.Logger = slog.Default()
 	}
 
+	if c.ParseMode == "" {
+		c.ParseMode = formatting.ModeMarkdown
+	}
+
+	if c.SendLimits == nil {
+		limits := DefaultSendLimits
+		c.SendLimits = &limits
+	}
+
+	if c.MaxRetries < 0 {
+		c.MaxRetries = DefaultSendRetries
+	}
+
+	if c.Backoff == nil {
+		c.Backoff = NewExponentialBackoff()
+	}
+
+	if c.MaxRetryAfter <= 0 {
+		c.MaxRetryAfter = DefaultMaxRetryAfter
+	}
+
 	return nil
 }
 
 // Sender sends messages and actions via the Telegram Bot API.
+// Messages go through a send queue that paces them under Telegram's flood
+// limits, and requests answered with 429 or 5xx are retried.
 type Sender struct {
 	config SenderConfig
+	queue  *sendQueue
+	sleep  func(ctx context.Context, d time.Duration) error
 }
 
 // SenderOption is a functional option for configuring the Sender.
@@ -97,10 +159,48 @@ func WithSenderTimeout(d time.Duration) SenderOption {
 	}
 }
 
+// WithSenderParseMode sets the default parse mode for message text.
+func WithSenderParseMode(mode formatting.Mode) SenderOption {
+	return func(c *SenderConfig) {
+		c.ParseMode = mode
+	}
+}
+
+// WithSendLimits sets the pacing of outgoing messages. Zero fields disable
+// the corresponding limit.
+func WithSendLimits(limits SendLimits) SenderOption {
+	return func(c *SenderConfig) {
+		c.SendLimits = &limits
+	}
+}
+
+// WithSenderMaxRetries sets how often a request answered with 429 or 5xx is
+// retried. Zero disables retries.
+func WithSenderMaxRetries(n int) SenderOption {
+	return func(c *SenderConfig) {
+		c.MaxRetries = n
+	}
+}
+
+// WithSenderBackoff sets the backoff strategy for retrying 5xx answers.
+func WithSenderBackoff(b BackoffStrategy) SenderOption {
+	return func(c *SenderConfig) {
+		c.Backoff = b
+	}
+}
+
+// WithSenderMaxRetryAfter sets the longest retry_after the sender waits for.
+func WithSenderMaxRetryAfter(d time.Duration) SenderOption {
+	return func(c *SenderConfig) {
+		c.MaxRetryAfter = d
+	}
+}
+
 // NewSender creates a new Sender with the given token and functional options.
 func NewSender(token string, opts ...SenderOption) (*Sender, error) {
 	config := SenderConfig{
-		Token: token,
+		Token:      token,
+		MaxRetries: DefaultSendRetries,
 	}
 
 	for _, opt := range opts {
@@ -111,13 +211,19 @@ func NewSender(token string, opts ...SenderOption) (*Sender, error) {
 		return nil, err
 	}
 
-	return &Sender{config: config}, nil
+	return &Sender{
+		config: config,
+		queue:  newSendQueue(*config.SendLimits),
+		sleep:  sleepContext,
+	}, nil
 }
 
 // SendOption is a functional option for configuring individual send requests.
 type SendOption func(map[string]interface{})
 
 // WithParseMode sets the parse mode for the message (e.g. "Markdown", "HTML").
+// The text is then sent as is, without conversion from CommonMark.
+// An empty mode sends the text without any formatting.
 func WithParseMode(mode string) SendOption {
 	return func(body map[string]interface{}) {
 		body["parse_mode"] = mode
@@ -138,6 +244,44 @@ func WithReplyToMessageID(id int) SendOption {
 	}
 }
 
+// WithReplyMarkup attaches a keyboard to the message, e.g. a
+// *types.InlineKeyboardMarkup.
+func WithReplyMarkup(markup interface{}) SendOption {
+	return func(body map[string]interface{}) {
+		body["reply_markup"] = markup
+	}
+}
+
+// WithMessageThreadID sends the message to a topic of a forum supergroup.
+func WithMessageThreadID(id int) SendOption {
+	return func(body map[string]interface{}) {
+		body["message_thread_id"] = id
+	}
+}
+
+type threadKey struct{}
+
+// ContextWithThreadID returns a context whose messages and chat actions go
+// to the forum topic threadID unless a request sets its own. It lets code
+// answering an update in a topic reply there without passing the topic down.
+func ContextWithThreadID(ctx context.Context, threadID int) context.Context {
+	return context.WithValue(ctx, threadKey{}, threadID)
+}
+
+// withContextThread sets the forum topic stored in ctx, if any, on body.
+func withContextThread(ctx context.Context, body map[string]interface{}) {
+	if id, _ := ctx.Value(threadKey{}).(int); id != 0 {
+		body["message_thread_id"] = id
+	}
+}
+
+// withoutReplyMarkup removes a keyboard set by an earlier option.
+func withoutReplyMarkup() SendOption {
+	return func(body map[string]interface{}) {
+		delete(body, "reply_markup")
+	}
+}
+
 // SendText sends a plain text message to the specified chat.
 // This is the simplified version of SendMessage without options.
 func (s *Sender) SendText(ctx context.Context, chatID int64, text string) error {
@@ -145,24 +289,138 @@ func (s *Sender) SendText(ctx context.Context, chatID int64, text string) error
 }
 
 // SendMessage sends a text message to the specified chat.
-// By default it uses Markdown parse mode. Use WithParseMode to override.
+// By default it uses the sender's parse mode. Use WithParseMode to override.
+// If Telegram cannot parse the formatted text, it is resent as plain text.
 func (s *Sender) SendMessage(ctx context.Context, chatID int64, text string, opts ...SendOption) error {
+	_, err := s.SendMessageResult(ctx, chatID, text, opts...)
+	return err
+}
+
+// SendMessageResult sends a text message like SendMessage and returns the
+// message created by Telegram (e.g. to edit it later).
+func (s *Sender) SendMessageResult(ctx context.Context, chatID int64, text string, opts ...SendOption) (*types.Message, error) {
+	body := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	withContextThread(ctx, body)
+
+	for _, opt := range opts {
+		opt(body)
+	}
+
+	s.config.Logger.Debug("sending message",
+		slog.Int64("chat_id", chatID),
+		slog.Int("text_len", len(text)),
+	)
+
+	return s.postMessage(ctx, "sendMessage", body)
+}
+
+// SendLongMessage sends text that may exceed MaxMessageLength. The text is
+// split with SplitMessage and the chunks are sent in order, each one replying
+// to the previous chunk so they read as a single thread. opts apply to every
+// chunk, except that a reply target set with WithReplyToMessageID applies to
+// the first and a keyboard set with WithReplyMarkup to the last.
+// It returns the messages sent before any error occurred.
+func (s *Sender) SendLongMessage(ctx context.Context, chatID int64, text string, opts ...SendOption) ([]*types.Message, error) {
+	chunks := SplitMessage(text, MaxMessageLength)
+	sent := make([]*types.Message, 0, len(chunks))
+
+	for i, chunk := range chunks {
+		chunkOpts := opts[:len(opts):len(opts)]
+		if i > 0 {
+			chunkOpts = append(chunkOpts, WithReplyToMessageID(sent[i-1].ID))
+		}
+		if i < len(chunks)-1 {
+			chunkOpts = append(chunkOpts, withoutReplyMarkup())
+		}
+
+		msg, err := s.SendMessageResult(ctx, chatID, chunk, chunkOpts...)
+		if err != nil {
+			return sent, fmt.Errorf("telegram: failed to send chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		sent = append(sent, msg)
+	}
+
+	return sent, nil
+}
+
+// EditMessageText replaces the text of a message previously sent by the bot.
+// Formatting works as in SendMessage, including the plain-text fallback.
+func (s *Sender) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...SendOption) error {
 	body := map[string]interface{}{
 		"chat_id":    chatID,
+		"message_id": messageID,
 		"text":       text,
-		"parse_mode": "Markdown",
 	}
 
 	for _, opt := range opts {
 		opt(body)
 	}
 
-	s.config.Logger.Debug("sending message",
+	s.config.Logger.Debug("editing message",
 		slog.Int64("chat_id", chatID),
+		slog.Int("message_id", messageID),
 		slog.Int("text_len", len(text)),
 	)
 
-	return s.doPost(ctx, "sendMessage", body)
+	_, err := s.postText(ctx, "editMessageText", body)
+	return err
+}
+
+// TryEditMessageText edits a message like EditMessageText, but only if the
+// chat can take the edit right now without delaying its next message. It
+// never waits for the send queue nor retries, and reports whether the edit
+// was sent; a skipped edit is not an error. Streamed partial replies use it
+// so generation never waits on Telegram's flood limits.
+func (s *Sender) TryEditMessageText(ctx context.Context, chatID int64, messageID int, text string, opts ...SendOption) (bool, error) {
+	err := s.EditMessageText(context.WithValue(ctx, skippableKey{}, true), chatID, messageID, text, opts...)
+	if errors.Is(err, errSlotBusy) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// skippableKey marks a context whose queued request is dropped rather than
+// delayed, see TryEditMessageText.
+type skippableKey struct{}
+
+// errSlotBusy is returned by call for a skippable request without a free
+// send slot.
+var errSlotBusy = errors.New("telegram: no free send slot")
+
+// DeleteMessage deletes a message previously sent by the bot.
+func (s *Sender) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
+	body := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}
+
+	s.config.Logger.Debug("deleting message",
+		slog.Int64("chat_id", chatID),
+		slog.Int("message_id", messageID),
+	)
+
+	return s.doPost(ctx, "deleteMessage", body)
+}
+
+// AnswerCallbackQuery acknowledges a callback query from an inline keyboard
+// button, stopping the button's loading indicator. A non-empty text is shown
+// to the user as a short notification.
+func (s *Sender) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	body := map[string]interface{}{
+		"callback_query_id": callbackQueryID,
+	}
+	if text != "" {
+		body["text"] = text
+	}
+
+	s.config.Logger.Debug("answering callback query",
+		slog.String("callback_query_id", callbackQueryID),
+	)
+
+	return s.doPost(ctx, "answerCallbackQuery", body)
 }
 
 // SendChatAction sends a chat action (e.g. "typing") to the specified chat.
@@ -171,6 +429,7 @@ func (s *Sender) SendChatAction(ctx context.Context, chatID int64, action string
 		"chat_id": chatID,
 		"action":  action,
 	}
+	withContextThread(ctx, body)
 
 	s.config.Logger.Debug("sending chat action",
 		slog.Int64("chat_id", chatID),
@@ -202,46 +461,148 @@ func (s *Sender) SetMyCommands(ctx context.Context, commands []BotCommand) error
 
 // doPost performs a POST request to the given Telegram Bot API method.
 func (s *Sender) doPost(ctx context.Context, method string, body map[string]interface{}) error {
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return fmt.Errorf("telegram: failed to marshal request body: %w", err)
-	}
+	_, err := s.call(ctx, method, body)
+	return err
+}
 
-	apiURL := fmt.Sprintf("%s/bot%s/%s", s.config.BaseURL, s.config.Token, method)
+// call performs a Telegram Bot API request. Messages wait for their slot in
+// the send queue; requests answered with 429 are retried after retry_after
+// (which also holds back the chat's other messages) and those answered with
+// 5xx after a backoff, up to MaxRetries times. Skippable messages (see
+// TryEditMessageText) are sent only if their slot is free and never retried.
+func (s *Sender) call(ctx context.Context, method string, body map[string]interface{}) (json.RawMessage, error) {
+	chatID, queued := body["chat_id"].(int64)
+	queued = queued && queuedMethods[method]
+	skippable, _ := ctx.Value(skippableKey{}).(bool)
+	skippable = skippable && queued
+
+	for attempt := 0; ; attempt++ {
+		if skippable {
+			if !s.queue.tryReserve(chatID) {
+				return nil, errSlotBusy
+			}
+		} else if queued {
+			if err := s.sleep(ctx, s.queue.reserve(chatID)); err != nil {
+				return nil, err
+			}
+			if err := s.sleep(ctx, s.queue.reserveGlobal()); err != nil {
+				return nil, err
+			}
+		}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(jsonBody))
-	if err != nil {
-		return fmt.Errorf("telegram: failed to create request: %w", err)
+		result, err := callMethod(ctx, s.config.HTTPClient, s.config.BaseURL, s.config.Token, method, body)
+		if skippable {
+			// Never retried, but flood control still holds back the chat
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+				s.queue.block(chatID, time.Duration(apiErr.RetryAfter)*time.Second)
+			}
+			return result, err
+		}
+		delay, retry := s.retryDelay(method, err, attempt)
+		if !retry {
+			return result, err
+		}
+
+		s.config.Logger.Warn("telegram request failed, retrying",
+			slog.String("method", method),
+			slog.Int64("chat_id", chatID),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()),
+		)
+		if queued {
+			// Flood control applies to the chat, not just this request
+			s.queue.block(chatID, delay)
+			continue
+		}
+		if err := s.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// retryDelay decides whether a failed request is retried and after how long.
+// Only API errors are retried: after a network error the message may have
+// been delivered, and sending it again would duplicate it.
+func (s *Sender) retryDelay(method string, err error, attempt int) (time.Duration, bool) {
+	var apiErr *APIError
+	if err == nil || attempt >= s.config.MaxRetries || ephemeralMethods[method] ||
+		!errors.As(err, &apiErr) || !apiErr.IsRetryable() {
+		return 0, false
+	}
+	if apiErr.RetryAfter > 0 {
+		delay := time.Duration(apiErr.RetryAfter) * time.Second
+		return delay, delay <= s.config.MaxRetryAfter
+	}
+	return s.config.Backoff.NextBackoff(attempt), true
+}
 
-	resp, err := s.config.HTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("telegram: request failed: %w", err)
+// postText performs a POST request carrying message text. Unless the caller
+// chose a parse mode with WithParseMode, the text is converted for the
+// sender's parse mode. If Telegram cannot parse the entities, the request is
+// retried once as plain text.
+func (s *Sender) postText(ctx context.Context, method string, body map[string]interface{}) (json.RawMessage, error) {
+	text, _ := body["text"].(string)
+	plain := text
+
+	mode, explicit := body["parse_mode"].(string)
+	if !explicit {
+		mode = string(s.config.ParseMode)
+		if s.config.ParseMode.Converts() {
+			body["text"] = formatting.Render(text, s.config.ParseMode)
+			plain = formatting.ToPlain(text)
+		}
+	}
+	if mode == "" {
+		delete(body, "parse_mode")
+	} else {
+		body["parse_mode"] = mode
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("telegram: failed to read response: %w", err)
+	result, err := s.call(ctx, method, body)
+	if err == nil || mode == "" || !IsParseEntitiesError(err) {
+		return result, err
 	}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return fmt.Errorf("telegram: failed to parse response: %w", err)
+	s.config.Logger.Warn("telegram rejected formatted text, resending as plain text",
+		slog.String("method", method),
+		slog.String("parse_mode", mode),
+		slog.String("error", err.Error()),
+	)
+
+	body["text"] = plain
+	delete(body, "parse_mode")
+	return s.call(ctx, method, body)
+}
+
+// postMessage performs a POST request to a method that returns a Message.
+func (s *Sender) postMessage(ctx context.Context, method string, body map[string]interface{}) (*types.Message, error) {
+	result, err := s.postText(ctx, method, body)
+	if err != nil {
+		return nil, err
 	}
 
-	if !apiResp.OK {
-		apiErr := &APIError{
-			Code:        apiResp.ErrorCode,
-			Description: apiResp.Description,
+	var msg types.Message
+	if len(result) > 0 {
+		if err := json.Unmarshal(result, &msg); err != nil {
+			return nil, fmt.Errorf("telegram: failed to parse message: %w", err)
 		}
-		if apiResp.Parameters != nil {
-			apiErr.RetryAfter = apiResp.Parameters.RetryAfter
-		}
-		return apiErr
 	}
 
-	return nil
+	return &msg, nil
+}
+
+// IsMessageNotModified reports whether err is Telegram's "message is not
+// modified" error, returned when an edit would not change the message.
+func IsMessageNotModified(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == 400 && strings.Contains(apiErr.Description, "message is not modified")
+}
+
+// IsParseEntitiesError reports whether err is Telegram's "can't parse
+// entities" error, returned when formatted text is malformed.
+func IsParseEntitiesError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == 400 && strings.Contains(apiErr.Description, "can't parse entities")
 }
@@ -3,11 +3,16 @@ package telegram
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+	"github.com/pocky-ops-bot/internal/formatting"
 )
 
 func TestNewSender(t *testing.T) {
@@ -372,3 +377,315 @@ func TestSendMessageContextCancellation(t *testing.T) {
 		t.Error("SendMessage() expected error for cancelled context, got nil")
 	}
 }
+
+func TestSendMessageResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":555,"date":0,"chat":{"id":12345,"type":"private"},"text":"..."}}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	msg, err := sender.SendMessageResult(context.Background(), 12345, "...")
+	if err != nil {
+		t.Fatalf("SendMessageResult() error = %v", err)
+	}
+	if msg.ID != 555 {
+		t.Errorf("message ID = %d, want 555", msg.ID)
+	}
+}
+
+func TestEditMessageText(t *testing.T) {
+	var reqBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest-token/editMessageText" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &reqBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":555,"date":0,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	err = sender.EditMessageText(context.Background(), 12345, 555, "partial answer", WithParseMode(""))
+	if err != nil {
+		t.Fatalf("EditMessageText() error = %v", err)
+	}
+
+	if id, ok := reqBody["message_id"].(float64); !ok || int(id) != 555 {
+		t.Errorf("message_id = %v, want 555", reqBody["message_id"])
+	}
+	if reqBody["text"] != "partial answer" {
+		t.Errorf("text = %v, want %q", reqBody["text"], "partial answer")
+	}
+	if _, ok := reqBody["parse_mode"]; ok {
+		t.Errorf("parse_mode = %v, want absent for WithParseMode(\"\")", reqBody["parse_mode"])
+	}
+}
+
+func TestIsMessageNotModified(t *testing.T) {
+	notModified := &APIError{Code: 400, Description: "Bad Request: message is not modified: specified new message content and reply markup are exactly the same"}
+	if !IsMessageNotModified(notModified) {
+		t.Error("IsMessageNotModified() = false, want true")
+	}
+	if IsMessageNotModified(&APIError{Code: 400, Description: "Bad Request: chat not found"}) {
+		t.Error("IsMessageNotModified() = true for unrelated error")
+	}
+}
+
+func TestSendLongMessage(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":12345,"type":"private"}}}`, 100+len(bodies))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	para := strings.Repeat("a", 3000)
+	text := para + "\n\n" + para + "\n\n" + para
+
+	msgs, err := sender.SendLongMessage(context.Background(), 12345, text, WithReplyToMessageID(7))
+	if err != nil {
+		t.Fatalf("SendLongMessage() error = %v", err)
+	}
+
+	if len(msgs) != 3 || len(bodies) != 3 {
+		t.Fatalf("sent %d messages (%d requests), want 3", len(msgs), len(bodies))
+	}
+	wantReplyTo := []float64{7, 101, 102}
+	for i, body := range bodies {
+		if body["text"] != para {
+			t.Errorf("chunk %d text has %d chars, want one paragraph", i, len(body["text"].(string)))
+		}
+		if body["reply_to_message_id"] != wantReplyTo[i] {
+			t.Errorf("chunk %d reply_to_message_id = %v, want %v", i, body["reply_to_message_id"], wantReplyTo[i])
+		}
+	}
+}
+
+func TestSendMessageConvertsCommonMark(t *testing.T) {
+	var reqBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &reqBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token",
+		WithSenderBaseURL(server.URL),
+		WithSenderParseMode(formatting.ModeHTML),
+	)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	if err := sender.SendMessage(context.Background(), 12345, "**BTC_USDT** < 1"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if reqBody["parse_mode"] != "HTML" {
+		t.Errorf("parse_mode = %v, want HTML", reqBody["parse_mode"])
+	}
+	if reqBody["text"] != "<b>BTC_USDT</b> &lt; 1" {
+		t.Errorf("text = %v, want rendered HTML", reqBody["text"])
+	}
+
+	// An explicit parse mode sends the text unchanged
+	if err := sender.SendMessage(context.Background(), 12345, "<i>raw</i>", WithParseMode("HTML")); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if reqBody["text"] != "<i>raw</i>" {
+		t.Errorf("text = %v, want unchanged with explicit parse mode", reqBody["text"])
+	}
+}
+
+func TestSendMessagePlainTextFallback(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		bodies = append(bodies, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, ok := body["parse_mode"]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 3"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	if err := sender.SendMessage(context.Background(), 12345, "BTC_USDT up"); err != nil {
+		t.Fatalf("SendMessage() error = %v, want fallback to succeed", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(bodies))
+	}
+	if bodies[0]["parse_mode"] != "Markdown" {
+		t.Errorf("first parse_mode = %v, want Markdown", bodies[0]["parse_mode"])
+	}
+	if _, ok := bodies[1]["parse_mode"]; ok {
+		t.Errorf("fallback parse_mode = %v, want absent", bodies[1]["parse_mode"])
+	}
+	if bodies[1]["text"] != "BTC_USDT up" {
+		t.Errorf("fallback text = %v, want original text", bodies[1]["text"])
+	}
+}
+
+func TestIsParseEntitiesError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &APIError{Code: 400, Description: "Bad Request: can't parse entities: Unsupported start tag"})
+	if !IsParseEntitiesError(err) {
+		t.Error("IsParseEntitiesError() = false, want true")
+	}
+	if IsParseEntitiesError(&APIError{Code: 400, Description: "Bad Request: chat not found"}) {
+		t.Error("IsParseEntitiesError() = true for unrelated error")
+	}
+}
+
+func TestSendLongMessageKeyboardOnLastChunk(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":12345,"type":"private"}}}`, len(bodies))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	keyboard := &types.InlineKeyboardMarkup{
+		InlineKeyboard: [][]types.InlineKeyboardButton{{{Text: "Refresh", CallbackData: "refresh"}}},
+	}
+	para := strings.Repeat("a", 3000)
+	_, err = sender.SendLongMessage(context.Background(), 12345, para+"\n\n"+para, WithReplyMarkup(keyboard))
+	if err != nil {
+		t.Fatalf("SendLongMessage() error = %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(bodies))
+	}
+	if _, ok := bodies[0]["reply_markup"]; ok {
+		t.Error("first chunk should not carry the keyboard")
+	}
+	markup, ok := bodies[1]["reply_markup"].(map[string]interface{})
+	if !ok || markup["inline_keyboard"] == nil {
+		t.Errorf("last chunk reply_markup = %v, want inline keyboard", bodies[1]["reply_markup"])
+	}
+}
+
+func TestAnswerCallbackQuery(t *testing.T) {
+	var reqBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest-token/answerCallbackQuery" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &reqBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	if err := sender.AnswerCallbackQuery(context.Background(), "cb-1", ""); err != nil {
+		t.Fatalf("AnswerCallbackQuery() error = %v", err)
+	}
+	if reqBody["callback_query_id"] != "cb-1" {
+		t.Errorf("callback_query_id = %v, want cb-1", reqBody["callback_query_id"])
+	}
+	if _, ok := reqBody["text"]; ok {
+		t.Errorf("text = %v, want absent for empty text", reqBody["text"])
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	var reqBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest-token/deleteMessage" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	if err := sender.DeleteMessage(context.Background(), 42, 901); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if reqBody["chat_id"] != float64(42) || reqBody["message_id"] != float64(901) {
+		t.Errorf("request = %v, want chat 42, message 901", reqBody)
+	}
+}
+
+func TestSendToContextThread(t *testing.T) {
+	var threads []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		threads = append(threads, reqBody["message_thread_id"])
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":-100,"type":"supergroup"}}}`))
+	}))
+	defer server.Close()
+
+	sender, err := NewSender("test-token", WithSenderBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	ctx := ContextWithThreadID(context.Background(), 7)
+	sender.SendText(ctx, -100, "in topic")
+	sender.SendChatAction(ctx, -100, "typing")
+	sender.SendMessage(ctx, -100, "elsewhere", WithMessageThreadID(9))
+	sender.SendText(context.Background(), -100, "general")
+
+	want := []interface{}{float64(7), float64(7), float64(9), nil}
+	if fmt.Sprint(threads) != fmt.Sprint(want) {
+		t.Errorf("message_thread_id = %v, want %v", threads, want)
+	}
+}
@@ -14,6 +14,7 @@ const (
 	DefaultMaxBackoff      = 60 * time.Second
 	DefaultBackoffFactor   = 2.0
 	DefaultUpdatesChanSize = 100
+	DefaultStallTimeout    = 5 * time.Minute
 )
 
 // AllowedUpdateType represents the types of updates the bot can receive.
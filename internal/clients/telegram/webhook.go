@@ -0,0 +1,472 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+// SecretTokenHeader is the header Telegram uses to echo the webhook secret token.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Default configuration values for the webhook server.
+const (
+	DefaultWebhookListenAddr  = ":8080"
+	DefaultWebhookMaxBodySize = 1 << 20 // 1 MiB
+)
+
+// WebhookConfig holds configuration options for the Webhook.
+type WebhookConfig struct {
+	// Token is the Telegram Bot API token (required).
+	Token string
+
+	// BaseURL is the Telegram Bot API base URL.
+	// Defaults to "https://api.telegram.org" if empty.
+	BaseURL string
+
+	// URL is the public HTTPS URL Telegram should deliver updates to.
+	// If empty, StartWithHandler does not call setWebhook (useful when the
+	// webhook is registered out of band).
+	URL string
+
+	// ListenAddr is the local address the HTTP server listens on.
+	// Defaults to DefaultWebhookListenAddr.
+	ListenAddr string
+
+	// Path is the HTTP path that accepts updates.
+	// Defaults to the path component of URL, or "/" if URL has none.
+	Path string
+
+	// SecretToken is sent to Telegram in setWebhook and must be echoed back in
+	// the X-Telegram-Bot-Api-Secret-Token header of every update request.
+	// 1-256 characters, only A-Z, a-z, 0-9, _ and - are allowed.
+	SecretToken string
+
+	// MaxConnections is the maximum number of simultaneous HTTPS connections
+	// Telegram opens to deliver updates (1-100). Zero uses Telegram's default.
+	MaxConnections int
+
+	// AllowedUpdates specifies the update types to receive.
+	// Empty slice means all update types.
+	AllowedUpdates []AllowedUpdateType
+
+	// DropPendingUpdates drops updates queued by Telegram when the webhook is set.
+	DropPendingUpdates bool
+
+	// HTTPClient is the HTTP client used for Bot API calls.
+	// Defaults to http.Client with a 30s timeout if nil.
+	HTTPClient HTTPClient
+
+	// Logger is the structured logger for debug output.
+	// Defaults to slog.Default() if nil.
+	Logger *slog.Logger
+}
+
+// validate checks the configuration and applies defaults.
+func (c *WebhookConfig) validate() error {
+	if c.Token == "" {
+		return fmt.Errorf("telegram: bot token is required")
+	}
+
+	if c.BaseURL == "" {
+		c.BaseURL = "https://api.telegram.org"
+	}
+
+	if c.ListenAddr == "" {
+		c.ListenAddr = DefaultWebhookListenAddr
+	}
+
+	if c.Path == "" {
+		c.Path = "/"
+		if c.URL != "" {
+			u, err := url.Parse(c.URL)
+			if err != nil {
+				return fmt.Errorf("telegram: invalid webhook url: %w", err)
+			}
+			if u.Path != "" {
+				c.Path = u.Path
+			}
+		}
+	}
+
+	if err := validateSecretToken(c.SecretToken); err != nil {
+		return err
+	}
+
+	if c.MaxConnections < 0 || c.MaxConnections > 100 {
+		return fmt.Errorf("telegram: webhook max connections must be between 0 and 100 (0 = Telegram default)")
+	}
+
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{
+			Timeout: 30 * time.Second,
+		}
+	}
+
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+
+	return nil
+}
+
+// validateSecretToken checks the secret token against Telegram's allowed alphabet.
+// An empty token is valid and disables header verification.
+func validateSecretToken(token string) error {
+	if len(token) > 256 {
+		return fmt.Errorf("telegram: webhook secret token must be at most 256 characters")
+	}
+	for _, r := range token {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return fmt.Errorf("telegram: webhook secret token contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// Webhook receives updates pushed by Telegram over HTTP.
+// It is an alternative to Poller and exposes the same UpdateHandler contract.
+type Webhook struct {
+	config  WebhookConfig
+	handler UpdateHandler
+	server  *http.Server
+	running atomic.Bool
+	wg      sync.WaitGroup
+	stopCh  chan struct{}
+	ctx     context.Context
+}
+
+// WebhookOption is a functional option for configuring the Webhook.
+type WebhookOption func(*WebhookConfig)
+
+// WithWebhookURL sets the public URL registered with setWebhook.
+func WithWebhookURL(u string) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.URL = u
+	}
+}
+
+// WithWebhookListenAddr sets the local listen address.
+func WithWebhookListenAddr(addr string) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.ListenAddr = addr
+	}
+}
+
+// WithWebhookPath sets the HTTP path that accepts updates.
+func WithWebhookPath(path string) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.Path = path
+	}
+}
+
+// WithWebhookSecretToken sets the secret token verified on every request.
+func WithWebhookSecretToken(token string) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.SecretToken = token
+	}
+}
+
+// WithWebhookMaxConnections sets the maximum number of concurrent deliveries.
+func WithWebhookMaxConnections(n int) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.MaxConnections = n
+	}
+}
+
+// WithWebhookAllowedUpdates sets the allowed update types.
+func WithWebhookAllowedUpdates(updates ...AllowedUpdateType) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.AllowedUpdates = updates
+	}
+}
+
+// WithWebhookDropPendingUpdates drops pending updates when the webhook is set.
+func WithWebhookDropPendingUpdates() WebhookOption {
+	return func(c *WebhookConfig) {
+		c.DropPendingUpdates = true
+	}
+}
+
+// WithWebhookBaseURL sets the API base URL (useful for testing).
+func WithWebhookBaseURL(u string) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.BaseURL = u
+	}
+}
+
+// WithWebhookHTTPClient sets the HTTP client used for Bot API calls.
+func WithWebhookHTTPClient(client HTTPClient) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.HTTPClient = client
+	}
+}
+
+// WithWebhookLogger sets the logger.
+func WithWebhookLogger(logger *slog.Logger) WebhookOption {
+	return func(c *WebhookConfig) {
+		c.Logger = logger
+	}
+}
+
+// NewWebhook creates a new Webhook with the given configuration.
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Webhook{config: config}, nil
+}
+
+// NewWebhookWithOptions creates a new Webhook with functional options.
+func NewWebhookWithOptions(token string, opts ...WebhookOption) (*Webhook, error) {
+	config := WebhookConfig{
+		Token: token,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return NewWebhook(config)
+}
+
+// StartWithHandler registers the webhook with Telegram (if URL is set), starts
+// the HTTP server, and processes every received update with the given handler.
+// It returns once the listener is bound; the server runs until ctx is cancelled
+// or Stop is called.
+func (w *Webhook) StartWithHandler(ctx context.Context, handler UpdateHandler) error {
+	if !w.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("telegram: webhook is already running")
+	}
+
+	w.handler = handler
+	w.ctx = ctx
+
+	// Bind before registering so Telegram never pushes to a closed port.
+	ln, err := net.Listen("tcp", w.config.ListenAddr)
+	if err != nil {
+		w.running.Store(false)
+		return fmt.Errorf("telegram: failed to listen on %s: %w", w.config.ListenAddr, err)
+	}
+
+	if w.config.URL != "" {
+		if err := w.SetWebhook(ctx); err != nil {
+			ln.Close()
+			w.running.Store(false)
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(w.config.Path, w)
+	w.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	w.stopCh = make(chan struct{})
+	stopCh := w.stopCh
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if err := w.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.config.Logger.Error("webhook server failed",
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-stopCh:
+		}
+	}()
+
+	w.config.Logger.Info("telegram webhook started",
+		slog.String("listen_addr", ln.Addr().String()),
+		slog.String("path", w.config.Path),
+		slog.Bool("secret_token", w.config.SecretToken != ""),
+	)
+
+	return nil
+}
+
+// Stop gracefully shuts down the HTTP server.
+// The webhook stays registered with Telegram so updates queue up until restart.
+func (w *Webhook) Stop() {
+	if !w.running.CompareAndSwap(true, false) {
+		return // Already stopped
+	}
+
+	close(w.stopCh)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := w.server.Shutdown(shutdownCtx); err != nil {
+		w.config.Logger.Warn("webhook server shutdown error",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	w.wg.Wait()
+
+	w.config.Logger.Info("telegram webhook stopped")
+}
+
+// IsRunning returns true if the webhook server is currently running.
+func (w *Webhook) IsRunning() bool {
+	return w.running.Load()
+}
+
+// ServeHTTP implements http.Handler. It verifies the secret token header,
+// decodes the update, and passes it to the handler given to StartWithHandler.
+// It can also be mounted on an existing mux after calling SetHandler.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.config.SecretToken != "" {
+		got := r.Header.Get(SecretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(w.config.SecretToken)) != 1 {
+			w.config.Logger.Warn("webhook request with invalid secret token",
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	var update types.Update
+	body := http.MaxBytesReader(rw, r.Body, DefaultWebhookMaxBodySize)
+	if err := json.NewDecoder(body).Decode(&update); err != nil {
+		w.config.Logger.Warn("failed to decode webhook update",
+			slog.String("error", err.Error()),
+		)
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	w.config.Logger.Debug("received webhook update",
+		slog.Int("update_id", update.UpdateID),
+	)
+
+	if w.handler != nil {
+		ctx := w.ctx
+		if ctx == nil {
+			ctx = r.Context()
+		}
+		// Handler errors are logged, not returned to Telegram: a non-2xx status
+		// makes Telegram redeliver the same update over and over.
+		if err := w.handler(ctx, update); err != nil {
+			w.config.Logger.Error("handler error",
+				slog.String("error", err.Error()),
+				slog.Int("update_id", update.UpdateID),
+			)
+		}
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// SetHandler sets the handler used by ServeHTTP without starting the built-in
+// server. Use it when mounting the Webhook on an existing http.ServeMux.
+func (w *Webhook) SetHandler(ctx context.Context, handler UpdateHandler) {
+	w.ctx = ctx
+	w.handler = handler
+}
+
+// SetWebhook calls the setWebhook API method with the configured URL and options.
+func (w *Webhook) SetWebhook(ctx context.Context) error {
+	if w.config.URL == "" {
+		return fmt.Errorf("telegram: webhook url is required")
+	}
+
+	body := map[string]interface{}{
+		"url": w.config.URL,
+	}
+	if w.config.SecretToken != "" {
+		body["secret_token"] = w.config.SecretToken
+	}
+	if w.config.MaxConnections > 0 {
+		body["max_connections"] = w.config.MaxConnections
+	}
+	if len(w.config.AllowedUpdates) > 0 {
+		body["allowed_updates"] = w.config.AllowedUpdates
+	}
+	if w.config.DropPendingUpdates {
+		body["drop_pending_updates"] = true
+	}
+
+	w.config.Logger.Debug("setting webhook",
+		slog.String("url", w.config.URL),
+	)
+
+	_, err := callMethod(ctx, w.config.HTTPClient, w.config.BaseURL, w.config.Token, "setWebhook", body)
+	return err
+}
+
+// DeleteWebhook calls the deleteWebhook API method, switching the bot back to
+// getUpdates. If dropPending is true, queued updates are discarded.
+func (w *Webhook) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	body := map[string]interface{}{}
+	if dropPending {
+		body["drop_pending_updates"] = true
+	}
+
+	w.config.Logger.Debug("deleting webhook",
+		slog.Bool("drop_pending_updates", dropPending),
+	)
+
+	_, err := callMethod(ctx, w.config.HTTPClient, w.config.BaseURL, w.config.Token, "deleteWebhook", body)
+	return err
+}
+
+// GetWebhookInfo calls the getWebhookInfo API method.
+func (w *Webhook) GetWebhookInfo(ctx context.Context) (*types.WebhookInfo, error) {
+	result, err := callMethod(ctx, w.config.HTTPClient, w.config.BaseURL, w.config.Token, "getWebhookInfo", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.WebhookInfo
+	if err := json.Unmarshal(result, &info); err != nil {
+		return nil, fmt.Errorf("telegram: failed to parse webhook info: %w", err)
+	}
+
+	return &info, nil
+}
+
+// GetMe calls the getMe API method to test the bot token and get bot info.
+func (w *Webhook) GetMe(ctx context.Context) (*types.User, error) {
+	result, err := callMethod(ctx, w.config.HTTPClient, w.config.BaseURL, w.config.Token, "getMe", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	var user types.User
+	if err := json.Unmarshal(result, &user); err != nil {
+		return nil, fmt.Errorf("telegram: failed to parse user: %w", err)
+	}
+
+	return &user, nil
+}
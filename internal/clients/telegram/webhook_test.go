@@ -0,0 +1,267 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pocky-ops-bot/internal/bot/types"
+)
+
+func TestNewWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  WebhookConfig
+		wantErr bool
+	}{
+		{
+			name:    "empty token",
+			config:  WebhookConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "valid config",
+			config:  WebhookConfig{Token: "test-token"},
+			wantErr: false,
+		},
+		{
+			name:    "invalid secret token",
+			config:  WebhookConfig{Token: "test-token", SecretToken: "bad token!"},
+			wantErr: true,
+		},
+		{
+			name:    "max connections out of range",
+			config:  WebhookConfig{Token: "test-token", MaxConnections: 101},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWebhook(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookDefaults(t *testing.T) {
+	wh, err := NewWebhookWithOptions("test-token",
+		WithWebhookURL("https://example.com/tg/hook"),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhookWithOptions() error = %v", err)
+	}
+
+	if wh.config.ListenAddr != DefaultWebhookListenAddr {
+		t.Errorf("ListenAddr = %q, want %q", wh.config.ListenAddr, DefaultWebhookListenAddr)
+	}
+	if wh.config.Path != "/tg/hook" {
+		t.Errorf("Path = %q, want %q", wh.config.Path, "/tg/hook")
+	}
+}
+
+func TestWebhookServeHTTP(t *testing.T) {
+	update := types.Update{UpdateID: 7, Message: &types.Message{ID: 1, Text: "hi"}}
+	payload, _ := json.Marshal(update)
+
+	tests := []struct {
+		name        string
+		method      string
+		secret      string
+		body        string
+		wantStatus  int
+		wantHandled bool
+	}{
+		{"valid update", http.MethodPost, "s3cret", string(payload), http.StatusOK, true},
+		{"wrong secret", http.MethodPost, "nope", string(payload), http.StatusForbidden, false},
+		{"missing secret", http.MethodPost, "", string(payload), http.StatusForbidden, false},
+		{"wrong method", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed, false},
+		{"malformed body", http.MethodPost, "s3cret", "{", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh, err := NewWebhookWithOptions("test-token", WithWebhookSecretToken("s3cret"))
+			if err != nil {
+				t.Fatalf("NewWebhookWithOptions() error = %v", err)
+			}
+
+			var handled atomic.Int32
+			var gotID int
+			wh.SetHandler(context.Background(), func(ctx context.Context, u types.Update) error {
+				handled.Add(1)
+				gotID = u.UpdateID
+				return nil
+			})
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(SecretTokenHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			wh.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if (handled.Load() == 1) != tt.wantHandled {
+				t.Errorf("handled = %d, wantHandled %v", handled.Load(), tt.wantHandled)
+			}
+			if tt.wantHandled && gotID != 7 {
+				t.Errorf("UpdateID = %d, want 7", gotID)
+			}
+		})
+	}
+}
+
+func TestWebhookSetWebhook(t *testing.T) {
+	var reqBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest-token/setWebhook" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &reqBody)
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer server.Close()
+
+	wh, err := NewWebhookWithOptions("test-token",
+		WithWebhookBaseURL(server.URL),
+		WithWebhookURL("https://example.com/hook"),
+		WithWebhookSecretToken("abc_123"),
+		WithWebhookMaxConnections(10),
+		WithWebhookAllowedUpdates(UpdateTypeMessage, UpdateTypeCallbackQuery),
+		WithWebhookDropPendingUpdates(),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhookWithOptions() error = %v", err)
+	}
+
+	if err := wh.SetWebhook(context.Background()); err != nil {
+		t.Fatalf("SetWebhook() error = %v", err)
+	}
+
+	if reqBody["url"] != "https://example.com/hook" {
+		t.Errorf("url = %v, want %q", reqBody["url"], "https://example.com/hook")
+	}
+	if reqBody["secret_token"] != "abc_123" {
+		t.Errorf("secret_token = %v, want %q", reqBody["secret_token"], "abc_123")
+	}
+	if mc, ok := reqBody["max_connections"].(float64); !ok || int(mc) != 10 {
+		t.Errorf("max_connections = %v, want 10", reqBody["max_connections"])
+	}
+	if allowed, ok := reqBody["allowed_updates"].([]interface{}); !ok || len(allowed) != 2 {
+		t.Errorf("allowed_updates = %v, want 2 entries", reqBody["allowed_updates"])
+	}
+	if reqBody["drop_pending_updates"] != true {
+		t.Errorf("drop_pending_updates = %v, want true", reqBody["drop_pending_updates"])
+	}
+}
+
+func TestWebhookDeleteAndInfo(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/bottest-token/deleteWebhook":
+			w.Write([]byte(`{"ok":true,"result":true}`))
+		case "/bottest-token/getWebhookInfo":
+			w.Write([]byte(`{"ok":true,"result":{"url":"https://example.com/hook","has_custom_certificate":false,"pending_update_count":3}}`))
+		default:
+			w.Write([]byte(`{"ok":false,"error_code":404,"description":"Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	wh, err := NewWebhookWithOptions("test-token", WithWebhookBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewWebhookWithOptions() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if err := wh.DeleteWebhook(ctx, true); err != nil {
+		t.Fatalf("DeleteWebhook() error = %v", err)
+	}
+
+	info, err := wh.GetWebhookInfo(ctx)
+	if err != nil {
+		t.Fatalf("GetWebhookInfo() error = %v", err)
+	}
+	if info.URL != "https://example.com/hook" {
+		t.Errorf("URL = %q, want %q", info.URL, "https://example.com/hook")
+	}
+	if info.PendingUpdateCount != 3 {
+		t.Errorf("PendingUpdateCount = %d, want 3", info.PendingUpdateCount)
+	}
+
+	if len(paths) != 2 {
+		t.Errorf("expected 2 API calls, got %d", len(paths))
+	}
+}
+
+func TestWebhookSetWebhookAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook: HTTPS url must be provided for webhook"}`))
+	}))
+	defer server.Close()
+
+	wh, err := NewWebhookWithOptions("test-token",
+		WithWebhookBaseURL(server.URL),
+		WithWebhookURL("http://example.com/hook"),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhookWithOptions() error = %v", err)
+	}
+
+	err = wh.SetWebhook(context.Background())
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected *APIError, got %T (%v)", err, err)
+	}
+	if apiErr.Code != 400 {
+		t.Errorf("Code = %d, want 400", apiErr.Code)
+	}
+}
+
+func TestWebhookStartStop(t *testing.T) {
+	wh, err := NewWebhookWithOptions("test-token",
+		WithWebhookListenAddr("127.0.0.1:0"),
+		WithWebhookPath("/hook"),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhookWithOptions() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := func(ctx context.Context, u types.Update) error { return nil }
+	if err := wh.StartWithHandler(ctx, handler); err != nil {
+		t.Fatalf("StartWithHandler() error = %v", err)
+	}
+
+	if !wh.IsRunning() {
+		t.Error("IsRunning() = false after StartWithHandler()")
+	}
+
+	if err := wh.StartWithHandler(ctx, handler); err == nil {
+		t.Error("StartWithHandler() should fail when already running")
+	}
+
+	wh.Stop()
+	if wh.IsRunning() {
+		t.Error("IsRunning() = true after Stop()")
+	}
+
+	// Stopping again should be idempotent
+	wh.Stop()
+}
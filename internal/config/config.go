@@ -2,13 +2,30 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// AIBackend is one provider/model pair in the AI fallback chain.
+type AIBackend struct {
+	Provider string
+	Model    string
+	APIKey   string
+	BaseURL  string
+}
+
+// RateLimit is a token bucket: Burst requests at once, one more every Interval.
+// A zero Burst disables the limit.
+type RateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
 // Config holds all configuration values for the application.
 type Config struct {
 	// TelegramToken is the bot token from BotFather.
@@ -26,13 +43,58 @@ type Config struct {
 	// MaxRetries is the maximum retry attempts for transient failures.
 	MaxRetries int
 
-	// AIProvider is the AI service provider (gemini, claude, openai).
+	// TelegramOffsetFile is where the poller persists its update offset (empty disables persistence).
+	TelegramOffsetFile string
+
+	// TelegramParseMode is the parse mode for outgoing messages (HTML, MarkdownV2, Markdown).
+	TelegramParseMode string
+
+	// TelegramMode selects how updates are received (polling, webhook).
+	TelegramMode string
+
+	// WebhookURL is the public HTTPS URL registered with Telegram in webhook mode.
+	WebhookURL string
+
+	// WebhookListenAddr is the local address the webhook HTTP server binds to.
+	WebhookListenAddr string
+
+	// WebhookPath is the HTTP path that accepts updates (defaults to the path of WebhookURL).
+	WebhookPath string
+
+	// WebhookSecretToken is verified against the X-Telegram-Bot-Api-Secret-Token header.
+	WebhookSecretToken string
+
+	// AllowedUserIDs are the Telegram users allowed to use the bot.
+	AllowedUserIDs []int64
+
+	// AllowedChatIDs are the chats (e.g. groups) in which everyone may use the bot.
+	AllowedChatIDs []int64
+
+	// AdminIDs are the Telegram users with admin rights (always allowed).
+	AdminIDs []int64
+
+	// GroupMentionOnly makes the bot answer in groups only when mentioned,
+	// replied to or sent a command.
+	GroupMentionOnly bool
+
+	// RateLimitUserAI and RateLimitChatAI limit messages answered by the AI,
+	// per user and per chat.
+	RateLimitUserAI RateLimit
+	RateLimitChatAI RateLimit
+
+	// RateLimitUserCommands and RateLimitChatCommands limit cheap commands and
+	// buttons, per user and per chat.
+	RateLimitUserCommands RateLimit
+	RateLimitChatCommands RateLimit
+
+	// AIProvider is the AI service provider (gemini, claude, openai, qwen, ollama, openai-compatible).
 	AIProvider string
 
-	// AIAPIKey is the API key for the AI provider.
+	// AIAPIKey is the API key for the AI provider (optional for ollama and openai-compatible).
 	AIAPIKey string
 
 	// AIModel is the model name to use (e.g. gemini-2.0-flash, claude-sonnet-4-20250514).
+	// Empty selects the provider's default model.
 	AIModel string
 
 	// AIBaseURL overrides the default API base URL for the provider (optional).
@@ -44,18 +106,89 @@ type Config struct {
 	// AITimeout is the timeout for AI API requests.
 	AITimeout time.Duration
 
+	// AIMaxRetries is how often a failed AI request is retried before falling back.
+	AIMaxRetries int
+
+	// AIFallbacks are tried in order when the primary AI provider keeps failing.
+	AIFallbacks []AIBackend
+
 	// AISystemPrompt is the system prompt for AI conversations.
 	AISystemPrompt string
 
 	// AIVietnamese forces the AI to always respond in Vietnamese.
 	AIVietnamese bool
 
+	// AIStreaming enables progressive reply delivery by editing a placeholder message.
+	AIStreaming bool
+
+	// AIStreamEditInterval is the minimum time between edits of a streamed reply.
+	AIStreamEditInterval time.Duration
+
+	// AIContextBudget is the token budget for conversation history (0 derives it from AI_MODEL).
+	AIContextBudget int
+
+	// AISummarize compresses old turns into a summary instead of dropping them by count.
+	AISummarize bool
+
+	// AIToolParallelism is how many tool calls of one round run at once.
+	AIToolParallelism int
+
+	// AIToolTimeout limits a single tool call (0 = no limit).
+	AIToolTimeout time.Duration
+
+	// ToolGroups are the tool groups (e.g. "spot", "futures", "ops") the AI
+	// may use in chats without an entry below (nil = all, empty = none).
+	ToolGroups []string
+
+	// ToolGroupsChats and ToolGroupsUsers enable tool groups per chat and
+	// per user. A chat's groups are a ceiling for everyone in it; a user's
+	// groups replace ToolGroups.
+	ToolGroupsChats map[int64][]string
+	ToolGroupsUsers map[int64][]string
+
+	// STTAPIKey is the OpenAI API key for voice transcription (defaults to
+	// AI_API_KEY when AI_PROVIDER is openai).
+	STTAPIKey string
+
+	// STTBaseURL points transcription at an OpenAI-compatible server, e.g. a
+	// local whisper server (optional; no API key needed then).
+	STTBaseURL string
+
+	// STTModel is the speech-to-text model.
+	STTModel string
+
+	// STTLanguage is the ISO-639-1 language of voice messages (empty = detect).
+	STTLanguage string
+
 	// ConversationMaxTurns is the maximum number of message pairs to keep in history.
 	ConversationMaxTurns int
 
 	// ConversationTTL is the time-to-live for conversation history.
 	ConversationTTL time.Duration
 
+	// HistoryStore selects where conversation history is persisted (memory, file, kv).
+	HistoryStore string
+
+	// HistoryPath is the directory (file store) or database file (kv store) for history.
+	HistoryPath string
+
+	// UsageTracking enables the token usage and cost ledger (/chiphi, budgets).
+	UsageTracking bool
+
+	// UsagePath is the database file where usage is persisted (empty = memory only).
+	UsagePath string
+
+	// UsagePrices overrides model prices as "model=input/output,..." in USD per 1M tokens.
+	UsagePrices string
+
+	// UsageBudgetDaily and UsageBudgetMonthly cap the spending of the whole bot in USD (0 = no limit).
+	UsageBudgetDaily   float64
+	UsageBudgetMonthly float64
+
+	// UsageUserBudgetDaily and UsageUserBudgetMonthly cap the spending of each user in USD (0 = no limit).
+	UsageUserBudgetDaily   float64
+	UsageUserBudgetMonthly float64
+
 	// BinanceAPIKey is the Binance API key for portfolio tracking.
 	BinanceAPIKey string
 
@@ -67,6 +200,12 @@ type Config struct {
 
 	// BinanceFuturesBaseURL overrides the default Binance Futures API base URL (optional, for testnet).
 	BinanceFuturesBaseURL string
+
+	// MCPConfig is the JSON file listing MCP servers whose tools the AI can use (empty = none).
+	MCPConfig string
+
+	// MCPDisabled names MCP servers of MCPConfig to skip.
+	MCPDisabled []string
 }
 
 // Load reads configuration from environment variables and .env file.
@@ -82,27 +221,113 @@ func Load() (*Config, error) {
 		Timeout:       parseDuration("TIMEOUT", 30*time.Second),
 		MaxRetries:    3,
 
+		TelegramOffsetFile: getEnvOrDefault("TELEGRAM_OFFSET_FILE", "data/telegram_offset"),
+		TelegramParseMode:  getEnvOrDefault("TELEGRAM_PARSE_MODE", "HTML"),
+		TelegramMode:       getEnvOrDefault("TELEGRAM_MODE", "polling"),
+		WebhookURL:         os.Getenv("WEBHOOK_URL"),
+		WebhookListenAddr:  getEnvOrDefault("WEBHOOK_LISTEN_ADDR", ":8080"),
+		WebhookPath:        os.Getenv("WEBHOOK_PATH"),
+		WebhookSecretToken: os.Getenv("WEBHOOK_SECRET_TOKEN"),
+
+		GroupMentionOnly: parseBool("GROUP_MENTION_ONLY", true),
+
+		RateLimitUserAI:       parseRateLimit("RATE_LIMIT_USER_AI", RateLimit{Burst: 5, Interval: 10 * time.Second}),
+		RateLimitChatAI:       parseRateLimit("RATE_LIMIT_CHAT_AI", RateLimit{Burst: 10, Interval: 5 * time.Second}),
+		RateLimitUserCommands: parseRateLimit("RATE_LIMIT_USER_COMMANDS", RateLimit{Burst: 10, Interval: 2 * time.Second}),
+		RateLimitChatCommands: parseRateLimit("RATE_LIMIT_CHAT_COMMANDS", RateLimit{Burst: 30, Interval: time.Second}),
+
 		AIProvider:     getEnvOrDefault("AI_PROVIDER", "gemini"),
 		AIAPIKey:       os.Getenv("AI_API_KEY"),
-		AIModel:        getEnvOrDefault("AI_MODEL", "gemini-2.0-flash"),
+		AIModel:        os.Getenv("AI_MODEL"),
 		AIBaseURL:      os.Getenv("AI_BASE_URL"),
 		AIMaxTokens:    parseInt("AI_MAX_TOKENS", 1024),
 		AITimeout:      parseDuration("AI_TIMEOUT", 60*time.Second),
+		AIMaxRetries:   parseInt("AI_MAX_RETRIES", 2),
+		AIFallbacks:    parseAIBackends("AI_FALLBACKS"),
 		AISystemPrompt: getEnvOrDefault("AI_SYSTEM_PROMPT", "You are Pocky, a helpful and friendly assistant."),
 		AIVietnamese:   parseBool("AI_VIETNAMESE", true),
 
+		AIStreaming:          parseBool("AI_STREAMING", true),
+		AIStreamEditInterval: parseDuration("AI_STREAM_EDIT_INTERVAL", time.Second),
+
+		AIContextBudget: parseInt("AI_CONTEXT_BUDGET", 0),
+		AISummarize:     parseBool("AI_SUMMARIZE", true),
+
+		AIToolParallelism: parseInt("AI_TOOL_PARALLELISM", 4),
+		AIToolTimeout:     parseDuration("AI_TOOL_TIMEOUT", 20*time.Second),
+
+		ToolGroups: parseToolGroups(os.Getenv("TOOL_GROUPS")),
+
+		STTBaseURL:  os.Getenv("STT_BASE_URL"),
+		STTModel:    getEnvOrDefault("STT_MODEL", "whisper-1"),
+		STTLanguage: os.Getenv("STT_LANGUAGE"),
+
 		ConversationMaxTurns: parseInt("CONVERSATION_MAX_TURNS", 20),
 		ConversationTTL:      parseDuration("CONVERSATION_TTL", 30*time.Minute),
 
+		HistoryStore: getEnvOrDefault("HISTORY_STORE", "file"),
+
+		UsageTracking:          parseBool("USAGE_TRACKING", true),
+		UsagePath:              getEnvOrDefault("USAGE_PATH", "data/usage.kv"),
+		UsagePrices:            os.Getenv("USAGE_PRICES"),
+		UsageBudgetDaily:       parseFloat("USAGE_BUDGET_DAILY", 0),
+		UsageBudgetMonthly:     parseFloat("USAGE_BUDGET_MONTHLY", 0),
+		UsageUserBudgetDaily:   parseFloat("USAGE_USER_BUDGET_DAILY", 0),
+		UsageUserBudgetMonthly: parseFloat("USAGE_USER_BUDGET_MONTHLY", 0),
+
 		BinanceAPIKey:    os.Getenv("BINANCE_API_KEY"),
 		BinanceSecretKey: os.Getenv("BINANCE_SECRET_KEY"),
 		BinanceBaseURL:        os.Getenv("BINANCE_BASE_URL"),
 		BinanceFuturesBaseURL: os.Getenv("BINANCE_FUTURES_BASE_URL"),
+
+		MCPConfig:   os.Getenv("MCP_CONFIG"),
+		MCPDisabled: parseList("MCP_DISABLED"),
+	}
+
+	// A typo in an allowlist must not leave it empty, which opens the bot
+	// to everyone.
+	var err error
+	if cfg.AllowedUserIDs, err = parseInt64List("ALLOWED_USER_IDS"); err != nil {
+		return nil, err
+	}
+	if cfg.AllowedChatIDs, err = parseInt64List("ALLOWED_CHAT_IDS"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminIDs, err = parseInt64List("ADMIN_IDS"); err != nil {
+		return nil, err
+	}
+
+	// A dropped entry would give its chat or user the default groups.
+	if cfg.ToolGroupsChats, err = parseToolGroupMap("TOOL_GROUPS_CHATS"); err != nil {
+		return nil, err
+	}
+	if cfg.ToolGroupsUsers, err = parseToolGroupMap("TOOL_GROUPS_USERS"); err != nil {
+		return nil, err
+	}
+
+	cfg.HistoryPath = getEnvOrDefault("HISTORY_PATH", defaultHistoryPath(cfg.HistoryStore))
+
+	cfg.STTAPIKey = os.Getenv("STT_API_KEY")
+	if cfg.STTAPIKey == "" && cfg.AIProvider == "openai" {
+		cfg.STTAPIKey = cfg.AIAPIKey
 	}
 
 	return cfg, nil
 }
 
+// defaultHistoryPath returns the default HISTORY_PATH for a history store type.
+func defaultHistoryPath(store string) string {
+	if store == "kv" {
+		return "data/history.kv"
+	}
+	return "data/history"
+}
+
+// VoiceEnabled reports whether voice messages can be transcribed.
+func (c *Config) VoiceEnabled() bool {
+	return c.STTAPIKey != "" || c.STTBaseURL != ""
+}
+
 // getEnvOrDefault returns the environment variable value or a default.
 func getEnvOrDefault(key, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
@@ -121,6 +346,16 @@ func parseInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// parseFloat parses a floating point number from an environment variable.
+func parseFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
 // parseBool parses a boolean from an environment variable.
 func parseBool(key string, defaultVal bool) bool {
 	if val := os.Getenv(key); val != "" {
@@ -140,3 +375,124 @@ func parseDuration(key string, defaultVal time.Duration) time.Duration {
 	}
 	return defaultVal
 }
+
+// parseRateLimit parses a "burst/interval" rate limit (e.g. "5/10s") from an
+// environment variable. "0" or "off" disables the limit.
+func parseRateLimit(key string, defaultVal RateLimit) RateLimit {
+	val := strings.TrimSpace(os.Getenv(key))
+	switch val {
+	case "":
+		return defaultVal
+	case "0", "off":
+		return RateLimit{}
+	}
+	burst, interval, ok := strings.Cut(val, "/")
+	if !ok {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil || n < 0 {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(interval))
+	if err != nil || d <= 0 {
+		return defaultVal
+	}
+	return RateLimit{Burst: n, Interval: d}
+}
+
+// parseInt64List parses a comma-separated list of integers from an environment
+// variable. Empty entries are skipped; any other invalid entry is an error.
+func parseInt64List(key string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(os.Getenv(key), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid ID %q", key, field)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
+
+// parseList parses a comma-separated list of strings from an environment
+// variable. Empty entries are skipped.
+func parseList(key string) []string {
+	var values []string
+	for _, field := range strings.Split(os.Getenv(key), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			values = append(values, field)
+		}
+	}
+	return values
+}
+
+// parseToolGroups parses a comma-separated list of tool groups. An empty
+// value returns nil (all groups) and "none" an empty list (no groups).
+func parseToolGroups(val string) []string {
+	val = strings.TrimSpace(val)
+	switch val {
+	case "":
+		return nil
+	case "none":
+		return []string{}
+	}
+	groups := []string{}
+	for _, field := range strings.Split(val, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			groups = append(groups, field)
+		}
+	}
+	return groups
+}
+
+// parseToolGroupMap parses semicolon-separated "id=group,group" entries
+// (e.g. "-1001234=ops;42=spot,futures") from an environment variable.
+// "id=none" or "id=" enables no groups. Empty entries are skipped; any other
+// malformed entry is an error.
+func parseToolGroupMap(key string) (map[int64][]string, error) {
+	groups := make(map[int64][]string)
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		id, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: entry %q is not id=groups", key, strings.TrimSpace(entry))
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid ID %q", key, strings.TrimSpace(id))
+		}
+		groups[n] = parseToolGroups(list)
+		if groups[n] == nil {
+			groups[n] = []string{}
+		}
+	}
+	return groups, nil
+}
+
+// parseAIBackends parses a comma-separated list of "provider[:model]" entries.
+// Each provider's API key and base URL come from AI_API_KEY_<PROVIDER> and
+// AI_BASE_URL_<PROVIDER>, falling back to AI_API_KEY for the key.
+func parseAIBackends(key string) []AIBackend {
+	var backends []AIBackend
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, model, _ := strings.Cut(entry, ":")
+		suffix := strings.ToUpper(provider)
+		backends = append(backends, AIBackend{
+			Provider: provider,
+			Model:    model,
+			APIKey:   getEnvOrDefault("AI_API_KEY_"+suffix, os.Getenv("AI_API_KEY")),
+			BaseURL:  os.Getenv("AI_BASE_URL_" + suffix),
+		})
+	}
+	return backends
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAllowlists(t *testing.T) {
+	t.Setenv("ALLOWED_USER_IDS", " 1, 2,")
+	t.Setenv("ALLOWED_CHAT_IDS", "-1001234")
+	t.Setenv("ADMIN_IDS", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.AllowedUserIDs) != 2 || cfg.AllowedUserIDs[0] != 1 || cfg.AllowedUserIDs[1] != 2 {
+		t.Errorf("AllowedUserIDs = %v, want [1 2]", cfg.AllowedUserIDs)
+	}
+	if len(cfg.AllowedChatIDs) != 1 || cfg.AllowedChatIDs[0] != -1001234 {
+		t.Errorf("AllowedChatIDs = %v, want [-1001234]", cfg.AllowedChatIDs)
+	}
+	if len(cfg.AdminIDs) != 0 {
+		t.Errorf("AdminIDs = %v, want none", cfg.AdminIDs)
+	}
+}
+
+func TestLoadRejectsInvalidAllowlistID(t *testing.T) {
+	for _, key := range []string{"ALLOWED_USER_IDS", "ALLOWED_CHAT_IDS", "ADMIN_IDS"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "123,12a4")
+
+			_, err := Load()
+			if err == nil {
+				t.Fatal("Load() error = nil, want an error for the invalid ID")
+			}
+			if !strings.Contains(err.Error(), key) || !strings.Contains(err.Error(), `"12a4"`) {
+				t.Errorf("Load() error = %q, want it to name %s and the bad entry", err, key)
+			}
+		})
+	}
+}
+
+func TestLoadToolGroupMaps(t *testing.T) {
+	t.Setenv("TOOL_GROUPS_CHATS", "-1001234=ops;42=;")
+	t.Setenv("TOOL_GROUPS_USERS", "7=spot,futures")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.ToolGroupsChats[-1001234]; len(got) != 1 || got[0] != "ops" {
+		t.Errorf("ToolGroupsChats[-1001234] = %v, want [ops]", got)
+	}
+	if got, ok := cfg.ToolGroupsChats[42]; !ok || len(got) != 0 {
+		t.Errorf("ToolGroupsChats[42] = %v, want no groups", got)
+	}
+	if got := cfg.ToolGroupsUsers[7]; len(got) != 2 {
+		t.Errorf("ToolGroupsUsers[7] = %v, want [spot futures]", got)
+	}
+}
+
+func TestLoadRejectsMalformedToolGroupEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  string
+	}{
+		{"wrong separator", "TOOL_GROUPS_CHATS", "-1001234:ops", `"-1001234:ops"`},
+		{"invalid ID", "TOOL_GROUPS_CHATS", "42=spot;chat=ops", `"chat"`},
+		{"user entry", "TOOL_GROUPS_USERS", "7=spot;8 ops", `"8 ops"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+
+			_, err := Load()
+			if err == nil {
+				t.Fatal("Load() error = nil, want an error for the malformed entry")
+			}
+			if !strings.Contains(err.Error(), tt.key) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %q, want it to name %s and %s", err, tt.key, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package formatting converts the CommonMark produced by language models into
+// text Telegram can parse: MarkdownV2, HTML, or plain text.
+package formatting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mode is a Telegram parse mode. Its value is sent as the parse_mode field.
+type Mode string
+
+const (
+	// ModeMarkdown is Telegram's legacy Markdown. Text is sent unchanged.
+	ModeMarkdown Mode = "Markdown"
+
+	// ModeMarkdownV2 renders CommonMark as Telegram MarkdownV2.
+	ModeMarkdownV2 Mode = "MarkdownV2"
+
+	// ModeHTML renders CommonMark as Telegram HTML.
+	ModeHTML Mode = "HTML"
+)
+
+// ParseMode parses a mode name case-insensitively (markdown, markdownv2, html).
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "markdown":
+		return ModeMarkdown, nil
+	case "markdownv2":
+		return ModeMarkdownV2, nil
+	case "html":
+		return ModeHTML, nil
+	default:
+		return "", fmt.Errorf("formatting: unknown parse mode %q", s)
+	}
+}
+
+// Converts reports whether text sent in this mode is rendered from CommonMark.
+func (m Mode) Converts() bool {
+	return m == ModeMarkdownV2 || m == ModeHTML
+}
+
+// Render converts CommonMark text for the given mode. Text for ModeMarkdown
+// (or an unknown mode) is returned unchanged.
+func Render(md string, mode Mode) string {
+	switch mode {
+	case ModeMarkdownV2:
+		return ToMarkdownV2(md)
+	case ModeHTML:
+		return ToHTML(md)
+	default:
+		return md
+	}
+}
+
+// ToMarkdownV2 converts CommonMark text to Telegram MarkdownV2, escaping
+// every reserved character outside of entities.
+func ToMarkdownV2(md string) string {
+	return render(md, markdownV2Renderer{})
+}
+
+// ToHTML converts CommonMark text to Telegram HTML.
+func ToHTML(md string) string {
+	return render(md, htmlRenderer{})
+}
+
+// ToPlain strips CommonMark syntax, keeping the text readable without any
+// parse mode. Link targets are kept in parentheses after the link text.
+func ToPlain(md string) string {
+	return render(md, plainRenderer{})
+}
+
+// markdownV2Special lists the characters that must be escaped in MarkdownV2 text.
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// EscapeMarkdownV2 escapes s for use as literal MarkdownV2 text.
+func EscapeMarkdownV2(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, c := range s {
+		if strings.ContainsRune(markdownV2Special, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// htmlEscaper escapes the characters Telegram HTML requires.
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// EscapeHTML escapes s for use as literal Telegram HTML text.
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// renderer produces the target syntax for each CommonMark construct.
+// Inner content passed to the wrapping methods is already rendered.
+type renderer interface {
+	text(s string) string
+	bold(inner string) string
+	italic(inner string) string
+	strike(inner string) string
+	code(s string) string
+	pre(lang, s string) string
+	link(inner, url string) string
+	quote(lines []string) string
+}
+
+var (
+	headingRe     = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	bulletRe      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedRe     = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	ruleRe        = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_])){2,}\s*$`)
+	fenceRe       = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([^`\\s]*)")
+	quoteMarkerRe = regexp.MustCompile(`^\s{0,3}>\s?`)
+)
+
+// horizontalRule replaces thematic breaks, which Telegram cannot display.
+const horizontalRule = "──────────"
+
+// render converts md line by line using r.
+func render(md string, r renderer) string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Fenced code block
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence := m[1]
+			var code []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[j]), fence[:3]) {
+					break
+				}
+				code = append(code, lines[j])
+			}
+			out = append(out, r.pre(m[2], strings.Join(code, "\n")))
+			i = j
+			continue
+		}
+
+		// Block quote: consecutive lines starting with '>'
+		if quoteMarkerRe.MatchString(line) {
+			var quoted []string
+			for ; i < len(lines) && quoteMarkerRe.MatchString(lines[i]); i++ {
+				quoted = append(quoted, renderInline(quoteMarkerRe.ReplaceAllString(lines[i], ""), r))
+			}
+			i--
+			out = append(out, r.quote(quoted))
+			continue
+		}
+
+		out = append(out, renderLine(line, r))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// renderLine renders a single line outside code blocks and quotes.
+func renderLine(line string, r renderer) string {
+	if ruleRe.MatchString(line) {
+		return r.text(horizontalRule)
+	}
+	if m := headingRe.FindStringSubmatch(line); m != nil {
+		return r.bold(renderInline(m[1], r))
+	}
+	if m := bulletRe.FindStringSubmatch(line); m != nil {
+		return r.text(m[1]+"• ") + renderInline(m[2], r)
+	}
+	if m := orderedRe.FindStringSubmatch(line); m != nil {
+		return r.text(m[1]+m[2]+". ") + renderInline(m[3], r)
+	}
+	return renderInline(line, r)
+}
+
+// renderInline renders inline CommonMark (emphasis, code spans, links).
+func renderInline(s string, r renderer) string {
+	return renderNodes(parseInline([]rune(s)), r)
+}
+
+func renderNodes(nodes []node, r renderer) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			b.WriteString(r.text(n.text))
+		case codeNode:
+			b.WriteString(r.code(n.text))
+		case boldNode:
+			b.WriteString(r.bold(renderNodes(n.children, r)))
+		case italicNode:
+			b.WriteString(r.italic(renderNodes(n.children, r)))
+		case strikeNode:
+			b.WriteString(r.strike(renderNodes(n.children, r)))
+		case linkNode:
+			b.WriteString(r.link(renderNodes(n.children, r), n.url))
+		}
+	}
+	return b.String()
+}
+
+// markdownV2Renderer renders Telegram MarkdownV2.
+type markdownV2Renderer struct{}
+
+func (markdownV2Renderer) text(s string) string       { return EscapeMarkdownV2(s) }
+func (markdownV2Renderer) bold(inner string) string   { return "*" + inner + "*" }
+func (markdownV2Renderer) italic(inner string) string { return "_" + inner + "_" }
+func (markdownV2Renderer) strike(inner string) string { return "~" + inner + "~" }
+func (markdownV2Renderer) code(s string) string       { return "`" + escapeMarkdownV2Code(s) + "`" }
+func (markdownV2Renderer) link(inner, url string) string {
+	return "[" + inner + "](" + strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(url) + ")"
+}
+
+func (markdownV2Renderer) pre(lang, s string) string {
+	return "```" + lang + "\n" + escapeMarkdownV2Code(s) + "\n```"
+}
+
+func (markdownV2Renderer) quote(lines []string) string {
+	for i, l := range lines {
+		lines[i] = ">" + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeMarkdownV2Code escapes the characters reserved inside code entities.
+func escapeMarkdownV2Code(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s)
+}
+
+// htmlRenderer renders Telegram HTML.
+type htmlRenderer struct{}
+
+func (htmlRenderer) text(s string) string       { return EscapeHTML(s) }
+func (htmlRenderer) bold(inner string) string   { return "<b>" + inner + "</b>" }
+func (htmlRenderer) italic(inner string) string { return "<i>" + inner + "</i>" }
+func (htmlRenderer) strike(inner string) string { return "<s>" + inner + "</s>" }
+func (htmlRenderer) code(s string) string       { return "<code>" + EscapeHTML(s) + "</code>" }
+func (htmlRenderer) link(inner, url string) string {
+	return `<a href="` + EscapeHTML(url) + `">` + inner + "</a>"
+}
+
+func (htmlRenderer) pre(lang, s string) string {
+	if lang == "" {
+		return "<pre>" + EscapeHTML(s) + "</pre>"
+	}
+	return `<pre><code class="language-` + EscapeHTML(lang) + `">` + EscapeHTML(s) + "</code></pre>"
+}
+
+func (htmlRenderer) quote(lines []string) string {
+	return "<blockquote>" + strings.Join(lines, "\n") + "</blockquote>"
+}
+
+// plainRenderer drops all markup.
+type plainRenderer struct{}
+
+func (plainRenderer) text(s string) string       { return s }
+func (plainRenderer) bold(inner string) string   { return inner }
+func (plainRenderer) italic(inner string) string { return inner }
+func (plainRenderer) strike(inner string) string { return inner }
+func (plainRenderer) code(s string) string       { return s }
+func (plainRenderer) pre(lang, s string) string  { return s }
+func (plainRenderer) link(inner, url string) string {
+	if inner == url {
+		return url
+	}
+	return inner + " (" + url + ")"
+}
+
+func (plainRenderer) quote(lines []string) string {
+	for i, l := range lines {
+		lines[i] = "> " + l
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,118 @@
+package formatting
+
+import "testing"
+
+func TestToMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text escaped", "Price: 1.5 (up 2%)!", `Price: 1\.5 \(up 2%\)\!`},
+		{"bold", "**BTC** rallied", `*BTC* rallied`},
+		{"italic", "*slightly* up", `_slightly_ up`},
+		{"underscore identifier", "BTC_USDT and ETH_USDT", `BTC\_USDT and ETH\_USDT`},
+		{"unmatched asterisk", "ratio 3*4 is 12", `ratio 3\*4 is 12`},
+		{"strikethrough", "~~old~~ new", `~old~ new`},
+		{"code span", "run `a_b*c`", "run `a_b*c`"},
+		{"code span escapes backtick", "``a`b``", "`a\\`b`"},
+		{"link", "[Binance](https://binance.com/en?a=1)", `[Binance](https://binance.com/en?a=1)`},
+		{"heading", "## Spot - total", `*Spot \- total*`},
+		{"bullet", "- BTC: 0.5", `• BTC: 0\.5`},
+		{"ordered", "1. First", `1\. First`},
+		{"nested", "***both***", `*_both_*`},
+		{"escaped asterisk", `\*literal\*`, `\*literal\*`},
+		{"quote", "> note", `>note`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToMarkdownV2(tt.in); got != tt.want {
+				t.Errorf("ToMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMarkdownV2CodeBlock(t *testing.T) {
+	in := "Result:\n```json\n{\"a\": \"b`c\"}\n```\ndone."
+	want := "Result:\n```json\n{\"a\": \"b\\`c\"}\n```\ndone\\."
+
+	if got := ToMarkdownV2(in); got != want {
+		t.Errorf("ToMarkdownV2() = %q, want %q", got, want)
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"escapes", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"bold italic", "**PnL** is *positive*", "<b>PnL</b> is <i>positive</i>"},
+		{"underscore identifier", "BTC_USDT", "BTC_USDT"},
+		{"code", "`x<y`", "<code>x&lt;y</code>"},
+		{"link", `[a](https://x.com/?q="1")`, `<a href="https://x.com/?q=&quot;1&quot;">a</a>`},
+		{"strike", "~~gone~~", "<s>gone</s>"},
+		{"heading", "# Portfolio", "<b>Portfolio</b>"},
+		{"quote", "> one\n> two", "<blockquote>one\ntwo</blockquote>"},
+		{"rule", "---", horizontalRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.in); got != tt.want {
+				t.Errorf("ToHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTMLCodeBlock(t *testing.T) {
+	in := "```go\nif a < b {}\n```"
+	want := `<pre><code class="language-go">if a &lt; b {}</code></pre>`
+	if got := ToHTML(in); got != want {
+		t.Errorf("ToHTML() = %q, want %q", got, want)
+	}
+
+	// Unterminated block runs to the end of the text
+	if got := ToHTML("```\nx"); got != "<pre>x</pre>" {
+		t.Errorf("ToHTML(unterminated) = %q, want %q", got, "<pre>x</pre>")
+	}
+}
+
+func TestToPlain(t *testing.T) {
+	in := "## Spot\n- **BTC**: `0.5`\n[docs](https://x.com)"
+	want := "Spot\n• BTC: 0.5\ndocs (https://x.com)"
+	if got := ToPlain(in); got != want {
+		t.Errorf("ToPlain() = %q, want %q", got, want)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{"html", ModeHTML, false},
+		{"MarkdownV2", ModeMarkdownV2, false},
+		{"Markdown", ModeMarkdown, false},
+		{"bbcode", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRenderMarkdownPassthrough(t *testing.T) {
+	in := "*legacy* _text_"
+	if got := Render(in, ModeMarkdown); got != in {
+		t.Errorf("Render(ModeMarkdown) = %q, want unchanged", got)
+	}
+}
@@ -0,0 +1,256 @@
+package formatting
+
+import (
+	"strings"
+	"unicode"
+)
+
+// nodeKind identifies an inline CommonMark construct.
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	codeNode
+	boldNode
+	italicNode
+	strikeNode
+	linkNode
+)
+
+// node is an inline element. Text and code nodes carry text; the others
+// carry their parsed children (and a URL for links).
+type node struct {
+	kind     nodeKind
+	text     string
+	url      string
+	children []node
+}
+
+// parseInline parses emphasis, strikethrough, code spans and links.
+// Delimiters without a matching closer are kept as literal text.
+func parseInline(r []rune) []node {
+	var nodes []node
+	var buf []rune
+
+	flush := func() {
+		if len(buf) > 0 {
+			nodes = append(nodes, node{kind: textNode, text: string(buf)})
+			buf = nil
+		}
+	}
+
+	for i := 0; i < len(r); {
+		c := r[i]
+
+		switch c {
+		case '\\':
+			if i+1 < len(r) && isASCIIPunct(r[i+1]) {
+				buf = append(buf, r[i+1])
+				i += 2
+				continue
+			}
+
+		case '`':
+			n := runLength(r, i, '`')
+			if end := findBacktickRun(r, i+n, n); end >= 0 {
+				flush()
+				nodes = append(nodes, node{kind: codeNode, text: trimCodeSpan(string(r[i+n : end]))})
+				i = end + n
+				continue
+			}
+			buf = append(buf, r[i:i+n]...)
+			i += n
+			continue
+
+		case '[':
+			if label, url, end, ok := parseLink(r, i); ok {
+				flush()
+				nodes = append(nodes, node{kind: linkNode, url: url, children: parseInline(label)})
+				i = end
+				continue
+			}
+
+		case '*', '_', '~':
+			n := runLength(r, i, c)
+			width := 1
+			kind := italicNode
+			if n >= 2 {
+				width = 2
+				kind = boldNode
+			}
+			if c == '~' {
+				kind = strikeNode
+			}
+
+			if (c != '~' || width == 2) && canOpen(r, i, width) {
+				if end := findCloser(r, i+width, c, width); end >= 0 {
+					flush()
+					nodes = append(nodes, node{kind: kind, children: parseInline(r[i+width : end])})
+					i = end + width
+					continue
+				}
+			}
+			buf = append(buf, r[i:i+n]...)
+			i += n
+			continue
+		}
+
+		buf = append(buf, c)
+		i++
+	}
+
+	flush()
+	return nodes
+}
+
+// canOpen reports whether the delimiter run of width runes at i can open
+// emphasis: it must be followed by non-space, and an underscore must not
+// start inside a word (so identifiers like BTC_USDT stay literal).
+func canOpen(r []rune, i, width int) bool {
+	next := i + width
+	if next >= len(r) || unicode.IsSpace(r[next]) {
+		return false
+	}
+	if r[i] == '_' && i > 0 && isWordRune(r[i-1]) {
+		return false
+	}
+	return true
+}
+
+// canClose reports whether the delimiter of width runes at j can close
+// emphasis opened with the same character.
+func canClose(r []rune, j, width int) bool {
+	if j == 0 || unicode.IsSpace(r[j-1]) {
+		return false
+	}
+	after := j + width
+	if r[j] == '_' && after < len(r) && isWordRune(r[after]) {
+		return false
+	}
+	return true
+}
+
+// findCloser returns the index of the closing delimiter for an emphasis of
+// width runes of c, starting the search at from. Code spans are skipped.
+// It returns -1 if there is none or the content would be empty.
+func findCloser(r []rune, from int, c rune, width int) int {
+	for j := from; j < len(r); {
+		switch r[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			n := runLength(r, j, '`')
+			if end := findBacktickRun(r, j+n, n); end >= 0 {
+				j = end + n
+				continue
+			}
+			j += n
+			continue
+		case c:
+			m := runLength(r, j, c)
+			if m >= width {
+				// With a longer run, the closer is its last width runes
+				// (e.g. "***" closes bold after an inner italic)
+				at := j + m - width
+				if at > from && canClose(r, at, width) {
+					return at
+				}
+			}
+			j += m
+			continue
+		}
+		j++
+	}
+	return -1
+}
+
+// parseLink parses [label](url) starting at the '[' at i. It returns the
+// label, the URL and the index just after the closing parenthesis.
+func parseLink(r []rune, i int) (label []rune, url string, end int, ok bool) {
+	depth := 0
+	closeBracket := -1
+	for j := i; j < len(r); j++ {
+		if r[j] == '\\' {
+			j++
+			continue
+		}
+		if r[j] == '[' {
+			depth++
+		} else if r[j] == ']' {
+			depth--
+			if depth == 0 {
+				closeBracket = j
+				break
+			}
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(r) || r[closeBracket+1] != '(' {
+		return nil, "", 0, false
+	}
+
+	depth = 0
+	for j := closeBracket + 1; j < len(r); j++ {
+		switch r[j] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				target := strings.TrimSpace(string(r[closeBracket+2 : j]))
+				if target == "" || strings.ContainsAny(target, " \t\n") {
+					return nil, "", 0, false
+				}
+				return r[i+1 : closeBracket], target, j + 1, true
+			}
+		case ' ', '\t', '\n':
+			// A title ("...") or spaces make it something other than a plain link
+			if depth == 1 && strings.TrimSpace(string(r[closeBracket+2:j])) != "" {
+				return nil, "", 0, false
+			}
+		}
+	}
+	return nil, "", 0, false
+}
+
+// findBacktickRun returns the index of the next run of exactly n backticks.
+func findBacktickRun(r []rune, from, n int) int {
+	for j := from; j < len(r); {
+		if r[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(r, j, '`')
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// trimCodeSpan strips one leading and trailing space when both are present,
+// as CommonMark does so code spans can start or end with a backtick.
+func trimCodeSpan(s string) string {
+	if len(s) >= 2 && s[0] == ' ' && s[len(s)-1] == ' ' && strings.TrimSpace(s) != "" {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// runLength counts consecutive c runes starting at i.
+func runLength(r []rune, i int, c rune) int {
+	n := 0
+	for i+n < len(r) && r[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func isASCIIPunct(c rune) bool {
+	return c < 128 && unicode.IsPunct(c) || strings.ContainsRune("$+<=>^`|~", c)
+}
@@ -0,0 +1,346 @@
+// Package kv provides a small embedded key-value store backed by a single
+// append-only log file.
+//
+// Every Put and Delete appends a checksummed record to the log; Open replays
+// the log into memory, so reads never touch the disk. A record cut short by a
+// crash is dropped on the next Open. When the log holds more dead records
+// than live data it is compacted by rewriting the live keys to a new file.
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Record operations.
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+// minCompactSize is the log size below which compaction never runs.
+const minCompactSize = 1 << 20
+
+// ErrClosed is returned by operations on a closed Store.
+var ErrClosed = errors.New("kv: store is closed")
+
+// Store is an embedded key-value store. It is safe for concurrent use.
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	file   *os.File
+	data   map[string][]byte
+	size   int64 // bytes in the log
+	live   int64 // bytes of records for current values
+	noSync bool
+	closed bool
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithoutSync skips fsync after each write. Faster, but the last writes may be
+// lost if the machine crashes.
+func WithoutSync() Option {
+	return func(s *Store) {
+		s.noSync = true
+	}
+}
+
+// Open opens the store at path, creating it and its parent directories if
+// needed, and loads its contents into memory.
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[string][]byte),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("kv: failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("kv: failed to open %s: %w", path, err)
+	}
+
+	valid, err := s.replay(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Drop a torn record left by a crash so new records start cleanly
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("kv: failed to truncate %s: %w", path, err)
+	}
+
+	s.file = file
+	s.size = valid
+	return s, nil
+}
+
+// replay loads every complete record of the log into memory and returns the
+// length of the valid prefix.
+func (s *Store) replay(file *os.File) (int64, error) {
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		op, key, value, n, err := readRecord(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errCorrupt) {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("kv: failed to read %s: %w", s.path, err)
+		}
+		offset += n
+
+		if old, ok := s.data[key]; ok {
+			s.live -= recordSize(key, old)
+		}
+		switch op {
+		case opPut:
+			s.data[key] = value
+			s.live += n
+		case opDelete:
+			delete(s.data, key)
+		}
+	}
+}
+
+// Get returns a copy of the value stored under key.
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, false, ErrClosed
+	}
+	value, ok := s.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), value...), true, nil
+}
+
+// Put stores value under key.
+func (s *Store) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	value = append([]byte(nil), value...)
+	if err := s.append(opPut, key, value); err != nil {
+		return err
+	}
+	if old, ok := s.data[key]; ok {
+		s.live -= recordSize(key, old)
+	}
+	s.data[key] = value
+	s.live += recordSize(key, value)
+	return s.maybeCompact()
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	old, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if err := s.append(opDelete, key, nil); err != nil {
+		return err
+	}
+	delete(s.data, key)
+	s.live -= recordSize(key, old)
+	return s.maybeCompact()
+}
+
+// Keys returns all keys in sorted order.
+func (s *Store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Close flushes and closes the log file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("kv: failed to close %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// append writes one record to the end of the log. Callers hold s.mu.
+func (s *Store) append(op byte, key string, value []byte) error {
+	record := encodeRecord(op, key, value)
+	if _, err := s.file.Write(record); err != nil {
+		return fmt.Errorf("kv: failed to write %s: %w", s.path, err)
+	}
+	if !s.noSync {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("kv: failed to sync %s: %w", s.path, err)
+		}
+	}
+	s.size += int64(len(record))
+	return nil
+}
+
+// maybeCompact rewrites the log when dead records outweigh live data.
+// Callers hold s.mu.
+func (s *Store) maybeCompact() error {
+	if s.size < minCompactSize || s.size < 2*s.live {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact writes the live keys to a temporary file and renames it over the
+// log. Callers hold s.mu.
+func (s *Store) compact() error {
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("kv: failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	var size int64
+	for key, value := range s.data {
+		n, err := w.Write(encodeRecord(opPut, key, value))
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("kv: failed to compact %s: %w", s.path, err)
+		}
+		size += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("kv: failed to compact %s: %w", s.path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("kv: failed to compact %s: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("kv: failed to compact %s: %w", s.path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("kv: failed to replace %s: %w", s.path, err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("kv: failed to reopen %s: %w", s.path, err)
+	}
+	s.file.Close()
+	s.file = file
+	s.size = size
+	s.live = size
+	return nil
+}
+
+// errCorrupt marks a record whose checksum or header does not match.
+var errCorrupt = errors.New("kv: corrupt record")
+
+// encodeRecord serializes a log record:
+//
+//	crc32 (4 bytes, over everything after it) | op (1 byte) |
+//	key length (uvarint) | value length (uvarint) | key | value
+func encodeRecord(op byte, key string, value []byte) []byte {
+	buf := make([]byte, 4, recordSize(key, value))
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.LittleEndian.PutUint32(buf[:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func recordSize(key string, value []byte) int64 {
+	return int64(4 + 1 + uvarintLen(uint64(len(key))) + uvarintLen(uint64(len(value))) + len(key) + len(value))
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// readRecord reads one record and returns its size in bytes.
+func readRecord(r *bufio.Reader) (op byte, key string, value []byte, n int64, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return 0, "", nil, 0, err
+	}
+	sum := binary.LittleEndian.Uint32(header[:4])
+	op = header[4]
+	if op != opPut && op != opDelete {
+		return 0, "", nil, 0, errCorrupt
+	}
+
+	keyLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+	valueLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+	if keyLen > 1<<20 || valueLen > 1<<30 {
+		return 0, "", nil, 0, errCorrupt
+	}
+
+	body := make([]byte, keyLen+valueLen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, "", nil, 0, io.ErrUnexpectedEOF
+	}
+
+	key = string(body[:keyLen])
+	if op == opPut {
+		value = body[keyLen:]
+	}
+	if crc32.ChecksumIEEE(encodeRecord(op, key, value)[4:]) != sum {
+		return 0, "", nil, 0, errCorrupt
+	}
+
+	return op, key, value, recordSize(key, value), nil
+}
@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore_PutGetDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "store.kv")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if _, ok, _ := s.Get("a"); ok {
+		t.Error("Get() on an empty store should miss")
+	}
+	if err := s.Put("a", []byte("1")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := s.Put("b", []byte("2")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := s.Put("a", []byte("3")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	value, ok, err := s.Get("a")
+	if err != nil || !ok || string(value) != "3" {
+		t.Errorf("Get(a) = %q, %v, %v; want latest value", value, ok, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Reopening replays the log
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close()
+
+	if got := s.Keys(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Keys() = %v, want [a]", got)
+	}
+	value, _, _ = s.Get("a")
+	if string(value) != "3" {
+		t.Errorf("Get(a) after reopen = %q, want 3", value)
+	}
+}
+
+func TestStore_TornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	s, _ := Open(path)
+	s.Put("a", []byte("1"))
+	s.Put("b", []byte("2"))
+	s.Close()
+
+	// Simulate a crash in the middle of the last record
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Error("torn record should be dropped")
+	}
+	if v, _, _ := s.Get("a"); string(v) != "1" {
+		t.Errorf("Get(a) = %q, want records before the tear kept", v)
+	}
+
+	// New writes after recovery are readable
+	s.Put("c", []byte("3"))
+	s.Close()
+	s, _ = Open(path)
+	defer s.Close()
+	if v, _, _ := s.Get("c"); string(v) != "3" {
+		t.Errorf("Get(c) = %q, want write after recovery", v)
+	}
+}
+
+func TestStore_Compaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	s, err := Open(path, WithoutSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := []byte(strings.Repeat("x", 4096))
+	for i := 0; i < 600; i++ {
+		if err := s.Put(fmt.Sprintf("k%d", i%3), value); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	s.Close()
+
+	info, _ := os.Stat(path)
+	if info.Size() >= minCompactSize {
+		t.Errorf("log size = %d, want it compacted below %d", info.Size(), minCompactSize)
+	}
+
+	s, _ = Open(path)
+	defer s.Close()
+	if got := len(s.Keys()); got != 3 {
+		t.Errorf("len(Keys()) = %d, want 3 after compaction", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the log file, got %d entries", len(entries))
+	}
+}
+
+func TestStore_Closed(t *testing.T) {
+	s, _ := Open(filepath.Join(t.TempDir(), "store.kv"))
+	s.Close()
+	if err := s.Put("a", nil); err != ErrClosed {
+		t.Errorf("Put() after Close = %v, want ErrClosed", err)
+	}
+}
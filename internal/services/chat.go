@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pocky-ops-bot/internal/clients/llm"
 	"github.com/pocky-ops-bot/internal/tools"
@@ -17,6 +19,12 @@ type AICompleter interface {
 	Complete(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error)
 }
 
+// AIStreamer is implemented by completers that can stream partial output.
+// Defined at the consumer side for testability.
+type AIStreamer interface {
+	CompleteStream(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error)
+}
+
 // ToolExecutor executes tool calls and provides tool definitions.
 // Defined at the consumer side for testability.
 type ToolExecutor interface {
@@ -24,6 +32,13 @@ type ToolExecutor interface {
 	Execute(ctx context.Context, call llm.ToolCall) tools.ToolResult
 }
 
+// ScopedToolExecutor is implemented by executors whose available tools depend
+// on the request, e.g. tool groups enabled per chat or user.
+// Defined at the consumer side for testability.
+type ScopedToolExecutor interface {
+	DefinitionsFor(ctx context.Context) []llm.ToolDefinition
+}
+
 // ChatService handles AI conversation generation.
 // It is stateless — history is managed by the caller.
 type ChatService struct {
@@ -31,6 +46,8 @@ type ChatService struct {
 	tools         ToolExecutor
 	systemPrompt  string
 	maxToolRounds int
+	toolParallel  int
+	toolTimeout   time.Duration
 	vietnamese    bool
 	logger        *slog.Logger
 }
@@ -59,6 +76,25 @@ func WithMaxToolRounds(n int) ChatServiceOption {
 	}
 }
 
+// WithToolParallelism sets how many tool calls of one round run at once
+// (default 4). 1 runs them one after another.
+func WithToolParallelism(n int) ChatServiceOption {
+	return func(s *ChatService) {
+		if n > 0 {
+			s.toolParallel = n
+		}
+	}
+}
+
+// WithToolTimeout limits how long a single tool call may take (default 20s,
+// 0 disables the limit). A call that times out is reported to the AI as a
+// failed tool result, so one slow endpoint cannot stall the answer.
+func WithToolTimeout(d time.Duration) ChatServiceOption {
+	return func(s *ChatService) {
+		s.toolTimeout = d
+	}
+}
+
 // NewChatService creates a new ChatService.
 func NewChatService(completer AICompleter, systemPrompt string, logger *slog.Logger, opts ...ChatServiceOption) *ChatService {
 	if logger == nil {
@@ -68,6 +104,8 @@ func NewChatService(completer AICompleter, systemPrompt string, logger *slog.Log
 		ai:            completer,
 		systemPrompt:  systemPrompt,
 		maxToolRounds: 5,
+		toolParallel:  4,
+		toolTimeout:   20 * time.Second,
 		logger:        logger,
 	}
 	for _, opt := range opts {
@@ -79,56 +117,97 @@ func NewChatService(completer AICompleter, systemPrompt string, logger *slog.Log
 		s.systemPrompt += "\n\nAlways respond in Vietnamese (tiếng Việt)."
 	}
 
-	// Enhance system prompt with tool descriptions so the LLM knows to use them
-	if s.tools != nil {
-		defs := s.tools.Definitions()
-		if len(defs) > 0 {
-			var toolList strings.Builder; toolList.WriteString("\n\nYou have access to the following tools:\n")
-			for _, def := range defs {
-				fmt.Fprintf(&toolList, "- %s: %s\n", def.Name, def.Description)
-			}
-			toolList.WriteString("\nWhen the user asks about their portfolio, balance, prices, P&L, " +
-				"futures positions, margin, leverage, open orders, trade history, or funding fees, " +
-				"you MUST use these tools to fetch real-time data. " +
-				"Do not make up or estimate values — always call the tools first.")
-			s.systemPrompt += toolList.String()
-		}
+	return s
+}
+
+// definitions returns the tools available for the request of ctx.
+func (s *ChatService) definitions(ctx context.Context) []llm.ToolDefinition {
+	if s.tools == nil {
+		return nil
+	}
+	if scoped, ok := s.tools.(ScopedToolExecutor); ok {
+		return scoped.DefinitionsFor(ctx)
 	}
+	return s.tools.Definitions()
+}
 
-	return s
+// toolPrompt describes the available tools in the system prompt so the LLM
+// knows to use them. It depends only on defs, keeping the prompt identical
+// between requests with the same tools.
+func toolPrompt(defs []llm.ToolDefinition) string {
+	if len(defs) == 0 {
+		return ""
+	}
+	var toolList strings.Builder; toolList.WriteString("\n\nYou have access to the following tools:\n")
+	for _, def := range defs {
+		fmt.Fprintf(&toolList, "- %s: %s\n", def.Name, def.Description)
+	}
+	toolList.WriteString("\nWhen the user asks about their portfolio, balance, prices, P&L, " +
+		"futures positions, margin, leverage, open orders, trade history, or funding fees, " +
+		"you MUST use these tools to fetch real-time data. " +
+		"Do not make up or estimate values — always call the tools first.")
+	return toolList.String()
 }
 
 // GenerateResponse calls the AI with the given history and user text.
 // History is owned by the caller — this method does not store anything.
 // If tools are configured, handles the tool call loop automatically.
 func (s *ChatService) GenerateResponse(ctx context.Context, history []llm.ChatMessage, userText string) (string, error) {
-	// Build messages: history + current user message
-	messages := make([]llm.ChatMessage, len(history), len(history)+1)
-	copy(messages, history)
-	messages = append(messages, llm.ChatMessage{
-		Role:    llm.RoleUser,
-		Content: userText,
-	})
+	return s.generate(ctx, history, llm.ChatMessage{Content: userText}, nil)
+}
 
-	req := llm.ChatRequest{
-		Messages: messages,
-		System:   s.systemPrompt,
+// GenerateResponseStream works like GenerateResponse but reports the reply
+// text generated so far through onPartial. Each tool call round starts over
+// from an empty text. If the completer cannot stream, onPartial is called
+// once per round with the complete text.
+func (s *ChatService) GenerateResponseStream(ctx context.Context, history []llm.ChatMessage, userText string, onPartial func(text string)) (string, error) {
+	return s.generate(ctx, history, llm.ChatMessage{Content: userText}, onPartial)
+}
+
+// GenerateMessageResponse answers a complete user message, which may carry
+// images next to its text. With a non-nil onPartial it streams like
+// GenerateResponseStream.
+func (s *ChatService) GenerateMessageResponse(ctx context.Context, history []llm.ChatMessage, msg llm.ChatMessage, onPartial func(text string)) (string, error) {
+	return s.generate(ctx, history, msg, onPartial)
+}
+
+// generate runs the tool call loop, streaming partial text when onPartial is set.
+func (s *ChatService) generate(ctx context.Context, history []llm.ChatMessage, userMsg llm.ChatMessage, onPartial func(text string)) (string, error) {
+	// Tools enabled for this request, described in the system prompt
+	defs := s.definitions(ctx)
+
+	// Build messages: history + current user message.
+	// System messages in history (e.g. summaries of older turns) extend the
+	// system prompt, since providers only accept system text there.
+	system := s.systemPrompt + toolPrompt(defs)
+	messages := make([]llm.ChatMessage, 0, len(history)+1)
+	for _, msg := range history {
+		if msg.Role == llm.RoleSystem {
+			system += "\n\n" + msg.Content
+			continue
+		}
+		messages = append(messages, msg)
 	}
+	userMsg.Role = llm.RoleUser
+	messages = append(messages, userMsg)
 
-	// Attach tool definitions if available
-	if s.tools != nil {
-		req.Tools = s.tools.Definitions()
+	req := llm.ChatRequest{
+		Messages: messages,
+		System:   system,
+		Tools:    defs,
 	}
 
 	// Tool call loop
 	for round := 0; round <= s.maxToolRounds; round++ {
-		resp, err := s.ai.Complete(ctx, req)
+		resp, err := s.complete(ctx, req, onPartial)
 		if err != nil {
 			return "", fmt.Errorf("ai completion failed: %w", err)
 		}
 
 		s.logger.Info("ai response",
 			slog.Int("round", round),
+			slog.String("provider", string(resp.Provider)),
+			slog.String("model", resp.Model),
 			slog.Int("tool_calls", len(resp.ToolCalls)),
 			slog.Int("input_tokens", resp.InputTokens),
 			slog.Int("output_tokens", resp.OutputTokens),
@@ -151,21 +230,8 @@ func (s *ChatService) GenerateResponse(ctx context.Context, history []llm.ChatMe
 			ToolCalls: resp.ToolCalls,
 		})
 
-		// Execute each tool call and append results
-		for _, call := range resp.ToolCalls {
-			s.logger.Info("executing tool",
-				slog.String("tool", call.Name),
-				slog.String("call_id", call.ID),
-			)
-
-			result := s.tools.Execute(ctx, call)
-
-			s.logger.Info("tool result",
-				slog.String("tool", call.Name),
-				slog.Bool("is_error", result.IsError),
-				slog.Int("content_len", len(result.Content)),
-			)
-
+		// Execute the round's tool calls and append results in call order
+		for _, result := range s.executeTools(ctx, resp.ToolCalls) {
 			req.Messages = append(req.Messages, llm.ChatMessage{
 				Role:       llm.RoleTool,
 				Content:    result.Content,
@@ -176,3 +242,84 @@ func (s *ChatService) GenerateResponse(ctx context.Context, history []llm.ChatMe
 
 	return "", fmt.Errorf("tool call loop exceeded maximum rounds (%d)", s.maxToolRounds)
 }
+
+// executeTools runs the tool calls of one round, up to toolParallel at a
+// time, and returns their results in the order of calls.
+func (s *ChatService) executeTools(ctx context.Context, calls []llm.ToolCall) []tools.ToolResult {
+	results := make([]tools.ToolResult, len(calls))
+	sem := make(chan struct{}, s.toolParallel)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, call llm.ToolCall) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.executeTool(ctx, call)
+		}(i, call)
+	}
+	wg.Wait()
+	return results
+}
+
+// executeTool runs one tool call within the per-tool timeout. A tool that
+// does not return in time is abandoned and reported as failed; its context
+// is cancelled, so well-behaved tools stop shortly after.
+func (s *ChatService) executeTool(ctx context.Context, call llm.ToolCall) tools.ToolResult {
+	s.logger.Info("executing tool",
+		slog.String("tool", call.Name),
+		slog.String("call_id", call.ID),
+	)
+
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.toolTimeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, s.toolTimeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan tools.ToolResult, 1)
+	go func() { done <- s.tools.Execute(callCtx, call) }()
+
+	var result tools.ToolResult
+	select {
+	case result = <-done:
+	case <-callCtx.Done():
+		result = tools.ToolResult{CallID: call.ID, IsError: true, Content: callCtx.Err().Error()}
+		if ctx.Err() == nil {
+			result.Content = fmt.Sprintf("tool %s timed out after %s", call.Name, s.toolTimeout)
+		}
+	}
+
+	s.logger.Info("tool result",
+		slog.String("tool", call.Name),
+		slog.String("call_id", call.ID),
+		slog.Bool("is_error", result.IsError),
+		slog.Int("content_len", len(result.Content)),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return result
+}
+
+// complete performs a single completion round, streaming through onPartial
+// when both the caller and the completer support it.
+func (s *ChatService) complete(ctx context.Context, req llm.ChatRequest, onPartial func(text string)) (*llm.ChatResponse, error) {
+	if onPartial == nil {
+		return s.ai.Complete(ctx, req)
+	}
+
+	streamer, ok := s.ai.(AIStreamer)
+	if !ok {
+		resp, err := s.ai.Complete(ctx, req)
+		if err == nil && resp.Content != "" {
+			onPartial(resp.Content)
+		}
+		return resp, err
+	}
+
+	var text strings.Builder
+	return streamer.CompleteStream(ctx, req, func(delta string) {
+		text.WriteString(delta)
+		onPartial(text.String())
+	})
+}
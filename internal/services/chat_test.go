@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pocky-ops-bot/internal/clients/llm"
 	"github.com/pocky-ops-bot/internal/tools"
@@ -40,7 +43,11 @@ func (m *mockAICompleter) Complete(ctx context.Context, req llm.ChatRequest) (*l
 type mockToolExecutor struct {
 	definitions []llm.ToolDefinition
 	results     map[string]tools.ToolResult // keyed by tool name
+	delays      map[string]time.Duration    // keyed by tool name
+	mu          sync.Mutex
 	calls       []llm.ToolCall
+	running     int
+	maxRunning  int
 }
 
 func (m *mockToolExecutor) Definitions() []llm.ToolDefinition {
@@ -48,7 +55,26 @@ func (m *mockToolExecutor) Definitions() []llm.ToolDefinition {
 }
 
 func (m *mockToolExecutor) Execute(ctx context.Context, call llm.ToolCall) tools.ToolResult {
+	m.mu.Lock()
 	m.calls = append(m.calls, call)
+	m.running++
+	if m.running > m.maxRunning {
+		m.maxRunning = m.running
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.running--
+		m.mu.Unlock()
+	}()
+
+	if delay := m.delays[call.Name]; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return tools.ToolResult{CallID: call.ID, Content: ctx.Err().Error(), IsError: true}
+		}
+	}
 	if result, ok := m.results[call.Name]; ok {
 		result.CallID = call.ID
 		return result
@@ -192,6 +218,60 @@ func TestChatService_GenerateResponse_WithToolsAttachesDefinitions(t *testing.T)
 	}
 }
 
+// namedTool is a tools.Tool with a fixed name and no parameters.
+type namedTool string
+
+func (n namedTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{Name: string(n), Description: "Tool " + string(n), Parameters: json.RawMessage(`{"type":"object"}`)}
+}
+
+func (n namedTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	return string(n), nil
+}
+
+func TestChatService_ToolGroups(t *testing.T) {
+	registry := tools.NewRegistry(nil)
+	registry.Register(namedTool("get_spot_balances"), "spot")
+	registry.Register(namedTool("get_futures_positions"), "futures")
+	registry.Register(namedTool("restart_service"), "ops")
+
+	mock := &mockAICompleter{response: &llm.ChatResponse{Content: "ok"}}
+	service := NewChatService(mock, "You are Pocky", nil, WithTools(registry))
+
+	// The same tools give the same system prompt on every request
+	for i := 0; i < 2; i++ {
+		if _, err := service.GenerateResponse(context.Background(), nil, "Hello"); err != nil {
+			t.Fatalf("GenerateResponse() error = %v", err)
+		}
+	}
+	if len(mock.requests[0].Tools) != 3 || mock.requests[0].System != mock.requests[1].System {
+		t.Fatalf("unrestricted requests: %d tools, stable system prompt = %v", len(mock.requests[0].Tools), mock.requests[0].System == mock.requests[1].System)
+	}
+
+	// A chat limited to ops sees neither the tools nor their descriptions
+	ctx := tools.ContextWithGroups(context.Background(), []string{"ops"})
+	if _, err := service.GenerateResponse(ctx, nil, "Hello"); err != nil {
+		t.Fatalf("GenerateResponse() error = %v", err)
+	}
+	req := mock.requests[2]
+	if len(req.Tools) != 1 || req.Tools[0].Name != "restart_service" {
+		t.Errorf("ops request tools = %+v, want only restart_service", req.Tools)
+	}
+	if strings.Contains(req.System, "get_spot_balances") || !strings.Contains(req.System, "restart_service") {
+		t.Errorf("ops system prompt = %q, want only restart_service described", req.System)
+	}
+
+	// A chat without groups gets no tools and no tool prompt
+	ctx = tools.ContextWithGroups(context.Background(), nil)
+	if _, err := service.GenerateResponse(ctx, nil, "Hello"); err != nil {
+		t.Fatalf("GenerateResponse() error = %v", err)
+	}
+	req = mock.requests[3]
+	if len(req.Tools) != 0 || req.System != "You are Pocky" {
+		t.Errorf("request without tools = %d tools, system %q", len(req.Tools), req.System)
+	}
+}
+
 func TestChatService_GenerateResponse_ToolCallLoop(t *testing.T) {
 	// Simulate: LLM calls tool, gets result, then returns final text
 	aiMock := &mockAICompleter{
@@ -382,3 +462,223 @@ func TestChatService_DefaultMaxToolRounds(t *testing.T) {
 		t.Errorf("maxToolRounds = %d, want 5", service.maxToolRounds)
 	}
 }
+
+// mockStreamingCompleter implements AIStreamer by emitting the response content in fixed-size deltas.
+type mockStreamingCompleter struct {
+	mockAICompleter
+	streamCalls int
+}
+
+func (m *mockStreamingCompleter) CompleteStream(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error) {
+	m.streamCalls++
+	resp, err := m.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(resp.Content); i += 3 {
+		end := i + 3
+		if end > len(resp.Content) {
+			end = len(resp.Content)
+		}
+		onDelta(resp.Content[i:end])
+	}
+	return resp, nil
+}
+
+func TestChatService_GenerateResponseStream(t *testing.T) {
+	mock := &mockStreamingCompleter{
+		mockAICompleter: mockAICompleter{
+			responses: []*llm.ChatResponse{
+				{ToolCalls: []llm.ToolCall{{ID: "c1", Name: "get_spot_balances", Arguments: json.RawMessage(`{}`)}}},
+				{Content: "Balance: 1 BTC"},
+			},
+		},
+	}
+	executor := &mockToolExecutor{
+		definitions: []llm.ToolDefinition{{Name: "get_spot_balances"}},
+		results:     map[string]tools.ToolResult{"get_spot_balances": {Content: `[]`}},
+	}
+
+	service := NewChatService(mock, "", nil, WithTools(executor))
+
+	var partials []string
+	reply, err := service.GenerateResponseStream(context.Background(), nil, "balance?", func(text string) {
+		partials = append(partials, text)
+	})
+	if err != nil {
+		t.Fatalf("GenerateResponseStream() error = %v", err)
+	}
+
+	if reply != "Balance: 1 BTC" {
+		t.Errorf("reply = %q, want %q", reply, "Balance: 1 BTC")
+	}
+	if mock.streamCalls != 2 {
+		t.Errorf("stream calls = %d, want 2 (one per round)", mock.streamCalls)
+	}
+	if len(partials) == 0 || partials[len(partials)-1] != "Balance: 1 BTC" {
+		t.Errorf("last partial = %v, want accumulated reply", partials)
+	}
+	if partials[0] != "Bal" {
+		t.Errorf("first partial = %q, want %q", partials[0], "Bal")
+	}
+}
+
+func TestChatService_GenerateResponseStream_NonStreamingCompleter(t *testing.T) {
+	mock := &mockAICompleter{
+		response: &llm.ChatResponse{Content: "whole reply"},
+	}
+
+	service := NewChatService(mock, "", nil)
+
+	var partials []string
+	reply, err := service.GenerateResponseStream(context.Background(), nil, "hi", func(text string) {
+		partials = append(partials, text)
+	})
+	if err != nil {
+		t.Fatalf("GenerateResponseStream() error = %v", err)
+	}
+
+	if reply != "whole reply" {
+		t.Errorf("reply = %q, want %q", reply, "whole reply")
+	}
+	if len(partials) != 1 || partials[0] != "whole reply" {
+		t.Errorf("partials = %v, want single complete text", partials)
+	}
+}
+
+func TestChatService_GenerateMessageResponse_Images(t *testing.T) {
+	mock := &mockAICompleter{
+		response: &llm.ChatResponse{Content: "a BTC chart"},
+	}
+
+	service := NewChatService(mock, "", nil)
+
+	photo := llm.Image{MimeType: "image/jpeg", Data: []byte{0xff, 0xd8}}
+	reply, err := service.GenerateMessageResponse(context.Background(), nil, llm.ChatMessage{
+		Content: "what is this?",
+		Images:  []llm.Image{photo},
+	}, nil)
+	if err != nil {
+		t.Fatalf("GenerateMessageResponse() error = %v", err)
+	}
+	if reply != "a BTC chart" {
+		t.Errorf("reply = %q", reply)
+	}
+
+	msgs := mock.requests[0].Messages
+	last := msgs[len(msgs)-1]
+	if last.Role != llm.RoleUser || last.Content != "what is this?" || len(last.Images) != 1 {
+		t.Errorf("user message = %+v, want text and image", last)
+	}
+}
+
+// toolRound returns a completer asking for the given tool calls, then
+// answering with "done".
+func toolRound(calls ...llm.ToolCall) *mockAICompleter {
+	return &mockAICompleter{responses: []*llm.ChatResponse{{ToolCalls: calls}, {Content: "done"}}}
+}
+
+// toolMessages returns the tool results sent in the final request.
+func toolMessages(m *mockAICompleter) []llm.ChatMessage {
+	var results []llm.ChatMessage
+	for _, msg := range m.requests[len(m.requests)-1].Messages {
+		if msg.Role == llm.RoleTool {
+			results = append(results, msg)
+		}
+	}
+	return results
+}
+
+func TestChatService_ParallelToolCalls(t *testing.T) {
+	aiMock := toolRound(
+		llm.ToolCall{ID: "call_1", Name: "slow"},
+		llm.ToolCall{ID: "call_2", Name: "fast"},
+		llm.ToolCall{ID: "call_3", Name: "slow"},
+	)
+	executor := &mockToolExecutor{
+		results: map[string]tools.ToolResult{
+			"slow": {Content: "slow result"},
+			"fast": {Content: "fast result"},
+		},
+		delays: map[string]time.Duration{"slow": 50 * time.Millisecond, "fast": 20 * time.Millisecond},
+	}
+	service := NewChatService(aiMock, "", nil, WithTools(executor), WithToolParallelism(3))
+
+	start := time.Now()
+	if _, err := service.GenerateResponse(context.Background(), nil, "Portfolio"); err != nil {
+		t.Fatalf("GenerateResponse() error = %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if executor.maxRunning != 3 {
+		t.Errorf("max concurrent tool calls = %d, want 3", executor.maxRunning)
+	}
+	if elapsed >= 100*time.Millisecond {
+		t.Errorf("round took %v, want the slow calls to overlap", elapsed)
+	}
+
+	results := toolMessages(aiMock)
+	want := []struct{ id, content string }{
+		{"call_1", "slow result"},
+		{"call_2", "fast result"},
+		{"call_3", "slow result"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("tool results = %+v, want %d", results, len(want))
+	}
+	for i, w := range want {
+		if results[i].ToolCallID != w.id || results[i].Content != w.content {
+			t.Errorf("result %d = {%s, %q}, want {%s, %q}", i, results[i].ToolCallID, results[i].Content, w.id, w.content)
+		}
+	}
+}
+
+func TestChatService_ToolParallelismLimit(t *testing.T) {
+	calls := make([]llm.ToolCall, 5)
+	for i := range calls {
+		calls[i] = llm.ToolCall{ID: fmt.Sprintf("call_%d", i), Name: "slow"}
+	}
+	executor := &mockToolExecutor{
+		results: map[string]tools.ToolResult{"slow": {Content: "ok"}},
+		delays:  map[string]time.Duration{"slow": 10 * time.Millisecond},
+	}
+	service := NewChatService(toolRound(calls...), "", nil, WithTools(executor), WithToolParallelism(2))
+
+	if _, err := service.GenerateResponse(context.Background(), nil, "Portfolio"); err != nil {
+		t.Fatalf("GenerateResponse() error = %v", err)
+	}
+	if len(executor.calls) != 5 || executor.maxRunning != 2 {
+		t.Errorf("calls = %d with %d at once, want 5 with at most 2 at once", len(executor.calls), executor.maxRunning)
+	}
+}
+
+func TestChatService_ToolTimeout(t *testing.T) {
+	aiMock := toolRound(
+		llm.ToolCall{ID: "call_1", Name: "hang"},
+		llm.ToolCall{ID: "call_2", Name: "fast"},
+	)
+	executor := &mockToolExecutor{
+		results: map[string]tools.ToolResult{
+			"hang": {Content: "too late"},
+			"fast": {Content: "fast result"},
+		},
+		delays: map[string]time.Duration{"hang": time.Hour},
+	}
+	service := NewChatService(aiMock, "", nil, WithTools(executor), WithToolTimeout(20*time.Millisecond))
+
+	reply, err := service.GenerateResponse(context.Background(), nil, "Portfolio")
+	if err != nil || reply != "done" {
+		t.Fatalf("GenerateResponse() = %q, %v; want the answer despite the slow tool", reply, err)
+	}
+
+	results := toolMessages(aiMock)
+	if len(results) != 2 {
+		t.Fatalf("tool results = %+v, want 2", results)
+	}
+	if results[0].ToolCallID != "call_1" || results[0].Content != "tool hang timed out after 20ms" {
+		t.Errorf("slow result = %+v, want a timeout notice", results[0])
+	}
+	if results[1].Content != "fast result" {
+		t.Errorf("fast result = %+v", results[1])
+	}
+}
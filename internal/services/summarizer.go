@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// SummaryPrefix starts the content of the synthetic system message that
+// replaces summarized turns in a conversation history.
+const SummaryPrefix = "Summary of the earlier conversation:\n"
+
+// summarizerPrompt instructs the model how to compress old turns.
+const summarizerPrompt = "You compress chat transcripts. Summarize the conversation below so the " +
+	"assistant can continue it without the original messages. Keep facts, numbers, " +
+	"symbols, decisions, user preferences and open questions; drop small talk. " +
+	"Write in the language of the conversation, as concise bullet points."
+
+// maxTranscriptToolChars bounds how much of a single tool result is sent to
+// the summarizer; raw tool output is rarely worth keeping verbatim.
+const maxTranscriptToolChars = 2000
+
+// Summarizer keeps a conversation history within a token budget by
+// compressing its oldest turns into a single summary message, generated by the
+// same AICompleter that answers the chat.
+type Summarizer struct {
+	ai           AICompleter
+	budget       int
+	keepFraction float64
+	maxTokens    int
+	logger       *slog.Logger
+}
+
+// SummarizerOption is a functional option for configuring Summarizer.
+type SummarizerOption func(*Summarizer)
+
+// WithKeepFraction sets the share of the budget kept as verbatim recent turns
+// after summarizing (default 0.5).
+func WithKeepFraction(f float64) SummarizerOption {
+	return func(s *Summarizer) {
+		s.keepFraction = f
+	}
+}
+
+// WithSummaryMaxTokens caps the length of the generated summary.
+func WithSummaryMaxTokens(n int) SummarizerOption {
+	return func(s *Summarizer) {
+		s.maxTokens = n
+	}
+}
+
+// NewSummarizer creates a Summarizer that keeps histories under budget tokens.
+func NewSummarizer(completer AICompleter, budget int, logger *slog.Logger, opts ...SummarizerOption) *Summarizer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Summarizer{
+		ai:           completer,
+		budget:       budget,
+		keepFraction: 0.5,
+		logger:       logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.maxTokens == 0 {
+		s.maxTokens = min(max(budget/8, 256), 1024)
+	}
+	return s
+}
+
+// Compact returns history unchanged while it fits the budget. Otherwise the
+// oldest turns, including any previous summary, are replaced by one RoleSystem
+// message starting with SummaryPrefix, followed by the most recent turns
+// verbatim. If the summary cannot be generated the oldest turns are dropped
+// instead and the error is returned along with the trimmed history.
+func (s *Summarizer) Compact(ctx context.Context, history []llm.ChatMessage) ([]llm.ChatMessage, error) {
+	total := llm.EstimateMessagesTokens(history)
+	if total <= s.budget {
+		return history, nil
+	}
+
+	split := s.splitPoint(history)
+	if split == 0 {
+		return history, nil
+	}
+	old, recent := history[:split], history[split:]
+
+	summary, err := s.summarize(ctx, old)
+	if err != nil {
+		return append([]llm.ChatMessage(nil), recent...), fmt.Errorf("services: failed to summarize history: %w", err)
+	}
+
+	compacted := make([]llm.ChatMessage, 0, len(recent)+1)
+	compacted = append(compacted, llm.ChatMessage{Role: llm.RoleSystem, Content: SummaryPrefix + summary})
+	compacted = append(compacted, recent...)
+
+	s.logger.Info("history summarized",
+		slog.Int("summarized_messages", len(old)),
+		slog.Int("kept_messages", len(recent)),
+		slog.Int("tokens_before", total),
+		slog.Int("tokens_after", llm.EstimateMessagesTokens(compacted)),
+	)
+	return compacted, nil
+}
+
+// splitPoint returns the index of the first message kept verbatim. The kept
+// tail fits keepFraction of the budget, always includes the latest exchange,
+// and starts on a user message so no tool result loses its call.
+func (s *Summarizer) splitPoint(history []llm.ChatMessage) int {
+	keep := int(float64(s.budget) * s.keepFraction)
+
+	split := len(history)
+	var tokens int
+	for split > 0 {
+		n := llm.EstimateMessageTokens(history[split-1])
+		if tokens+n > keep && len(history)-split >= 2 {
+			break
+		}
+		tokens += n
+		split--
+	}
+
+	for split < len(history) && history[split].Role != llm.RoleUser {
+		split++
+	}
+	if split == len(history) {
+		// Only a single oversized exchange; nothing sensible to summarize
+		return 0
+	}
+	return split
+}
+
+// summarize asks the AI for a summary of msgs.
+func (s *Summarizer) summarize(ctx context.Context, msgs []llm.ChatMessage) (string, error) {
+	resp, err := s.ai.Complete(ctx, llm.ChatRequest{
+		System:    summarizerPrompt,
+		MaxTokens: s.maxTokens,
+		Messages: []llm.ChatMessage{
+			{Role: llm.RoleUser, Content: transcript(msgs)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(resp.Content) == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// transcript renders msgs as plain text for the summarizer.
+func transcript(msgs []llm.ChatMessage) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		switch msg.Role {
+		case llm.RoleSystem:
+			fmt.Fprintf(&b, "Previous summary:\n%s\n\n", strings.TrimPrefix(msg.Content, SummaryPrefix))
+		case llm.RoleUser:
+			fmt.Fprintf(&b, "User: %s\n\n", msg.Content)
+		case llm.RoleAssistant:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "Assistant: %s\n\n", msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "Assistant called %s(%s)\n\n", call.Name, call.Arguments)
+			}
+		case llm.RoleTool:
+			content := msg.Content
+			if runes := []rune(content); len(runes) > maxTranscriptToolChars {
+				content = string(runes[:maxTranscriptToolChars]) + "…"
+			}
+			fmt.Fprintf(&b, "Tool result: %s\n\n", content)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
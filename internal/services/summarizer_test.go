@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// turns builds n user/assistant exchanges of roughly size tokens each.
+func turns(n, size int) []llm.ChatMessage {
+	var history []llm.ChatMessage
+	text := strings.Repeat("word ", size*4/5)
+	for i := 0; i < n; i++ {
+		history = append(history,
+			llm.ChatMessage{Role: llm.RoleUser, Content: "q" + text},
+			llm.ChatMessage{Role: llm.RoleAssistant, Content: "a" + text},
+		)
+	}
+	return history
+}
+
+func TestSummarizer_UnderBudget(t *testing.T) {
+	mock := &mockAICompleter{response: &llm.ChatResponse{Content: "summary"}}
+	s := NewSummarizer(mock, 10_000, nil)
+
+	history := turns(3, 50)
+	got, err := s.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if len(got) != len(history) || len(mock.requests) != 0 {
+		t.Error("history within budget should be returned without calling the AI")
+	}
+}
+
+func TestSummarizer_Compact(t *testing.T) {
+	mock := &mockAICompleter{response: &llm.ChatResponse{Content: "- user holds BTC"}}
+	s := NewSummarizer(mock, 1000, nil)
+
+	history := turns(10, 100) // ~2000 tokens
+	got, err := s.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if got[0].Role != llm.RoleSystem || got[0].Content != SummaryPrefix+"- user holds BTC" {
+		t.Errorf("got[0] = %+v, want synthetic summary message", got[0])
+	}
+	if got[1].Role != llm.RoleUser {
+		t.Errorf("got[1].Role = %s, want kept turns to start with a user message", got[1].Role)
+	}
+	if tokens := llm.EstimateMessagesTokens(got); tokens > 1000 {
+		t.Errorf("compacted history = %d tokens, want within budget", tokens)
+	}
+	last := history[len(history)-1]
+	if got[len(got)-1].Content != last.Content {
+		t.Error("latest turn should be kept verbatim")
+	}
+
+	if len(mock.requests) != 1 {
+		t.Fatalf("AI called %d times, want 1", len(mock.requests))
+	}
+	req := mock.requests[0]
+	if req.System != summarizerPrompt || !strings.HasPrefix(req.Messages[0].Content, "User: q") {
+		t.Errorf("summarizer request = %+v, want transcript of the oldest turns", req)
+	}
+}
+
+func TestSummarizer_FoldsPreviousSummary(t *testing.T) {
+	mock := &mockAICompleter{response: &llm.ChatResponse{Content: "merged"}}
+	s := NewSummarizer(mock, 1000, nil)
+
+	history := append([]llm.ChatMessage{{Role: llm.RoleSystem, Content: SummaryPrefix + "older facts"}}, turns(10, 100)...)
+	got, err := s.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if !strings.Contains(mock.requests[0].Messages[0].Content, "Previous summary:\nolder facts") {
+		t.Error("previous summary should be included in the transcript")
+	}
+	var summaries int
+	for _, msg := range got {
+		if msg.Role == llm.RoleSystem {
+			summaries++
+		}
+	}
+	if summaries != 1 {
+		t.Errorf("got %d summary messages, want exactly 1", summaries)
+	}
+}
+
+func TestSummarizer_FailureDropsOldest(t *testing.T) {
+	mock := &mockAICompleter{err: errors.New("provider down")}
+	s := NewSummarizer(mock, 1000, nil)
+
+	history := turns(10, 100)
+	got, err := s.Compact(context.Background(), history)
+	if err == nil {
+		t.Fatal("Compact() should report the summarizer failure")
+	}
+	if len(got) == 0 || len(got) >= len(history) || got[0].Role != llm.RoleUser {
+		t.Errorf("got %d messages, want the oldest turns dropped", len(got))
+	}
+}
+
+func TestChatService_SummaryExtendsSystemPrompt(t *testing.T) {
+	mock := &mockAICompleter{response: &llm.ChatResponse{Content: "ok"}}
+	svc := NewChatService(mock, "Be helpful.", nil)
+
+	history := []llm.ChatMessage{
+		{Role: llm.RoleSystem, Content: SummaryPrefix + "user likes ETH"},
+		{Role: llm.RoleUser, Content: "hi"},
+		{Role: llm.RoleAssistant, Content: "hello"},
+	}
+	if _, err := svc.GenerateResponse(context.Background(), history, "and now?"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := mock.requests[0]
+	if !strings.Contains(req.System, "Be helpful.") || !strings.Contains(req.System, "user likes ETH") {
+		t.Errorf("System = %q, want prompt plus summary", req.System)
+	}
+	for _, msg := range req.Messages {
+		if msg.Role == llm.RoleSystem {
+			t.Error("summary should not be sent as a message")
+		}
+	}
+	if len(req.Messages) != 3 {
+		t.Errorf("got %d messages, want 2 history + 1 user", len(req.Messages))
+	}
+}
@@ -86,6 +86,7 @@ func (t *GetFuturesPositionsTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbol": {
 					"type": "string",
+					"pattern": "^[A-Z0-9]+$",
 					"description": "Trading pair symbol, e.g. \"BTCUSDT\". Optional — omit to get all open positions."
 				}
 			}
@@ -155,6 +156,7 @@ func (t *GetFuturesOpenOrdersTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbol": {
 					"type": "string",
+					"pattern": "^[A-Z0-9]+$",
 					"description": "Trading pair symbol, e.g. \"BTCUSDT\". Optional — omit to get all open orders (higher API weight)."
 				}
 			}
@@ -213,10 +215,13 @@ func (t *GetFuturesTradesTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbol": {
 					"type": "string",
+					"pattern": "^[A-Z0-9]+$",
 					"description": "Trading pair symbol, e.g. \"BTCUSDT\". Required."
 				},
 				"limit": {
 					"type": "integer",
+					"minimum": 1,
+					"maximum": 1000,
 					"description": "Number of trades to return. Default 20, max 1000."
 				}
 			},
@@ -289,6 +294,7 @@ func (t *GetFuturesIncomeTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbol": {
 					"type": "string",
+					"pattern": "^[A-Z0-9]+$",
 					"description": "Trading pair symbol, e.g. \"BTCUSDT\". Optional."
 				},
 				"income_type": {
@@ -298,6 +304,8 @@ func (t *GetFuturesIncomeTool) Definition() llm.ToolDefinition {
 				},
 				"limit": {
 					"type": "integer",
+					"minimum": 1,
+					"maximum": 1000,
 					"description": "Number of records to return. Default 50, max 1000."
 				}
 			}
@@ -0,0 +1,28 @@
+package binance
+
+import (
+	"log/slog"
+
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// Tool groups of the Binance tools.
+const (
+	GroupSpot    = "spot"
+	GroupFutures = "futures"
+)
+
+// Register adds the 3 spot tools backed by spot to the GroupSpot group and
+// the 5 futures tools backed by futures to the GroupFutures group of
+// registry.
+func Register(registry *tools.Registry, spot BinanceClient, futures FuturesClient, logger *slog.Logger) {
+	registry.Register(NewGetBalancesTool(spot, logger), GroupSpot)
+	registry.Register(NewGetPricesTool(spot, logger), GroupSpot)
+	registry.Register(NewGet24hrStatsTool(spot, logger), GroupSpot)
+
+	registry.Register(NewGetFuturesAccountTool(futures, logger), GroupFutures)
+	registry.Register(NewGetFuturesPositionsTool(futures, logger), GroupFutures)
+	registry.Register(NewGetFuturesOpenOrdersTool(futures, logger), GroupFutures)
+	registry.Register(NewGetFuturesTradesTool(futures, logger), GroupFutures)
+	registry.Register(NewGetFuturesIncomeTool(futures, logger), GroupFutures)
+}
@@ -85,7 +85,8 @@ func (t *GetPricesTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbols": {
 					"type": "array",
-					"items": {"type": "string"},
+					"items": {"type": "string", "pattern": "^[A-Z0-9]+$"},
+					"minItems": 1,
 					"description": "List of trading pair symbols, e.g. [\"BTCUSDT\", \"ETHUSDT\"]. Each must end with the quote asset (usually USDT)."
 				}
 			},
@@ -156,7 +157,8 @@ func (t *Get24hrStatsTool) Definition() llm.ToolDefinition {
 			"properties": {
 				"symbols": {
 					"type": "array",
-					"items": {"type": "string"},
+					"items": {"type": "string", "pattern": "^[A-Z0-9]+$"},
+					"minItems": 1,
 					"description": "List of trading pair symbols, e.g. [\"BTCUSDT\", \"ETHUSDT\"]."
 				}
 			},
@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	bnclient "github.com/pocky-ops-bot/internal/clients/binance"
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	"github.com/pocky-ops-bot/internal/tools"
 )
 
 // mockBinanceClient implements BinanceClient for testing.
@@ -226,3 +228,44 @@ func TestGet24hrStatsTool_Execute_APIError(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+func TestToolSchemas_Validate(t *testing.T) {
+	r := tools.NewRegistry(nil)
+	for _, tool := range []tools.Tool{
+		NewGetBalancesTool(nil, nil),
+		NewGetPricesTool(nil, nil),
+		NewGet24hrStatsTool(nil, nil),
+		NewGetFuturesAccountTool(nil, nil),
+		NewGetFuturesPositionsTool(nil, nil),
+		NewGetFuturesOpenOrdersTool(nil, nil),
+		NewGetFuturesTradesTool(nil, nil),
+		NewGetFuturesIncomeTool(nil, nil),
+	} {
+		r.Register(tool)
+	}
+
+	tests := []struct {
+		tool  string
+		args  string
+		valid bool
+	}{
+		{"get_spot_balances", ``, true},
+		{"get_ticker_prices", `{"symbols":["BTCUSDT","ETHUSDT"]}`, true},
+		{"get_ticker_prices", `{"symbols":[]}`, false},
+		{"get_ticker_prices", `{"symbols":"BTCUSDT"}`, false},
+		{"get_24hr_ticker_stats", `{"symbols":["btcusdt"]}`, false},
+		{"get_futures_positions", `{}`, true},
+		{"get_futures_positions", `{"symbol":"BTC/USDT"}`, false},
+		{"get_futures_open_orders", `{"symbol":"ETHUSDT"}`, true},
+		{"get_futures_trades", `{"limit":10}`, false},
+		{"get_futures_trades", `{"symbol":"BTCUSDT","limit":5000}`, false},
+		{"get_futures_income", `{"income_type":"REALIZED_PNL","limit":100}`, true},
+		{"get_futures_income", `{"income_type":"PNL"}`, false},
+	}
+	for _, tt := range tests {
+		err := r.Validate(llm.ToolCall{Name: tt.tool, Arguments: json.RawMessage(tt.args)})
+		if (err == nil) != tt.valid {
+			t.Errorf("%s %s: error = %v, want valid %v", tt.tool, tt.args, err, tt.valid)
+		}
+	}
+}
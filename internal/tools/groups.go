@@ -0,0 +1,38 @@
+package tools
+
+import "context"
+
+type groupsKey struct{}
+
+// ContextWithGroups returns a context in which only tools of the given
+// groups, and tools without any group, are available. An empty list leaves
+// only the tools without a group.
+func ContextWithGroups(ctx context.Context, groups []string) context.Context {
+	if groups == nil {
+		groups = []string{}
+	}
+	return context.WithValue(ctx, groupsKey{}, groups)
+}
+
+// GroupsFromContext returns the tool groups enabled in ctx. It reports false
+// if ctx does not restrict the tools.
+func GroupsFromContext(ctx context.Context) ([]string, bool) {
+	groups, ok := ctx.Value(groupsKey{}).([]string)
+	return groups, ok
+}
+
+// inGroups reports whether a tool of the given groups is available when the
+// enabled groups are restricted to enabled.
+func inGroups(groups, enabled []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, e := range enabled {
+			if group == e {
+				return true
+			}
+		}
+	}
+	return false
+}
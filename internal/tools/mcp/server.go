@@ -0,0 +1,292 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	mcpclient "github.com/pocky-ops-bot/internal/clients/mcp"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// supportedVersions are the protocol revisions the server accepts from a
+// client. They do not differ in the tools subset it implements.
+var supportedVersions = map[string]bool{
+	mcpclient.ProtocolVersion: true,
+	"2024-11-05":              true,
+}
+
+// maxRequestSize bounds one newline-delimited message from the client.
+const maxRequestSize = 16 << 20
+
+// ToolSet is the set of tools served, implemented by tools.Registry.
+// Defined at the consumer side for testability.
+type ToolSet interface {
+	Definitions() []llm.ToolDefinition
+	Execute(ctx context.Context, call llm.ToolCall) tools.ToolResult
+}
+
+// Server serves a ToolSet to MCP clients over stdio: newline-delimited
+// JSON-RPC messages on its input and output. Other requests are answered in
+// order; tool calls run concurrently and can be cancelled by the client.
+type Server struct {
+	tools        ToolSet
+	info         mcpclient.Implementation
+	instructions string
+	logger       *slog.Logger
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc // in-flight calls by request ID
+}
+
+// ServerOption is a functional option for configuring the Server.
+type ServerOption func(*Server)
+
+// WithServerInfo sets the name and version the server announces.
+func WithServerInfo(name, version string) ServerOption {
+	return func(s *Server) {
+		s.info = mcpclient.Implementation{Name: name, Version: version}
+	}
+}
+
+// WithInstructions sets the usage hints sent to clients on initialize.
+func WithInstructions(instructions string) ServerOption {
+	return func(s *Server) {
+		s.instructions = instructions
+	}
+}
+
+// NewServer creates a server for set. If logger is nil, slog.Default() is
+// used; it must not write to the server's output.
+func NewServer(set ToolSet, logger *slog.Logger, opts ...ServerOption) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Server{
+		tools:   set,
+		info:    mcpclient.Implementation{Name: "pocky-ops-bot", Version: "1.0.0"},
+		logger:  logger,
+		running: make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Serve reads messages from in and writes responses to out until in is
+// closed or ctx is done, then waits for the calls still running.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxRequestSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("mcp: read: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var msg mcpclient.Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				s.reply(json.RawMessage("null"), nil, &mcpclient.RPCError{Code: mcpclient.CodeParseError, Message: "parse error"})
+				continue
+			}
+			switch {
+			case msg.IsRequest() && msg.Method == "tools/call":
+				// Tool calls may be slow: run them aside so the client
+				// can cancel them and keep using the session
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.handleRequest(ctx, &msg)
+				}()
+			case msg.IsRequest():
+				s.handleRequest(ctx, &msg)
+			case msg.IsNotification():
+				s.handleNotification(&msg)
+			}
+			// Responses are not expected: the server sends no requests
+		}
+	}
+}
+
+// handleRequest answers one request.
+func (s *Server) handleRequest(ctx context.Context, req *mcpclient.Message) {
+	var (
+		result interface{}
+		rpcErr *mcpclient.RPCError
+	)
+	switch req.Method {
+	case "initialize":
+		result, rpcErr = s.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = s.listTools()
+	case "tools/call":
+		result, rpcErr = s.callTool(ctx, req)
+	default:
+		rpcErr = &mcpclient.RPCError{Code: mcpclient.CodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	s.reply(req.ID, result, rpcErr)
+}
+
+// handleNotification handles a notification; only cancellation matters.
+func (s *Server) handleNotification(msg *mcpclient.Message) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.running[string(params.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		s.logger.Info("mcp tool call cancelled by client", slog.String("request_id", string(params.RequestID)))
+		cancel()
+	}
+}
+
+// initialize accepts the client's protocol version if supported, otherwise
+// proposes the latest one.
+func (s *Server) initialize(raw json.RawMessage) (interface{}, *mcpclient.RPCError) {
+	var params mcpclient.InitializeParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &mcpclient.RPCError{Code: mcpclient.CodeInvalidParams, Message: "invalid initialize params"}
+	}
+	version := mcpclient.ProtocolVersion
+	if supportedVersions[params.ProtocolVersion] {
+		version = params.ProtocolVersion
+	}
+	s.logger.Info("mcp client connected",
+		slog.String("client", params.ClientInfo.Name),
+		slog.String("client_version", params.ClientInfo.Version),
+		slog.String("protocol", version),
+	)
+	return mcpclient.InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    json.RawMessage(`{"tools":{}}`),
+		ServerInfo:      s.info,
+		Instructions:    s.instructions,
+	}, nil
+}
+
+// listTools returns every tool in one page.
+func (s *Server) listTools() mcpclient.ListToolsResult {
+	defs := s.tools.Definitions()
+	list := make([]mcpclient.Tool, 0, len(defs))
+	for _, def := range defs {
+		list = append(list, ToMCPTool(def))
+	}
+	return mcpclient.ListToolsResult{Tools: list}
+}
+
+// callTool runs a tool. A tool that fails, including on invalid arguments,
+// yields a result with IsError set so the client's model can react; only an
+// unknown tool is a protocol error.
+func (s *Server) callTool(ctx context.Context, req *mcpclient.Message) (interface{}, *mcpclient.RPCError) {
+	var params mcpclient.CallToolParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Name == "" {
+		return nil, &mcpclient.RPCError{Code: mcpclient.CodeInvalidParams, Message: "invalid tools/call params"}
+	}
+	if !s.hasTool(params.Name) {
+		return nil, &mcpclient.RPCError{Code: mcpclient.CodeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	id := string(req.ID)
+	s.mu.Lock()
+	s.running[id] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	result := s.tools.Execute(ctx, llm.ToolCall{ID: id, Name: params.Name, Arguments: params.Arguments})
+	return mcpclient.TextResult(result.Content, result.IsError), nil
+}
+
+func (s *Server) hasTool(name string) bool {
+	for _, def := range s.tools.Definitions() {
+		if def.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reply writes the response to the request id.
+func (s *Server) reply(id json.RawMessage, result interface{}, rpcErr *mcpclient.RPCError) {
+	resp := mcpclient.Message{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &mcpclient.RPCError{Code: mcpclient.CodeInternalError, Message: "encode result: " + err.Error()}
+		} else {
+			resp.Result = raw
+		}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Error("mcp failed to encode response", slog.String("error", err.Error()))
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		s.logger.Error("mcp failed to write response", slog.String("error", err.Error()))
+	}
+}
+
+// ToMCPTool translates a tool definition to its MCP form. MCP requires an
+// object input schema, so a tool without parameters gets an empty one.
+func ToMCPTool(def llm.ToolDefinition) mcpclient.Tool {
+	schema := def.Parameters
+	if len(bytes.TrimSpace(schema)) == 0 || bytes.Equal(bytes.TrimSpace(schema), []byte("null")) {
+		schema = emptySchema
+	}
+	return mcpclient.Tool{Name: def.Name, Description: def.Description, InputSchema: schema}
+}
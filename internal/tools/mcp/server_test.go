@@ -0,0 +1,262 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	mcpclient "github.com/pocky-ops-bot/internal/clients/mcp"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// blockingTool runs until its context is cancelled.
+type blockingTool struct {
+	started chan struct{}
+}
+
+func (b *blockingTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{Name: "wait", Description: "Waits forever"}
+}
+
+func (b *blockingTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	close(b.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// echoTool returns its arguments, or fails when asked to.
+type echoTool struct{}
+
+func (echoTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "echo",
+		Description: "Echoes its arguments",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"},"fail":{"type":"boolean"}},"required":["text"]}`),
+	}
+}
+
+func (echoTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Text string `json:"text"`
+		Fail bool   `json:"fail"`
+	}
+	_ = json.Unmarshal(arguments, &args)
+	if args.Fail {
+		return "", errors.New("echo failed: " + args.Text)
+	}
+	return args.Text, nil
+}
+
+// serve runs a server over the given input lines and returns its responses
+// by request ID.
+func serve(t *testing.T, set ToolSet, lines ...string) map[string]mcpclient.Message {
+	t.Helper()
+	var out strings.Builder
+	server := NewServer(set, nil, WithServerInfo("test-server", "0.1"), WithInstructions("be nice"))
+	if err := server.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	responses := make(map[string]mcpclient.Message)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var msg mcpclient.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid response %q: %v", line, err)
+		}
+		responses[string(msg.ID)] = msg
+	}
+	return responses
+}
+
+func newTestRegistry() *tools.Registry {
+	registry := tools.NewRegistry(nil)
+	registry.Register(echoTool{})
+	return registry
+}
+
+func decodeResult(t *testing.T, msg mcpclient.Message, out interface{}) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("response %s error = %v", msg.ID, msg.Error)
+	}
+	if err := json.Unmarshal(msg.Result, out); err != nil {
+		t.Fatalf("response %s result: %v", msg.ID, err)
+	}
+}
+
+func TestServer_Initialize(t *testing.T) {
+	responses := serve(t, newTestRegistry(),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"desktop","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01","capabilities":{},"clientInfo":{"name":"old","version":"1"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"ping"}`,
+	)
+	if len(responses) != 3 {
+		t.Fatalf("got %d responses, want 3 (none for the notification)", len(responses))
+	}
+
+	var result mcpclient.InitializeResult
+	decodeResult(t, responses["1"], &result)
+	if result.ProtocolVersion != "2024-11-05" {
+		t.Errorf("ProtocolVersion = %q, want the client's supported version", result.ProtocolVersion)
+	}
+	if result.ServerInfo.Name != "test-server" || result.Instructions != "be nice" {
+		t.Errorf("InitializeResult = %+v", result)
+	}
+	if !strings.Contains(string(result.Capabilities), `"tools"`) {
+		t.Errorf("Capabilities = %s, want tools", result.Capabilities)
+	}
+
+	decodeResult(t, responses["2"], &result)
+	if result.ProtocolVersion != mcpclient.ProtocolVersion {
+		t.Errorf("ProtocolVersion = %q for an unsupported version, want %q", result.ProtocolVersion, mcpclient.ProtocolVersion)
+	}
+
+	if string(responses["3"].Result) != "{}" {
+		t.Errorf("ping result = %s, want {}", responses["3"].Result)
+	}
+}
+
+func TestServer_ListTools(t *testing.T) {
+	registry := newTestRegistry()
+	registry.Register(&blockingTool{})
+	responses := serve(t, registry, `{"jsonrpc":"2.0","id":"a","method":"tools/list"}`)
+
+	var result mcpclient.ListToolsResult
+	decodeResult(t, responses[`"a"`], &result)
+	if len(result.Tools) != 2 {
+		t.Fatalf("got %d tools, want 2", len(result.Tools))
+	}
+	byName := make(map[string]mcpclient.Tool)
+	for _, tool := range result.Tools {
+		byName[tool.Name] = tool
+	}
+	echo := byName["echo"]
+	if echo.Description != "Echoes its arguments" || string(echo.InputSchema) != string(echoTool{}.Definition().Parameters) {
+		t.Errorf("echo = %+v, want its definition", echo)
+	}
+	if got := string(byName["wait"].InputSchema); got != string(emptySchema) {
+		t.Errorf("wait schema = %s, want an empty object schema", got)
+	}
+}
+
+func TestServer_CallTool(t *testing.T) {
+	responses := serve(t, newTestRegistry(),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"boom","fail":true}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"missing"}}`,
+	)
+
+	var result mcpclient.CallToolResult
+	decodeResult(t, responses["1"], &result)
+	if result.IsError || result.Text() != "hi" {
+		t.Errorf("echo = %+v, want hi", result)
+	}
+
+	// A failing tool is a result with isError, not a protocol error
+	result = mcpclient.CallToolResult{}
+	decodeResult(t, responses["2"], &result)
+	if !result.IsError || result.Text() != "echo failed: boom" {
+		t.Errorf("failing echo = %+v, want isError with the message", result)
+	}
+
+	// So are arguments the registry rejects
+	result = mcpclient.CallToolResult{}
+	decodeResult(t, responses["3"], &result)
+	if !result.IsError || !strings.Contains(result.Text(), "text: is required") {
+		t.Errorf("invalid echo = %+v, want isError with the validation issues", result)
+	}
+
+	if err := responses["4"].Error; err == nil || err.Code != mcpclient.CodeInvalidParams {
+		t.Errorf("unknown tool error = %v, want code %d", err, mcpclient.CodeInvalidParams)
+	}
+}
+
+func TestServer_ProtocolErrors(t *testing.T) {
+	responses := serve(t, newTestRegistry(),
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":"oops"}`,
+	)
+	if err := responses["null"].Error; err == nil || err.Code != mcpclient.CodeParseError {
+		t.Errorf("parse error = %v, want code %d", err, mcpclient.CodeParseError)
+	}
+	if err := responses["1"].Error; err == nil || err.Code != mcpclient.CodeMethodNotFound {
+		t.Errorf("unknown method error = %v, want code %d", err, mcpclient.CodeMethodNotFound)
+	}
+	if err := responses["2"].Error; err == nil || err.Code != mcpclient.CodeInvalidParams {
+		t.Errorf("bad params error = %v, want code %d", err, mcpclient.CodeInvalidParams)
+	}
+}
+
+func TestServer_CancelledCall(t *testing.T) {
+	tool := &blockingTool{started: make(chan struct{})}
+	registry := tools.NewRegistry(nil)
+	registry.Register(tool)
+
+	in, input := io.Pipe()
+	output, out := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(registry, nil).Serve(context.Background(), in, out)
+		out.Close()
+	}()
+
+	io.WriteString(input, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"wait"}}`+"\n")
+	select {
+	case <-tool.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("tool was not called")
+	}
+	io.WriteString(input, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user"}}`+"\n")
+
+	reader := bufio.NewReader(output)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	var resp mcpclient.Message
+	var result mcpclient.CallToolResult
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", line, err)
+	}
+	decodeResult(t, resp, &result)
+	if !result.IsError || !strings.Contains(result.Text(), "canceled") {
+		t.Errorf("cancelled call = %+v, want isError", result)
+	}
+
+	input.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+}
+
+func TestServer_ContextCancelled(t *testing.T) {
+	in, input := io.Pipe()
+	defer input.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(newTestRegistry(), nil).Serve(ctx, in, io.Discard)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Serve() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve() did not stop on cancel")
+	}
+}
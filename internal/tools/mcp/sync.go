@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// SessionLister is a ToolLister that reports each new session with its
+// server, after which the server's tools may have changed.
+type SessionLister interface {
+	ToolLister
+	Sessions() <-chan struct{}
+}
+
+// Sync keeps the tools of the server behind client registered in registry
+// until ctx is done, in groups as for Register. It lists and registers them
+// in the background, retrying with backoff until the server answers, so a
+// server that is down at startup joins once it is up. After every new
+// session it lists them again: new and changed tools are registered and the
+// ones the server dropped are removed.
+func Sync(ctx context.Context, registry *tools.Registry, client SessionLister, groups []string, logger *slog.Logger) {
+	syncTools(ctx, registry, client, groups, logger, time.Second, time.Minute)
+}
+
+// syncTools is Sync with the retry backoff doubling from minBackoff up to
+// maxBackoff.
+func syncTools(ctx context.Context, registry *tools.Registry, client SessionLister, groups []string, logger *slog.Logger, minBackoff, maxBackoff time.Duration) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if len(groups) == 0 {
+		groups = []string{client.Name()}
+	}
+
+	registered := make(map[string]string) // name -> tool as listed
+	backoff := minBackoff
+	for {
+		err := syncOnce(ctx, registry, client, groups, registered, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warn("mcp tools unavailable, retrying",
+				slog.String("server", client.Name()),
+				slog.String("error", err.Error()),
+				slog.Duration("retry_in", backoff),
+			)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		backoff = minBackoff
+		select {
+		case <-client.Sessions():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// syncOnce lists the server's tools and brings registry in line with them.
+// registered holds the tools registered by the previous run; tools that did
+// not change are left alone.
+func syncOnce(ctx context.Context, registry *tools.Registry, client ToolLister, groups []string, registered map[string]string, logger *slog.Logger) error {
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		return fmt.Errorf("mcp: list tools of %s: %w", client.Name(), err)
+	}
+	adapters, err := newTools(client, list, logger)
+	if err != nil {
+		return err
+	}
+
+	added, removed := 0, 0
+	listed := make(map[string]bool, len(adapters))
+	for _, adapter := range adapters {
+		listed[adapter.name] = true
+		raw, _ := json.Marshal(adapter.tool)
+		if registered[adapter.name] == string(raw) {
+			continue
+		}
+		registry.Register(adapter, groups...)
+		registered[adapter.name] = string(raw)
+		added++
+	}
+	for name := range registered {
+		if !listed[name] {
+			registry.Unregister(name)
+			delete(registered, name)
+			removed++
+		}
+	}
+
+	if added > 0 || removed > 0 {
+		logger.Info("mcp tools registered",
+			slog.String("server", client.Name()),
+			slog.Int("tools", len(adapters)),
+			slog.Int("updated", added),
+			slog.Int("removed", removed),
+			slog.Any("groups", groups),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mcpclient "github.com/pocky-ops-bot/internal/clients/mcp"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// syncServer implements SessionLister with tools tests change while Sync
+// runs.
+type syncServer struct {
+	sessions chan struct{}
+	lists    chan struct{}
+
+	mu      sync.Mutex
+	tools   []mcpclient.Tool
+	listErr error
+}
+
+func (s *syncServer) Name() string {
+	return "files"
+}
+
+func (s *syncServer) Sessions() <-chan struct{} {
+	return s.sessions
+}
+
+func (s *syncServer) ListTools(ctx context.Context) ([]mcpclient.Tool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.lists <- struct{}{}:
+	default:
+	}
+	return s.tools, s.listErr
+}
+
+func (s *syncServer) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*mcpclient.CallToolResult, error) {
+	return mcpclient.TextResult(name, false), nil
+}
+
+func (s *syncServer) set(tools []mcpclient.Tool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools, s.listErr = tools, err
+}
+
+// definitions returns the registry's tools as "name:description" pairs.
+func definitions(registry *tools.Registry) string {
+	var defs []string
+	for _, def := range registry.Definitions() {
+		defs = append(defs, def.Name+":"+def.Description)
+	}
+	return strings.Join(defs, ",")
+}
+
+// waitForDefinitions waits until the registry holds want.
+func waitForDefinitions(t *testing.T, registry *tools.Registry, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for definitions(registry) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("definitions = %q, want %q", definitions(registry), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSync(t *testing.T) {
+	server := &syncServer{
+		sessions: make(chan struct{}, 1),
+		lists:    make(chan struct{}, 1),
+		listErr:  errors.New("server starting"),
+	}
+	registry := tools.NewRegistry(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		syncTools(ctx, registry, server, nil, nil, time.Millisecond, 4*time.Millisecond)
+		close(done)
+	}()
+
+	// A server that is not up yet is asked again
+	<-server.lists
+	<-server.lists
+	if defs := registry.Definitions(); len(defs) != 0 {
+		t.Fatalf("registry has %d tools before the server answered", len(defs))
+	}
+	server.set([]mcpclient.Tool{{Name: "read", Description: "Read"}, {Name: "list", Description: "List"}}, nil)
+	waitForDefinitions(t, registry, "files__list:[files] List,files__read:[files] Read")
+
+	// After a reconnect the tools are listed again
+	server.set([]mcpclient.Tool{{Name: "read", Description: "Read a file"}, {Name: "write", Description: "Write"}}, nil)
+	server.sessions <- struct{}{}
+	waitForDefinitions(t, registry, "files__read:[files] Read a file,files__write:[files] Write")
+	if groups := registry.Groups(); len(groups) != 1 || groups[0] != "files" {
+		t.Errorf("Groups() = %v, want the server name", groups)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sync did not return after the context was cancelled")
+	}
+}
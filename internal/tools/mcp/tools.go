@@ -0,0 +1,190 @@
+// Package mcp bridges tools and the Model Context Protocol: it adapts the
+// tools of MCP servers to tools.Tool, so the AI can call them like the
+// built-in tools, and serves a tools.Registry to MCP clients.
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	mcpclient "github.com/pocky-ops-bot/internal/clients/mcp"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// maxNameLength is the longest tool name all LLM providers accept.
+const maxNameLength = 64
+
+// emptySchema stands in for a missing parameter schema.
+var emptySchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// ToolCaller calls tools on one MCP server.
+// Defined at the consumer side for testability.
+type ToolCaller interface {
+	CallTool(ctx context.Context, name string, arguments json.RawMessage) (*mcpclient.CallToolResult, error)
+}
+
+// ToolLister lists the tools of one MCP server.
+type ToolLister interface {
+	ToolCaller
+	Name() string
+	ListTools(ctx context.Context) ([]mcpclient.Tool, error)
+}
+
+// Tool is one tool of an MCP server. Its name is prefixed with the server's,
+// so tools of different servers cannot collide with each other or with the
+// built-in tools.
+type Tool struct {
+	client ToolCaller
+	server string
+	tool   mcpclient.Tool
+	name   string
+	logger *slog.Logger
+}
+
+// NewTool creates the adapter for tool of the named server.
+func NewTool(client ToolCaller, server string, tool mcpclient.Tool, logger *slog.Logger) *Tool {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Tool{
+		client: client,
+		server: server,
+		tool:   tool,
+		name:   ToolName(server, tool.Name),
+		logger: logger,
+	}
+}
+
+func (t *Tool) Definition() llm.ToolDefinition {
+	schema := t.tool.InputSchema
+	if len(bytes.TrimSpace(schema)) == 0 || bytes.Equal(bytes.TrimSpace(schema), []byte("null")) {
+		schema = emptySchema
+	}
+	description := t.tool.Description
+	if description == "" {
+		description = t.tool.Name
+	}
+	return llm.ToolDefinition{
+		Name:        t.name,
+		Description: fmt.Sprintf("[%s] %s", t.server, description),
+		Parameters:  schema,
+	}
+}
+
+// Execute calls the tool on its server. A result the server marks as an
+// error is returned as an error carrying its text, so the AI sees it failed.
+func (t *Tool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	t.logger.Debug("calling mcp tool",
+		slog.String("server", t.server),
+		slog.String("tool", t.tool.Name),
+	)
+
+	result, err := t.client.CallTool(ctx, t.tool.Name, arguments)
+	if err != nil {
+		return "", fmt.Errorf("mcp server %s: %w", t.server, err)
+	}
+	text := result.Text()
+	if result.IsError {
+		if text == "" {
+			text = "tool reported an error"
+		}
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+// Register lists the tools of the server behind client and registers an
+// adapter for each in groups, or in a group named after the server if none
+// are given. It returns the number of tools registered.
+func Register(ctx context.Context, registry *tools.Registry, client ToolLister, groups []string, logger *slog.Logger) (int, error) {
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("mcp: list tools of %s: %w", client.Name(), err)
+	}
+	adapters, err := newTools(client, list, logger)
+	if err != nil {
+		return 0, err
+	}
+	if len(groups) == 0 {
+		groups = []string{client.Name()}
+	}
+	for _, adapter := range adapters {
+		registry.Register(adapter, groups...)
+	}
+	return len(adapters), nil
+}
+
+// newTools creates the adapters for the tools of the server behind client.
+// A tool whose name collides with an earlier one of the server once
+// sanitized or shortened, such as two long names sharing their first 64
+// bytes, gets a short hash of its own name appended instead.
+func newTools(client ToolLister, list []mcpclient.Tool, logger *slog.Logger) ([]*Tool, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	adapters := make([]*Tool, 0, len(list))
+	taken := make(map[string]string, len(list)) // registry name -> tool name
+	for _, tool := range list {
+		adapter := NewTool(client, client.Name(), tool, logger)
+		if other, ok := taken[adapter.name]; ok {
+			adapter.name = hashedName(adapter.name, tool.Name)
+			if _, ok := taken[adapter.name]; ok || other == tool.Name {
+				return nil, fmt.Errorf("mcp: tools %q and %q of %s have the same name", other, tool.Name, client.Name())
+			}
+			logger.Warn("mcp tool renamed to avoid a name collision",
+				slog.String("server", client.Name()),
+				slog.String("tool", tool.Name),
+				slog.String("collides_with", other),
+				slog.String("name", adapter.name),
+			)
+		}
+		taken[adapter.name] = tool.Name
+		adapters = append(adapters, adapter)
+	}
+	return adapters, nil
+}
+
+// ToolName returns the registry name of a server's tool: "<server>__<tool>",
+// reduced to the characters and length every provider accepts.
+func ToolName(server, tool string) string {
+	name := sanitize(server) + "__" + sanitize(tool)
+	if name[0] >= '0' && name[0] <= '9' || name[0] == '-' {
+		name = "_" + name
+	}
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	return name
+}
+
+// hashedName makes name unique by appending a short hash of the tool's own
+// name, shortening name to keep within the length limit.
+func hashedName(name, tool string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tool))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	if len(name) > maxNameLength-len(suffix) {
+		name = name[:maxNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// sanitize replaces characters outside [A-Za-z0-9_-] with underscores.
+// LoadConfig of clients/mcp rejects server names that are the same once
+// sanitized.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
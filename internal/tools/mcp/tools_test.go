@@ -0,0 +1,219 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+	mcpclient "github.com/pocky-ops-bot/internal/clients/mcp"
+	"github.com/pocky-ops-bot/internal/tools"
+)
+
+// mockServer implements ToolLister with canned tools and results.
+type mockServer struct {
+	name     string
+	tools    []mcpclient.Tool
+	listErr  error
+	result   *mcpclient.CallToolResult
+	callErr  error
+	lastName string
+	lastArgs json.RawMessage
+}
+
+func (m *mockServer) Name() string {
+	return m.name
+}
+
+func (m *mockServer) ListTools(ctx context.Context) ([]mcpclient.Tool, error) {
+	return m.tools, m.listErr
+}
+
+func (m *mockServer) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*mcpclient.CallToolResult, error) {
+	m.lastName = name
+	m.lastArgs = arguments
+	return m.result, m.callErr
+}
+
+func TestToolName(t *testing.T) {
+	tests := []struct {
+		server, tool, want string
+	}{
+		{"github", "create_issue", "github__create_issue"},
+		{"my server", "get.file", "my_server__get_file"},
+		{"1password", "read", "_1password__read"},
+		{"-x", "y", "_-x__y"},
+		{"srv", strings.Repeat("a", 80), "srv__" + strings.Repeat("a", 59)},
+	}
+	for _, tt := range tests {
+		if got := ToolName(tt.server, tt.tool); got != tt.want {
+			t.Errorf("ToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestTool_Definition(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object","properties":{"q":{"type":"string"}}}`)
+	tool := NewTool(&mockServer{}, "web", mcpclient.Tool{Name: "search", Description: "Search the web", InputSchema: schema}, nil)
+
+	def := tool.Definition()
+	if def.Name != "web__search" {
+		t.Errorf("Name = %q, want web__search", def.Name)
+	}
+	if def.Description != "[web] Search the web" {
+		t.Errorf("Description = %q", def.Description)
+	}
+	if string(def.Parameters) != string(schema) {
+		t.Errorf("Parameters = %s, want %s", def.Parameters, schema)
+	}
+
+	// A tool without schema or description still gets valid ones
+	def = NewTool(&mockServer{}, "web", mcpclient.Tool{Name: "now"}, nil).Definition()
+	if def.Description != "[web] now" || string(def.Parameters) != `{"type":"object","properties":{}}` {
+		t.Errorf("Definition() = %+v", def)
+	}
+}
+
+func TestTool_Execute(t *testing.T) {
+	server := &mockServer{result: mcpclient.TextResult("found 3 pages", false)}
+	tool := NewTool(server, "web", mcpclient.Tool{Name: "search"}, nil)
+
+	got, err := tool.Execute(context.Background(), json.RawMessage(`{"q":"btc"}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got != "found 3 pages" {
+		t.Errorf("Execute() = %q", got)
+	}
+	if server.lastName != "search" || string(server.lastArgs) != `{"q":"btc"}` {
+		t.Errorf("called %s with %s, want search with the arguments", server.lastName, server.lastArgs)
+	}
+}
+
+func TestTool_ExecuteErrors(t *testing.T) {
+	// A result the server marks as an error fails the tool with its text
+	server := &mockServer{result: mcpclient.TextResult("rate limited", true)}
+	tool := NewTool(server, "web", mcpclient.Tool{Name: "search"}, nil)
+	if _, err := tool.Execute(context.Background(), nil); err == nil || err.Error() != "rate limited" {
+		t.Errorf("Execute() error = %v, want rate limited", err)
+	}
+
+	// Connection failures name the server
+	server = &mockServer{callErr: errors.New("connection refused")}
+	tool = NewTool(server, "web", mcpclient.Tool{Name: "search"}, nil)
+	if _, err := tool.Execute(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "mcp server web") {
+		t.Errorf("Execute() error = %v, want it to name the server", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	server := &mockServer{
+		name: "files",
+		tools: []mcpclient.Tool{
+			{Name: "read", InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}`)},
+			{Name: "list"},
+		},
+		result: mcpclient.TextResult("hello", false),
+	}
+	registry := tools.NewRegistry(nil)
+
+	n, err := Register(context.Background(), registry, server, nil, nil)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if n != 2 || len(registry.Definitions()) != 2 {
+		t.Fatalf("Register() = %d, registry has %d tools; want 2", n, len(registry.Definitions()))
+	}
+	if groups := registry.Groups(); len(groups) != 1 || groups[0] != "files" {
+		t.Errorf("Groups() = %v, want the server name", groups)
+	}
+
+	// The server's schema is enforced by the registry before the call
+	result := registry.Execute(context.Background(), llm.ToolCall{ID: "1", Name: "files__read", Arguments: json.RawMessage(`{}`)})
+	if !result.IsError || server.lastName != "" {
+		t.Errorf("Execute() without path = %+v, want validation error and no call", result)
+	}
+	result = registry.Execute(context.Background(), llm.ToolCall{ID: "2", Name: "files__read", Arguments: json.RawMessage(`{"path":"a.txt"}`)})
+	if result.IsError || result.Content != "hello" || server.lastName != "read" {
+		t.Errorf("Execute() = %+v, want hello from read", result)
+	}
+}
+
+func TestRegister_Groups(t *testing.T) {
+	server := &mockServer{name: "github", tools: []mcpclient.Tool{{Name: "create_issue"}}}
+	registry := tools.NewRegistry(nil)
+
+	if _, err := Register(context.Background(), registry, server, []string{"ops", "dev"}, nil); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got := strings.Join(registry.Groups(), ","); got != "dev,ops" {
+		t.Errorf("Groups() = %s, want dev,ops", got)
+	}
+	ctx := tools.ContextWithGroups(context.Background(), []string{"spot"})
+	if defs := registry.DefinitionsFor(ctx); len(defs) != 0 {
+		t.Errorf("DefinitionsFor(spot) = %v, want none", defs)
+	}
+}
+
+func TestRegister_ListError(t *testing.T) {
+	server := &mockServer{name: "down", listErr: errors.New("timeout")}
+	registry := tools.NewRegistry(nil)
+
+	if _, err := Register(context.Background(), registry, server, []string{"ops"}, nil); err == nil {
+		t.Fatal("Register() error = nil, want list failure")
+	}
+	if len(registry.Definitions()) != 0 {
+		t.Errorf("registry has %d tools, want 0", len(registry.Definitions()))
+	}
+}
+
+func TestRegister_NameCollisions(t *testing.T) {
+	long := strings.Repeat("a", 80)
+	server := &mockServer{
+		name: "srv",
+		tools: []mcpclient.Tool{
+			{Name: long + "_read"},
+			{Name: long + "_write"},
+			{Name: "get.file"},
+			{Name: "get_file"},
+		},
+		result: mcpclient.TextResult("ok", false),
+	}
+	registry := tools.NewRegistry(nil)
+
+	n, err := Register(context.Background(), registry, server, nil, nil)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defs := registry.Definitions()
+	if n != 4 || len(defs) != 4 {
+		t.Fatalf("Register() = %d, registry has %d tools; want 4", n, len(defs))
+	}
+	for _, def := range defs {
+		if len(def.Name) > maxNameLength {
+			t.Errorf("name %q longer than %d", def.Name, maxNameLength)
+		}
+	}
+
+	// The first tool of each pair keeps its plain name, and each name
+	// reaches its own tool
+	for _, tt := range []struct{ name, tool string }{
+		{ToolName("srv", long+"_read"), long + "_read"},
+		{hashedName(ToolName("srv", long+"_write"), long+"_write"), long + "_write"},
+		{"srv__get_file", "get.file"},
+		{hashedName("srv__get_file", "get_file"), "get_file"},
+	} {
+		result := registry.Execute(context.Background(), llm.ToolCall{ID: "1", Name: tt.name, Arguments: json.RawMessage(`{}`)})
+		if result.IsError || server.lastName != tt.tool {
+			t.Errorf("Execute(%q) = %+v, called %q; want %q", tt.name, result, server.lastName, tt.tool)
+		}
+	}
+
+	// A server listing the same tool twice cannot be told apart
+	server.tools = []mcpclient.Tool{{Name: "read"}, {Name: "read"}}
+	if _, err := Register(context.Background(), tools.NewRegistry(nil), server, nil, nil); err == nil {
+		t.Error("Register() with duplicate tools error = nil")
+	}
+}
@@ -1,18 +1,30 @@
 package tools
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/pocky-ops-bot/internal/clients/llm"
 )
 
 // Registry holds all available tools indexed by name.
+// Tools are listed sorted by name, whatever the order they were registered
+// in, so the tool list sent to the LLM is the same on every run. Tools may be
+// added and removed while
+// it is in use, as MCP servers come and go; it is safe for concurrent use.
 type Registry struct {
-	tools  map[string]Tool
-	logger *slog.Logger
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	order   []string            // tool names, sorted
+	groups  map[string][]string // tool groups by tool name
+	schemas map[string]*schema  // compiled parameter schemas, nil if invalid
+	logger  *slog.Logger
 }
 
 // NewRegistry creates a new Registry with the given logger.
@@ -22,37 +34,163 @@ func NewRegistry(logger *slog.Logger) *Registry {
 		logger = slog.Default()
 	}
 	return &Registry{
-		tools:  make(map[string]Tool),
-		logger: logger,
+		tools:   make(map[string]Tool),
+		groups:  make(map[string][]string),
+		schemas: make(map[string]*schema),
+		logger:  logger,
 	}
 }
 
-// Register adds a tool to the registry indexed by its definition name.
-func (r *Registry) Register(tool Tool) {
-	name := tool.Definition().Name
-	r.tools[name] = tool
-	r.logger.Info("tool registered", slog.String("name", name))
+// Register adds a tool to the registry indexed by its definition name, as a
+// member of groups (e.g. "spot", "futures"). A tool without groups is
+// available in every conversation. Registering a name again replaces the
+// tool in place.
+// Its parameter schema is compiled once here; a tool whose schema cannot be
+// compiled is still registered, but its arguments are not validated.
+func (r *Registry) Register(tool Tool, groups ...string) {
+	def := tool.Definition()
+	s, err := compileSchema(def.Parameters)
+
+	r.mu.Lock()
+	if _, ok := r.tools[def.Name]; !ok {
+		i := sort.SearchStrings(r.order, def.Name)
+		r.order = append(r.order[:i:i], append([]string{def.Name}, r.order[i:]...)...)
+	}
+	r.tools[def.Name] = tool
+	r.groups[def.Name] = groups
+	r.schemas[def.Name] = s
+	r.mu.Unlock()
+
+	if err != nil {
+		r.logger.Warn("tool schema ignored, arguments will not be validated",
+			slog.String("name", def.Name),
+			slog.String("error", err.Error()),
+		)
+	}
+	r.logger.Info("tool registered",
+		slog.String("name", def.Name),
+		slog.Any("groups", groups),
+	)
+}
+
+// Unregister removes the named tool and reports whether it was registered.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tools[name]; !ok {
+		return false
+	}
+	delete(r.tools, name)
+	delete(r.groups, name)
+	delete(r.schemas, name)
+	i := sort.SearchStrings(r.order, name)
+	r.order = append(r.order[:i:i], r.order[i+1:]...)
+	r.logger.Info("tool unregistered", slog.String("name", name))
+	return true
 }
 
-// Definitions returns a slice of all tool definitions (for sending to the LLM).
+// Definitions returns the definitions of all tools sorted by name (for
+// sending to the LLM).
 func (r *Registry) Definitions() []llm.ToolDefinition {
-	defs := make([]llm.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
-		defs = append(defs, tool.Definition())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]llm.ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		defs = append(defs, r.tools[name].Definition())
 	}
 	return defs
 }
 
+// DefinitionsFor returns the definitions of the tools available under ctx,
+// which may restrict them to some groups (see ContextWithGroups), sorted by
+// name.
+func (r *Registry) DefinitionsFor(ctx context.Context) []llm.ToolDefinition {
+	enabled, restricted := GroupsFromContext(ctx)
+	if !restricted {
+		return r.Definitions()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]llm.ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		if inGroups(r.groups[name], enabled) {
+			defs = append(defs, r.tools[name].Definition())
+		}
+	}
+	return defs
+}
+
+// Groups returns the names of all tool groups, sorted.
+func (r *Registry) Groups() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var groups []string
+	for _, name := range r.order {
+		for _, group := range r.groups[name] {
+			if !seen[group] {
+				seen[group] = true
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
 // Get looks up a tool by name.
 func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	tool, ok := r.tools[name]
 	return tool, ok
 }
 
+// Validate checks the arguments of a call against the tool's parameter
+// schema. Missing arguments count as an empty object. A failed check returns
+// a *ValidationError.
+func (r *Registry) Validate(call llm.ToolCall) error {
+	r.mu.RLock()
+	s := r.schemas[call.Name]
+	r.mu.RUnlock()
+	return validate(s, call)
+}
+
+// validate checks the arguments of call against s, if the tool has one.
+func validate(s *schema, call llm.ToolCall) error {
+	if s == nil {
+		return nil
+	}
+	if issues := s.validate(normalizeArguments(call.Arguments)); len(issues) > 0 {
+		return &ValidationError{Tool: call.Name, Issues: issues}
+	}
+	return nil
+}
+
+// normalizeArguments turns missing arguments, which models send for tools
+// without parameters, into an empty object.
+func normalizeArguments(arguments json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(arguments)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return json.RawMessage(`{}`)
+	}
+	return arguments
+}
+
 // Execute runs a tool call and returns the result.
-// If the tool is not found, it returns a ToolResult with IsError set to true.
+// If the tool is not found, not available under ctx, or the arguments do not
+// match its schema, it returns a ToolResult with IsError set to true,
+// explaining the problem so the model can correct the call.
 func (r *Registry) Execute(ctx context.Context, call llm.ToolCall) ToolResult {
+	r.mu.RLock()
 	tool, ok := r.tools[call.Name]
+	groups, s := r.groups[call.Name], r.schemas[call.Name]
+	r.mu.RUnlock()
 	if !ok {
 		return ToolResult{
 			CallID:  call.ID,
@@ -60,6 +198,31 @@ func (r *Registry) Execute(ctx context.Context, call llm.ToolCall) ToolResult {
 			Content: fmt.Sprintf("unknown tool: %s", call.Name),
 		}
 	}
+	if enabled, restricted := GroupsFromContext(ctx); restricted && !inGroups(groups, enabled) {
+		r.logger.Warn("tool not enabled in this conversation",
+			slog.String("name", call.Name),
+			slog.String("call_id", call.ID),
+		)
+		return ToolResult{
+			CallID:  call.ID,
+			IsError: true,
+			Content: fmt.Sprintf("tool %s is not enabled in this conversation", call.Name),
+		}
+	}
+
+	if err := validate(s, call); err != nil {
+		r.logger.Warn("tool arguments rejected",
+			slog.String("name", call.Name),
+			slog.String("call_id", call.ID),
+			slog.String("error", err.Error()),
+		)
+		return ToolResult{
+			CallID:  call.ID,
+			IsError: true,
+			Content: err.Error(),
+		}
+	}
+	call.Arguments = normalizeArguments(call.Arguments)
 
 	r.logger.Info("executing tool",
 		slog.String("name", call.Name),
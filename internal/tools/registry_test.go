@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/pocky-ops-bot/internal/clients/llm"
@@ -97,7 +98,7 @@ func TestRegistry_Definitions(t *testing.T) {
 		t.Fatalf("expected 2 definitions, got %d", len(defs))
 	}
 
-	// Collect names (order is not guaranteed)
+	// Collect names
 	names := make(map[string]bool)
 	for _, d := range defs {
 		names[d.Name] = true
@@ -111,6 +112,123 @@ func TestRegistry_Definitions(t *testing.T) {
 	}
 }
 
+func TestRegistry_Definitions_Order(t *testing.T) {
+	r := NewRegistry(nil)
+	for _, name := range []string{"zeta", "alpha", "mu", "beta"} {
+		r.Register(newMockTool(name, name, "", nil))
+	}
+	// Registering a name again replaces the tool
+	r.Register(newMockTool("alpha", "Alpha v2", "", nil))
+
+	// Another registration order gives the same list
+	other := NewRegistry(nil)
+	for _, name := range []string{"beta", "mu", "alpha", "zeta"} {
+		other.Register(newMockTool(name, name, "", nil))
+	}
+	// A tool that leaves and comes back, like one of a reconnected MCP
+	// server, keeps its place
+	other.Unregister("alpha")
+	other.Register(newMockTool("alpha", "alpha", "", nil))
+
+	for _, reg := range []*Registry{r, other} {
+		var names []string
+		for _, d := range reg.Definitions() {
+			names = append(names, d.Name)
+		}
+		if got := strings.Join(names, ","); got != "alpha,beta,mu,zeta" {
+			t.Fatalf("Definitions() order = %s, want sorted by name", got)
+		}
+	}
+	if got := r.Definitions()[0].Description; got != "Alpha v2" {
+		t.Errorf("replaced tool description = %q, want Alpha v2", got)
+	}
+}
+
+func TestRegistry_Unregister(t *testing.T) {
+	r := NewRegistry(nil)
+	for _, name := range []string{"zeta", "alpha", "mu"} {
+		r.Register(newMockTool(name, name, "", nil), "g-"+name)
+	}
+
+	if !r.Unregister("alpha") {
+		t.Fatal("Unregister(alpha) = false, want true")
+	}
+	if r.Unregister("alpha") {
+		t.Error("Unregister(alpha) again = true, want false")
+	}
+	if _, ok := r.Get("alpha"); ok {
+		t.Error("Get(alpha) found an unregistered tool")
+	}
+	var names []string
+	for _, d := range r.Definitions() {
+		names = append(names, d.Name)
+	}
+	if got := strings.Join(names, ","); got != "mu,zeta" {
+		t.Errorf("Definitions() = %s, want mu,zeta", got)
+	}
+	if got := strings.Join(r.Groups(), ","); got != "g-mu,g-zeta" {
+		t.Errorf("Groups() = %s, want the groups of the remaining tools", got)
+	}
+	result := r.Execute(context.Background(), llm.ToolCall{ID: "1", Name: "alpha"})
+	if !result.IsError {
+		t.Errorf("Execute(alpha) = %+v, want unknown tool", result)
+	}
+}
+
+func TestRegistry_Groups(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Register(newMockTool("balances", "", "", nil), "spot")
+	r.Register(newMockTool("positions", "", "", nil), "futures")
+	r.Register(newMockTool("deploy", "", "", nil), "ops", "dev")
+	r.Register(newMockTool("time", "", "", nil))
+
+	if got := strings.Join(r.Groups(), ","); got != "dev,futures,ops,spot" {
+		t.Errorf("Groups() = %s, want dev,futures,ops,spot", got)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "unrestricted", ctx: context.Background(), want: "balances,deploy,positions,time"},
+		{name: "spot and futures", ctx: ContextWithGroups(context.Background(), []string{"spot", "futures"}), want: "balances,positions,time"},
+		{name: "one of several groups", ctx: ContextWithGroups(context.Background(), []string{"dev"}), want: "deploy,time"},
+		{name: "none", ctx: ContextWithGroups(context.Background(), nil), want: "time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, d := range r.DefinitionsFor(tt.ctx) {
+				names = append(names, d.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("DefinitionsFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Execute_DisabledGroup(t *testing.T) {
+	r := NewRegistry(nil)
+	tool := newMockTool("balances", "", "ok", nil)
+	r.Register(tool, "spot")
+
+	ctx := ContextWithGroups(context.Background(), []string{"ops"})
+	result := r.Execute(ctx, llm.ToolCall{ID: "call-1", Name: "balances", Arguments: json.RawMessage(`{}`)})
+	if !result.IsError || tool.called {
+		t.Fatalf("result = %+v, want an error without running the tool", result)
+	}
+	if !strings.Contains(result.Content, "not enabled") {
+		t.Errorf("content = %q, want it to say the tool is not enabled", result.Content)
+	}
+
+	result = r.Execute(ContextWithGroups(context.Background(), []string{"spot"}), llm.ToolCall{ID: "call-2", Name: "balances"})
+	if result.IsError || !tool.called {
+		t.Errorf("result = %+v, want the tool executed in its group", result)
+	}
+}
+
 func TestRegistry_Execute_Success(t *testing.T) {
 	r := NewRegistry(nil)
 	tool := newMockTool("echo", "Echo tool", `{"echo":"hello"}`, nil)
@@ -203,3 +321,65 @@ func TestRegistry_Execute_Logging(t *testing.T) {
 		t.Errorf("Content = %q, want %q", result.Content, "ok")
 	}
 }
+
+func TestRegistry_Execute_InvalidArguments(t *testing.T) {
+	r := NewRegistry(nil)
+	tool := newMockTool("trades", "Trades tool", "ok", nil)
+	tool.def.Parameters = json.RawMessage(`{
+		"type": "object",
+		"properties": {"symbol": {"type": "string"}, "limit": {"type": "integer", "maximum": 1000}},
+		"required": ["symbol"]
+	}`)
+	r.Register(tool)
+
+	result := r.Execute(context.Background(), llm.ToolCall{
+		ID:        "call-5",
+		Name:      "trades",
+		Arguments: json.RawMessage(`{"limit":5000}`),
+	})
+
+	if !result.IsError {
+		t.Fatal("IsError = false, want true")
+	}
+	if tool.called {
+		t.Error("tool executed with invalid arguments")
+	}
+	for _, want := range []string{"invalid arguments for tool trades", "- symbol: is required", "- limit: must be <= 1000"} {
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("Content = %q, want it to contain %q", result.Content, want)
+		}
+	}
+
+	var invalid *ValidationError
+	err := r.Validate(llm.ToolCall{Name: "trades", Arguments: json.RawMessage(`{"symbol":7}`)})
+	if !errors.As(err, &invalid) || len(invalid.Issues) != 1 || invalid.Issues[0].Path != "symbol" {
+		t.Errorf("Validate() = %v, want one issue for symbol", err)
+	}
+}
+
+func TestRegistry_Execute_EmptyArguments(t *testing.T) {
+	r := NewRegistry(nil)
+	tool := newMockTool("balances", "Balances tool", "ok", nil)
+	r.Register(tool)
+
+	result := r.Execute(context.Background(), llm.ToolCall{ID: "call-6", Name: "balances"})
+
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.Content)
+	}
+	if string(tool.lastArgs) != `{}` {
+		t.Errorf("arguments = %q, want an empty object", tool.lastArgs)
+	}
+}
+
+func TestRegistry_Register_InvalidSchema(t *testing.T) {
+	r := NewRegistry(nil)
+	tool := newMockTool("broken", "Broken schema", "ok", nil)
+	tool.def.Parameters = json.RawMessage(`{"type": 5}`)
+	r.Register(tool)
+
+	result := r.Execute(context.Background(), llm.ToolCall{ID: "call-7", Name: "broken", Arguments: json.RawMessage(`{"any":1}`)})
+	if result.IsError || !tool.called {
+		t.Errorf("result = %+v, want the tool executed without validation", result)
+	}
+}
@@ -0,0 +1,323 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// schema is the subset of JSON Schema that tool parameters are validated
+// against: types, object properties, required properties, additional
+// properties, enums, string length and patterns, numeric bounds and array
+// items and bounds. Other keywords are ignored.
+type schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	UniqueItems          bool               `json:"uniqueItems"`
+
+	pattern    *regexp.Regexp
+	additional *schema // schema of additional properties, if any
+	noExtra    bool    // additionalProperties: false
+}
+
+// schemaTypes is the "type" keyword: a single type or a list of types.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("tools: schema type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// compileSchema parses a tool's parameter schema. An empty schema accepts
+// any object.
+func compileSchema(raw json.RawMessage) (*schema, error) {
+	s := &schema{}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, fmt.Errorf("tools: invalid parameter schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compile prepares patterns and additional properties of s and its children.
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("tools: invalid schema pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	switch extra := bytes.TrimSpace(s.AdditionalProperties); {
+	case len(extra) == 0, bytes.Equal(extra, []byte("true")):
+	case bytes.Equal(extra, []byte("false")):
+		s.noExtra = true
+	default:
+		s.additional = &schema{}
+		if err := json.Unmarshal(extra, s.additional); err != nil {
+			return fmt.Errorf("tools: invalid additionalProperties schema: %w", err)
+		}
+		if err := s.additional.compile(); err != nil {
+			return err
+		}
+	}
+
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// ValidationIssue is one way in which tool arguments break the schema.
+type ValidationIssue struct {
+	Path    string // e.g. "symbols[1]", "arguments" for the whole object
+	Message string
+}
+
+// ValidationError reports tool arguments that do not match the tool's
+// parameter schema. Its message lists every issue and is meant to be read by
+// the model, so it can correct the call.
+type ValidationError struct {
+	Tool   string
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid arguments for tool %s:", e.Tool)
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "\n- %s: %s", issue.Path, issue.Message)
+	}
+	b.WriteString("\nFix the arguments to match the tool's parameter schema and call it again.")
+	return b.String()
+}
+
+// rootPath names the arguments object itself in validation issues.
+const rootPath = "arguments"
+
+// validate checks arguments against s and returns the issues found.
+func (s *schema) validate(arguments json.RawMessage) []ValidationIssue {
+	var value interface{}
+	if err := json.Unmarshal(arguments, &value); err != nil {
+		return []ValidationIssue{{Path: rootPath, Message: "not valid JSON: " + err.Error()}}
+	}
+	var issues []ValidationIssue
+	s.check(rootPath, value, &issues)
+	return issues
+}
+
+// check validates value at path against s, appending issues.
+func (s *schema) check(path string, value interface{}, issues *[]ValidationIssue) {
+	report := func(format string, args ...interface{}) {
+		*issues = append(*issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.match(value) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), describe(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		report("must be one of %s, got %s", enumList(s.Enum), describe(value))
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			report("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("%q does not match the pattern %s", v, s.Pattern)
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			report("must be >= %v, got %v", *s.Minimum, v)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			report("must be <= %v, got %v", *s.Maximum, v)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			report("must be > %v, got %v", *s.ExclusiveMinimum, v)
+		}
+		if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+			report("must be < %v, got %v", *s.ExclusiveMaximum, v)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			report("must have at least %d item(s), got %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			report("must have at most %d item(s), got %d", *s.MaxItems, len(v))
+		}
+		if s.UniqueItems {
+			for i := 1; i < len(v); i++ {
+				for j := 0; j < i; j++ {
+					if reflect.DeepEqual(v[i], v[j]) {
+						report("items must be unique, items %d and %d are equal", j, i)
+					}
+				}
+			}
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, issues)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*issues = append(*issues, ValidationIssue{Path: childPath(path, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				prop.check(childPath(path, name), v[name], issues)
+				continue
+			}
+			switch {
+			case s.noExtra:
+				*issues = append(*issues, ValidationIssue{
+					Path:    childPath(path, name),
+					Message: "unknown property, allowed: " + strings.Join(s.propertyNames(), ", "),
+				})
+			case s.additional != nil:
+				s.additional.check(childPath(path, name), v[name], issues)
+			}
+		}
+	}
+}
+
+// match reports whether value has one of the types.
+func (t schemaTypes) match(value interface{}) bool {
+	for _, typ := range t {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case float64:
+			if typ == "number" || (typ == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *schema) inEnum(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func childPath(path, name string) string {
+	if path == rootPath {
+		return name
+	}
+	return path + "." + name
+}
+
+// describe names the JSON type of value, with the value itself for scalars.
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func enumList(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, ", ")
+}
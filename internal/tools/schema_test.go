@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"symbol": {"type": "string", "pattern": "^[A-Z0-9]+$", "minLength": 5},
+		"symbols": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 3, "uniqueItems": true},
+		"side": {"type": "string", "enum": ["BUY", "SELL"]},
+		"limit": {"type": "integer", "minimum": 1, "maximum": 1000},
+		"ratio": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+		"note": {"type": ["string", "null"], "maxLength": 4},
+		"filter": {
+			"type": "object",
+			"properties": {"active": {"type": "boolean"}},
+			"required": ["active"],
+			"additionalProperties": false
+		}
+	},
+	"required": ["symbol"]
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := compileSchema(json.RawMessage(testSchema))
+	if err != nil {
+		t.Fatalf("compileSchema() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want []string // "path: message prefix"
+	}{
+		{"valid", `{"symbol":"BTCUSDT","symbols":["ETHUSDT"],"side":"BUY","limit":20,"ratio":0.5,"note":null,"filter":{"active":true}}`, nil},
+		{"missing required", `{}`, []string{"symbol: is required"}},
+		{"wrong type", `{"symbol":42}`, []string{"symbol: expected string, got number 42"}},
+		{"not an object", `["BTCUSDT"]`, []string{"arguments: expected object, got array"}},
+		{"pattern", `{"symbol":"btcusdt"}`, []string{`symbol: "btcusdt" does not match the pattern ^[A-Z0-9]+$`}},
+		{"min length", `{"symbol":"BTC"}`, []string{"symbol: must be at least 5 characters long"}},
+		{"enum", `{"symbol":"BTCUSDT","side":"LONG"}`, []string{`side: must be one of "BUY", "SELL", got string "LONG"`}},
+		{"integer", `{"symbol":"BTCUSDT","limit":2.5}`, []string{"limit: expected integer, got number 2.5"}},
+		{"bounds", `{"symbol":"BTCUSDT","limit":5000,"ratio":1}`, []string{"limit: must be <= 1000, got 5000", "ratio: must be < 1, got 1"}},
+		{"array bounds", `{"symbol":"BTCUSDT","symbols":[]}`, []string{"symbols: must have at least 1 item(s), got 0"}},
+		{"array items", `{"symbol":"BTCUSDT","symbols":["A","B","A",1]}`, []string{
+			"symbols: must have at most 3 item(s), got 4",
+			"symbols: items must be unique, items 0 and 2 are equal",
+			"symbols[3]: expected string, got number 1",
+		}},
+		{"type list", `{"symbol":"BTCUSDT","note":true}`, []string{"note: expected string or null, got boolean true"}},
+		{"nested", `{"symbol":"BTCUSDT","filter":{"side":"BUY"}}`, []string{
+			"filter.active: is required",
+			"filter.side: unknown property, allowed: active",
+		}},
+		{"invalid JSON", `{"symbol":`, []string{"arguments: not valid JSON"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := s.validate(json.RawMessage(tt.args))
+			if len(issues) != len(tt.want) {
+				t.Fatalf("issues = %+v, want %q", issues, tt.want)
+			}
+			for i, issue := range issues {
+				if got := issue.Path + ": " + issue.Message; !strings.HasPrefix(got, tt.want[i]) {
+					t.Errorf("issue %d = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCompileSchema_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"type": 5}`,
+		`{"type": "object", "properties": {"s": {"type": "string", "pattern": "("}}}`,
+		`not json`,
+	} {
+		if _, err := compileSchema(json.RawMessage(raw)); err == nil {
+			t.Errorf("compileSchema(%s) error = nil, want an error", raw)
+		}
+	}
+}
+
+func TestValidationError_Message(t *testing.T) {
+	err := &ValidationError{Tool: "get_futures_trades", Issues: []ValidationIssue{
+		{Path: "symbol", Message: "is required"},
+		{Path: "limit", Message: "must be <= 1000, got 5000"},
+	}}
+	want := "invalid arguments for tool get_futures_trades:\n- symbol: is required\n- limit: must be <= 1000, got 5000\n" +
+		"Fix the arguments to match the tool's parameter schema and call it again."
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
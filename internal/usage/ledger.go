@@ -0,0 +1,471 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/kv"
+)
+
+// keyPrefix namespaces usage records in the kv store.
+const keyPrefix = "usage/"
+
+// dayLayout formats the day of a bucket; months are its first 7 characters.
+const dayLayout = "2006-01-02"
+
+// Scope identifies who an AI call is made for.
+type Scope struct {
+	ChatID int64
+	UserID int64
+}
+
+type scopeKey struct{}
+
+// ContextWithScope returns a context that attributes AI usage to scope.
+func ContextWithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the scope stored in ctx, or the zero Scope.
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
+
+// Totals aggregates the usage of one or more AI calls.
+type Totals struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.InputTokens += o.InputTokens
+	t.OutputTokens += o.OutputTokens
+	t.Cost += o.Cost
+}
+
+// Budgets are spending limits in USD. Zero disables a limit.
+type Budgets struct {
+	Daily       float64 // whole bot, per day
+	Monthly     float64 // whole bot, per calendar month
+	UserDaily   float64 // each user, per day
+	UserMonthly float64 // each user, per calendar month
+}
+
+// Enabled reports whether any limit is set.
+func (b Budgets) Enabled() bool {
+	return b.Daily > 0 || b.Monthly > 0 || b.UserDaily > 0 || b.UserMonthly > 0
+}
+
+// BudgetError is returned when a budget is exhausted.
+type BudgetError struct {
+	User    bool // the per-user budget, not the bot-wide one
+	Monthly bool // the monthly budget, not the daily one
+	Limit   float64
+	Spent   float64
+}
+
+func (e *BudgetError) Error() string {
+	who, period := "bot", "daily"
+	if e.User {
+		who = "user"
+	}
+	if e.Monthly {
+		period = "monthly"
+	}
+	return fmt.Sprintf("usage: %s %s budget of $%.2f exhausted (spent $%.4f)", who, period, e.Limit, e.Spent)
+}
+
+// UserMessage explains the block to the user.
+func (e *BudgetError) UserMessage() string {
+	who, period, retry := "Bot", "hôm nay", "ngày mai"
+	if e.User {
+		who = "Bạn"
+	}
+	if e.Monthly {
+		period, retry = "tháng này", "tháng sau"
+	}
+	return fmt.Sprintf("💸 %s đã dùng hết ngân sách AI %s (%s/%s). Vui lòng quay lại vào %s.",
+		who, period, FormatCost(e.Spent), FormatCost(e.Limit), retry)
+}
+
+// bucket is the unit of aggregation: one model used by one user in one chat
+// on one day.
+type bucket struct {
+	Day    string
+	ChatID int64
+	UserID int64
+	Model  string
+}
+
+func (b bucket) key() string {
+	return fmt.Sprintf("%s%s/%d/%d/%s", keyPrefix, b.Day, b.ChatID, b.UserID, b.Model)
+}
+
+// parseBucket parses a key written by bucket.key. Model names may contain
+// slashes, so the model is everything after the user ID.
+func parseBucket(key string) (bucket, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(key, keyPrefix), "/", 4)
+	if len(parts) != 4 {
+		return bucket{}, false
+	}
+	chatID, err1 := strconv.ParseInt(parts[1], 10, 64)
+	userID, err2 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return bucket{}, false
+	}
+	return bucket{Day: parts[0], ChatID: chatID, UserID: userID, Model: parts[3]}, true
+}
+
+// period holds the running totals of the bot and of each user for one day
+// or month.
+type period struct {
+	key   string // the day or month, as in bucket.Day
+	bot   Totals
+	users map[int64]*Totals
+}
+
+func newPeriod(key string) period {
+	return period{key: key, users: make(map[int64]*Totals)}
+}
+
+func (p *period) add(userID int64, t Totals) {
+	p.bot.add(t)
+	u, ok := p.users[userID]
+	if !ok {
+		u = &Totals{}
+		p.users[userID] = u
+	}
+	u.add(t)
+}
+
+// user returns the spending of userID in the period.
+func (p *period) user(userID int64) float64 {
+	if u, ok := p.users[userID]; ok {
+		return u.Cost
+	}
+	return 0
+}
+
+// Ledger records token usage and estimated cost and enforces budgets. It is
+// safe for concurrent use.
+//
+// Only the buckets of the current month are kept in memory; older ones stay
+// in the store. Budgets are checked against running totals for the current
+// day and month, so a check costs the same however long the bot runs.
+type Ledger struct {
+	mu      sync.Mutex
+	buckets map[bucket]*Totals
+	day     period
+	month   period
+
+	prices  Prices
+	budgets Budgets
+	store   *kv.Store
+	now     func() time.Time
+	logger  *slog.Logger
+}
+
+// LedgerOption is a functional option for configuring Ledger.
+type LedgerOption func(*Ledger)
+
+// WithPrices sets the price table (default DefaultPrices).
+func WithPrices(prices Prices) LedgerOption {
+	return func(l *Ledger) {
+		l.prices = prices
+	}
+}
+
+// WithBudgets sets the spending limits (default none).
+func WithBudgets(budgets Budgets) LedgerOption {
+	return func(l *Ledger) {
+		l.budgets = budgets
+	}
+}
+
+// WithStore persists usage in store, so totals survive restarts.
+func WithStore(store *kv.Store) LedgerOption {
+	return func(l *Ledger) {
+		l.store = store
+	}
+}
+
+// WithClock sets the time source (default time.Now). Days and months follow
+// the location of the returned times.
+func WithClock(now func() time.Time) LedgerOption {
+	return func(l *Ledger) {
+		l.now = now
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger *slog.Logger) LedgerOption {
+	return func(l *Ledger) {
+		l.logger = logger
+	}
+}
+
+// NewLedger creates a Ledger, loading previously recorded usage from the
+// store if one is configured.
+func NewLedger(opts ...LedgerOption) (*Ledger, error) {
+	l := &Ledger{
+		buckets: make(map[bucket]*Totals),
+		prices:  DefaultPrices,
+		now:     time.Now,
+		logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	today := l.now().Format(dayLayout)
+	if err := l.load(today[:7]); err != nil {
+		return nil, err
+	}
+	l.rollover(today)
+	return l, nil
+}
+
+// load reads the usage records of month from the store into memory.
+func (l *Ledger) load(month string) error {
+	if l.store == nil {
+		return nil
+	}
+	for _, key := range l.store.Keys() {
+		if !strings.HasPrefix(key, keyPrefix) {
+			continue
+		}
+		b, ok := parseBucket(key)
+		if !ok {
+			l.logger.Warn("skipping malformed usage key", slog.String("key", key))
+			continue
+		}
+		if !strings.HasPrefix(b.Day, month) {
+			continue
+		}
+		data, found, err := l.store.Get(key)
+		if err != nil {
+			return fmt.Errorf("usage: load %s: %w", key, err)
+		}
+		if !found {
+			continue
+		}
+		var t Totals
+		if err := json.Unmarshal(data, &t); err != nil {
+			l.logger.Warn("skipping malformed usage record", slog.String("key", key), slog.String("error", err.Error()))
+			continue
+		}
+		l.buckets[b] = &t
+	}
+	return nil
+}
+
+// rollover moves the running totals to today when it is later than their
+// day, dropping the buckets of earlier months when the month changes. The
+// totals are rebuilt from the buckets, which only hold the current month.
+// l.mu must be held, except while NewLedger builds l.
+func (l *Ledger) rollover(today string) {
+	if today <= l.day.key {
+		return
+	}
+	month := today[:7]
+	if month != l.month.key {
+		for b := range l.buckets {
+			if !strings.HasPrefix(b.Day, month) {
+				delete(l.buckets, b)
+			}
+		}
+	}
+	l.day, l.month = newPeriod(today), newPeriod(month)
+	for b, t := range l.buckets {
+		if b.Day == today {
+			l.day.add(b.UserID, *t)
+		}
+		if strings.HasPrefix(b.Day, month) {
+			l.month.add(b.UserID, *t)
+		}
+	}
+}
+
+// Budgets returns the configured spending limits.
+func (l *Ledger) Budgets() Budgets {
+	return l.budgets
+}
+
+// Record adds one AI call to the ledger and returns its estimated cost. The
+// call is always counted in memory; the returned error only reports a
+// failure to persist it.
+func (l *Ledger) Record(scope Scope, model string, inputTokens, outputTokens int) (float64, error) {
+	cost := l.prices.Cost(model, inputTokens, outputTokens)
+	b := bucket{
+		Day:    l.now().Format(dayLayout),
+		ChatID: scope.ChatID,
+		UserID: scope.UserID,
+		Model:  model,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover(b.Day)
+	call := Totals{Requests: 1, InputTokens: inputTokens, OutputTokens: outputTokens, Cost: cost}
+	t, ok := l.buckets[b]
+	if !ok {
+		t = &Totals{}
+		l.buckets[b] = t
+	}
+	t.add(call)
+	if b.Day == l.day.key {
+		l.day.add(b.UserID, call)
+	}
+	if strings.HasPrefix(b.Day, l.month.key) {
+		l.month.add(b.UserID, call)
+	}
+
+	if l.store == nil {
+		return cost, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return cost, fmt.Errorf("usage: encode: %w", err)
+	}
+	if err := l.store.Put(b.key(), data); err != nil {
+		return cost, fmt.Errorf("usage: persist: %w", err)
+	}
+	return cost, nil
+}
+
+// Check returns a *BudgetError if a budget that applies to scope is already
+// exhausted. User budgets apply only when the user is known.
+func (l *Ledger) Check(scope Scope) error {
+	if !l.budgets.Enabled() {
+		return nil
+	}
+	today := l.now().Format(dayLayout)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover(today)
+	var botDay, botMonth, userDay, userMonth float64
+	if l.day.key == today {
+		botDay, userDay = l.day.bot.Cost, l.day.user(scope.UserID)
+	}
+	if l.month.key == today[:7] {
+		botMonth, userMonth = l.month.bot.Cost, l.month.user(scope.UserID)
+	}
+
+	limits := []struct {
+		limit, spent  float64
+		user, monthly bool
+	}{
+		{l.budgets.Daily, botDay, false, false},
+		{l.budgets.Monthly, botMonth, false, true},
+		{l.budgets.UserDaily, userDay, true, false},
+		{l.budgets.UserMonthly, userMonth, true, true},
+	}
+	for _, lim := range limits {
+		if lim.user && scope.UserID == 0 {
+			continue
+		}
+		if lim.limit > 0 && lim.spent >= lim.limit {
+			return &BudgetError{User: lim.user, Monthly: lim.monthly, Limit: lim.limit, Spent: lim.spent}
+		}
+	}
+	return nil
+}
+
+// Report summarizes spending from the point of view of one scope.
+type Report struct {
+	Day   string // the current day, YYYY-MM-DD
+	Month string // the current month, YYYY-MM
+
+	UserToday Totals
+	UserMonth Totals
+	// UserModels breaks down the user's spending this month by model.
+	UserModels map[string]Totals
+
+	ChatToday Totals
+	ChatMonth Totals
+
+	BotToday Totals
+	BotMonth Totals
+
+	Budgets Budgets
+}
+
+// Models returns the model names of UserModels, most expensive first.
+func (r Report) Models() []string {
+	models := make([]string, 0, len(r.UserModels))
+	for m := range r.UserModels {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		ci, cj := r.UserModels[models[i]].Cost, r.UserModels[models[j]].Cost
+		if ci != cj {
+			return ci > cj
+		}
+		return models[i] < models[j]
+	})
+	return models
+}
+
+// Report returns the spending of scope's user and chat and of the whole bot
+// for the current day and month.
+func (l *Ledger) Report(scope Scope) Report {
+	today := l.now().Format(dayLayout)
+	r := Report{
+		Day:        today,
+		Month:      today[:7],
+		UserModels: make(map[string]Totals),
+		Budgets:    l.budgets,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover(today)
+	for b, t := range l.buckets {
+		if !strings.HasPrefix(b.Day, r.Month) {
+			continue
+		}
+		isToday := b.Day == today
+		r.BotMonth.add(*t)
+		if isToday {
+			r.BotToday.add(*t)
+		}
+		if b.ChatID == scope.ChatID {
+			r.ChatMonth.add(*t)
+			if isToday {
+				r.ChatToday.add(*t)
+			}
+		}
+		if b.UserID == scope.UserID {
+			r.UserMonth.add(*t)
+			if isToday {
+				r.UserToday.add(*t)
+			}
+			m := r.UserModels[b.Model]
+			m.add(*t)
+			r.UserModels[b.Model] = m
+		}
+	}
+	return r
+}
+
+// FormatCost formats a cost in USD with enough precision for small amounts.
+func FormatCost(usd float64) string {
+	if usd > 0 && usd < 0.01 {
+		return fmt.Sprintf("$%.4f", usd)
+	}
+	return fmt.Sprintf("$%.2f", usd)
+}
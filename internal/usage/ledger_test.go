@@ -0,0 +1,245 @@
+package usage
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/kv"
+)
+
+// testPrices makes costs easy to compute: $1 per million input tokens and
+// $2 per million output tokens.
+var testPrices = Prices{"test": {Input: 1, Output: 2}}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPrices_Lookup(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Price
+		found bool
+	}{
+		{"gpt-4o", Price{2.50, 10.00}, true},
+		{"gpt-4o-mini-2024-07-18", Price{0.15, 0.60}, true},
+		{"Gemini-2.0-Flash", Price{0.10, 0.40}, true},
+		{"llama3.1", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, found := DefaultPrices.Lookup(tt.model)
+		if got != tt.want || found != tt.found {
+			t.Errorf("Lookup(%q) = %v, %v; want %v, %v", tt.model, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices(" gpt-4o=3/12 , llama3.1=0.1/0.2,")
+	if err != nil {
+		t.Fatalf("ParsePrices() error = %v", err)
+	}
+	merged := DefaultPrices.With(prices)
+	if p, _ := merged.Lookup("gpt-4o"); p != (Price{3, 12}) {
+		t.Errorf("gpt-4o = %v, want override", p)
+	}
+	if p, _ := merged.Lookup("llama3.1:8b"); p != (Price{0.1, 0.2}) {
+		t.Errorf("llama3.1 = %v, want added price", p)
+	}
+	if p, _ := DefaultPrices.Lookup("gpt-4o"); p != (Price{2.50, 10.00}) {
+		t.Error("With() must not modify the receiver")
+	}
+
+	for _, bad := range []string{"gpt-4o", "gpt-4o=1", "=1/2", "gpt-4o=a/2", "gpt-4o=1/b"} {
+		if _, err := ParsePrices(bad); err == nil {
+			t.Errorf("ParsePrices(%q) should fail", bad)
+		}
+	}
+}
+
+func TestLedger_RecordAndReport(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	l, err := NewLedger(WithPrices(testPrices), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := Scope{ChatID: 1, UserID: 1}
+	bob := Scope{ChatID: 2, UserID: 2}
+	cost, _ := l.Record(alice, "test-model", 1_000_000, 500_000)
+	if !approx(cost, 2) {
+		t.Errorf("cost = %v, want 2", cost)
+	}
+	l.Record(alice, "other", 1000, 1000)
+	l.Record(bob, "test-model", 1_000_000, 0)
+
+	now = now.AddDate(0, 0, -1)
+	l.Record(alice, "test-model", 2_000_000, 0)
+	now = now.AddDate(0, -1, 0)
+	l.Record(alice, "test-model", 5_000_000, 0) // last month
+	now = time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	r := l.Report(alice)
+	if r.Day != "2026-03-15" || r.Month != "2026-03" {
+		t.Errorf("period = %s %s", r.Day, r.Month)
+	}
+	if r.UserToday.Requests != 2 || !approx(r.UserToday.Cost, 2) {
+		t.Errorf("UserToday = %+v, want 2 requests for $2", r.UserToday)
+	}
+	if r.UserMonth.Requests != 3 || !approx(r.UserMonth.Cost, 4) || r.UserMonth.InputTokens != 3_001_000 {
+		t.Errorf("UserMonth = %+v, want 3 requests for $4", r.UserMonth)
+	}
+	if r.BotToday.Requests != 3 || !approx(r.BotToday.Cost, 3) {
+		t.Errorf("BotToday = %+v, want 3 requests for $3", r.BotToday)
+	}
+	if !approx(r.BotMonth.Cost, 5) {
+		t.Errorf("BotMonth = %+v, want $5", r.BotMonth)
+	}
+	if models := r.Models(); len(models) != 2 || models[0] != "test-model" {
+		t.Errorf("Models() = %v, want test-model first", models)
+	}
+}
+
+func TestLedger_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		budgets Budgets
+		scope   Scope
+		want    *BudgetError
+	}{
+		{"no budgets", Budgets{}, Scope{UserID: 1}, nil},
+		{"under budget", Budgets{Daily: 10, UserDaily: 5}, Scope{UserID: 1}, nil},
+		{"bot daily", Budgets{Daily: 3}, Scope{UserID: 2}, &BudgetError{Limit: 3, Spent: 3}},
+		{"bot monthly", Budgets{Monthly: 4}, Scope{UserID: 2}, &BudgetError{Monthly: true, Limit: 4, Spent: 4}},
+		{"user daily", Budgets{UserDaily: 2}, Scope{UserID: 1}, &BudgetError{User: true, Limit: 2, Spent: 2}},
+		{"other user", Budgets{UserDaily: 2}, Scope{UserID: 2}, nil},
+		{"user monthly", Budgets{UserMonthly: 2.5}, Scope{UserID: 1}, &BudgetError{User: true, Monthly: true, Limit: 2.5, Spent: 3}},
+		{"unknown user", Budgets{UserDaily: 0.1}, Scope{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+			l, _ := NewLedger(WithPrices(testPrices), WithBudgets(tt.budgets), WithClock(func() time.Time { return now }))
+			l.Record(Scope{UserID: 1}, "test", 2_000_000, 0)
+			l.Record(Scope{UserID: 2}, "test", 1_000_000, 0)
+			now = now.AddDate(0, 0, -1)
+			l.Record(Scope{UserID: 1}, "test", 1_000_000, 0)
+			now = now.AddDate(0, 0, 1)
+
+			err := l.Check(tt.scope)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+			var budgetErr *BudgetError
+			if !errors.As(err, &budgetErr) {
+				t.Fatalf("Check() error = %v, want *BudgetError", err)
+			}
+			if *budgetErr != *tt.want {
+				t.Errorf("Check() = %+v, want %+v", budgetErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestLedger_Rollover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.kv")
+	store, err := kv.Open(path, kv.WithoutSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	l, _ := NewLedger(WithStore(store), WithPrices(testPrices), WithBudgets(Budgets{Daily: 2, Monthly: 3}), WithClock(clock))
+	l.Record(Scope{UserID: 1}, "test", 2_000_000, 0)
+	if err := l.Check(Scope{UserID: 1}); err == nil {
+		t.Fatal("Check() = nil, want daily budget exhausted")
+	}
+
+	// The next day the daily budget is available again
+	now = now.Add(2 * time.Hour)
+	if err := l.Check(Scope{UserID: 1}); err != nil {
+		t.Errorf("Check() on a new day = %v, want nil", err)
+	}
+	l.Record(Scope{UserID: 1}, "test", 1_000_000, 0)
+
+	// March was dropped from memory when April began, but not from the store
+	if len(l.buckets) != 1 {
+		t.Errorf("ledger holds %d buckets, want only the current month's", len(l.buckets))
+	}
+	if r := l.Report(Scope{UserID: 1}); !approx(r.BotMonth.Cost, 1) || !approx(r.UserToday.Cost, 1) {
+		t.Errorf("report = %+v, want only April's $1", r)
+	}
+	if len(store.Keys()) != 2 {
+		t.Errorf("store holds %d records, want both months", len(store.Keys()))
+	}
+
+	// Reloading skips the earlier months
+	l, err = NewLedger(WithStore(store), WithPrices(testPrices), WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	if len(l.buckets) != 1 || !approx(l.month.bot.Cost, 1) {
+		t.Errorf("reloaded ledger = %d buckets, month %+v; want April only", len(l.buckets), l.month.bot)
+	}
+}
+
+func TestBudgetError_UserMessage(t *testing.T) {
+	msg := (&BudgetError{User: true, Monthly: true, Limit: 5, Spent: 5.2}).UserMessage()
+	if !strings.Contains(msg, "Bạn") || !strings.Contains(msg, "tháng này") || !strings.Contains(msg, "$5.20/$5.00") {
+		t.Errorf("UserMessage() = %q", msg)
+	}
+	msg = (&BudgetError{Limit: 1, Spent: 1}).UserMessage()
+	if !strings.Contains(msg, "Bot") || !strings.Contains(msg, "hôm nay") {
+		t.Errorf("UserMessage() = %q", msg)
+	}
+}
+
+func TestLedger_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.kv")
+	store, err := kv.Open(path, kv.WithoutSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := func() time.Time { return time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC) }
+	l, _ := NewLedger(WithStore(store), WithPrices(testPrices), WithClock(now))
+	l.Record(Scope{ChatID: -100, UserID: 7}, "test/model", 1_000_000, 0)
+	l.Record(Scope{ChatID: -100, UserID: 7}, "test/model", 1_000_000, 0)
+	store.Close()
+
+	store, err = kv.Open(path, kv.WithoutSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	l, err = NewLedger(WithStore(store), WithPrices(testPrices), WithClock(now))
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+
+	r := l.Report(Scope{ChatID: -100, UserID: 7})
+	if r.UserToday.Requests != 2 || !approx(r.UserToday.Cost, 2) || !approx(r.ChatMonth.Cost, 2) {
+		t.Errorf("reloaded report = %+v, want 2 requests for $2", r)
+	}
+	if _, ok := r.UserModels["test/model"]; !ok {
+		t.Errorf("UserModels = %v, want model names with slashes preserved", r.UserModels)
+	}
+}
+
+func TestFormatCost(t *testing.T) {
+	tests := map[float64]string{0: "$0.00", 0.0012: "$0.0012", 1.5: "$1.50"}
+	for usd, want := range tests {
+		if got := FormatCost(usd); got != want {
+			t.Errorf("FormatCost(%v) = %q, want %q", usd, got, want)
+		}
+	}
+}
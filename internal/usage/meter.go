@@ -0,0 +1,92 @@
+package usage
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// Completer is the AI client being metered.
+// Defined at the consumer side for testability.
+type Completer interface {
+	Complete(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error)
+}
+
+// Streamer is implemented by completers that can stream partial output.
+type Streamer interface {
+	CompleteStream(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error)
+}
+
+// Meter wraps an AI client, refusing calls once a budget is exhausted and
+// recording the usage of every call in a Ledger. Calls are attributed to the
+// Scope of their context.
+type Meter struct {
+	ai     Completer
+	ledger *Ledger
+	logger *slog.Logger
+}
+
+// NewMeter creates a Meter around completer.
+func NewMeter(completer Completer, ledger *Ledger, logger *slog.Logger) *Meter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Meter{ai: completer, ledger: ledger, logger: logger}
+}
+
+// Complete checks the budget, forwards the request and records its usage.
+func (m *Meter) Complete(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	scope := ScopeFromContext(ctx)
+	if err := m.ledger.Check(scope); err != nil {
+		return nil, err
+	}
+	resp, err := m.ai.Complete(ctx, req)
+	m.record(scope, req, resp)
+	return resp, err
+}
+
+// CompleteStream is Complete for streaming requests. If the wrapped client
+// cannot stream, the request is completed without partial output.
+func (m *Meter) CompleteStream(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error) {
+	streamer, ok := m.ai.(Streamer)
+	if !ok {
+		return m.Complete(ctx, req)
+	}
+	scope := ScopeFromContext(ctx)
+	if err := m.ledger.Check(scope); err != nil {
+		return nil, err
+	}
+	resp, err := streamer.CompleteStream(ctx, req, onDelta)
+	m.record(scope, req, resp)
+	return resp, err
+}
+
+func (m *Meter) record(scope Scope, req llm.ChatRequest, resp *llm.ChatResponse) {
+	if resp == nil {
+		return
+	}
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	if model == "" {
+		model = "unknown"
+	}
+	cost, err := m.ledger.Record(scope, model, resp.InputTokens, resp.OutputTokens)
+	if err != nil {
+		m.logger.Warn("failed to record AI usage",
+			slog.Int64("chat_id", scope.ChatID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	m.logger.Debug("AI usage recorded",
+		slog.Int64("chat_id", scope.ChatID),
+		slog.Int64("user_id", scope.UserID),
+		slog.String("model", model),
+		slog.Int("input_tokens", resp.InputTokens),
+		slog.Int("output_tokens", resp.OutputTokens),
+		slog.Float64("cost_usd", cost),
+	)
+}
@@ -0,0 +1,91 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocky-ops-bot/internal/clients/llm"
+)
+
+// mockCompleter returns a fixed response and counts calls.
+type mockCompleter struct {
+	resp  *llm.ChatResponse
+	calls int
+}
+
+func (m *mockCompleter) Complete(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	m.calls++
+	return m.resp, nil
+}
+
+// mockStreamer also streams its response as a single delta.
+type mockStreamer struct {
+	mockCompleter
+	streamed bool
+}
+
+func (m *mockStreamer) CompleteStream(ctx context.Context, req llm.ChatRequest, onDelta llm.StreamHandler) (*llm.ChatResponse, error) {
+	m.streamed = true
+	onDelta(m.resp.Content)
+	return m.Complete(ctx, req)
+}
+
+func TestMeter_RecordsAndBlocks(t *testing.T) {
+	now := func() time.Time { return time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC) }
+	ledger, _ := NewLedger(WithPrices(testPrices), WithBudgets(Budgets{UserDaily: 1}), WithClock(now))
+	ai := &mockCompleter{resp: &llm.ChatResponse{Content: "ok", Model: "test-1", InputTokens: 1_000_000}}
+	meter := NewMeter(ai, ledger, nil)
+
+	ctx := ContextWithScope(context.Background(), Scope{ChatID: 5, UserID: 5})
+	if _, err := meter.Complete(ctx, llm.ChatRequest{}); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	r := ledger.Report(Scope{ChatID: 5, UserID: 5})
+	if r.UserToday.Requests != 1 || r.UserModels["test-1"].InputTokens != 1_000_000 {
+		t.Errorf("report = %+v, want the call recorded under test-1", r)
+	}
+
+	// The budget is now exhausted for this user, but not for others
+	_, err := meter.Complete(ctx, llm.ChatRequest{})
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || !budgetErr.User {
+		t.Errorf("Complete() error = %v, want user BudgetError", err)
+	}
+	if ai.calls != 1 {
+		t.Errorf("AI calls = %d, want the blocked call not forwarded", ai.calls)
+	}
+	other := ContextWithScope(context.Background(), Scope{ChatID: 6, UserID: 6})
+	if _, err := meter.Complete(other, llm.ChatRequest{}); err != nil {
+		t.Errorf("Complete() for another user error = %v", err)
+	}
+}
+
+func TestMeter_CompleteStream(t *testing.T) {
+	ledger, _ := NewLedger(WithPrices(testPrices))
+	ai := &mockStreamer{mockCompleter: mockCompleter{resp: &llm.ChatResponse{Content: "hi", OutputTokens: 10}}}
+	meter := NewMeter(ai, ledger, nil)
+
+	var got string
+	_, err := meter.CompleteStream(context.Background(), llm.ChatRequest{Model: "test-2"}, func(delta string) { got += delta })
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+	if !ai.streamed || got != "hi" {
+		t.Errorf("streamed = %v, got %q; want the call streamed", ai.streamed, got)
+	}
+	if r := ledger.Report(Scope{}); r.UserModels["test-2"].OutputTokens != 10 {
+		t.Errorf("report = %+v, want the request model used when the response has none", r)
+	}
+
+	// A client that cannot stream is still metered
+	plain := NewMeter(&ai.mockCompleter, ledger, nil)
+	if _, err := plain.CompleteStream(context.Background(), llm.ChatRequest{}, func(string) {}); err != nil {
+		t.Fatalf("CompleteStream() without streaming error = %v", err)
+	}
+	if r := ledger.Report(Scope{}); r.BotToday.Requests != 2 {
+		t.Errorf("requests = %d, want 2", r.BotToday.Requests)
+	}
+}
@@ -0,0 +1,107 @@
+// Package usage accounts AI token usage and its estimated cost per chat,
+// user, day and model, and enforces spending budgets.
+package usage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Cost returns the cost in USD of a request with the given token counts.
+func (p Price) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.Input + float64(outputTokens)*p.Output) / 1e6
+}
+
+// Prices maps model name prefixes to prices. The longest matching prefix
+// wins; models without a match (e.g. local models) cost nothing.
+type Prices map[string]Price
+
+// DefaultPrices are list prices of common models at the time of writing.
+// Override or extend them with USAGE_PRICES.
+var DefaultPrices = Prices{
+	"gemini-1.5-flash":  {Input: 0.075, Output: 0.30},
+	"gemini-1.5-pro":    {Input: 1.25, Output: 5.00},
+	"gemini-2.0-flash":  {Input: 0.10, Output: 0.40},
+	"gemini-2.5-flash":  {Input: 0.30, Output: 2.50},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10.00},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	"claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-sonnet-4":   {Input: 3.00, Output: 15.00},
+	"claude-opus-4":     {Input: 15.00, Output: 75.00},
+	"gpt-4o":            {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"gpt-4.1":           {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":      {Input: 0.10, Output: 0.40},
+	"o3":                {Input: 2.00, Output: 8.00},
+	"o4-mini":           {Input: 1.10, Output: 4.40},
+	"qwen-turbo":        {Input: 0.05, Output: 0.20},
+	"qwen-plus":         {Input: 0.40, Output: 1.20},
+	"qwen-max":          {Input: 1.60, Output: 6.40},
+}
+
+// Lookup returns the price of model by longest prefix match.
+func (p Prices) Lookup(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	best, price := -1, Price{}
+	for prefix, pr := range p {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, price = len(prefix), pr
+		}
+	}
+	return price, best >= 0
+}
+
+// Cost returns the cost in USD of a request to model.
+func (p Prices) Cost(model string, inputTokens, outputTokens int) float64 {
+	price, _ := p.Lookup(model)
+	return price.Cost(inputTokens, outputTokens)
+}
+
+// With returns a copy of p with overrides added or replaced.
+func (p Prices) With(overrides Prices) Prices {
+	merged := make(Prices, len(p)+len(overrides))
+	for model, price := range p {
+		merged[model] = price
+	}
+	for model, price := range overrides {
+		merged[strings.ToLower(model)] = price
+	}
+	return merged
+}
+
+// ParsePrices parses a comma-separated list of "model=input/output" entries
+// with prices in USD per million tokens, e.g.
+// "gpt-4o=2.5/10,llama3.1=0/0".
+func ParsePrices(s string) (Prices, error) {
+	prices := make(Prices)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(entry, "=")
+		in, out, ok2 := strings.Cut(rates, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("usage: invalid price %q (want model=input/output)", entry)
+		}
+		input, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err != nil {
+			return nil, fmt.Errorf("usage: invalid input price in %q: %w", entry, err)
+		}
+		output, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+		if err != nil {
+			return nil, fmt.Errorf("usage: invalid output price in %q: %w", entry, err)
+		}
+		prices[strings.ToLower(strings.TrimSpace(model))] = Price{Input: input, Output: output}
+	}
+	return prices, nil
+}